@@ -1,6 +1,9 @@
 terraform {
   required_version = ">= 1.5, < 2.0"
 
+  # The test provider passes a per-cluster path with -backend-config
+  backend "local" {}
+
   required_providers {
     aws = {
       source  = "hashicorp/aws"
@@ -264,20 +267,43 @@ resource "aws_iam_openid_connect_provider" "this" {
 }
 
 # -----------------------------------------------------------------------------
-# Managed Node Group
+# Managed Node Groups
 # -----------------------------------------------------------------------------
+locals {
+  # Without explicit node groups a single group is built from node_count and instance_type
+  node_groups = length(var.node_groups) > 0 ? var.node_groups : [{
+    name          = "nodes"
+    instance_type = var.instance_type
+    node_count    = var.node_count
+    labels        = {}
+    taints        = []
+  }]
+}
+
 resource "aws_eks_node_group" "this" {
+  for_each = { for g in local.node_groups : g.name => g }
+
   cluster_name    = aws_eks_cluster.this.name
-  node_group_name = "${var.cluster_name}-nodes"
+  node_group_name = "${var.cluster_name}-${each.key}"
   node_role_arn   = aws_iam_role.node_group.arn
   subnet_ids      = aws_subnet.private[*].id
-  instance_types  = [var.instance_type]
+  instance_types  = [coalesce(each.value.instance_type, var.instance_type)]
   ami_type        = var.node_arch == "arm64" ? "AL2023_ARM_64_STANDARD" : "AL2023_x86_64_STANDARD"
+  labels          = each.value.labels
 
   scaling_config {
-    desired_size = var.node_count
-    max_size     = var.node_count
-    min_size     = var.node_count
+    desired_size = each.value.node_count
+    max_size     = each.value.node_count
+    min_size     = each.value.node_count
+  }
+
+  dynamic "taint" {
+    for_each = each.value.taints
+    content {
+      key    = taint.value.key
+      value  = taint.value.value
+      effect = taint.value.effect
+    }
   }
 
   depends_on = [
@@ -287,6 +313,12 @@ resource "aws_eks_node_group" "this" {
   ]
 }
 
+# The single node group used to be a plain resource
+moved {
+  from = aws_eks_node_group.this
+  to   = aws_eks_node_group.this["nodes"]
+}
+
 # -----------------------------------------------------------------------------
 # EBS CSI Driver Addon
 # -----------------------------------------------------------------------------
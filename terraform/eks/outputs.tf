@@ -8,6 +8,16 @@ output "cluster_endpoint" {
   value       = aws_eks_cluster.this.endpoint
 }
 
+output "cluster_version" {
+  description = "Kubernetes version of the EKS control plane"
+  value       = aws_eks_cluster.this.version
+}
+
+output "node_groups" {
+  description = "Desired node count of each managed node group, by name"
+  value       = { for name, g in aws_eks_node_group.this : name => g.scaling_config[0].desired_size }
+}
+
 output "cluster_ca_certificate" {
   description = "Base64 encoded certificate data for the cluster"
   value       = aws_eks_cluster.this.certificate_authority[0].data
@@ -17,7 +17,7 @@ variable "region" {
 variable "kubernetes_version" {
   description = "Kubernetes version for the EKS cluster"
   type        = string
-  default     = "1.32"
+  default     = "1.33"
 }
 
 variable "node_count" {
@@ -37,6 +37,32 @@ variable "instance_type" {
   default     = "m5.large"
 }
 
+variable "node_groups" {
+  description = "Managed node groups to create instead of the single default group built from node_count and instance_type. Taint effects use the EKS form (NO_SCHEDULE, NO_EXECUTE, PREFER_NO_SCHEDULE)."
+  type = list(object({
+    name          = string
+    instance_type = optional(string)
+    node_count    = number
+    labels        = optional(map(string), {})
+    taints = optional(list(object({
+      key    = string
+      value  = optional(string)
+      effect = string
+    })), [])
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for g in var.node_groups : g.node_count > 0])
+    error_message = "node_count of every node group must be a positive integer."
+  }
+
+  validation {
+    condition     = length(distinct([for g in var.node_groups : g.name])) == length(var.node_groups)
+    error_message = "node group names must be unique."
+  }
+}
+
 variable "eks_api_allowed_cidrs" {
   description = "List of CIDRs allowed to reach the EKS public API endpoint. Defaults to unrestricted; override with your org/CI runner CIDRs for tighter control (e.g., [\"203.0.113.0/24\"])."
   type        = list(string)
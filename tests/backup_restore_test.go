@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBackupRestore backs a cluster up to MinIO through the Barman Cloud Plugin and restores it
+// into a new cluster, both from the backup and to a point in time. It replaces the upstream
+// backup-restore specs, which are excluded because they target the in-tree Barman Cloud support
+// pgEdge images no longer ship.
+func TestBackupRestore(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping backup and restore test in short mode")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-backup-restore-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+	helpers.DeployBarmanCloudPlugin(t, provider.GetKubeConfigPath(), helpers.BarmanCloudPluginVersion)
+
+	opts := provider.GetKubectlOptions("default")
+	minio := helpers.DeployMinIO(t, opts, "minio", "backups")
+
+	source := fmt.Sprintf(`
+apiVersion: barmancloud.cnpg.io/v1
+kind: ObjectStore
+metadata:
+  name: minio-store
+spec:
+  configuration:
+    destinationPath: s3://%[1]s/
+    endpointURL: %[2]s
+    s3Credentials:
+      accessKeyId:
+        name: %[3]s
+        key: ACCESS_KEY_ID
+      secretAccessKey:
+        name: %[3]s
+        key: ACCESS_SECRET_KEY
+    wal:
+      compression: gzip
+---
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: backup-source
+spec:
+  instances: 1
+  storage:
+    size: 1Gi
+  plugins:
+  - name: %[4]s
+    isWALArchiver: true
+    parameters:
+      barmanObjectName: minio-store
+`, minio.Bucket, minio.Endpoint, minio.CredentialsSecret, helpers.BarmanCloudPluginName)
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, source), "Failed to create source cluster")
+	defer func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, source)
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "backup-source", 10*time.Minute))
+
+	const rows = 1000
+	ctx := context.Background()
+	conn, closeConn, err := helpers.OpenServiceConnection(t, opts, "backup-source-rw", "backup-source-app")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, `CREATE TABLE backup_check AS SELECT g AS id, md5(g::text) AS payload FROM generate_series(1, $1) g`, rows)
+	closeConn()
+	require.NoError(t, err, "Failed to write test data")
+
+	backup := fmt.Sprintf(`
+apiVersion: postgresql.cnpg.io/v1
+kind: Backup
+metadata:
+  name: backup-source-manual
+spec:
+  cluster:
+    name: backup-source
+  method: plugin
+  pluginConfiguration:
+    name: %s
+`, helpers.BarmanCloudPluginName)
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, backup), "Failed to create backup")
+	defer func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, backup)
+	}()
+	require.NoError(t, helpers.WaitForBackupCompleted(t, opts, "backup-source-manual", 10*time.Minute))
+
+	restored := fmt.Sprintf(`
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: backup-restored
+spec:
+  instances: 1
+  storage:
+    size: 1Gi
+  bootstrap:
+    recovery:
+      source: origin
+      database: app
+      owner: app
+  externalClusters:
+  - name: origin
+    plugin:
+      name: %s
+      parameters:
+        barmanObjectName: minio-store
+        serverName: backup-source
+`, helpers.BarmanCloudPluginName)
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, restored), "Failed to create restored cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "backup-restored", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "backup-restored", 15*time.Minute))
+
+	t.Run("Restored cluster has the backed up data", func(t *testing.T) {
+		conn, closeConn, err := helpers.OpenServiceConnection(t, opts, "backup-restored-rw", "backup-restored-app")
+		require.NoError(t, err)
+		defer closeConn()
+
+		var count int
+		require.NoError(t, conn.QueryRowContext(ctx, `SELECT count(*) FROM backup_check`).Scan(&count))
+		require.Equal(t, rows, count)
+	})
+	t.Run("Point-in-time restore stops at the target time", func(t *testing.T) {
+		conn, closeConn, err := helpers.OpenServiceConnection(t, opts, "backup-source-rw", "backup-source-app")
+		require.NoError(t, err)
+		defer closeConn()
+
+		// The marker after the target gives recovery a commit past targetTime to stop at
+		targetTime := helpers.WritePITRMarker(t, conn, "before-target")
+		time.Sleep(2 * time.Second)
+		helpers.WritePITRMarker(t, conn, "after-target")
+
+		helpers.RestoreToPointInTime(t, opts, "backup-source", "backup-pitr", targetTime)
+	})
+}
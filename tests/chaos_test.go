@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChaosDrainThenDeletePrimary drains the primary's node, then deletes the new primary,
+// checking the cluster recovers after each step
+func TestChaosDrainThenDeletePrimary(t *testing.T) {
+	t.Parallel()
+
+	if providers.GetProviderType() != "kind" {
+		t.Skipf("Chaos scenarios run on kind only, not %s", providers.GetProviderType())
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-chaos-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+
+	cluster := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: chaos
+spec:
+  instances: 3
+  storage:
+    size: 1Gi
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "chaos", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "chaos", 10*time.Minute))
+	helpers.AssertClusterServicePort(t, opts, "chaos", 5432)
+
+	// Each fault records the primary it takes down, the step only passes once another instance
+	// has taken over and that pod has been recreated
+	var drained, deleted helpers.InstancePod
+	takingDownPrimary := func(primary *helpers.InstancePod, fault helpers.ChaosFault) helpers.ChaosFault {
+		return func(t *testing.T) (func(t *testing.T) error, error) {
+			var err error
+			if *primary, err = helpers.GetPrimaryPod(t, opts, "chaos"); err != nil {
+				return nil, err
+			}
+			return fault(t)
+		}
+	}
+
+	helpers.NewChaos().Run(t, helpers.ChaosScenario{
+		Name:            "drain-then-delete-primary",
+		RecoveryTimeout: 10 * time.Minute,
+		Steps: []helpers.ChaosStep{
+			{
+				Name:             "drain primary node",
+				Fault:            takingDownPrimary(&drained, helpers.DrainPrimaryNodeFault(opts, "chaos")),
+				HealBeforeAssert: true,
+				Assert: func(t *testing.T) error {
+					return helpers.CheckPrimaryReplaced(t, opts, "chaos", drained)
+				},
+			},
+			{
+				Name:  "delete primary",
+				Fault: takingDownPrimary(&deleted, helpers.DeletePrimaryFault(opts, "chaos")),
+				Assert: func(t *testing.T) error {
+					return helpers.CheckPrimaryReplaced(t, opts, "chaos", deleted)
+				},
+			},
+		},
+	})
+}
@@ -1,13 +1,22 @@
 package tests
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/onsi/ginkgo/v2/types"
 	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
 	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
 	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
@@ -39,10 +48,12 @@ func TestUpstream(t *testing.T) {
 	providers.Setup(t, provider)
 
 	// Get PostgreSQL image
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
 	postgresImage := cfg.GetPostgresImageName(
 		cfg.PostgresImages.DefaultRegistry,
 		postgresVersion,
-		"standard",
+		variant,
 	)
 
 	// Deploy CNPG operator
@@ -50,7 +61,7 @@ func TestUpstream(t *testing.T) {
 		provider.GetKubeConfigPath(),
 		cnpgVersion.Version,
 		cnpgVersion.ChartVersion,
-		"cnpg-system",
+		helpers.DefaultOperatorNamespace,
 		cnpgVersion.GetOperatorImageName(),
 		postgresImage,
 	)
@@ -58,7 +69,10 @@ func TestUpstream(t *testing.T) {
 	t.Logf("CNPG operator deployed, running upstream E2E tests")
 
 	// Clone CNPG repository at specific version
-	cnpgRepo := cloneCNPGRepo(t, cnpgVersion.GitTag, cnpgVersion.Version, postgresVersion)
+	cnpgRepo, releaseRepo, err := cloneCNPGRepo(t, cnpgVersion.GitTag, cnpgVersion.Version, postgresVersion)
+	require.NoError(t, err, "Failed to clone CNPG repository")
+	// Other runs must not replace the checkout while the suite runs from it
+	defer releaseRepo()
 
 	// Get provider-aware storage config
 	storageConfig, ok := cfg.GetStorageConfig(providers.GetProviderType())
@@ -72,6 +86,10 @@ func TestUpstream(t *testing.T) {
 		t.Fatalf("storage config for provider %s is missing SnapshotClass", providers.GetProviderType())
 	}
 
+	// A class name mismatch would otherwise fail most of the multi-hour suite
+	err = helpers.VerifyE2EEnvMatchesCluster(t, provider.GetKubectlOptions("default"), e2eClassEnv(storageConfig))
+	require.NoError(t, err)
+
 	// Run upstream E2E tests
 	testResults := runUpstreamE2ETests(t, cnpgRepo, provider.GetKubeConfigPath(), postgresImage, storageConfig)
 
@@ -91,47 +109,221 @@ func TestUpstream(t *testing.T) {
 
 // TestResults represents E2E test execution results
 type TestResults struct {
-	Passed  int
-	Failed  int
-	Skipped int
-	Total   int
+	Passed      int
+	Failed      int
+	Skipped     int
+	Pending     int
+	Total       int
+	FailedSpecs []string
+	Failures    []SpecFailure
+}
+
+// SpecFailure describes a failed Ginkgo spec
+type SpecFailure struct {
+	Name     string
+	State    string
+	Message  string
+	Location string
+}
+
+// newSpecFailure extracts the failure details of a Ginkgo spec named name
+func newSpecFailure(name string, spec types.SpecReport) SpecFailure {
+	location := spec.Failure.Location
+	if location.FileName == "" {
+		location = spec.LeafNodeLocation
+	}
+	return SpecFailure{
+		Name:     name,
+		State:    spec.State.String(),
+		Message:  strings.TrimSpace(spec.Failure.Message),
+		Location: location.String(),
+	}
+}
+
+// FailureReport formats the failed specs with their message and location, one block per spec
+func (r TestResults) FailureReport() string {
+	if len(r.Failures) == 0 {
+		return "No failed specs"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d failed spec(s):\n", len(r.Failures))
+	for i, f := range r.Failures {
+		fmt.Fprintf(&b, "\n%d) %s [%s]\n", i+1, f.Name, f.State)
+		if f.Location != "" && f.Location != ":0" {
+			fmt.Fprintf(&b, "   at %s\n", f.Location)
+		}
+		if f.Message != "" {
+			for _, line := range strings.Split(f.Message, "\n") {
+				fmt.Fprintf(&b, "   %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
+
+// gitCloneTimeout bounds a single clone attempt so a hung clone cannot eat the test budget
+const gitCloneTimeout = 10 * time.Minute
+
+// getGitCloneRetries returns the number of clone attempts from GIT_CLONE_RETRIES, defaulting to 3
+func getGitCloneRetries() int {
+	if v := os.Getenv("GIT_CLONE_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 3
+}
+
+// isCompleteClone reports whether dir is a git checkout whose HEAD is gitTag
+func isCompleteClone(dir, gitTag string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return false
+	}
+	head, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return false
+	}
+	tag, err := exec.Command("git", "-C", dir, "rev-parse", "--verify", "--quiet", gitTag+"^{commit}").Output()
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(head)) == strings.TrimSpace(string(tag))
+}
+
+// cnpgCacheEnvVar overrides where CNPG checkouts are cached across runs
+const cnpgCacheEnvVar = "PGEDGE_TEST_CACHE"
+
+// cnpgCacheDir returns the persistent checkout cache, $PGEDGE_TEST_CACHE or ~/.cache/pgedge-cnpg-dist
+func cnpgCacheDir() (string, error) {
+	if dir := os.Getenv(cnpgCacheEnvVar); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".cache", "pgedge-cnpg-dist"), nil
+}
+
+const (
+	// cacheLockTimeout bounds how long a run waits on the checkout lock, long enough for another
+	// run to finish cloning or, for the clone itself, for other runs to finish with the checkout
+	cacheLockTimeout = 2 * time.Hour
+	// cacheLockInterval is the pause between attempts to take a held checkout lock
+	cacheLockInterval = time.Second
+)
+
+// lockCacheEntry takes a lock on path.lock: shared (syscall.LOCK_SH) while a run uses the
+// checkout, exclusive (syscall.LOCK_EX) while it clones into it
+func lockCacheEntry(path string, how int) (func(), error) {
+	return helpers.LockFile(path+".lock", how, cacheLockTimeout, cacheLockInterval)
 }
 
-// cloneCNPGRepo clones the CNPG repository at a specific version
-func cloneCNPGRepo(t *testing.T, gitTag, cnpgVersion, postgresVersion string) string {
+// cachedCheckoutAttempts bounds how often a cached checkout is cloned before giving up, in case
+// other runs keep replacing it
+const cachedCheckoutAttempts = 3
+
+// useCachedCheckout returns the cached checkout of gitTag in repoDir with a shared lock held, so
+// no other run replaces it while the caller runs from it. A missing or incomplete checkout is
+// cloned under an exclusive lock first. release drops the shared lock.
+func useCachedCheckout(t *testing.T, gitTag, repoDir string) (func(), error) {
 	t.Helper()
 
-	repoDir := filepath.Join(os.TempDir(), fmt.Sprintf("cnpg-e2e-%s-%s", cnpgVersion, postgresVersion))
+	for attempt := 0; attempt < cachedCheckoutAttempts; attempt++ {
+		release, err := lockCacheEntry(repoDir, syscall.LOCK_SH)
+		if err != nil {
+			return nil, err
+		}
+		if isCompleteClone(repoDir, gitTag) {
+			t.Logf("Reusing CNPG repository (tag: %s) at %s", gitTag, repoDir)
+			return release, nil
+		}
+		release()
 
-	// Always start fresh to avoid stale/corrupted clones
-	if _, err := os.Stat(repoDir); err == nil {
-		t.Logf("Removing existing CNPG repository at %s", repoDir)
-		if err := os.RemoveAll(repoDir); err != nil {
-			t.Fatalf("failed to remove existing CNPG repo %s: %v", repoDir, err)
+		unlock, err := lockCacheEntry(repoDir, syscall.LOCK_EX)
+		if err != nil {
+			return nil, err
+		}
+		_, err = cloneCNPGRepoInto(t, gitTag, repoDir)
+		unlock()
+		if err != nil {
+			return nil, err
 		}
+		// Another run may get the exclusive lock before we get the shared one, so check again
 	}
+	return nil, fmt.Errorf("CNPG checkout %s was still incomplete after %d attempts", repoDir, cachedCheckoutAttempts)
+}
 
-	t.Logf("Cloning CNPG repository (tag: %s) to %s", gitTag, repoDir)
+// cloneCNPGRepo returns a checkout of the CNPG repository at gitTag and a func to call once the
+// checkout is no longer used. Checkouts are cached per tag under cnpgCacheDir and reused across
+// runs; when the cache is unusable the clone goes to a temporary directory keyed on the CNPG and
+// PostgreSQL versions instead.
+func cloneCNPGRepo(t *testing.T, gitTag, cnpgVersion, postgresVersion string) (string, func(), error) {
+	t.Helper()
 
-	// Clone with shallow copy for speed
-	cmd := exec.Command("git", "clone",
-		"--depth", "1",
-		"--branch", gitTag,
-		"https://github.com/cloudnative-pg/cloudnative-pg.git",
-		repoDir,
-	)
+	cacheDir, err := cnpgCacheDir()
+	if err == nil {
+		repoDir := filepath.Join(cacheDir, "cnpg-"+strings.ReplaceAll(gitTag, "/", "_"))
+		var release func()
+		if release, err = useCachedCheckout(t, gitTag, repoDir); err == nil {
+			return repoDir, release, nil
+		}
+	}
+	t.Logf("CNPG checkout cache is not usable, cloning to a temporary directory: %v", err)
+
+	repoDir, err := cloneCNPGRepoInto(t, gitTag, filepath.Join(os.TempDir(), fmt.Sprintf("cnpg-e2e-%s-%s", cnpgVersion, postgresVersion)))
+	return repoDir, func() {}, err
+}
+
+// cloneCNPGRepoInto clones the CNPG repository at gitTag into repoDir, reusing a previous complete
+// clone of the same tag. Failed or hung clones are retried GIT_CLONE_RETRIES times.
+func cloneCNPGRepoInto(t *testing.T, gitTag, repoDir string) (string, error) {
+	t.Helper()
+
+	if isCompleteClone(repoDir, gitTag) {
+		t.Logf("Reusing CNPG repository (tag: %s) at %s", gitTag, repoDir)
+		return repoDir, nil
+	}
+
+	retries := getGitCloneRetries()
+	_, err := retry.DoWithRetryE(t, fmt.Sprintf("Clone CNPG repository (tag: %s)", gitTag), retries, 10*time.Second, func() (string, error) {
+		// Start each attempt fresh so a partial or corrupt clone is never reused
+		if err := os.RemoveAll(repoDir); err != nil {
+			return "", retry.FatalError{Underlying: fmt.Errorf("failed to remove existing CNPG repo %s: %w", repoDir, err)}
+		}
 
-	output, err := cmd.CombinedOutput()
+		ctx, cancel := context.WithTimeout(context.Background(), gitCloneTimeout)
+		defer cancel()
+
+		t.Logf("Cloning CNPG repository (tag: %s) to %s", gitTag, repoDir)
+
+		// Clone with shallow copy for speed
+		cmd := exec.CommandContext(ctx, "git", "clone",
+			"--depth", "1",
+			"--branch", gitTag,
+			"https://github.com/cloudnative-pg/cloudnative-pg.git",
+			repoDir,
+		)
+		output, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("git clone timed out after %s", gitCloneTimeout)
+		}
+		if err != nil {
+			return "", fmt.Errorf("git clone failed: %w\nOutput: %s", err, string(output))
+		}
+		return "", nil
+	})
 	if err != nil {
-		t.Fatalf("Failed to clone CNPG repo: %v\nOutput: %s", err, string(output))
+		return "", fmt.Errorf("failed to clone CNPG repo after %d attempts: %w", retries, err)
 	}
 
 	t.Logf("CNPG repository cloned successfully")
-	return repoDir
+	return repoDir, nil
 }
 
 // e2eExcludeFilters lists Ginkgo label exclusions applied to every upstream E2E run.
-// - backup-restore, snapshot: pgEdge images use new Barman Cloud Plugin
+// - backup-restore, snapshot: replaced by TestBackupRestore and TestVolumeSnapshotBackupRestore
 // - postgres-major-upgrade: requires specific upgrade path setup
 // - plugin: requires plugin infrastructure not available in test environment
 // - observability: requires PodMonitor CRD from prometheus-operator
@@ -157,17 +349,29 @@ func buildLabelFilter() string {
 	return strings.Join(e2eExcludeFilters, " && ")
 }
 
+// e2eClassEnv returns the variables telling the upstream E2E suite which storage and volume
+// snapshot classes to use.
+func e2eClassEnv(storageConfig config.StorageConfig) map[string]string {
+	return map[string]string{
+		"E2E_DEFAULT_STORAGE_CLASS":        storageConfig.CSIClass,
+		"E2E_CSI_STORAGE_CLASS":            storageConfig.CSIClass,
+		"E2E_DEFAULT_VOLUMESNAPSHOT_CLASS": storageConfig.SnapshotClass,
+	}
+}
+
 // buildE2EEnv constructs the environment for the ginkgo E2E process.
 func buildE2EEnv(kubeconfigPath, postgresImage string, storageConfig config.StorageConfig) []string {
-	return append(os.Environ(),
+	env := append(os.Environ(),
 		fmt.Sprintf("KUBECONFIG=%s", kubeconfigPath),
 		fmt.Sprintf("POSTGRES_IMG=%s", postgresImage),
 		"TEST_UPGRADE_TO_V1=false",
 		"TEST_CLOUD_VENDOR=kind",
-		fmt.Sprintf("E2E_DEFAULT_STORAGE_CLASS=%s", storageConfig.CSIClass),
-		fmt.Sprintf("E2E_CSI_STORAGE_CLASS=%s", storageConfig.CSIClass),
-		fmt.Sprintf("E2E_DEFAULT_VOLUMESNAPSHOT_CLASS=%s", storageConfig.SnapshotClass),
 	)
+	classEnv := e2eClassEnv(storageConfig)
+	for _, key := range slices.Sorted(maps.Keys(classEnv)) {
+		env = append(env, fmt.Sprintf("%s=%s", key, classEnv[key]))
+	}
+	return env
 }
 
 // buildGinkgoCmd constructs the ginkgo exec.Command for the upstream E2E suite.
@@ -193,6 +397,13 @@ func buildGinkgoCmd(testsDir, labelFilter, reportPath string) *exec.Cmd {
 	return cmd
 }
 
+const (
+	// sampleResourcesEnvVar set to "true" samples node CPU and memory during the E2E run
+	sampleResourcesEnvVar = "E2E_SAMPLE_RESOURCES"
+	// resourceSampleInterval matches metrics-server's default resolution
+	resourceSampleInterval = 15 * time.Second
+)
+
 // runUpstreamE2ETests executes the upstream CNPG E2E tests
 func runUpstreamE2ETests(t *testing.T, cnpgRepoDir, kubeconfigPath, postgresImage string, storageConfig config.StorageConfig) TestResults {
 	t.Helper()
@@ -201,7 +412,14 @@ func runUpstreamE2ETests(t *testing.T, cnpgRepoDir, kubeconfigPath, postgresImag
 	t.Logf("Running upstream E2E tests from %s", testsDir)
 
 	labelFilter := buildLabelFilter()
-	reportPath := filepath.Join(testsDir, "report.json")
+	// The checkout may be shared with other runs, so the report goes to a file of our own
+	report, err := os.CreateTemp("", "cnpg-e2e-report-*.json")
+	if err != nil {
+		t.Fatalf("Failed to create test report file: %v", err)
+	}
+	report.Close()
+	defer os.Remove(report.Name())
+	reportPath := report.Name()
 
 	cmd := buildGinkgoCmd(testsDir, labelFilter, reportPath)
 	cmd.Env = buildE2EEnv(kubeconfigPath, postgresImage, storageConfig)
@@ -209,46 +427,95 @@ func runUpstreamE2ETests(t *testing.T, cnpgRepoDir, kubeconfigPath, postgresImag
 	t.Logf("Executing: ginkgo with label filter: %s", labelFilter)
 	t.Logf("JSON report will be written to: %s", reportPath)
 
-	err := cmd.Run()
+	// Node CPU and memory during the run show whether the ginkgo node count suits the cluster
+	if os.Getenv(sampleResourcesEnvVar) == "true" {
+		samples, err := os.CreateTemp("", "cnpg-e2e-resources-*.jsonl")
+		if err != nil {
+			t.Fatalf("Failed to create resource samples file: %v", err)
+		}
+		samples.Close()
+		stopSampling := helpers.SampleNodeResources(t, kubeconfigPath, samples.Name(), resourceSampleInterval)
+		defer stopSampling()
+	}
+
+	err = cmd.Run()
 	results := parseTestResults(t, reportPath)
 
-	// If ginkgo succeeded but JSON parsing found no results, the format may differ.
-	// Trust ginkgo's exit code in that case.
-	if err == nil && results.Passed == 0 && results.Failed == 0 {
-		t.Logf("Warning: Ginkgo succeeded but JSON parsing found no results")
-		t.Logf("This likely means the JSON format is different than expected")
+	// Without a usable report only ginkgo's exit code is known
+	if err == nil && results.Total == 0 {
+		t.Logf("Warning: Ginkgo succeeded but the report contained no specs")
 		t.Logf("Trusting ginkgo exit code - marking tests as passed")
 		results.Passed = 1
 	}
 
 	if err != nil {
 		t.Logf("Warning: ginkgo command failed: %v", err)
-		t.Logf("This may be expected if tests failed. Results: %+v", results)
+	}
+	if results.Failed > 0 {
+		t.Logf("Upstream E2E failures:\n%s", results.FailureReport())
 	}
 
 	return results
 }
 
-// countGinkgoState counts occurrences of a test state in Ginkgo v2 JSON content,
-// trying multiple format variants until a non-zero count is found.
-func countGinkgoState(content string, patterns []string) int {
-	for _, p := range patterns {
-		if n := strings.Count(content, p); n > 0 {
-			return n
+// readGinkgoReports decodes a Ginkgo v2 JSON report, which holds one Report per suite
+func readGinkgoReports(data []byte) ([]types.Report, error) {
+	var reports []types.Report
+	if err := json.Unmarshal(data, &reports); err == nil {
+		return reports, nil
+	}
+
+	var report types.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to decode ginkgo report: %w", err)
+	}
+	return []types.Report{report}, nil
+}
+
+// summarizeGinkgoReports counts the specs of every suite by state. Setup nodes such as
+// BeforeSuite only count when they fail, since a failure there fails the whole suite.
+func summarizeGinkgoReports(reports []types.Report) TestResults {
+	var results TestResults
+	for _, report := range reports {
+		for _, spec := range report.SpecReports {
+			if spec.LeafNodeType != types.NodeTypeIt {
+				if spec.Failed() {
+					name := fmt.Sprintf("[%s]", spec.LeafNodeType)
+					if text := spec.FullText(); text != "" {
+						name += " " + text
+					}
+					results.Failed++
+					results.FailedSpecs = append(results.FailedSpecs, name)
+					results.Failures = append(results.Failures, newSpecFailure(name, spec))
+				}
+				continue
+			}
+
+			switch {
+			case spec.State == types.SpecStatePassed:
+				results.Passed++
+			case spec.State.Is(types.SpecStateFailureStates):
+				results.Failed++
+				results.FailedSpecs = append(results.FailedSpecs, spec.FullText())
+				results.Failures = append(results.Failures, newSpecFailure(spec.FullText(), spec))
+			case spec.State == types.SpecStateSkipped:
+				results.Skipped++
+			case spec.State == types.SpecStatePending:
+				results.Pending++
+			}
 		}
 	}
-	return 0
+	results.Total = results.Passed + results.Failed + results.Skipped + results.Pending
+	return results
 }
 
-// parseTestResults parses the Ginkgo JSON report
+// parseTestResults parses the Ginkgo JSON report. A missing or unreadable report yields zeroed results.
 func parseTestResults(t *testing.T, reportPath string) TestResults {
 	t.Helper()
 
-	defaultResults := TestResults{}
-
 	if _, err := os.Stat(reportPath); os.IsNotExist(err) {
 		t.Logf("Test report not found at %s", reportPath)
-		return defaultResults
+		return TestResults{}
 	}
 
 	t.Logf("Test report generated at %s", reportPath)
@@ -256,27 +523,135 @@ func parseTestResults(t *testing.T, reportPath string) TestResults {
 	data, err := os.ReadFile(reportPath)
 	if err != nil {
 		t.Logf("Warning: failed to read report: %v", err)
-		return defaultResults
+		return TestResults{}
 	}
-
-	content := string(data)
-
-	passed := countGinkgoState(content, []string{`"State":"passed"`, `"state":"passed"`, `"Passed":true`})
-	failed := countGinkgoState(content, []string{`"State":"failed"`, `"state":"failed"`})
-	if failed == 0 {
-		failed = strings.Count(content, `"Passed":false`) - strings.Count(content, `"Skipped":true`)
+	if len(strings.TrimSpace(string(data))) == 0 {
+		t.Logf("Warning: test report %s is empty", reportPath)
+		return TestResults{}
 	}
-	skipped := countGinkgoState(content, []string{`"State":"skipped"`, `"state":"skipped"`, `"Skipped":true`})
 
-	results := TestResults{
-		Passed:  passed,
-		Failed:  failed,
-		Skipped: skipped,
+	reports, err := readGinkgoReports(data)
+	if err != nil {
+		t.Logf("Warning: %v", err)
+		return TestResults{}
 	}
-	results.Total = results.Passed + results.Failed + results.Skipped
 
-	t.Logf("Parsed test results: Passed=%d, Failed=%d, Skipped=%d, Total=%d",
-		results.Passed, results.Failed, results.Skipped, results.Total)
+	results := summarizeGinkgoReports(reports)
+
+	t.Logf("Parsed test results: Passed=%d, Failed=%d, Skipped=%d, Pending=%d, Total=%d",
+		results.Passed, results.Failed, results.Skipped, results.Pending, results.Total)
 
 	return results
 }
+
+func TestParseTestResults(t *testing.T) {
+	dir := t.TempDir()
+
+	missing := parseTestResults(t, filepath.Join(dir, "missing.json"))
+	require.Equal(t, TestResults{}, missing)
+
+	emptyPath := filepath.Join(dir, "empty.json")
+	require.NoError(t, os.WriteFile(emptyPath, nil, 0o644))
+	require.Equal(t, TestResults{}, parseTestResults(t, emptyPath))
+
+	ginkgoReport := `[{
+  "SuiteDescription": "CloudNativePG Operator E2E",
+  "SpecReports": [
+    {"ContainerHierarchyTexts": ["Backup"], "LeafNodeType": "It", "LeafNodeText": "restores", "State": "passed"},
+    {"ContainerHierarchyTexts": ["Backup"], "LeafNodeType": "It", "LeafNodeText": "prunes", "State": "failed",
+     "Failure": {"Message": "Expected\n    <int>: 5\nto equal\n    <int>: 3", "Location": {"FileName": "tests/e2e/backup_test.go", "LineNumber": 42}}},
+    {"ContainerHierarchyTexts": ["Fencing"], "LeafNodeType": "It", "LeafNodeText": "fences", "State": "timedout"},
+    {"ContainerHierarchyTexts": ["Tablespaces"], "LeafNodeType": "It", "LeafNodeText": "creates", "State": "skipped"},
+    {"ContainerHierarchyTexts": ["Tablespaces"], "LeafNodeType": "It", "LeafNodeText": "drops", "State": "pending"},
+    {"LeafNodeType": "BeforeSuite", "State": "passed"},
+    {"LeafNodeType": "AfterSuite", "State": "failed"}
+  ]
+}]`
+	reportPath := filepath.Join(dir, "report.json")
+	require.NoError(t, os.WriteFile(reportPath, []byte(ginkgoReport), 0o644))
+
+	results := parseTestResults(t, reportPath)
+	require.Equal(t, 1, results.Passed)
+	require.Equal(t, 3, results.Failed)
+	require.Equal(t, 1, results.Skipped)
+	require.Equal(t, 1, results.Pending)
+	require.Equal(t, 6, results.Total)
+	require.Equal(t, []string{"Backup prunes", "Fencing fences", "[AfterSuite]"}, results.FailedSpecs)
+
+	report := results.FailureReport()
+	require.Contains(t, report, "3 failed spec(s)")
+	require.Contains(t, report, "1) Backup prunes [failed]\n   at tests/e2e/backup_test.go:42\n   Expected\n")
+	require.Contains(t, report, "2) Fencing fences [timedout]")
+	require.Contains(t, report, "3) [AfterSuite] [failed]")
+
+	// A report without failures
+	require.NoError(t, os.WriteFile(reportPath, []byte(`[{"SpecReports": [{"LeafNodeType": "It", "State": "passed"}]}]`), 0o644))
+	results = parseTestResults(t, reportPath)
+	require.Zero(t, results.Failed)
+	require.Equal(t, "No failed specs", results.FailureReport())
+}
+
+func TestIsCompleteClone(t *testing.T) {
+	dir := t.TempDir()
+	require.False(t, isCompleteClone(dir, "v1.0.0"), "directory without .git")
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	git("tag", "v1.0.0")
+	require.True(t, isCompleteClone(dir, "v1.0.0"))
+	require.False(t, isCompleteClone(dir, "v1.1.0"), "missing tag")
+
+	git("commit", "-q", "--allow-empty", "-m", "second")
+	require.False(t, isCompleteClone(dir, "v1.0.0"), "HEAD moved past the tag")
+}
+
+func TestCNPGCacheDir(t *testing.T) {
+	t.Setenv(cnpgCacheEnvVar, "/srv/cache")
+	dir, err := cnpgCacheDir()
+	require.NoError(t, err)
+	require.Equal(t, "/srv/cache", dir)
+
+	t.Setenv(cnpgCacheEnvVar, "")
+	t.Setenv("HOME", "/home/ci")
+	dir, err = cnpgCacheDir()
+	require.NoError(t, err)
+	require.Equal(t, "/home/ci/.cache/pgedge-cnpg-dist", dir)
+}
+
+func TestLockCacheEntry(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "cache", "cnpg-v1.28.3")
+	unlock, err := lockCacheEntry(repoDir, syscall.LOCK_SH)
+	require.NoError(t, err)
+
+	// Runs using the checkout share it
+	unlockShared, err := lockCacheEntry(repoDir, syscall.LOCK_SH)
+	require.NoError(t, err)
+	unlockShared()
+
+	acquired := make(chan struct{})
+	go func() {
+		unlockExclusive, err := lockCacheEntry(repoDir, syscall.LOCK_EX)
+		if err == nil {
+			unlockExclusive()
+		}
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("exclusive lock acquired while the checkout was in use")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	<-acquired
+
+	// A cache under a regular file cannot be created
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	_, err = lockCacheEntry(filepath.Join(file, "cnpg-v1.28.3"), syscall.LOCK_EX)
+	require.Error(t, err)
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,6 +19,7 @@ type Config struct {
 	PostgresImages   PostgresImages              `yaml:"postgres_images"`
 	TestDefaults     TestDefaults                `yaml:"test_defaults"`
 	ProviderDefaults map[string]ProviderDefaults `yaml:"provider_defaults"`
+	Proxy            ProxyConfig                 `yaml:"proxy"`
 }
 
 // CNPGVersion represents a specific CNPG version configuration
@@ -23,6 +30,8 @@ type CNPGVersion struct {
 	OperatorImage    string                    `yaml:"operator_image"`
 	PostgresVersions []string                  `yaml:"postgres_versions"`
 	Providers        map[string]ProviderConfig `yaml:"providers"`
+	// SupportedKubernetesVersions is a range such as ">=1.32 <=1.34"
+	SupportedKubernetesVersions string `yaml:"supported_kubernetes_versions"`
 }
 
 // ProviderConfig represents provider-specific configuration
@@ -90,6 +99,87 @@ type StorageConfig struct {
 	DefaultClass  string `yaml:"default_class"`
 	CSIClass      string `yaml:"csi_class"`
 	SnapshotClass string `yaml:"snapshot_class"`
+	// SnapshotControllerVersion is the external-snapshotter release substituted for
+	// {snapshot_controller_version} in manifest URLs
+	SnapshotControllerVersion string `yaml:"snapshot_controller_version"`
+}
+
+// ProxyConfig represents the HTTP(S) proxy used for image pulls and manifest fetches
+type ProxyConfig struct {
+	HTTPProxy  string `yaml:"http_proxy"`
+	HTTPSProxy string `yaml:"https_proxy"`
+	NoProxy    string `yaml:"no_proxy"`
+}
+
+// Enabled reports whether any proxy is configured
+func (p ProxyConfig) Enabled() bool {
+	return p.HTTPProxy != "" || p.HTTPSProxy != ""
+}
+
+// Env returns the proxy settings as environment variables, in both cases since tools differ
+// in which they read. Unset values are omitted.
+func (p ProxyConfig) Env() map[string]string {
+	env := make(map[string]string)
+	for name, value := range map[string]string{
+		"HTTP_PROXY":  p.HTTPProxy,
+		"HTTPS_PROXY": p.HTTPSProxy,
+		"NO_PROXY":    p.NoProxy,
+	} {
+		if value == "" {
+			continue
+		}
+		env[name] = value
+		env[strings.ToLower(name)] = value
+	}
+	return env
+}
+
+// clusterNoProxy are the cluster-internal destinations that must never go through the proxy
+var clusterNoProxy = []string{"localhost", "127.0.0.1", ".svc", ".cluster.local", "kubernetes.default"}
+
+// WithClusterNoProxy returns the proxy with NO_PROXY extended by the cluster-internal
+// destinations and networks, typically the service and pod CIDRs, after the configured entries
+func (p ProxyConfig) WithClusterNoProxy(networks ...string) ProxyConfig {
+	var entries []string
+	for _, entry := range slices.Concat(strings.Split(p.NoProxy, ","), clusterNoProxy, networks) {
+		if entry = strings.TrimSpace(entry); entry != "" && !slices.Contains(entries, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	p.NoProxy = strings.Join(entries, ",")
+	return p
+}
+
+// GetProxyConfig returns the proxy section of versions.yaml, with HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY from the environment taking precedence
+func (c *Config) GetProxyConfig() ProxyConfig {
+	proxy := c.Proxy
+	for _, v := range []struct {
+		dest  *string
+		names []string
+	}{
+		{&proxy.HTTPProxy, []string{"HTTP_PROXY", "http_proxy"}},
+		{&proxy.HTTPSProxy, []string{"HTTPS_PROXY", "https_proxy"}},
+		{&proxy.NoProxy, []string{"NO_PROXY", "no_proxy"}},
+	} {
+		for _, name := range v.names {
+			if value := os.Getenv(name); value != "" {
+				*v.dest = value
+				break
+			}
+		}
+	}
+	return proxy
+}
+
+// LoadProxyConfig returns the proxy from versions.yaml and the environment. Without a readable
+// versions.yaml only the environment is used.
+func LoadProxyConfig() ProxyConfig {
+	cfg, err := LoadConfig()
+	if err != nil {
+		cfg = &Config{}
+	}
+	return cfg.GetProxyConfig()
 }
 
 // GetStorageConfig returns the storage configuration for the given provider type.
@@ -112,18 +202,81 @@ type Manifest struct {
 	URL  string `yaml:"url"`
 }
 
-// LoadConfig loads the configuration from versions.yaml
-func LoadConfig() (*Config, error) {
-	// Try to find versions.yaml from current directory or parent
-	configPath := "config/versions.yaml"
+// snapshotControllerVersionPlaceholder is replaced by StorageConfig.SnapshotControllerVersion in manifest URLs
+const snapshotControllerVersionPlaceholder = "{snapshot_controller_version}"
+
+// ResolvedManifests returns the provider manifests with placeholders in their URLs filled in
+func (d ProviderDefaults) ResolvedManifests() ([]Manifest, error) {
+	return d.ResolveManifests(d.Manifests)
+}
+
+// ResolveManifests returns manifests, e.g. an entry of KubernetesVersionManifests, with the
+// provider's values filled in for placeholders in their URLs
+func (d ProviderDefaults) ResolveManifests(manifests []Manifest) ([]Manifest, error) {
+	resolved := make([]Manifest, 0, len(manifests))
+	for _, m := range manifests {
+		if strings.Contains(m.URL, snapshotControllerVersionPlaceholder) {
+			if d.Storage.SnapshotControllerVersion == "" {
+				return nil, fmt.Errorf("manifest %q uses %s but storage.snapshot_controller_version is not set",
+					m.Name, snapshotControllerVersionPlaceholder)
+			}
+			m.URL = strings.ReplaceAll(m.URL, snapshotControllerVersionPlaceholder, d.Storage.SnapshotControllerVersion)
+		}
+		resolved = append(resolved, m)
+	}
+	return resolved, nil
+}
+
+// configEnvVar names an explicit versions.yaml to load instead of searching for one
+const configEnvVar = "PGEDGE_TEST_CONFIG"
 
-	// Check if running from tests directory
-	if _, err := os.Stat(configPath); err != nil {
-		// Try from parent (project root)
-		configPath = "tests/config/versions.yaml"
-		if _, err := os.Stat(configPath); err != nil {
-			return nil, fmt.Errorf("failed to find config file: %w", err)
+// FindProjectRoot walks up from dir to the first directory containing go.mod
+func FindProjectRoot(dir string) (string, error) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
 		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("could not find project root (go.mod not found)")
+		}
+		dir = parent
+	}
+}
+
+// resolveConfigPath returns the versions.yaml to load: the file named by PGEDGE_TEST_CONFIG if
+// set, otherwise tests/config/versions.yaml under the project root containing dir
+func resolveConfigPath(dir string) (string, error) {
+	if path := os.Getenv(configEnvVar); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config file from %s not found: %w", configEnvVar, err)
+		}
+		return path, nil
+	}
+
+	var tried []string
+	if root, err := FindProjectRoot(dir); err == nil {
+		path := filepath.Join(root, "tests", "config", "versions.yaml")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		tried = append(tried, path)
+	} else {
+		tried = append(tried, fmt.Sprintf("<project root above %s>: %v", dir, err))
+	}
+	return "", fmt.Errorf("failed to find config file, tried %s (set %s to use another file)",
+		strings.Join(tried, ", "), configEnvVar)
+}
+
+// LoadConfig loads the configuration from versions.yaml, see resolveConfigPath
+func LoadConfig() (*Config, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	configPath, err := resolveConfigPath(wd)
+	if err != nil {
+		return nil, err
 	}
 
 	data, err := os.ReadFile(configPath)
@@ -136,9 +289,79 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", configPath, err)
+	}
+
 	return &config, nil
 }
 
+// Validate checks the configuration for missing or inconsistent fields and reports every
+// problem found, not just the first
+func (c *Config) Validate() error {
+	var errs []error
+
+	for i, v := range c.CNPGVersions {
+		name := v.Version
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		for _, f := range []struct{ field, value string }{
+			{"version", v.Version},
+			{"git_tag", v.GitTag},
+			{"operator_image", v.OperatorImage},
+		} {
+			if f.value == "" {
+				errs = append(errs, fmt.Errorf("cnpg_versions[%s]: %s is required", name, f.field))
+			}
+		}
+	}
+
+	if _, ok := c.PostgresImages.Registries[c.PostgresImages.DefaultRegistry]; !ok {
+		errs = append(errs, fmt.Errorf("postgres_images.default_registry %q is not defined in postgres_images.registries",
+			c.PostgresImages.DefaultRegistry))
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range c.PostgresImages.Variants {
+		if seen[v.Name] {
+			errs = append(errs, fmt.Errorf("postgres_images.variants: duplicate variant %q", v.Name))
+		}
+		seen[v.Name] = true
+	}
+
+	providers := make([]string, 0, len(c.ProviderDefaults))
+	for provider := range c.ProviderDefaults {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		defaults := c.ProviderDefaults[provider]
+		if _, err := defaults.ResolvedManifests(); err != nil {
+			errs = append(errs, fmt.Errorf("provider_defaults.%s: %w", provider, err))
+		}
+		versions := make([]string, 0, len(defaults.KubernetesVersionManifests))
+		for version := range defaults.KubernetesVersionManifests {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+		for _, version := range versions {
+			if _, err := defaults.ResolveManifests(defaults.KubernetesVersionManifests[version].Manifests); err != nil {
+				errs = append(errs, fmt.Errorf("provider_defaults.%s.kubernetes_version_manifests[%s]: %w", provider, version, err))
+			}
+		}
+		if defaults.DefaultKubernetesVersion == "" {
+			continue
+		}
+		if _, ok := defaults.KubernetesVersionManifests[defaults.DefaultKubernetesVersion]; !ok {
+			errs = append(errs, fmt.Errorf("provider_defaults.%s.default_kubernetes_version %q has no entry in kubernetes_version_manifests",
+				provider, defaults.DefaultKubernetesVersion))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // GetPostgresImageName constructs the full PostgreSQL image name
 func (c *Config) GetPostgresImageName(registry, version, variant string) string {
 	reg, ok := c.PostgresImages.Registries[registry]
@@ -162,6 +385,24 @@ func (c *Config) GetPostgresImageName(registry, version, variant string) string
 	)
 }
 
+// GetImageVariantFromEnv returns the image variant from POSTGRES_VARIANT, defaulting to "standard".
+// The variant must be one of PostgresImages.Variants.
+func (c *Config) GetImageVariantFromEnv() (string, error) {
+	variant := os.Getenv("POSTGRES_VARIANT")
+	if variant == "" {
+		variant = "standard"
+	}
+
+	names := make([]string, 0, len(c.PostgresImages.Variants))
+	for _, v := range c.PostgresImages.Variants {
+		if v.Name == variant {
+			return variant, nil
+		}
+		names = append(names, v.Name)
+	}
+	return "", fmt.Errorf("unknown image variant %q (POSTGRES_VARIANT), valid variants are: %s", variant, strings.Join(names, ", "))
+}
+
 // GetCNPGVersion returns the configuration for a specific CNPG version
 func (c *Config) GetCNPGVersion(version string) (*CNPGVersion, error) {
 	for _, v := range c.CNPGVersions {
@@ -219,3 +460,88 @@ func (v *CNPGVersion) GetPostgresVersionFromEnv() string {
 	// TODO: replace hardcoded fallback with a configurable default
 	return "17"
 }
+
+// parseVersion parses a "major.minor[.patch]" version, ignoring a leading "v" and any
+// pre-release or build suffix (e.g. "v1.33.1-eks-1234" or "v1.33.1+k3s1")
+func parseVersion(v string) ([]int, error) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version %q", v)
+	}
+
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", v, err)
+		}
+		nums[i] = n
+	}
+	return nums, nil
+}
+
+// compareVersions compares version with bound over the components bound specifies, so
+// 1.33.4 equals 1.33
+func compareVersions(version, bound []int) int {
+	for i := range bound {
+		var v int
+		if i < len(version) {
+			v = version[i]
+		}
+		switch {
+		case v < bound[i]:
+			return -1
+		case v > bound[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// VersionInRange reports whether version satisfies every space-separated comparison in
+// constraint, e.g. ">=1.32 <=1.34". Supported operators are >=, <=, >, < and =.
+func VersionInRange(version, constraint string) (bool, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	fields := strings.Fields(constraint)
+	if len(fields) == 0 {
+		return false, fmt.Errorf("empty version range")
+	}
+
+	for _, field := range fields {
+		op := strings.TrimRight(field, "0123456789.v")
+		bound, err := parseVersion(strings.TrimPrefix(field, op))
+		if err != nil {
+			return false, fmt.Errorf("invalid version range %q: %w", constraint, err)
+		}
+
+		cmp := compareVersions(v, bound)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "=", "":
+			ok = cmp == 0
+		default:
+			return false, fmt.Errorf("invalid operator %q in version range %q", op, constraint)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
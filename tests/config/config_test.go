@@ -0,0 +1,202 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionInRange(t *testing.T) {
+	const supported = ">=1.32 <=1.34"
+
+	for _, v := range []string{"1.32", "v1.33.1", "1.34.7", "v1.33.5-eks-2f008fe", "v1.32.2+k3s1"} {
+		ok, err := VersionInRange(v, supported)
+		require.NoError(t, err)
+		require.True(t, ok, "%s should be in %s", v, supported)
+	}
+
+	for _, v := range []string{"1.31", "v1.31.9", "1.35.0", "2.0"} {
+		ok, err := VersionInRange(v, supported)
+		require.NoError(t, err)
+		require.False(t, ok, "%s should not be in %s", v, supported)
+	}
+
+	ok, err := VersionInRange("1.33.2", "=1.33")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = VersionInRange("1.33.2", ">1.33 <1.35")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = VersionInRange("latest", supported)
+	require.Error(t, err)
+	_, err = VersionInRange("1.33", "~1.33")
+	require.Error(t, err)
+	_, err = VersionInRange("1.33", "")
+	require.Error(t, err)
+}
+
+func TestGetImageVariantFromEnv(t *testing.T) {
+	cfg := &Config{PostgresImages: PostgresImages{Variants: []ImageVariant{
+		{Name: "minimal", TagSuffix: "-minimal"},
+		{Name: "standard", TagSuffix: "-standard"},
+	}}}
+
+	t.Setenv("POSTGRES_VARIANT", "")
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "standard", variant)
+
+	t.Setenv("POSTGRES_VARIANT", "minimal")
+	variant, err = cfg.GetImageVariantFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "minimal", variant)
+
+	t.Setenv("POSTGRES_VARIANT", "full")
+	_, err = cfg.GetImageVariantFromEnv()
+	require.ErrorContains(t, err, `unknown image variant "full"`)
+	require.ErrorContains(t, err, "minimal, standard")
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			CNPGVersions: []CNPGVersion{
+				{Version: "1.28.3", GitTag: "v1.28.3", OperatorImage: "ghcr.io/cloudnative-pg/cloudnative-pg:1.28.3"},
+			},
+			PostgresImages: PostgresImages{
+				Registries:      map[string]Registry{"public": {Base: "ghcr.io/pgedge/pgedge-postgres"}},
+				DefaultRegistry: "public",
+				Variants:        []ImageVariant{{Name: "minimal"}, {Name: "standard"}},
+			},
+			ProviderDefaults: map[string]ProviderDefaults{
+				"kind": {
+					DefaultKubernetesVersion: "1.34",
+					Storage:                  StorageConfig{SnapshotControllerVersion: "v8.4.0"},
+					KubernetesVersionManifests: map[string]KubernetesVersion{"1.34": {
+						Manifests: []Manifest{{Name: "Snapshot CRDs", URL: "https://example.com/{snapshot_controller_version}/crds.yaml"}},
+					}},
+				},
+				"eks": {
+					KubernetesVersion: "1.33",
+					Storage:           StorageConfig{SnapshotControllerVersion: "v8.4.0"},
+					Manifests:         []Manifest{{Name: "CRDs", URL: "https://example.com/{snapshot_controller_version}/crds.yaml"}},
+				},
+			},
+		}
+	}
+	require.NoError(t, valid().Validate())
+
+	cfg := valid()
+	cfg.CNPGVersions = append(cfg.CNPGVersions, CNPGVersion{Version: "1.27.4"})
+	cfg.PostgresImages.DefaultRegistry = "pubilc"
+	cfg.PostgresImages.Variants = append(cfg.PostgresImages.Variants, ImageVariant{Name: "standard"})
+	kind := cfg.ProviderDefaults["kind"]
+	kind.DefaultKubernetesVersion = "1.36"
+	kind.Storage.SnapshotControllerVersion = ""
+	cfg.ProviderDefaults["kind"] = kind
+	eks := cfg.ProviderDefaults["eks"]
+	eks.Storage.SnapshotControllerVersion = ""
+	cfg.ProviderDefaults["eks"] = eks
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	require.Equal(t, strings.Join([]string{
+		"cnpg_versions[1.27.4]: git_tag is required",
+		"cnpg_versions[1.27.4]: operator_image is required",
+		`postgres_images.default_registry "pubilc" is not defined in postgres_images.registries`,
+		`postgres_images.variants: duplicate variant "standard"`,
+		`provider_defaults.eks: manifest "CRDs" uses {snapshot_controller_version} but storage.snapshot_controller_version is not set`,
+		`provider_defaults.kind.kubernetes_version_manifests[1.34]: manifest "Snapshot CRDs" uses {snapshot_controller_version} but storage.snapshot_controller_version is not set`,
+		`provider_defaults.kind.default_kubernetes_version "1.36" has no entry in kubernetes_version_manifests`,
+	}, "\n"), err.Error())
+}
+
+func TestResolvedManifests(t *testing.T) {
+	defaults := ProviderDefaults{
+		Storage: StorageConfig{SnapshotControllerVersion: "v8.0.0"},
+		Manifests: []Manifest{
+			{Name: "CRDs", URL: "https://example.com/external-snapshotter/{snapshot_controller_version}/crds.yaml"},
+			{Name: "Other", URL: "https://example.com/other.yaml"},
+		},
+	}
+	manifests, err := defaults.ResolvedManifests()
+	require.NoError(t, err)
+	require.Equal(t, []Manifest{
+		{Name: "CRDs", URL: "https://example.com/external-snapshotter/v8.0.0/crds.yaml"},
+		{Name: "Other", URL: "https://example.com/other.yaml"},
+	}, manifests)
+
+	manifests, err = defaults.ResolveManifests([]Manifest{{Name: "Controller", URL: "https://example.com/{snapshot_controller_version}/controller.yaml"}})
+	require.NoError(t, err)
+	require.Equal(t, []Manifest{{Name: "Controller", URL: "https://example.com/v8.0.0/controller.yaml"}}, manifests)
+}
+
+func TestResolveConfigPath(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "tests", "helpers")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "tests", "config"), 0o755))
+	require.NoError(t, os.MkdirAll(nested, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example\n"), 0o644))
+
+	t.Setenv(configEnvVar, "")
+	_, err := resolveConfigPath(nested)
+	require.ErrorContains(t, err, filepath.Join(root, "tests", "config", "versions.yaml"))
+
+	expected := filepath.Join(root, "tests", "config", "versions.yaml")
+	require.NoError(t, os.WriteFile(expected, []byte("cnpg_versions: []\n"), 0o644))
+	for _, dir := range []string{root, nested} {
+		path, err := resolveConfigPath(dir)
+		require.NoError(t, err)
+		require.Equal(t, expected, path)
+	}
+
+	explicit := filepath.Join(t.TempDir(), "custom.yaml")
+	t.Setenv(configEnvVar, explicit)
+	_, err = resolveConfigPath(nested)
+	require.ErrorContains(t, err, configEnvVar)
+
+	require.NoError(t, os.WriteFile(explicit, []byte("cnpg_versions: []\n"), 0o644))
+	path, err := resolveConfigPath(nested)
+	require.NoError(t, err)
+	require.Equal(t, explicit, path)
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv(configEnvVar, "")
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	require.NotEmpty(t, cfg.CNPGVersions)
+
+	// Default runs must pass the supported version check of the default CNPG version
+	if supported := cfg.CNPGVersions[0].SupportedKubernetesVersions; supported != "" {
+		for provider, defaults := range cfg.ProviderDefaults {
+			for _, version := range []string{defaults.KubernetesVersion, defaults.DefaultKubernetesVersion} {
+				if version == "" {
+					continue
+				}
+				ok, err := VersionInRange(version, supported)
+				require.NoError(t, err)
+				require.True(t, ok, "provider %s defaults to Kubernetes %s, outside %q", provider, version, supported)
+			}
+		}
+	}
+
+	// Bumping snapshot_controller_version must move every provider's snapshotter manifests
+	for provider, defaults := range cfg.ProviderDefaults {
+		manifests := defaults.Manifests
+		for _, entry := range defaults.KubernetesVersionManifests {
+			manifests = append(manifests, entry.Manifests...)
+		}
+		for _, m := range manifests {
+			if strings.Contains(m.URL, "/external-snapshotter/") {
+				require.Contains(t, m.URL, "/external-snapshotter/"+snapshotControllerVersionPlaceholder+"/",
+					"provider %s manifest %q hardcodes the snapshotter version", provider, m.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// imageValidationPolicyTemplate is the ValidatingAdmissionPolicy that blocks non-pgEdge PostgreSQL
+// images in CNPG clusters, so tests only ever run against pgEdge images
+var imageValidationPolicyTemplate = template.Must(template.New("image-validation-policy").Parse(`---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: pgedge-postgres-only
+spec:
+  failurePolicy: Fail
+  matchConstraints:
+    resourceRules:
+    - apiGroups: ["postgresql.cnpg.io"]
+      apiVersions: ["v1"]
+      operations: ["CREATE", "UPDATE"]
+      resources: ["clusters"]
+  validations:
+  - expression: |
+      !has(object.spec.imageName){{range .Prefixes}} ||
+      object.spec.imageName.startsWith('{{.}}'){{end}}
+    message: "CNPG Cluster must use pgEdge PostgreSQL images ({{.AllowedImages}}). Upstream CNPG images are not allowed in these tests."
+    reason: Forbidden
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: pgedge-postgres-only-binding
+spec:
+  policyName: pgedge-postgres-only
+  validationActions: ["{{.ValidationAction}}"]
+  matchResources:
+    namespaceSelector: {}
+`))
+
+// Validation actions of the image validation policy binding
+const (
+	// ValidationActionDeny rejects non-pgEdge images
+	ValidationActionDeny = "Deny"
+	// ValidationActionWarn admits non-pgEdge images with a warning to the client
+	ValidationActionWarn = "Warn"
+	// ValidationActionAudit admits non-pgEdge images and records the violation in the audit log
+	ValidationActionAudit = "Audit"
+)
+
+// AllowedImagePrefixesEnvVar lists extra image prefixes, comma-separated, the image validation
+// policy admits besides the configured registries, e.g. an internal mirror
+const AllowedImagePrefixesEnvVar = "PGEDGE_ALLOWED_IMAGE_PREFIXES"
+
+// AllowedImagePrefixes returns the image prefixes the image validation policy admits: every
+// configured registry base followed by a tag, then the prefixes from AllowedImagePrefixesEnvVar
+func (c *Config) AllowedImagePrefixes() ([]string, error) {
+	var bases []string
+	for name, reg := range c.PostgresImages.Registries {
+		if reg.Base == "" {
+			return nil, fmt.Errorf("postgres_images.registries.%s has no base", name)
+		}
+		// Prefixes are embedded in single-quoted CEL strings
+		if strings.ContainsAny(reg.Base, `'\`) {
+			return nil, fmt.Errorf("postgres_images.registries.%s base %q contains quotes or backslashes", name, reg.Base)
+		}
+		bases = append(bases, reg.Base)
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no registries configured in postgres_images.registries")
+	}
+	sort.Strings(bases)
+
+	prefixes := make([]string, 0, len(bases))
+	for _, base := range bases {
+		prefixes = append(prefixes, base+":")
+	}
+	for _, prefix := range strings.Split(os.Getenv(AllowedImagePrefixesEnvVar), ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		if strings.ContainsAny(prefix, `'\`) {
+			return nil, fmt.Errorf("%s prefix %q contains quotes or backslashes", AllowedImagePrefixesEnvVar, prefix)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// RenderImageValidationPolicy renders the image validation policy allowing exactly the image
+// bases of the configured registries and any prefixes from AllowedImagePrefixesEnvVar, bound with
+// validationAction (Deny, Warn or Audit)
+func (c *Config) RenderImageValidationPolicy(validationAction string) (string, error) {
+	switch validationAction {
+	case ValidationActionDeny, ValidationActionWarn, ValidationActionAudit:
+	default:
+		return "", fmt.Errorf("invalid validation action %q, must be %s, %s or %s",
+			validationAction, ValidationActionDeny, ValidationActionWarn, ValidationActionAudit)
+	}
+
+	prefixes, err := c.AllowedImagePrefixes()
+	if err != nil {
+		return "", err
+	}
+	allowed := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		allowed[i] = strings.TrimSuffix(prefix, ":")
+	}
+
+	var buf bytes.Buffer
+	err = imageValidationPolicyTemplate.Execute(&buf, struct {
+		Prefixes         []string
+		AllowedImages    string
+		ValidationAction string
+	}{prefixes, strings.Join(allowed, " or "), validationAction})
+	if err != nil {
+		return "", fmt.Errorf("failed to render image validation policy: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// policyAdmits evaluates the validation expressions of the rendered ValidatingAdmissionPolicy with
+// CEL, the way the API server does, and reports whether a Cluster with object as its body passes
+func policyAdmits(t *testing.T, policy string, object map[string]any) bool {
+	t.Helper()
+
+	var expressions []string
+	decoder := yaml.NewDecoder(strings.NewReader(policy))
+	for {
+		var doc struct {
+			Kind string `yaml:"kind"`
+			Spec struct {
+				Validations []struct {
+					Expression string `yaml:"expression"`
+				} `yaml:"validations"`
+			} `yaml:"spec"`
+		}
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if doc.Kind != "ValidatingAdmissionPolicy" {
+			continue
+		}
+		for _, v := range doc.Spec.Validations {
+			expressions = append(expressions, v.Expression)
+		}
+	}
+	require.NotEmpty(t, expressions, "Rendered policy has no validations")
+
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType))
+	require.NoError(t, err)
+	for _, expression := range expressions {
+		ast, issues := env.Compile(expression)
+		require.NoError(t, issues.Err(), "Failed to compile %q", expression)
+		program, err := env.Program(ast)
+		require.NoError(t, err)
+		out, _, err := program.Eval(map[string]any{"object": object})
+		require.NoError(t, err, "Failed to evaluate %q", expression)
+		if out.Value() != true {
+			return false
+		}
+	}
+	return true
+}
+
+// clusterWithImage returns the body of a CNPG Cluster using image, or the operator default if empty
+func clusterWithImage(image string) map[string]any {
+	spec := map[string]any{"instances": 1}
+	if image != "" {
+		spec["imageName"] = image
+	}
+	return map[string]any{"spec": spec}
+}
+
+func TestRenderImageValidationPolicy(t *testing.T) {
+	t.Setenv(configEnvVar, "")
+	t.Setenv(AllowedImagePrefixesEnvVar, "")
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	require.NotEmpty(t, cfg.PostgresImages.Registries)
+
+	policy, err := cfg.RenderImageValidationPolicy(ValidationActionDeny)
+	require.NoError(t, err)
+	require.Contains(t, policy, "must use pgEdge PostgreSQL images")
+	require.Contains(t, policy, `validationActions: ["Deny"]`)
+	for name, reg := range cfg.PostgresImages.Registries {
+		require.Contains(t, policy, "object.spec.imageName.startsWith('"+reg.Base+":')", "registry %s is not allowed", name)
+	}
+
+	policy, err = cfg.RenderImageValidationPolicy(ValidationActionWarn)
+	require.NoError(t, err)
+	require.Contains(t, policy, `validationActions: ["Warn"]`)
+
+	_, err = cfg.RenderImageValidationPolicy("Block")
+	require.ErrorContains(t, err, `invalid validation action "Block"`)
+
+	cfg.PostgresImages.Registries = map[string]Registry{"broken": {Base: "ghcr.io/it's"}}
+	_, err = cfg.RenderImageValidationPolicy(ValidationActionDeny)
+	require.ErrorContains(t, err, "contains quotes")
+
+	cfg.PostgresImages.Registries = nil
+	_, err = cfg.RenderImageValidationPolicy(ValidationActionDeny)
+	require.ErrorContains(t, err, "no registries configured")
+}
+
+func TestAllowedImagePrefixes(t *testing.T) {
+	t.Setenv(AllowedImagePrefixesEnvVar, " mirror.example.com/pgedge/ ,, registry.internal:5000/pgedge-postgres:")
+	cfg := &Config{PostgresImages: PostgresImages{Registries: map[string]Registry{
+		"public":   {Base: "ghcr.io/pgedge/pgedge-postgres"},
+		"internal": {Base: "ghcr.io/pgedge/pgedge-postgres-internal"},
+	}}}
+
+	prefixes, err := cfg.AllowedImagePrefixes()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"ghcr.io/pgedge/pgedge-postgres:",
+		"ghcr.io/pgedge/pgedge-postgres-internal:",
+		"mirror.example.com/pgedge/",
+		"registry.internal:5000/pgedge-postgres:",
+	}, prefixes)
+
+	policy, err := cfg.RenderImageValidationPolicy(ValidationActionDeny)
+	require.NoError(t, err)
+	require.Contains(t, policy, "object.spec.imageName.startsWith('ghcr.io/pgedge/pgedge-postgres:')")
+	require.Contains(t, policy, "object.spec.imageName.startsWith('mirror.example.com/pgedge/')")
+	require.Contains(t, policy, "or mirror.example.com/pgedge/ or registry.internal:5000/pgedge-postgres)")
+
+	require.True(t, policyAdmits(t, policy, clusterWithImage("mirror.example.com/pgedge/pgedge-postgres:17-spock5-standard")))
+	require.True(t, policyAdmits(t, policy, clusterWithImage("registry.internal:5000/pgedge-postgres:17")))
+	require.True(t, policyAdmits(t, policy, clusterWithImage("ghcr.io/pgedge/pgedge-postgres:17-spock5-standard")))
+	require.True(t, policyAdmits(t, policy, clusterWithImage("")))
+	require.False(t, policyAdmits(t, policy, clusterWithImage("docker.io/library/postgres:17")))
+	require.False(t, policyAdmits(t, policy, clusterWithImage("mirror.example.com/other/postgres:17")))
+	// The registry prefixes end in the tag separator, so look-alike repositories are rejected
+	require.False(t, policyAdmits(t, policy, clusterWithImage("ghcr.io/pgedge/pgedge-postgres-fork:17")))
+
+	t.Setenv(AllowedImagePrefixesEnvVar, "")
+	policy, err = cfg.RenderImageValidationPolicy(ValidationActionDeny)
+	require.NoError(t, err)
+	require.False(t, policyAdmits(t, policy, clusterWithImage("mirror.example.com/pgedge/pgedge-postgres:17-spock5-standard")))
+
+	t.Setenv(AllowedImagePrefixesEnvVar, "mirror.example.com/it's/")
+	_, err = cfg.RenderImageValidationPolicy(ValidationActionDeny)
+	require.ErrorContains(t, err, "PGEDGE_ALLOWED_IMAGE_PREFIXES prefix \"mirror.example.com/it's/\" contains quotes")
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDevCluster provisions the long-lived Kind dev cluster with CSI, the image validation
+// policy and the CNPG operator, and leaves it running. It only runs with DEV_CLUSTER=true.
+func TestDevCluster(t *testing.T) {
+	if os.Getenv("DEV_CLUSTER") != "true" {
+		t.Skip("Set DEV_CLUSTER=true to provision the dev cluster")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	dev := providers.NewDevCluster()
+	if dev.IsReady(t) {
+		t.Logf("Dev cluster %s is already running (kubeconfig: %s)", providers.DevClusterName, dev.GetKubeConfigPath())
+		return
+	}
+
+	t.Setenv("CLUSTER_CLEANUP", "false")
+	providers.Setup(t, dev)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	// Install without registering cleanup so the operator outlives the test
+	operator := helpers.NewCNPGOperator(t, &helpers.CNPGOperatorConfig{
+		Version:       cnpgVersion.Version,
+		ChartVersion:  cnpgVersion.ChartVersion,
+		Namespace:     helpers.DefaultOperatorNamespace,
+		ReleaseName:   "cloudnative-pg",
+		OperatorImage: cnpgVersion.GetOperatorImageName(),
+		PostgresImage: postgresImage,
+	}, dev.GetKubeConfigPath())
+	require.NoError(t, operator.Install(t), "Failed to install CNPG operator")
+
+	t.Logf("Dev cluster ready: export KUBECONFIG=%s", dev.GetKubeConfigPath())
+}
+
+// TestAttachDevCluster verifies tests can connect to a running dev cluster
+func TestAttachDevCluster(t *testing.T) {
+	opts := providers.AttachToDevCluster(t)
+
+	nodes, err := helpers.GetNodes(t, opts)
+	require.NoError(t, err)
+	require.NotEmpty(t, nodes, "Dev cluster should have nodes")
+}
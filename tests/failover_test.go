@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClusterFailover deletes the primary of a three-instance cluster with a separate WAL volume
+// and checks a replica is promoted and the cluster returns to healthy
+func TestClusterFailover(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-failover-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	operator := helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+	cluster := helpers.ClusterSpec{Name: "failover", Instances: 3, WALStorageSize: "1Gi"}.Manifest()
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "failover", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "failover", 10*time.Minute))
+
+	t.Run("WAL is on a separate volume", func(t *testing.T) {
+		helpers.AssertWALVolumeSeparate(t, opts, "failover")
+	})
+
+	t.Run("Primary is not co-located with the operator", func(t *testing.T) {
+		helpers.AssertPrimaryNotCoLocatedWithOperator(t, opts, operator, "failover")
+	})
+
+	t.Run("Zone-pinned instances are spread across zones", func(t *testing.T) {
+		zones := helpers.GetNodeZones(t, opts)
+		if len(zones) < 2 {
+			t.Skipf("Nodes span %d zones, zone distribution needs at least 2", len(zones))
+		}
+
+		zoned := helpers.ClusterSpec{Name: "failover-zones", Instances: 3, Zones: zones}.Manifest()
+		require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, zoned), "Failed to create zone-pinned cluster")
+		defer func() {
+			_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "failover-zones", "--ignore-not-found=true")
+		}()
+		require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "failover-zones", 10*time.Minute))
+		helpers.AssertZoneDistribution(t, opts, "failover-zones")
+	})
+
+	oldPrimary, newPrimary, err := helpers.TriggerFailover(t, opts, "failover")
+	require.NoError(t, err)
+	require.NotEqual(t, oldPrimary, newPrimary)
+
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "failover", 10*time.Minute))
+	status, err := helpers.GetClusterStatus(t, opts, "failover")
+	require.NoError(t, err)
+	require.Equal(t, newPrimary, status.CurrentPrimary, "Primary changed again after failover")
+
+	t.Run("WAL stays on a separate volume after failover", func(t *testing.T) {
+		helpers.AssertWALVolumeSeparate(t, opts, "failover")
+	})
+}
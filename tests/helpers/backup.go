@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// backupGVR identifies the CNPG Backup custom resource
+var backupGVR = schema.GroupVersionResource{Group: "postgresql.cnpg.io", Version: "v1", Resource: "backups"}
+
+const (
+	// backupCompletedPhase is the phase of a Backup that finished successfully
+	backupCompletedPhase = "completed"
+	// backupFailedPhase is the phase of a Backup that gave up
+	backupFailedPhase = "failed"
+)
+
+const (
+	// BarmanCloudPluginVersion is the Barman Cloud Plugin release in manifests/plugin-barman-cloud
+	// that backup tests install
+	BarmanCloudPluginVersion = "0.11.0"
+	// BarmanCloudPluginName is the name clusters and backups use to reference the plugin
+	BarmanCloudPluginName = "barman-cloud.cloudnative-pg.io"
+	// certManagerManifestURL installs cert-manager, which issues the plugin's TLS certificates
+	certManagerManifestURL = "https://github.com/cert-manager/cert-manager/releases/download/v1.16.2/cert-manager.yaml"
+	// certManagerNamespace is where certManagerManifestURL installs cert-manager
+	certManagerNamespace = "cert-manager"
+)
+
+// checkBackupCompleted returns nil once backup completed and a FatalError if it failed
+func checkBackupCompleted(backup *unstructured.Unstructured) error {
+	phase, _, _ := unstructured.NestedString(backup.Object, "status", "phase")
+	switch phase {
+	case backupCompletedPhase:
+		return nil
+	case backupFailedPhase:
+		reason, _, _ := unstructured.NestedString(backup.Object, "status", "error")
+		return retry.FatalError{Underlying: fmt.Errorf("backup %s failed: %s", backup.GetName(), reason)}
+	default:
+		return fmt.Errorf("backup %s is in phase %q", backup.GetName(), phase)
+	}
+}
+
+// WaitForBackupCompleted waits for the Backup backupName to complete, failing fast if it fails
+func WaitForBackupCompleted(t *testing.T, opts *k8s.KubectlOptions, backupName string, timeout time.Duration) error {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	maxRetries := int(timeout.Seconds() / 5)
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for backup %s to complete", backupName), maxRetries, 5*time.Second, func() (string, error) {
+		backup, err := dynClient.Resource(backupGVR).Namespace(opts.Namespace).Get(context.Background(), backupName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return "", checkBackupCompleted(backup)
+	})
+	var fatalErr retry.FatalError
+	if errors.As(err, &fatalErr) {
+		return fatalErr.Underlying
+	}
+	return err
+}
+
+// DeployBarmanCloudPlugin installs cert-manager and the Barman Cloud Plugin release version from
+// manifests/plugin-barman-cloud into the operator namespace, and removes the plugin when the test
+// finishes. The CNPG operator must already be installed in DefaultOperatorNamespace.
+func DeployBarmanCloudPlugin(t *testing.T, kubeconfigPath, version string) {
+	t.Helper()
+
+	projectRoot := findProjectRoot(t)
+	manifestPath := filepath.Join(projectRoot, "manifests", "plugin-barman-cloud", "v"+version, "manifest.yaml")
+	_, err := os.Stat(manifestPath)
+	require.NoError(t, err, "Barman Cloud Plugin manifest not found at %s", manifestPath)
+
+	t.Log("Installing cert-manager for the Barman Cloud Plugin")
+	certManagerOpts := k8s.NewKubectlOptions("", kubeconfigPath, certManagerNamespace)
+	require.NoError(t, k8s.RunKubectlE(t, certManagerOpts, "apply", "-f", certManagerManifestURL), "Failed to install cert-manager")
+	for _, deployment := range []string{"cert-manager", "cert-manager-cainjector", "cert-manager-webhook"} {
+		require.NoError(t, k8s.WaitUntilDeploymentAvailableE(t, certManagerOpts, deployment, 60, 5*time.Second),
+			"cert-manager deployment %s did not become available", deployment)
+	}
+
+	t.Logf("Installing Barman Cloud Plugin v%s", version)
+	opts := k8s.NewKubectlOptions("", kubeconfigPath, DefaultOperatorNamespace)
+	// The webhook of cert-manager may take a moment to serve after its deployment is available
+	_, err = retry.DoWithRetryE(t, "Apply Barman Cloud Plugin manifest", 12, 5*time.Second, func() (string, error) {
+		return "", k8s.RunKubectlE(t, opts, "apply", "--server-side", "--force-conflicts", "-f", manifestPath)
+	})
+	require.NoError(t, err, "Failed to install Barman Cloud Plugin")
+	t.Cleanup(func() {
+		_ = k8s.KubectlDeleteE(t, opts, manifestPath)
+	})
+
+	require.NoError(t, k8s.WaitUntilDeploymentAvailableE(t, opts, "barman-cloud", 60, 5*time.Second),
+		"Barman Cloud Plugin did not become available")
+}
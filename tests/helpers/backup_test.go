@@ -0,0 +1,38 @@
+package helpers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newCNPGBackup returns an unstructured CNPG Backup of clusterName in the given phase
+func newCNPGBackup(namespace, name, clusterName, phase string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("postgresql.cnpg.io/v1")
+	u.SetKind("Backup")
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	_ = unstructured.SetNestedField(u.Object, clusterName, "spec", "cluster", "name")
+	if phase != "" {
+		_ = unstructured.SetNestedField(u.Object, phase, "status", "phase")
+	}
+	return u
+}
+
+func TestCheckBackupCompleted(t *testing.T) {
+	require.NoError(t, checkBackupCompleted(newCNPGBackup("default", "b1", "pg", "completed")))
+
+	err := checkBackupCompleted(newCNPGBackup("default", "b1", "pg", "running"))
+	require.ErrorContains(t, err, `backup b1 is in phase "running"`)
+	require.False(t, errors.As(err, new(retry.FatalError)))
+
+	failed := newCNPGBackup("default", "b1", "pg", "failed")
+	require.NoError(t, unstructured.SetNestedField(failed.Object, "can't upload WAL", "status", "error"))
+	err = checkBackupCompleted(failed)
+	require.ErrorContains(t, err, "backup b1 failed: can't upload WAL")
+	require.True(t, errors.As(err, new(retry.FatalError)))
+}
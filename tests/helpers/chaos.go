@@ -0,0 +1,368 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ChaosFault injects a fault and optionally returns a function that heals it
+type ChaosFault func(t *testing.T) (heal func(t *testing.T) error, err error)
+
+// ChaosStep is one fault in a scenario, followed by the checks that must pass once it settles
+type ChaosStep struct {
+	Name string
+	// Fault is injected first
+	Fault ChaosFault
+	// HealBeforeAssert heals the fault before the checks run instead of at the end of the scenario
+	HealBeforeAssert bool
+	// Assert is retried until it succeeds or the scenario's recovery timeout expires
+	Assert func(t *testing.T) error
+}
+
+// ChaosScenario is a scripted sequence of faults with health assertions between them
+type ChaosScenario struct {
+	Name            string
+	Steps           []ChaosStep
+	RecoveryTimeout time.Duration
+}
+
+// chaosRecoveryInterval is the pause between attempts of a step's assertion
+const chaosRecoveryInterval = 5 * time.Second
+
+// Chaos runs chaos scenarios against a cluster
+type Chaos struct {
+	// recoveryInterval is the pause between assertion attempts; tests shorten it
+	recoveryInterval time.Duration
+}
+
+// NewChaos returns a chaos driver
+func NewChaos() *Chaos {
+	return &Chaos{recoveryInterval: chaosRecoveryInterval}
+}
+
+// Run executes each step of scenario as a subtest: inject the fault, optionally heal it, then wait
+// for the step's assertion to pass. Faults not healed in their step are healed when the scenario
+// ends, in reverse order. A failing step stops the scenario.
+func (c *Chaos) Run(t *testing.T, scenario ChaosScenario) {
+	t.Helper()
+
+	var pendingHeals []func(t *testing.T) error
+	defer func() {
+		for i := len(pendingHeals) - 1; i >= 0; i-- {
+			if err := pendingHeals[i](t); err != nil {
+				t.Logf("Warning: failed to heal fault: %v", err)
+			}
+		}
+	}()
+
+	timeout := scenario.RecoveryTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	maxRetries := int(timeout / c.recoveryInterval)
+	if maxRetries < 1 {
+		maxRetries = 1
+	}
+
+	for i, step := range scenario.Steps {
+		ok := t.Run(fmt.Sprintf("%d_%s", i+1, step.Name), func(t *testing.T) {
+			t.Logf("Chaos %s: injecting %s", scenario.Name, step.Name)
+			heal, err := step.Fault(t)
+			require.NoError(t, err, "Failed to inject %s", step.Name)
+
+			if heal != nil {
+				if step.HealBeforeAssert {
+					require.NoError(t, heal(t), "Failed to heal %s", step.Name)
+				} else {
+					pendingHeals = append(pendingHeals, heal)
+				}
+			}
+
+			if step.Assert == nil {
+				return
+			}
+			_, err = retry.DoWithRetryE(t, fmt.Sprintf("Recover from %s", step.Name), maxRetries, c.recoveryInterval, func() (string, error) {
+				return "", step.Assert(t)
+			})
+			require.NoError(t, err, "Cluster did not recover after %s", step.Name)
+		})
+		if !ok {
+			t.Fatalf("Chaos %s stopped at step %q", scenario.Name, step.Name)
+		}
+	}
+}
+
+// DeletePodFault force deletes a pod
+func DeletePodFault(opts *k8s.KubectlOptions, podName string) ChaosFault {
+	return func(t *testing.T) (func(t *testing.T) error, error) {
+		err := k8s.RunKubectlE(t, opts, "delete", "pod", podName, "--grace-period=0", "--force")
+		return nil, err
+	}
+}
+
+// primaryPodName returns the current primary instance of a CNPG cluster
+func primaryPodName(t *testing.T, opts *k8s.KubectlOptions, clusterName string) (string, error) {
+	status, err := GetClusterStatus(t, opts, clusterName)
+	if err != nil {
+		return "", fmt.Errorf("failed to find primary of %s: %w", clusterName, err)
+	}
+	if status.CurrentPrimary == "" {
+		return "", fmt.Errorf("cluster %s has no primary", clusterName)
+	}
+	return status.CurrentPrimary, nil
+}
+
+// DeletePrimaryFault force deletes the current primary of a CNPG cluster
+func DeletePrimaryFault(opts *k8s.KubectlOptions, clusterName string) ChaosFault {
+	return func(t *testing.T) (func(t *testing.T) error, error) {
+		primary, err := primaryPodName(t, opts, clusterName)
+		if err != nil {
+			return nil, err
+		}
+		t.Logf("Deleting primary %s", primary)
+		return DeletePodFault(opts, primary)(t)
+	}
+}
+
+// switchoverTarget picks a replica of the cluster that does not run on node to take over from
+// primary
+func switchoverTarget(pods []corev1.Pod, primary, node string) (string, error) {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Name != primary && pod.Spec.NodeName != node && pod.DeletionTimestamp == nil {
+			names = append(names, pod.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no replica of %s runs outside node %s", primary, node)
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// promoteInstance asks the operator to switch the primary of clusterName over to target, the way
+// the cnpg kubectl plugin's promote command does
+func promoteInstance(t *testing.T, opts *k8s.KubectlOptions, clusterName, target string) error {
+	patch := fmt.Sprintf(`{"status":{"targetPrimary":%q,"targetPrimaryTimestamp":%q,"phase":"Switchover in progress","phaseReason":"Switching over to %s"}}`,
+		target, time.Now().UTC().Format(time.RFC3339Nano), target)
+	if err := k8s.RunKubectlE(t, opts, "patch", "cluster", clusterName, "--subresource=status", "--type=merge", "-p", patch); err != nil {
+		return fmt.Errorf("failed to promote %s: %w", target, err)
+	}
+	return nil
+}
+
+// DrainPrimaryNodeFault drains the node running the primary of a CNPG cluster. The primary's
+// PodDisruptionBudget blocks its eviction, so the node is cordoned and the primary switched over
+// to a replica on another node first. Healing uncordons the node.
+func DrainPrimaryNodeFault(opts *k8s.KubectlOptions, clusterName string) ChaosFault {
+	return func(t *testing.T) (func(t *testing.T) error, error) {
+		primary, err := primaryPodName(t, opts, clusterName)
+		if err != nil {
+			return nil, err
+		}
+		node, err := k8s.RunKubectlAndGetOutputE(t, opts, "get", "pod", primary, "-o", "jsonpath={.spec.nodeName}")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find node of %s: %w", primary, err)
+		}
+
+		t.Logf("Draining node %s (hosts primary %s)", node, primary)
+		heal := func(t *testing.T) error {
+			return k8s.RunKubectlE(t, opts, "uncordon", node)
+		}
+		if err := k8s.RunKubectlE(t, opts, "cordon", node); err != nil {
+			return nil, err
+		}
+
+		clientset, err := getClientset(opts.ConfigPath)
+		if err != nil {
+			return heal, err
+		}
+		pods, err := listInstancePods(context.Background(), clientset, opts.Namespace, clusterName)
+		if err != nil {
+			return heal, err
+		}
+		target, err := switchoverTarget(pods, primary, node)
+		if err != nil {
+			return heal, err
+		}
+		t.Logf("Switching primary of %s over to %s before the drain", clusterName, target)
+		if err := promoteInstance(t, opts, clusterName, target); err != nil {
+			return heal, err
+		}
+		if _, err := waitForPrimaryChange(func() (ClusterStatus, error) {
+			return GetClusterStatus(t, opts, clusterName)
+		}, primary, failoverTimeout, 2*time.Second); err != nil {
+			return heal, fmt.Errorf("switchover away from node %s did not complete: %w", node, err)
+		}
+
+		err = k8s.RunKubectlE(t, opts, "drain", node,
+			"--ignore-daemonsets", "--delete-emptydir-data", "--force", "--timeout=5m")
+		return heal, err
+	}
+}
+
+// InstancePod identifies one incarnation of an instance pod. CNPG recreates instances under the
+// same name, only the UID tells them apart.
+type InstancePod struct {
+	Name string
+	UID  types.UID
+}
+
+// GetPrimaryPod returns the current primary instance pod of a CNPG cluster
+func GetPrimaryPod(t *testing.T, opts *k8s.KubectlOptions, clusterName string) (InstancePod, error) {
+	t.Helper()
+
+	name, err := primaryPodName(t, opts, clusterName)
+	if err != nil {
+		return InstancePod{}, err
+	}
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return InstancePod{}, err
+	}
+	pod, err := clientset.CoreV1().Pods(opts.Namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return InstancePod{}, fmt.Errorf("failed to get primary %s: %w", name, err)
+	}
+	return InstancePod{Name: pod.Name, UID: pod.UID}, nil
+}
+
+// checkPrimaryReplaced returns nil once the cluster is healthy, another instance has taken over
+// from old and the pod old ran in has been recreated
+func checkPrimaryReplaced(ctx context.Context, clientset kubernetes.Interface, dynClient dynamic.Interface, namespace, clusterName string, old InstancePod) error {
+	status, err := getClusterStatus(ctx, dynClient, namespace, clusterName)
+	if err != nil {
+		return err
+	}
+	if status.CurrentPrimary == old.Name {
+		return fmt.Errorf("cluster %s still has primary %s", clusterName, old.Name)
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, old.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("instance %s has not been recreated: %w", old.Name, err)
+	}
+	if pod.UID == old.UID {
+		return fmt.Errorf("instance %s is still the original pod %s", old.Name, old.UID)
+	}
+	return checkClusterHealthy(clusterName, status)
+}
+
+// CheckPrimaryReplaced returns nil once the cluster is healthy, another instance has taken over
+// from old and the pod old ran in has been recreated. It suits ChaosStep.Assert for faults that
+// take the primary down.
+func CheckPrimaryReplaced(t *testing.T, opts *k8s.KubectlOptions, clusterName string, old InstancePod) error {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	return checkPrimaryReplaced(context.Background(), clientset, dynClient, opts.Namespace, clusterName, old)
+}
+
+// PartitionPodsFault isolates the pods matching selector with a deny-all NetworkPolicy. It relies
+// on a CNI that enforces NetworkPolicies. Healing deletes the policy.
+func PartitionPodsFault(opts *k8s.KubectlOptions, name string, selector map[string]string) ChaosFault {
+	return func(t *testing.T) (func(t *testing.T) error, error) {
+		var matchLabels string
+		for k, v := range selector {
+			matchLabels += fmt.Sprintf("      %s: %q\n", k, v)
+		}
+		policy := fmt.Sprintf(`apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: %s
+spec:
+  podSelector:
+    matchLabels:
+%s  policyTypes:
+    - Ingress
+    - Egress
+`, name, matchLabels)
+
+		heal := func(t *testing.T) error {
+			return k8s.KubectlDeleteFromStringE(t, opts, policy)
+		}
+		return heal, k8s.KubectlApplyFromStringE(t, opts, policy)
+	}
+}
+
+// DeletePVCFault deletes a PVC together with the pod using it, forcing the operator to rebuild
+// the instance from a peer
+func DeletePVCFault(opts *k8s.KubectlOptions, pvcName string) ChaosFault {
+	return func(t *testing.T) (func(t *testing.T) error, error) {
+		if err := k8s.RunKubectlE(t, opts, "delete", "pvc", pvcName, "--wait=false"); err != nil {
+			return nil, err
+		}
+		// CNPG names instance pods after their PVC
+		return nil, k8s.RunKubectlE(t, opts, "delete", "pod", pvcName, "--ignore-not-found=true")
+	}
+}
+
+// failoverTimeout bounds how long TriggerFailover waits for a replica to be promoted
+const failoverTimeout = 5 * time.Minute
+
+// waitForPrimaryChange polls getStatus until a primary other than oldPrimary has been promoted,
+// i.e. currentPrimary moved and matches targetPrimary, and returns it
+func waitForPrimaryChange(getStatus func() (ClusterStatus, error), oldPrimary string, timeout, interval time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	var last ClusterStatus
+	for {
+		status, err := getStatus()
+		if err != nil {
+			return "", err
+		}
+		last = status
+		if status.CurrentPrimary != "" && status.CurrentPrimary != oldPrimary && status.CurrentPrimary == status.TargetPrimary {
+			return status.CurrentPrimary, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("no new primary after %s (current %q, target %q)", timeout, last.CurrentPrimary, last.TargetPrimary)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// TriggerFailover force deletes the current primary pod of a CNPG cluster and waits until the
+// operator has promoted another instance
+func TriggerFailover(t *testing.T, opts *k8s.KubectlOptions, clusterName string) (oldPrimary, newPrimary string, err error) {
+	t.Helper()
+
+	oldPrimary, err = primaryPodName(t, opts, clusterName)
+	if err != nil {
+		return "", "", err
+	}
+
+	t.Logf("Deleting primary %s of cluster %s", oldPrimary, clusterName)
+	if _, err := DeletePodFault(opts, oldPrimary)(t); err != nil {
+		return oldPrimary, "", fmt.Errorf("failed to delete primary %s: %w", oldPrimary, err)
+	}
+
+	newPrimary, err = waitForPrimaryChange(func() (ClusterStatus, error) {
+		return GetClusterStatus(t, opts, clusterName)
+	}, oldPrimary, failoverTimeout, 2*time.Second)
+	if err != nil {
+		return oldPrimary, "", fmt.Errorf("failover of cluster %s did not complete: %w", clusterName, err)
+	}
+
+	t.Logf("Cluster %s failed over from %s to %s", clusterName, oldPrimary, newPrimary)
+	return oldPrimary, newPrimary, nil
+}
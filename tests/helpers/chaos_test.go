@@ -0,0 +1,142 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestChaosRun(t *testing.T) {
+	var events []string
+	record := func(event string) { events = append(events, event) }
+
+	attempts := 0
+	scenario := ChaosScenario{
+		Name:            "drain-then-delete",
+		RecoveryTimeout: 100 * time.Millisecond,
+		Steps: []ChaosStep{
+			{
+				Name: "drain",
+				Fault: func(t *testing.T) (func(t *testing.T) error, error) {
+					record("inject drain")
+					return func(t *testing.T) error { record("heal drain"); return nil }, nil
+				},
+				Assert: func(t *testing.T) error {
+					attempts++
+					record("assert drain")
+					if attempts < 3 {
+						return errors.New("not converged")
+					}
+					return nil
+				},
+			},
+			{
+				Name:             "partition",
+				HealBeforeAssert: true,
+				Fault: func(t *testing.T) (func(t *testing.T) error, error) {
+					record("inject partition")
+					return func(t *testing.T) error { record("heal partition"); return nil }, nil
+				},
+				Assert: func(t *testing.T) error {
+					record("assert partition")
+					return nil
+				},
+			},
+		},
+	}
+
+	chaos := &Chaos{recoveryInterval: time.Millisecond}
+	t.Run("scenario", func(t *testing.T) {
+		chaos.Run(t, scenario)
+	})
+
+	require.Equal(t, []string{
+		"inject drain",
+		"assert drain", "assert drain", "assert drain",
+		"inject partition",
+		"heal partition",
+		"assert partition",
+		"heal drain",
+	}, events)
+}
+
+func TestWaitForPrimaryChange(t *testing.T) {
+	sequence := func(statuses ...ClusterStatus) func() (ClusterStatus, error) {
+		i := 0
+		return func() (ClusterStatus, error) {
+			status := statuses[min(i, len(statuses)-1)]
+			i++
+			return status, nil
+		}
+	}
+
+	newPrimary, err := waitForPrimaryChange(sequence(
+		ClusterStatus{CurrentPrimary: "pg-1", TargetPrimary: "pg-1"},
+		ClusterStatus{CurrentPrimary: "pg-1", TargetPrimary: "pg-2"},
+		ClusterStatus{CurrentPrimary: "pg-2", TargetPrimary: "pg-2"},
+	), "pg-1", time.Second, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, "pg-2", newPrimary)
+
+	_, err = waitForPrimaryChange(sequence(
+		ClusterStatus{CurrentPrimary: "pg-1", TargetPrimary: "pg-2"},
+	), "pg-1", 10*time.Millisecond, time.Millisecond)
+	require.EqualError(t, err, `no new primary after 10ms (current "pg-1", target "pg-2")`)
+
+	_, err = waitForPrimaryChange(func() (ClusterStatus, error) {
+		return ClusterStatus{}, errors.New("cluster not found")
+	}, "pg-1", time.Second, time.Millisecond)
+	require.EqualError(t, err, "cluster not found")
+}
+
+func TestSwitchoverTarget(t *testing.T) {
+	pod := func(name, node string) corev1.Pod {
+		return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: corev1.PodSpec{NodeName: node}}
+	}
+	pods := []corev1.Pod{pod("pg-1", "worker"), pod("pg-3", "worker3"), pod("pg-2", "worker")}
+
+	target, err := switchoverTarget(pods, "pg-1", "worker")
+	require.NoError(t, err)
+	require.Equal(t, "pg-3", target)
+
+	_, err = switchoverTarget(pods[:1], "pg-1", "worker")
+	require.ErrorContains(t, err, "no replica of pg-1 runs outside node worker")
+}
+
+func TestCheckPrimaryReplaced(t *testing.T) {
+	ctx := context.Background()
+	cluster := func(primary, phase string) *unstructured.Unstructured {
+		u := newCNPGCluster("default", "pg")
+		u.Object["spec"] = map[string]interface{}{"instances": int64(2)}
+		u.Object["status"] = map[string]interface{}{
+			"currentPrimary": primary, "targetPrimary": primary, "phase": phase, "readyInstances": int64(2),
+		}
+		return u
+	}
+	pod := func(uid string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pg-1", Namespace: "default", UID: types.UID(uid)}}
+	}
+	old := InstancePod{Name: "pg-1", UID: "a"}
+
+	err := checkPrimaryReplaced(ctx, fake.NewClientset(pod("a")), newFakeDynamicClient(cluster("pg-1", clusterHealthyPhase)), "default", "pg", old)
+	require.ErrorContains(t, err, "still has primary pg-1")
+
+	err = checkPrimaryReplaced(ctx, fake.NewClientset(), newFakeDynamicClient(cluster("pg-2", clusterHealthyPhase)), "default", "pg", old)
+	require.ErrorContains(t, err, "has not been recreated")
+
+	err = checkPrimaryReplaced(ctx, fake.NewClientset(pod("a")), newFakeDynamicClient(cluster("pg-2", clusterHealthyPhase)), "default", "pg", old)
+	require.ErrorContains(t, err, "still the original pod")
+
+	err = checkPrimaryReplaced(ctx, fake.NewClientset(pod("b")), newFakeDynamicClient(cluster("pg-2", "Failing over")), "default", "pg", old)
+	require.ErrorContains(t, err, `phase "Failing over"`)
+
+	require.NoError(t, checkPrimaryReplaced(ctx, fake.NewClientset(pod("b")), newFakeDynamicClient(cluster("pg-2", clusterHealthyPhase)), "default", "pg", old))
+}
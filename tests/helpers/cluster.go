@@ -0,0 +1,824 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// pgedgeClusterNamePattern matches the CNPG Cluster names created for each pgEdge node
+var pgedgeClusterNamePattern = regexp.MustCompile(`^pgedge-\d+$`)
+
+// listClusterNames returns the names of the CNPG Clusters in namespace, sorted
+func listClusterNames(ctx context.Context, dynClient dynamic.Interface, namespace string) ([]string, error) {
+	clusters, err := dynClient.Resource(clusterGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CNPG clusters in %s: %w", namespace, err)
+	}
+
+	names := make([]string, 0, len(clusters.Items))
+	for _, c := range clusters.Items {
+		names = append(names, c.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// checkClusterCount verifies there are exactly expected clusters, all named pgedge-N
+func checkClusterCount(names []string, expected int) error {
+	if len(names) != expected {
+		return fmt.Errorf("expected %d CNPG clusters, found %d: %v", expected, len(names), names)
+	}
+	for _, name := range names {
+		if !pgedgeClusterNamePattern.MatchString(name) {
+			return fmt.Errorf("CNPG cluster %q does not follow the pgedge-N naming convention", name)
+		}
+	}
+	return nil
+}
+
+// AssertClusterCount checks that namespace contains exactly expected CNPG Clusters,
+// one per pgEdge node, named pgedge-N
+func AssertClusterCount(t *testing.T, opts *k8s.KubectlOptions, namespace string, expected int) {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+
+	names, err := listClusterNames(context.Background(), dynClient, namespace)
+	require.NoError(t, err)
+	require.NoError(t, checkClusterCount(names, expected))
+}
+
+// checkPVCStorageClass verifies every PVC of a CNPG cluster uses expectedClass
+func checkPVCStorageClass(ctx context.Context, clientset kubernetes.Interface, namespace, clusterName, expectedClass string) error {
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "cnpg.io/cluster=" + clusterName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list PVCs for cluster %s: %w", clusterName, err)
+	}
+	if len(pvcs.Items) == 0 {
+		return fmt.Errorf("no PVCs found for cluster %s in %s", clusterName, namespace)
+	}
+
+	var mismatched []string
+	for _, pvc := range pvcs.Items {
+		class := "<default>"
+		if pvc.Spec.StorageClassName != nil {
+			class = *pvc.Spec.StorageClassName
+		}
+		if class != expectedClass {
+			mismatched = append(mismatched, fmt.Sprintf("%s uses %s", pvc.Name, class))
+		}
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("PVCs of cluster %s do not use storage class %s: %s",
+			clusterName, expectedClass, strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+// AssertPVCStorageClass checks that every PVC of the CNPG cluster uses expectedClass
+func AssertPVCStorageClass(t *testing.T, opts *k8s.KubectlOptions, clusterName, expectedClass string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	err = checkPVCStorageClass(context.Background(), clientset, opts.Namespace, clusterName, expectedClass)
+	require.NoError(t, err)
+}
+
+// clusterServiceSuffixes are the services CNPG creates for every Cluster
+var clusterServiceSuffixes = []string{"-rw", "-ro", "-r"}
+
+// exposesTCPPort reports whether port is exposed over TCP, the default protocol
+func exposesTCPPort(port int32, protocol corev1.Protocol, expected int) bool {
+	return int(port) == expected && (protocol == "" || protocol == corev1.ProtocolTCP)
+}
+
+// checkClusterServicePort verifies the services and instance pods of a CNPG cluster expose
+// expectedPort over TCP
+func checkClusterServicePort(ctx context.Context, clientset kubernetes.Interface, namespace, clusterName string, expectedPort int) error {
+	var problems []string
+
+	for _, suffix := range clusterServiceSuffixes {
+		name := clusterName + suffix
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("service %s: %v", name, err))
+			continue
+		}
+		found := false
+		var ports []string
+		for _, p := range svc.Spec.Ports {
+			found = found || exposesTCPPort(p.Port, p.Protocol, expectedPort)
+			ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("service %s exposes %v, not %d/TCP", name, ports, expectedPort))
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "cnpg.io/cluster=" + clusterName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods of cluster %s: %w", clusterName, err)
+	}
+	for _, pod := range pods.Items {
+		for _, c := range pod.Spec.Containers {
+			if c.Name != postgresContainerName {
+				continue
+			}
+			found := false
+			for _, p := range c.Ports {
+				found = found || exposesTCPPort(p.ContainerPort, p.Protocol, expectedPort)
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("pod %s does not expose container port %d/TCP", pod.Name, expectedPort))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("cluster %s does not expose port %d:\n%s", clusterName, expectedPort, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// AssertClusterServicePort checks that the -rw, -ro and -r services of a CNPG cluster and its
+// instance pods expose expectedPort (normally 5432) over TCP
+func AssertClusterServicePort(t *testing.T, opts *k8s.KubectlOptions, clusterName string, expectedPort int) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	require.NoError(t, checkClusterServicePort(context.Background(), clientset, opts.Namespace, clusterName, expectedPort))
+}
+
+// clusterHealthyPhase is the status.phase of a CNPG Cluster with all instances running
+const clusterHealthyPhase = "Cluster in healthy state"
+
+// terminalClusterPhases are phases a CNPG Cluster does not leave without manual intervention,
+// so there is no point in waiting for it to become healthy
+var terminalClusterPhases = []string{
+	"Cluster in failed state",
+	"Cluster is unrecoverable and needs manual intervention",
+}
+
+// ClusterStatus is the state of a CNPG Cluster: its phase, instance counts and primaries
+type ClusterStatus struct {
+	Phase          string
+	Instances      int
+	ReadyInstances int
+	// CurrentPrimary is the instance serving as primary, TargetPrimary the one the operator is
+	// promoting. They differ while a switchover or failover is in progress.
+	CurrentPrimary string
+	TargetPrimary  string
+}
+
+// getClusterStatus returns the phase, instance counts and primaries of a CNPG Cluster
+func getClusterStatus(ctx context.Context, dynClient dynamic.Interface, namespace, name string) (ClusterStatus, error) {
+	cluster, err := dynClient.Resource(clusterGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return ClusterStatus{}, fmt.Errorf("failed to get CNPG cluster %s/%s: %w", namespace, name, err)
+	}
+
+	var status ClusterStatus
+	status.Phase, _, _ = unstructured.NestedString(cluster.Object, "status", "phase")
+	instances, _, _ := unstructured.NestedInt64(cluster.Object, "spec", "instances")
+	readyInstances, _, _ := unstructured.NestedInt64(cluster.Object, "status", "readyInstances")
+	status.Instances, status.ReadyInstances = int(instances), int(readyInstances)
+	status.CurrentPrimary, _, _ = unstructured.NestedString(cluster.Object, "status", "currentPrimary")
+	status.TargetPrimary, _, _ = unstructured.NestedString(cluster.Object, "status", "targetPrimary")
+	return status, nil
+}
+
+// GetClusterStatus returns the phase, instance counts and primaries of a CNPG Cluster
+func GetClusterStatus(t *testing.T, opts *k8s.KubectlOptions, name string) (ClusterStatus, error) {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return ClusterStatus{}, err
+	}
+	return getClusterStatus(context.Background(), dynClient, opts.Namespace, name)
+}
+
+// checkClusterHealthy returns an error unless the cluster is healthy with every instance ready.
+// Terminal phases are wrapped in retry.FatalError to stop waiting.
+func checkClusterHealthy(name string, status ClusterStatus) error {
+	for _, phase := range terminalClusterPhases {
+		if status.Phase == phase {
+			return retry.FatalError{Underlying: fmt.Errorf("cluster %s is in terminal phase %q", name, status.Phase)}
+		}
+	}
+	if status.Phase != clusterHealthyPhase {
+		return fmt.Errorf("cluster %s is in phase %q", name, status.Phase)
+	}
+	if status.ReadyInstances != status.Instances {
+		return fmt.Errorf("cluster %s has %d of %d instances ready", name, status.ReadyInstances, status.Instances)
+	}
+	return nil
+}
+
+// WaitForClusterHealthy waits until the CNPG Cluster reports a healthy phase with all of its
+// instances ready. On failure the error includes the last observed phase.
+func WaitForClusterHealthy(t *testing.T, opts *k8s.KubectlOptions, clusterName string, timeout time.Duration) error {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	var last ClusterStatus
+	maxRetries := int(timeout.Seconds() / 5)
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for cluster %s healthy", clusterName), maxRetries, 5*time.Second, func() (string, error) {
+		status, err := getClusterStatus(context.Background(), dynClient, opts.Namespace, clusterName)
+		if err != nil {
+			return "", err
+		}
+		last = status
+		return status.Phase, checkClusterHealthy(clusterName, status)
+	})
+	if err != nil {
+		return fmt.Errorf("cluster %s not healthy (last phase %q, %d/%d instances ready): %w",
+			clusterName, last.Phase, last.ReadyInstances, last.Instances, err)
+	}
+	return nil
+}
+
+// bootstrapTimeout bounds how long a new cluster may take to bring up its primary
+const bootstrapTimeout = 10 * time.Minute
+
+// countReadyEndpoints returns the number of ready endpoints behind a service. Endpoints with an
+// unknown ready condition count as ready, as they do for kube-proxy.
+func countReadyEndpoints(ctx context.Context, clientset kubernetes.Interface, namespace, service string) (int, error) {
+	slices, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + service,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list endpoints of service %s: %w", service, err)
+	}
+
+	ready := 0
+	for _, slice := range slices.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready == nil || *ep.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready, nil
+}
+
+// checkNotServingBeforeBootstrap reports whether an instance pod of the cluster is ready and
+// returns an error if the -rw service has ready endpoints while none is. Endpoints are read
+// before pods, so an instance turning ready in between is not reported.
+func checkNotServingBeforeBootstrap(ctx context.Context, clientset kubernetes.Interface, namespace, clusterName string) (bootstrapped bool, err error) {
+	service := clusterName + "-rw"
+	ready, err := countReadyEndpoints(ctx, clientset, namespace, service)
+	if err != nil {
+		return false, err
+	}
+	pods, err := listInstancePods(ctx, clientset, namespace, clusterName)
+	if err != nil {
+		return false, err
+	}
+	for i := range pods {
+		if isPodReady(&pods[i]) {
+			return true, nil
+		}
+	}
+	if ready > 0 {
+		return false, fmt.Errorf("service %s has %d ready endpoints before any instance of cluster %s is ready", service, ready, clusterName)
+	}
+	return false, nil
+}
+
+// AssertNotReadyBeforeBootstrap checks that the -rw service of a freshly applied cluster has no
+// ready endpoints until its primary is ready, then waits for the cluster to become healthy and
+// checks the service is served. Call it right after applying the Cluster, so helpers connecting
+// after WaitForClusterHealthy can rely on readiness gating.
+func AssertNotReadyBeforeBootstrap(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	deadline := time.Now().Add(bootstrapTimeout)
+	for {
+		bootstrapped, err := checkNotServingBeforeBootstrap(ctx, clientset, opts.Namespace, clusterName)
+		require.NoError(t, err)
+		if bootstrapped {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "Cluster %s did not bootstrap within %s", clusterName, bootstrapTimeout)
+		time.Sleep(2 * time.Second)
+	}
+
+	require.NoError(t, WaitForClusterHealthy(t, opts, clusterName, bootstrapTimeout))
+	ready, err := countReadyEndpoints(ctx, clientset, opts.Namespace, clusterName+"-rw")
+	require.NoError(t, err)
+	require.Positive(t, ready, "Service %s-rw has no ready endpoints after bootstrap", clusterName)
+}
+
+const (
+	// unhealthyRecoveryTimeout bounds how long the operator may take to heal a cluster
+	unhealthyRecoveryTimeout = 10 * time.Minute
+	// unhealthyGracePeriod is how long to wait for an induced fault to show up in the phase
+	unhealthyGracePeriod = time.Minute
+)
+
+// trackRecovery waits up to grace for the cluster to leave the healthy phase and then up to
+// timeout for it to be healthy again with every instance ready. It returns the distinct phases
+// observed, in order.
+func trackRecovery(t *testing.T, clusterName string, getStatus func() (ClusterStatus, error), timeout, grace, interval time.Duration) ([]string, error) {
+	var phases []string
+	observe := func() (ClusterStatus, error) {
+		status, err := getStatus()
+		if err == nil && (len(phases) == 0 || phases[len(phases)-1] != status.Phase) {
+			phases = append(phases, status.Phase)
+		}
+		return status, err
+	}
+
+	_, err := retry.DoWithRetryE(t, fmt.Sprintf("Wait for cluster %s to leave %q", clusterName, clusterHealthyPhase),
+		max(int(grace/interval), 1), interval, func() (string, error) {
+			status, err := observe()
+			if err != nil {
+				return "", err
+			}
+			if status.Phase == clusterHealthyPhase {
+				return "", fmt.Errorf("cluster %s is still %q", clusterName, status.Phase)
+			}
+			return status.Phase, nil
+		})
+	if err != nil {
+		return phases, fmt.Errorf("cluster %s never left %q within %s: %w", clusterName, clusterHealthyPhase, grace, err)
+	}
+
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for cluster %s to recover", clusterName),
+		max(int(timeout/interval), 1), interval, func() (string, error) {
+			status, err := observe()
+			if err != nil {
+				return "", err
+			}
+			return status.Phase, checkClusterHealthy(clusterName, status)
+		})
+	if err != nil {
+		return phases, fmt.Errorf("cluster %s did not recover within %s: %w", clusterName, timeout, err)
+	}
+	return phases, nil
+}
+
+// AssertClusterRecoversFromUnhealthy runs induce to break the cluster and checks the cluster
+// leaves the healthy phase within unhealthyGracePeriod and the operator drives it back to healthy
+// within unhealthyRecoveryTimeout. The phases the cluster went through are logged.
+func AssertClusterRecoversFromUnhealthy(t *testing.T, opts *k8s.KubectlOptions, clusterName string, induce func()) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping unhealthy cluster recovery in short mode")
+	}
+
+	status, err := GetClusterStatus(t, opts, clusterName)
+	require.NoError(t, err)
+	require.NoError(t, checkClusterHealthy(clusterName, status), "Cluster %s must be healthy before inducing a fault", clusterName)
+
+	induce()
+
+	phases, err := trackRecovery(t, clusterName, func() (ClusterStatus, error) {
+		return GetClusterStatus(t, opts, clusterName)
+	}, unhealthyRecoveryTimeout, unhealthyGracePeriod, 2*time.Second)
+	t.Logf("Cluster %s phases: %s", clusterName, strings.Join(phases, " -> "))
+	require.NoError(t, err)
+}
+
+// ClusterSpec describes a CNPG Cluster for tests to create
+type ClusterSpec struct {
+	Name      string
+	Instances int
+	// StorageSize defaults to 1Gi
+	StorageSize string
+	// WALStorageSize puts the WAL on a separate PVC of this size when set
+	WALStorageSize string
+	// ImageName is left to the operator default when empty
+	ImageName string
+	// ImagePullPolicy is left to the operator default (IfNotPresent) when empty
+	ImagePullPolicy corev1.PullPolicy
+	// Zones pins instances to nodes in these topology.kubernetes.io/zone values and spreads them
+	// across zones when set
+	Zones []string
+}
+
+// Manifest renders the Cluster as YAML
+func (s ClusterSpec) Manifest() string {
+	storageSize := s.StorageSize
+	if storageSize == "" {
+		storageSize = "1Gi"
+	}
+	instances := s.Instances
+	if instances == 0 {
+		instances = 1
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: %s
+spec:
+  instances: %d
+`, s.Name, instances)
+	if s.ImageName != "" {
+		fmt.Fprintf(&b, "  imageName: %s\n", s.ImageName)
+	}
+	if s.ImagePullPolicy != "" {
+		fmt.Fprintf(&b, "  imagePullPolicy: %s\n", s.ImagePullPolicy)
+	}
+	fmt.Fprintf(&b, "  storage:\n    size: %s\n", storageSize)
+	if s.WALStorageSize != "" {
+		fmt.Fprintf(&b, "  walStorage:\n    size: %s\n", s.WALStorageSize)
+	}
+	if len(s.Zones) > 0 {
+		fmt.Fprintf(&b, `  affinity:
+    topologyKey: %s
+    nodeAffinity:
+      requiredDuringSchedulingIgnoredDuringExecution:
+        nodeSelectorTerms:
+        - matchExpressions:
+          - key: %s
+            operator: In
+            values: ["%s"]
+`, corev1.LabelTopologyZone, corev1.LabelTopologyZone, strings.Join(s.Zones, `", "`))
+	}
+	return b.String()
+}
+
+const (
+	// walVolumeName and walMountPath are where CNPG mounts a separate WAL PVC in instance pods
+	walVolumeName = "pg-wal"
+	walMountPath  = "/var/lib/postgresql/wal"
+	// pgWALLink is the pg_wal directory of PGDATA, a symlink into walMountPath with walStorage
+	pgWALLink = "/var/lib/postgresql/data/pgdata/pg_wal"
+)
+
+// checkWALVolumes verifies each instance pod mounts its own WAL PVC, distinct from its data
+// PVC, at walMountPath and that the PVC requests walSize
+func checkWALVolumes(ctx context.Context, clientset kubernetes.Interface, pods []corev1.Pod, walSize resource.Quantity) error {
+	if len(pods) == 0 {
+		return fmt.Errorf("no instance pods found")
+	}
+
+	var errs []error
+	for _, pod := range pods {
+		claims := make(map[string]string)
+		for _, v := range pod.Spec.Volumes {
+			if v.PersistentVolumeClaim != nil {
+				claims[v.Name] = v.PersistentVolumeClaim.ClaimName
+			}
+		}
+		walClaim, ok := claims[walVolumeName]
+		if !ok {
+			errs = append(errs, fmt.Errorf("pod %s has no %s volume", pod.Name, walVolumeName))
+			continue
+		}
+		for name, claim := range claims {
+			if name != walVolumeName && claim == walClaim {
+				errs = append(errs, fmt.Errorf("pod %s uses PVC %s for both %s and %s", pod.Name, claim, walVolumeName, name))
+			}
+		}
+
+		mounted := false
+		for _, c := range pod.Spec.Containers {
+			if c.Name != postgresContainerName {
+				continue
+			}
+			for _, m := range c.VolumeMounts {
+				if m.Name == walVolumeName && m.MountPath == walMountPath {
+					mounted = true
+				}
+			}
+		}
+		if !mounted {
+			errs = append(errs, fmt.Errorf("pod %s does not mount %s at %s", pod.Name, walVolumeName, walMountPath))
+		}
+
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, walClaim, metav1.GetOptions{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get WAL PVC %s of pod %s: %w", walClaim, pod.Name, err))
+			continue
+		}
+		if requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; requested.Cmp(walSize) != 0 {
+			errs = append(errs, fmt.Errorf("WAL PVC %s requests %s, expected %s", walClaim, requested.String(), walSize.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AssertWALVolumeSeparate checks that a cluster configured with walStorage gives every instance
+// a WAL PVC of the configured size, separate from its data PVC, and that PostgreSQL writes WAL to
+// it. The test is skipped for clusters without walStorage.
+func AssertWALVolumeSeparate(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	cluster, err := dynClient.Resource(clusterGVR).Namespace(opts.Namespace).Get(ctx, clusterName, metav1.GetOptions{})
+	require.NoError(t, err, "Failed to get cluster %s", clusterName)
+	size, found, _ := unstructured.NestedString(cluster.Object, "spec", "walStorage", "size")
+	if !found {
+		t.Skipf("Cluster %s has no walStorage", clusterName)
+	}
+	walSize, err := resource.ParseQuantity(size)
+	require.NoError(t, err, "Invalid walStorage size %q", size)
+
+	pods, err := listInstancePods(ctx, clientset, opts.Namespace, clusterName)
+	require.NoError(t, err)
+	require.NoError(t, checkWALVolumes(ctx, clientset, pods, walSize))
+
+	for _, pod := range pods {
+		output, err := k8s.RunKubectlAndGetOutputE(t, opts, "exec", pod.Name, "-c", postgresContainerName, "--",
+			"sh", "-c", fmt.Sprintf("grep -q ' %s ' /proc/mounts && readlink %s", walMountPath, pgWALLink))
+		require.NoError(t, err, "%s is not a separate mount in pod %s: %s", walMountPath, pod.Name, output)
+		require.Equal(t, walMountPath+"/pg_wal", strings.TrimSpace(output), "pg_wal of pod %s does not point at the WAL volume", pod.Name)
+	}
+}
+
+// instanceRestarts returns the container restart count of every instance pod, keyed by pod name
+func instanceRestarts(pods []corev1.Pod) map[string]int32 {
+	restarts := make(map[string]int32, len(pods))
+	for _, pod := range pods {
+		var count int32
+		for _, status := range pod.Status.ContainerStatuses {
+			count += status.RestartCount
+		}
+		restarts[pod.Name] = count
+	}
+	return restarts
+}
+
+// checkNoNewRestarts compares instance restart counts against an earlier snapshot. Pods missing
+// from before were created since, e.g. by a rolling update, and must not have restarted at all.
+func checkNoNewRestarts(before, after map[string]int32) error {
+	var names []string
+	for name := range after {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		if after[name] > before[name] {
+			problems = append(problems, fmt.Sprintf("%s restarted %d times", name, after[name]-before[name]))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("instance containers restarted: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// GetInstanceRestarts returns the container restart count of every instance pod of a CNPG cluster
+func GetInstanceRestarts(t *testing.T, opts *k8s.KubectlOptions, clusterName string) (map[string]int32, error) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := listInstancePods(context.Background(), clientset, opts.Namespace, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return instanceRestarts(pods), nil
+}
+
+// AssertNoNewRestarts checks that no instance container of a CNPG cluster restarted since before
+// was taken with GetInstanceRestarts. Pods replaced in the meantime are fine as long as their
+// containers have not restarted.
+func AssertNoNewRestarts(t *testing.T, opts *k8s.KubectlOptions, clusterName string, before map[string]int32) {
+	t.Helper()
+
+	after, err := GetInstanceRestarts(t, opts, clusterName)
+	require.NoError(t, err)
+	require.NoError(t, checkNoNewRestarts(before, after))
+}
+
+// bootstrapControllerContainer is the init container that copies the operator's instance manager
+// into an instance pod
+const bootstrapControllerContainer = "bootstrap-controller"
+
+// checkInstanceManagerRolledOut returns an error unless instances ready pods run the instance
+// manager from operatorImage
+func checkInstanceManagerRolledOut(pods []corev1.Pod, operatorImage string, instances int) error {
+	var stale []string
+	ready := 0
+	for i, pod := range pods {
+		image := ""
+		for _, c := range pod.Spec.InitContainers {
+			if c.Name == bootstrapControllerContainer {
+				image = c.Image
+			}
+		}
+		if image != operatorImage {
+			stale = append(stale, fmt.Sprintf("%s runs %q", pod.Name, image))
+			continue
+		}
+		if isPodReady(&pods[i]) && pod.DeletionTimestamp == nil {
+			ready++
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		return fmt.Errorf("instance manager not rolled out to %s: %s", operatorImage, strings.Join(stale, ", "))
+	}
+	if ready != instances {
+		return fmt.Errorf("%d of %d instances run %s and are ready", ready, instances, operatorImage)
+	}
+	return nil
+}
+
+// WaitForInstanceManagerRollout waits until every instance of clusterName runs the instance
+// manager from operatorImage and is ready, i.e. the operator has finished rolling out after an
+// upgrade
+func WaitForInstanceManagerRollout(t *testing.T, opts *k8s.KubectlOptions, clusterName, operatorImage string, timeout time.Duration) error {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for instance manager rollout of %s", clusterName), int(timeout/(5*time.Second)), 5*time.Second, func() (string, error) {
+		status, err := getClusterStatus(context.Background(), dynClient, opts.Namespace, clusterName)
+		if err != nil {
+			return "", err
+		}
+		pods, err := listInstancePods(context.Background(), clientset, opts.Namespace, clusterName)
+		if err != nil {
+			return "", err
+		}
+		return "", checkInstanceManagerRolledOut(pods, operatorImage, status.Instances)
+	})
+	return err
+}
+
+// instancePods returns the identity of every instance pod
+func instancePods(pods []corev1.Pod) []InstancePod {
+	ids := make([]InstancePod, 0, len(pods))
+	for _, pod := range pods {
+		ids = append(ids, InstancePod{Name: pod.Name, UID: pod.UID})
+	}
+	return ids
+}
+
+// GetInstancePods returns the identity of every instance pod of a CNPG cluster
+func GetInstancePods(t *testing.T, opts *k8s.KubectlOptions, clusterName string) ([]InstancePod, error) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := listInstancePods(context.Background(), clientset, opts.Namespace, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return instancePods(pods), nil
+}
+
+// checkInstancesReplaced returns an error naming the pods of before that are still running
+func checkInstancesReplaced(before, after []InstancePod) error {
+	var kept []string
+	for _, pod := range after {
+		if slices.Contains(before, pod) {
+			kept = append(kept, pod.Name)
+		}
+	}
+	if len(kept) > 0 {
+		sort.Strings(kept)
+		return fmt.Errorf("instances were not recreated: %s", strings.Join(kept, ", "))
+	}
+	return nil
+}
+
+// AssertInstancesReplaced checks that every instance pod of a CNPG cluster has been recreated
+// since before was taken with GetInstancePods
+func AssertInstancesReplaced(t *testing.T, opts *k8s.KubectlOptions, clusterName string, before []InstancePod) {
+	t.Helper()
+
+	after, err := GetInstancePods(t, opts, clusterName)
+	require.NoError(t, err)
+	require.NoError(t, checkInstancesReplaced(before, after))
+}
+
+// checkImagePullPolicy verifies the postgres container of every instance pod of clusterName uses
+// the expected pull policy
+func checkImagePullPolicy(ctx context.Context, clientset kubernetes.Interface, namespace, clusterName string, expected corev1.PullPolicy) error {
+	pods, err := listInstancePods(ctx, clientset, namespace, clusterName)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("cluster %s has no instance pods", clusterName)
+	}
+
+	var problems []string
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == postgresContainerName && c.ImagePullPolicy != expected {
+				problems = append(problems, fmt.Sprintf("pod %s pulls with %s", pod.Name, c.ImagePullPolicy))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("cluster %s does not use imagePullPolicy %s:\n%s", clusterName, expected, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// AssertImagePullPolicy checks that the instance pods of clusterName run PostgreSQL with the
+// expected imagePullPolicy
+func AssertImagePullPolicy(t *testing.T, opts *k8s.KubectlOptions, clusterName string, expected corev1.PullPolicy) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	require.NoError(t, checkImagePullPolicy(context.Background(), clientset, opts.Namespace, clusterName, expected))
+}
+
+// postgresContainerFieldPath is the involvedObject.fieldPath of kubelet events about the postgres
+// container of an instance pod
+var postgresContainerFieldPath = fmt.Sprintf("spec.containers{%s}", postgresContainerName)
+
+// checkNoImagePull returns an error naming the pods whose postgres image the kubelet pulled,
+// according to its Pulling events
+func checkNoImagePull(events []corev1.Event, pods []corev1.Pod) error {
+	instances := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		instances[pod.Name] = true
+	}
+
+	var pulled []string
+	for _, e := range events {
+		if e.Reason == "Pulling" && e.InvolvedObject.Kind == "Pod" && instances[e.InvolvedObject.Name] &&
+			e.InvolvedObject.FieldPath == postgresContainerFieldPath {
+			pulled = append(pulled, fmt.Sprintf("%s: %s", e.InvolvedObject.Name, e.Message))
+		}
+	}
+	if len(pulled) > 0 {
+		return fmt.Errorf("the postgres image was pulled:\n%s", strings.Join(pulled, "\n"))
+	}
+	return nil
+}
+
+// AssertImageNotPulled checks that the kubelet reported no Pulling event for the postgres
+// container of any instance pod of clusterName. With imagePullPolicy IfNotPresent and the image
+// already on the nodes, e.g. loaded into Kind with kind load, the cached image must be used.
+// Events expire (after an hour by default), so call it soon after the pods were created.
+func AssertImageNotPulled(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	pods, err := listInstancePods(ctx, clientset, opts.Namespace, clusterName)
+	require.NoError(t, err)
+	require.NotEmpty(t, pods, "Cluster %s has no instance pods", clusterName)
+	events, err := getEvents(ctx, clientset, opts.Namespace)
+	require.NoError(t, err)
+	require.NoError(t, checkNoImagePull(events, pods))
+}
@@ -0,0 +1,424 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckClusterCount(t *testing.T) {
+	dynClient := newFakeDynamicClient(
+		newCNPGCluster("pgedge", "pgedge-1"),
+		newCNPGCluster("pgedge", "pgedge-2"),
+		newCNPGCluster("pgedge", "pgedge-3"),
+		newCNPGCluster("other", "pgedge-1"),
+	)
+
+	names, err := listClusterNames(context.Background(), dynClient, "pgedge")
+	require.NoError(t, err)
+	require.Equal(t, []string{"pgedge-1", "pgedge-2", "pgedge-3"}, names)
+
+	require.NoError(t, checkClusterCount(names, 3))
+
+	err = checkClusterCount(names, 2)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected 2 CNPG clusters, found 3")
+
+	err = checkClusterCount([]string{"pgedge-1", "stray"}, 2)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "stray")
+}
+
+// newClusterPVC returns a PVC labelled as belonging to a CNPG cluster
+func newClusterPVC(namespace, name, cluster string, storageClass *string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"cnpg.io/cluster": cluster},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: storageClass},
+	}
+}
+
+func TestCheckPVCStorageClass(t *testing.T) {
+	hostpath := "csi-hostpath-sc"
+	standard := "standard"
+	clientset := fake.NewClientset(
+		newClusterPVC("default", "good-1", "good", &hostpath),
+		newClusterPVC("default", "good-2", "good", &hostpath),
+		newClusterPVC("default", "mixed-1", "mixed", &hostpath),
+		newClusterPVC("default", "mixed-2", "mixed", &standard),
+		newClusterPVC("default", "unset-1", "unset", nil),
+	)
+	ctx := context.Background()
+
+	require.NoError(t, checkPVCStorageClass(ctx, clientset, "default", "good", hostpath))
+
+	err := checkPVCStorageClass(ctx, clientset, "default", "mixed", hostpath)
+	require.ErrorContains(t, err, "mixed-2 uses standard")
+	require.NotContains(t, err.Error(), "mixed-1")
+
+	err = checkPVCStorageClass(ctx, clientset, "default", "unset", hostpath)
+	require.ErrorContains(t, err, "unset-1 uses <default>")
+
+	err = checkPVCStorageClass(ctx, clientset, "default", "missing", hostpath)
+	require.ErrorContains(t, err, "no PVCs found")
+}
+
+func TestGetClusterStatusPhase(t *testing.T) {
+	healthy := newCNPGCluster("default", "healthy")
+	require.NoError(t, unstructured.SetNestedField(healthy.Object, clusterHealthyPhase, "status", "phase"))
+	dynClient := newFakeDynamicClient(healthy, newCNPGCluster("default", "new"))
+	ctx := context.Background()
+
+	status, err := getClusterStatus(ctx, dynClient, "default", "healthy")
+	require.NoError(t, err)
+	require.Equal(t, clusterHealthyPhase, status.Phase)
+
+	status, err = getClusterStatus(ctx, dynClient, "default", "new")
+	require.NoError(t, err)
+	require.Empty(t, status.Phase)
+
+	_, err = getClusterStatus(ctx, dynClient, "default", "missing")
+	require.Error(t, err)
+}
+
+func TestCheckClusterHealthy(t *testing.T) {
+	cluster := newCNPGCluster("default", "pg")
+	require.NoError(t, unstructured.SetNestedField(cluster.Object, int64(3), "spec", "instances"))
+	require.NoError(t, unstructured.SetNestedField(cluster.Object, clusterHealthyPhase, "status", "phase"))
+	require.NoError(t, unstructured.SetNestedField(cluster.Object, int64(2), "status", "readyInstances"))
+	require.NoError(t, unstructured.SetNestedField(cluster.Object, "pg-1", "status", "currentPrimary"))
+	require.NoError(t, unstructured.SetNestedField(cluster.Object, "pg-2", "status", "targetPrimary"))
+
+	status, err := getClusterStatus(context.Background(), newFakeDynamicClient(cluster), "default", "pg")
+	require.NoError(t, err)
+	require.Equal(t, ClusterStatus{
+		Phase:          clusterHealthyPhase,
+		Instances:      3,
+		ReadyInstances: 2,
+		CurrentPrimary: "pg-1",
+		TargetPrimary:  "pg-2",
+	}, status)
+	require.ErrorContains(t, checkClusterHealthy("pg", status), "2 of 3 instances ready")
+
+	status.ReadyInstances = 3
+	require.NoError(t, checkClusterHealthy("pg", status))
+
+	err = checkClusterHealthy("pg", ClusterStatus{Phase: "Creating a new replica", Instances: 3})
+	require.ErrorContains(t, err, `phase "Creating a new replica"`)
+	require.False(t, errors.As(err, &retry.FatalError{}))
+
+	err = checkClusterHealthy("pg", ClusterStatus{Phase: "Cluster in failed state", Instances: 3})
+	require.True(t, errors.As(err, &retry.FatalError{}))
+}
+
+func TestTrackRecovery(t *testing.T) {
+	sequence := func(phases ...string) func() (ClusterStatus, error) {
+		i := 0
+		return func() (ClusterStatus, error) {
+			phase := phases[i]
+			if i < len(phases)-1 {
+				i++
+			}
+			return ClusterStatus{Phase: phase, Instances: 2, ReadyInstances: 2}, nil
+		}
+	}
+
+	phases, err := trackRecovery(t, "pg", sequence(
+		clusterHealthyPhase,
+		"Failing over",
+		"Failing over",
+		"Waiting for the instances to become active",
+		clusterHealthyPhase,
+	), time.Second, time.Second, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		clusterHealthyPhase,
+		"Failing over",
+		"Waiting for the instances to become active",
+		clusterHealthyPhase,
+	}, phases)
+
+	// Never degraded within the grace period
+	phases, err = trackRecovery(t, "pg", sequence(clusterHealthyPhase), time.Second, 10*time.Millisecond, time.Millisecond)
+	require.ErrorContains(t, err, "never left")
+	require.Equal(t, []string{clusterHealthyPhase}, phases)
+
+	// Never recovers
+	_, err = trackRecovery(t, "pg", sequence("Failing over"), 20*time.Millisecond, time.Second, time.Millisecond)
+	require.ErrorContains(t, err, "did not recover")
+}
+
+func TestCheckClusterServicePort(t *testing.T) {
+	service := func(name string, port int32, protocol corev1.Protocol) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "postgres", Port: port, Protocol: protocol}}},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pg-1", Labels: map[string]string{"cnpg.io/cluster": "pg"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "postgres",
+			Ports: []corev1.ContainerPort{{Name: "postgresql", ContainerPort: 5432, Protocol: corev1.ProtocolTCP}},
+		}}},
+	}
+	ctx := context.Background()
+
+	clientset := fake.NewClientset(
+		service("pg-rw", 5432, corev1.ProtocolTCP),
+		service("pg-ro", 5432, corev1.ProtocolTCP),
+		service("pg-r", 5432, ""),
+		pod,
+	)
+	require.NoError(t, checkClusterServicePort(ctx, clientset, "default", "pg", 5432))
+
+	clientset = fake.NewClientset(
+		service("pg-rw", 5433, corev1.ProtocolTCP),
+		service("pg-ro", 5432, corev1.ProtocolUDP),
+		pod,
+	)
+	err := checkClusterServicePort(ctx, clientset, "default", "pg", 5432)
+	require.ErrorContains(t, err, "service pg-rw exposes [5433/TCP], not 5432/TCP")
+	require.ErrorContains(t, err, "service pg-ro exposes [5432/UDP]")
+	require.ErrorContains(t, err, "service pg-r:")
+
+	err = checkClusterServicePort(ctx, fake.NewClientset(
+		service("pg-rw", 6432, corev1.ProtocolTCP),
+		service("pg-ro", 6432, corev1.ProtocolTCP),
+		service("pg-r", 6432, corev1.ProtocolTCP),
+		pod,
+	), "default", "pg", 6432)
+	require.ErrorContains(t, err, "pod pg-1 does not expose container port 6432/TCP")
+}
+
+func TestClusterSpecManifest(t *testing.T) {
+	manifest := ClusterSpec{Name: "pgedge", Instances: 3}.Manifest()
+	require.Contains(t, manifest, "instances: 3")
+	require.Contains(t, manifest, "size: 1Gi")
+	require.NotContains(t, manifest, "walStorage")
+	require.NotContains(t, manifest, "imageName")
+	require.NotContains(t, manifest, "imagePullPolicy")
+
+	manifest = ClusterSpec{Name: "pgedge", StorageSize: "2Gi", WALStorageSize: "512Mi", ImageName: "ghcr.io/pgedge/pgedge-postgres:17"}.Manifest()
+	require.Contains(t, manifest, "instances: 1")
+	require.Contains(t, manifest, "imageName: ghcr.io/pgedge/pgedge-postgres:17")
+	require.Contains(t, manifest, "storage:\n    size: 2Gi")
+	require.Contains(t, manifest, "walStorage:\n    size: 512Mi")
+
+	manifest = ClusterSpec{Name: "pgedge", ImagePullPolicy: corev1.PullAlways}.Manifest()
+	require.Contains(t, manifest, "imagePullPolicy: Always")
+}
+
+func TestCheckWALVolumes(t *testing.T) {
+	ctx := context.Background()
+	walSize := resource.MustParse("512Mi")
+	instancePod := func(walClaim string) corev1.Pod {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pgedge-1", Namespace: "pgedge"},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "pgdata", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pgedge-1"}}},
+				},
+				Containers: []corev1.Container{{
+					Name:         postgresContainerName,
+					VolumeMounts: []corev1.VolumeMount{{Name: "pgdata", MountPath: "/var/lib/postgresql/data"}},
+				}},
+			},
+		}
+		if walClaim != "" {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+				Name:         walVolumeName,
+				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: walClaim}},
+			})
+			pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts,
+				corev1.VolumeMount{Name: walVolumeName, MountPath: walMountPath})
+		}
+		return pod
+	}
+	walPVC := func(size string) *corev1.PersistentVolumeClaim {
+		pvc := newClusterPVC("pgedge", "pgedge-1-wal", "pgedge", nil)
+		pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)}
+		return pvc
+	}
+
+	err := checkWALVolumes(ctx, fake.NewClientset(), nil, walSize)
+	require.ErrorContains(t, err, "no instance pods found")
+
+	clientset := fake.NewClientset(walPVC("512Mi"))
+	require.NoError(t, checkWALVolumes(ctx, clientset, []corev1.Pod{instancePod("pgedge-1-wal")}, walSize))
+
+	err = checkWALVolumes(ctx, clientset, []corev1.Pod{instancePod("")}, walSize)
+	require.ErrorContains(t, err, "pod pgedge-1 has no pg-wal volume")
+
+	err = checkWALVolumes(ctx, clientset, []corev1.Pod{instancePod("pgedge-1")}, walSize)
+	require.ErrorContains(t, err, "pod pgedge-1 uses PVC pgedge-1 for both pg-wal and pgdata")
+
+	err = checkWALVolumes(ctx, fake.NewClientset(), []corev1.Pod{instancePod("pgedge-1-wal")}, walSize)
+	require.ErrorContains(t, err, "failed to get WAL PVC pgedge-1-wal of pod pgedge-1")
+
+	err = checkWALVolumes(ctx, fake.NewClientset(walPVC("1Gi")), []corev1.Pod{instancePod("pgedge-1-wal")}, walSize)
+	require.ErrorContains(t, err, "WAL PVC pgedge-1-wal requests 1Gi, expected 512Mi")
+}
+
+func TestCheckNotServingBeforeBootstrap(t *testing.T) {
+	ctx := context.Background()
+	endpointSlice := func(ready *bool) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pgedge-rw-abcde",
+				Namespace: "pgedge",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "pgedge-rw"},
+			},
+			Endpoints: []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: ready}}},
+		}
+	}
+	instance := func(ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pgedge-1",
+				Namespace: "pgedge",
+				Labels:    map[string]string{"cnpg.io/cluster": "pgedge", "cnpg.io/podRole": "instance"},
+			},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}},
+		}
+	}
+	notReady, ready := false, true
+
+	bootstrapped, err := checkNotServingBeforeBootstrap(ctx, fake.NewClientset(), "pgedge", "pgedge")
+	require.NoError(t, err)
+	require.False(t, bootstrapped)
+
+	clientset := fake.NewClientset(endpointSlice(&notReady), instance(corev1.ConditionFalse))
+	bootstrapped, err = checkNotServingBeforeBootstrap(ctx, clientset, "pgedge", "pgedge")
+	require.NoError(t, err)
+	require.False(t, bootstrapped)
+
+	clientset = fake.NewClientset(endpointSlice(&ready), instance(corev1.ConditionFalse))
+	_, err = checkNotServingBeforeBootstrap(ctx, clientset, "pgedge", "pgedge")
+	require.ErrorContains(t, err, "service pgedge-rw has 1 ready endpoints before any instance of cluster pgedge is ready")
+
+	clientset = fake.NewClientset(endpointSlice(nil), instance(corev1.ConditionFalse))
+	_, err = checkNotServingBeforeBootstrap(ctx, clientset, "pgedge", "pgedge")
+	require.Error(t, err)
+
+	clientset = fake.NewClientset(endpointSlice(&ready), instance(corev1.ConditionTrue))
+	bootstrapped, err = checkNotServingBeforeBootstrap(ctx, clientset, "pgedge", "pgedge")
+	require.NoError(t, err)
+	require.True(t, bootstrapped)
+}
+
+func TestCheckNoNewRestarts(t *testing.T) {
+	pod := func(name string, restarts ...int32) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		for _, r := range restarts {
+			p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, corev1.ContainerStatus{RestartCount: r})
+		}
+		return p
+	}
+
+	before := instanceRestarts([]corev1.Pod{pod("pgedge-1", 1, 0), pod("pgedge-2", 0)})
+	require.Equal(t, map[string]int32{"pgedge-1": 1, "pgedge-2": 0}, before)
+
+	require.NoError(t, checkNoNewRestarts(before, before))
+	require.NoError(t, checkNoNewRestarts(before, instanceRestarts([]corev1.Pod{pod("pgedge-1", 1), pod("pgedge-3", 0)})))
+
+	err := checkNoNewRestarts(before, instanceRestarts([]corev1.Pod{pod("pgedge-1", 2, 1), pod("pgedge-3", 1)}))
+	require.EqualError(t, err, "instance containers restarted: pgedge-1 restarted 2 times, pgedge-3 restarted 1 times")
+}
+
+func TestCheckInstanceManagerRolledOut(t *testing.T) {
+	const oldImage, newImage = "ghcr.io/cloudnative-pg/cloudnative-pg:1.28.1", "ghcr.io/cloudnative-pg/cloudnative-pg:1.29.1"
+	pod := func(name, image string, ready corev1.ConditionStatus) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PodSpec{InitContainers: []corev1.Container{{Name: bootstrapControllerContainer, Image: image}}},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}},
+		}
+	}
+
+	err := checkInstanceManagerRolledOut([]corev1.Pod{pod("pg-2", oldImage, corev1.ConditionTrue), pod("pg-1", newImage, corev1.ConditionTrue)}, newImage, 2)
+	require.EqualError(t, err, "instance manager not rolled out to "+newImage+": pg-2 runs \""+oldImage+"\"")
+
+	err = checkInstanceManagerRolledOut([]corev1.Pod{pod("pg-1", newImage, corev1.ConditionTrue), pod("pg-2", newImage, corev1.ConditionFalse)}, newImage, 2)
+	require.ErrorContains(t, err, "1 of 2 instances")
+
+	// The replacement of a deleted pod has not been created yet
+	err = checkInstanceManagerRolledOut([]corev1.Pod{pod("pg-1", newImage, corev1.ConditionTrue)}, newImage, 2)
+	require.ErrorContains(t, err, "1 of 2 instances")
+
+	require.NoError(t, checkInstanceManagerRolledOut([]corev1.Pod{pod("pg-1", newImage, corev1.ConditionTrue), pod("pg-2", newImage, corev1.ConditionTrue)}, newImage, 2))
+}
+
+func TestCheckInstancesReplaced(t *testing.T) {
+	pod := func(name, uid string) corev1.Pod {
+		return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(uid)}}
+	}
+	before := instancePods([]corev1.Pod{pod("pg-1", "a"), pod("pg-2", "b")})
+	require.Equal(t, []InstancePod{{Name: "pg-1", UID: "a"}, {Name: "pg-2", UID: "b"}}, before)
+
+	require.NoError(t, checkInstancesReplaced(before, instancePods([]corev1.Pod{pod("pg-1", "c"), pod("pg-2", "d")})))
+	err := checkInstancesReplaced(before, instancePods([]corev1.Pod{pod("pg-2", "b"), pod("pg-1", "a"), pod("pg-3", "e")}))
+	require.EqualError(t, err, "instances were not recreated: pg-1, pg-2")
+}
+
+func TestCheckImagePullPolicy(t *testing.T) {
+	ctx := context.Background()
+	instance := func(name string, policy corev1.PullPolicy) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pgedge", Labels: map[string]string{
+				"cnpg.io/cluster": "pgedge", "cnpg.io/podRole": "instance",
+			}},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "bootstrap-controller", ImagePullPolicy: corev1.PullAlways}},
+				Containers:     []corev1.Container{{Name: postgresContainerName, ImagePullPolicy: policy}},
+			},
+		}
+	}
+
+	err := checkImagePullPolicy(ctx, fake.NewClientset(), "pgedge", "pgedge", corev1.PullIfNotPresent)
+	require.ErrorContains(t, err, "cluster pgedge has no instance pods")
+
+	clientset := fake.NewClientset(instance("pgedge-1", corev1.PullIfNotPresent), instance("pgedge-2", corev1.PullIfNotPresent))
+	require.NoError(t, checkImagePullPolicy(ctx, clientset, "pgedge", "pgedge", corev1.PullIfNotPresent))
+
+	clientset = fake.NewClientset(instance("pgedge-1", corev1.PullIfNotPresent), instance("pgedge-2", corev1.PullAlways))
+	err = checkImagePullPolicy(ctx, clientset, "pgedge", "pgedge", corev1.PullIfNotPresent)
+	require.ErrorContains(t, err, "pod pgedge-2 pulls with Always")
+	require.NotContains(t, err.Error(), "pgedge-1")
+}
+
+func TestCheckNoImagePull(t *testing.T) {
+	pods := []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "pgedge-1"}}}
+	event := func(pod, reason, fieldPath, message string) corev1.Event {
+		return corev1.Event{
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod, FieldPath: fieldPath},
+			Reason:         reason,
+			Message:        message,
+		}
+	}
+
+	events := []corev1.Event{
+		event("pgedge-1", "Pulled", "spec.containers{postgres}", `Container image "ghcr.io/pgedge/pgedge-postgres:17" already present on machine`),
+		event("pgedge-1", "Pulling", "spec.initContainers{bootstrap-controller}", `Pulling image "ghcr.io/cloudnative-pg/cloudnative-pg:1.29.1"`),
+		event("other-1", "Pulling", "spec.containers{postgres}", `Pulling image "ghcr.io/pgedge/pgedge-postgres:17"`),
+	}
+	require.NoError(t, checkNoImagePull(events, pods))
+
+	events = append(events, event("pgedge-1", "Pulling", "spec.containers{postgres}", `Pulling image "ghcr.io/pgedge/pgedge-postgres:17"`))
+	err := checkNoImagePull(events, pods)
+	require.ErrorContains(t, err, `pgedge-1: Pulling image "ghcr.io/pgedge/pgedge-postgres:17"`)
+}
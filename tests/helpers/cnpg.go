@@ -1,16 +1,49 @@
 package helpers
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gruntwork-io/terratest/modules/helm"
 	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultOperatorNamespace is where the operator is installed unless a test chooses otherwise.
+// The static release manifests always install into it.
+const DefaultOperatorNamespace = "cnpg-system"
+
+const (
+	// webhookConfigurationName is the ValidatingWebhookConfiguration created by the operator
+	webhookConfigurationName = "cnpg-validating-webhook-configuration"
+	// webhookCertSecretName holds the certificate served by the operator webhook
+	webhookCertSecretName = "cnpg-webhook-cert"
+	// operatorConfigMapName carries the operator configuration, including POSTGRES_IMAGE_NAME
+	operatorConfigMapName = "cnpg-controller-manager-config"
+	// operatorPodSelector matches the operator pods of the Helm chart and the release manifests
+	operatorPodSelector = "app.kubernetes.io/name=cloudnative-pg"
 )
 
 // CNPGOperator represents a deployed CNPG operator
@@ -21,6 +54,7 @@ type CNPGOperator struct {
 	ChartPath      string
 	OperatorImage  string
 	PostgresImage  string
+	Proxy          config.ProxyConfig
 	KubectlOptions *k8s.KubectlOptions
 }
 
@@ -32,29 +66,38 @@ type CNPGOperatorConfig struct {
 	ReleaseName   string
 	OperatorImage string
 	PostgresImage string
+	Proxy         config.ProxyConfig
 }
 
-// NewCNPGOperator creates a new CNPG operator helper
-func NewCNPGOperator(t *testing.T, config *CNPGOperatorConfig, kubeconfigPath string) *CNPGOperator {
+// findProjectRoot returns the project root above the working directory, failing the test if there
+// is none
+func findProjectRoot(t *testing.T) string {
 	t.Helper()
 
-	// Get project root
-	projectRoot, err := os.Getwd()
+	wd, err := os.Getwd()
 	require.NoError(t, err, "Failed to get working directory")
+	root, err := config.FindProjectRoot(wd)
+	require.NoError(t, err)
+	return root
+}
 
-	// Find project root by looking for go.mod
-	for {
-		if _, err := os.Stat(filepath.Join(projectRoot, "go.mod")); err == nil {
-			break
-		}
-		parent := filepath.Dir(projectRoot)
-		if parent == projectRoot {
-			require.Fail(t, "Could not find project root (go.mod not found)")
-		}
-		projectRoot = parent
+// cnpgChartPath returns charts/cloudnative-pg/v<ChartVersion>, falling back to v<Version> when
+// no chart version is set
+func cnpgChartPath(projectRoot string, config *CNPGOperatorConfig) string {
+	version := config.ChartVersion
+	if version == "" {
+		version = config.Version
 	}
+	return filepath.Join(projectRoot, "charts", "cloudnative-pg", fmt.Sprintf("v%s", version))
+}
 
-	chartPath := filepath.Join(projectRoot, "charts", "cloudnative-pg", fmt.Sprintf("v%s", config.ChartVersion))
+// NewCNPGOperator creates a new CNPG operator helper
+func NewCNPGOperator(t *testing.T, config *CNPGOperatorConfig, kubeconfigPath string) *CNPGOperator {
+	t.Helper()
+
+	projectRoot := findProjectRoot(t)
+
+	chartPath := cnpgChartPath(projectRoot, config)
 
 	return &CNPGOperator{
 		Version:        config.Version,
@@ -63,6 +106,7 @@ func NewCNPGOperator(t *testing.T, config *CNPGOperatorConfig, kubeconfigPath st
 		ChartPath:      chartPath,
 		OperatorImage:  config.OperatorImage,
 		PostgresImage:  config.PostgresImage,
+		Proxy:          config.Proxy,
 		KubectlOptions: k8s.NewKubectlOptions("", kubeconfigPath, config.Namespace),
 	}
 }
@@ -79,20 +123,43 @@ func (co *CNPGOperator) Install(t *testing.T) error {
 		return fmt.Errorf("failed to create namespace: %w", err)
 	}
 
-	// Prepare Helm options
+	helmOptions, err := co.helmOptions(map[string][]string{
+		"install": {
+			"--create-namespace",
+			"--wait",
+			"--timeout", "5m",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Install chart
+	err = helm.InstallE(t, helmOptions, co.ChartPath, co.ReleaseName)
+	if err != nil {
+		return fmt.Errorf("failed to install Helm chart: %w", err)
+	}
+
+	// Wait for operator to be ready
+	err = co.waitForOperatorReady(t, 5*time.Minute)
+	if err != nil {
+		return fmt.Errorf("operator not ready: %w", err)
+	}
+
+	t.Logf("CNPG operator %s installed successfully", co.Version)
+	return nil
+}
+
+// helmOptions returns the Helm options deploying co's operator image, default PostgreSQL image
+// and proxy settings
+func (co *CNPGOperator) helmOptions(extraArgs map[string][]string) (*helm.Options, error) {
 	helmOptions := &helm.Options{
 		KubectlOptions: co.KubectlOptions,
 		SetValues: map[string]string{
 			"image.repository": getImageRepository(co.OperatorImage),
 			"image.tag":        getImageTag(co.OperatorImage),
 		},
-		ExtraArgs: map[string][]string{
-			"install": {
-				"--create-namespace",
-				"--wait",
-				"--timeout", "5m",
-			},
-		},
+		ExtraArgs: extraArgs,
 	}
 
 	// Add POSTGRES_IMAGE_NAME environment variable if PostgresImage is set
@@ -100,23 +167,82 @@ func (co *CNPGOperator) Install(t *testing.T) error {
 		helmOptions.SetValues["config.data.POSTGRES_IMAGE_NAME"] = co.PostgresImage
 	}
 
-	// Install chart
-	err = helm.InstallE(t, helmOptions, co.ChartPath, co.ReleaseName)
+	// Pass the proxy to the operator for any egress it performs
+	if co.Proxy.Enabled() {
+		additionalEnv, err := proxyEnvJSON(co.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		helmOptions.SetJsonValues = map[string]string{"additionalEnv": additionalEnv}
+	}
+	return helmOptions, nil
+}
+
+// upgradeChartPath returns the chart directory of target next to the current chart directory
+func upgradeChartPath(currentChartPath string, target *config.CNPGVersion) string {
+	return cnpgChartPath(filepath.Dir(filepath.Dir(filepath.Dir(currentChartPath))), &CNPGOperatorConfig{
+		Version:      target.Version,
+		ChartVersion: target.ChartVersion,
+	})
+}
+
+// UpgradeChartPath returns the chart directory Upgrade installs for toVersion from versions.yaml
+func (co *CNPGOperator) UpgradeChartPath(toVersion string) (string, error) {
+	cfg, err := config.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to install Helm chart: %w", err)
+		return "", err
 	}
+	target, err := cfg.GetCNPGVersion(toVersion)
+	if err != nil {
+		return "", err
+	}
+	return upgradeChartPath(co.ChartPath, target), nil
+}
 
-	// Wait for operator to be ready
-	err = co.waitForOperatorReady(t, 5*time.Minute)
+// Upgrade runs helm upgrade to the chart and operator image of toVersion from versions.yaml,
+// keeping the default PostgreSQL image, and waits for the new operator to become ready
+func (co *CNPGOperator) Upgrade(t *testing.T, toVersion string) error {
+	t.Helper()
+
+	cfg, err := config.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("operator not ready: %w", err)
+		return err
+	}
+	target, err := cfg.GetCNPGVersion(toVersion)
+	if err != nil {
+		return err
 	}
 
-	t.Logf("CNPG operator %s installed successfully", co.Version)
+	t.Logf("Upgrading CNPG operator %s to %s", co.Version, target.Version)
+
+	upgraded := *co
+	upgraded.Version = target.Version
+	upgraded.ChartPath = upgradeChartPath(co.ChartPath, target)
+	upgraded.OperatorImage = target.GetOperatorImageName()
+
+	helmOptions, err := upgraded.helmOptions(map[string][]string{
+		"upgrade": {
+			"--wait",
+			"--timeout", "5m",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := helm.UpgradeE(t, helmOptions, upgraded.ChartPath, co.ReleaseName); err != nil {
+		return fmt.Errorf("failed to upgrade Helm release to %s: %w", target.Version, err)
+	}
+	*co = upgraded
+
+	if err := co.waitForOperatorReady(t, 5*time.Minute); err != nil {
+		return fmt.Errorf("operator not ready after upgrade: %w", err)
+	}
+
+	t.Logf("CNPG operator upgraded to %s", co.Version)
 	return nil
 }
 
-// Uninstall removes the CNPG operator
+// Uninstall removes the CNPG operator, failing if the release leaves resources behind
 func (co *CNPGOperator) Uninstall(t *testing.T) error {
 	t.Helper()
 
@@ -130,6 +256,10 @@ func (co *CNPGOperator) Uninstall(t *testing.T) error {
 	if err != nil {
 		return fmt.Errorf("failed to uninstall Helm release: %w", err)
 	}
+	// Deleting the namespace would hide anything the chart leaves behind
+	if err := waitForReleaseRemoved(t, co.KubectlOptions.ConfigPath, co.Namespace, co.ReleaseName); err != nil {
+		return err
+	}
 
 	// Delete namespace
 	err = k8s.DeleteNamespaceE(t, co.KubectlOptions, co.Namespace)
@@ -147,7 +277,15 @@ func (co *CNPGOperator) waitForOperatorReady(t *testing.T, timeout time.Duration
 
 	maxRetries := int(timeout.Seconds() / 5)
 
+	pullErr, stop := watchImagePulls(co.KubectlOptions.ConfigPath, co.Namespace, operatorPodSelector)
+	defer stop()
+
 	_, err := retry.DoWithRetryE(t, "Wait for operator ready", maxRetries, 5*time.Second, func() (string, error) {
+		// A bad operator image never becomes ready, so stop waiting right away
+		if err := pullErr(); err != nil {
+			return "", retry.FatalError{Underlying: err}
+		}
+
 		// Check if deployment exists and is ready
 		deployment, getErr := k8s.GetDeploymentE(t, co.KubectlOptions, co.ReleaseName)
 		if getErr != nil {
@@ -175,7 +313,7 @@ func (co *CNPGOperator) GetOperatorLogs(t *testing.T) (string, error) {
 	// Get pod name using kubectl
 	output, err := k8s.RunKubectlAndGetOutputE(t, co.KubectlOptions,
 		"get", "pods",
-		"-l", "app.kubernetes.io/name=cloudnative-pg",
+		"-l", operatorPodSelector,
 		"-o", "jsonpath={.items[0].metadata.name}",
 	)
 	if err != nil {
@@ -195,20 +333,568 @@ func (co *CNPGOperator) GetOperatorLogs(t *testing.T) (string, error) {
 	return logs, nil
 }
 
-// DeployCNPGOperator is a convenience function to deploy CNPG operator
-func DeployCNPGOperator(t *testing.T, kubeconfigPath, version, chartVersion, namespace, operatorImage, postgresImage string) *CNPGOperator {
+// AssertWebhookCertValid checks that every webhook in the operator's ValidatingWebhookConfiguration
+// trusts the certificate the operator serves, and that the certificate has not expired.
+// opts must point at the operator namespace.
+func AssertWebhookCertValid(t *testing.T, opts *k8s.KubectlOptions) {
 	t.Helper()
 
-	config := &CNPGOperatorConfig{
-		Version:       version,
-		ChartVersion:  chartVersion,
-		Namespace:     namespace,
-		ReleaseName:   "cloudnative-pg",
-		OperatorImage: operatorImage,
-		PostgresImage: postgresImage,
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	err = validateWebhookCert(context.Background(), clientset, opts.Namespace, time.Now())
+	require.NoError(t, err, "Operator webhook certificate is not valid")
+}
+
+// validateWebhookCert loads the webhook configuration and serving secret and checks them.
+func validateWebhookCert(ctx context.Context, clientset kubernetes.Interface, namespace string, now time.Time) error {
+	webhookConfig, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, webhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get webhook configuration %s: %w", webhookConfigurationName, err)
 	}
 
-	operator := NewCNPGOperator(t, config, kubeconfigPath)
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, webhookCertSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get webhook secret %s/%s: %w", namespace, webhookCertSecretName, err)
+	}
+
+	return checkWebhookCert(webhookConfig, secret, now)
+}
+
+// checkWebhookCert verifies the serving certificate in secret chains to each webhook's caBundle
+// and is within its validity window at now.
+func checkWebhookCert(webhookConfig *admissionregistrationv1.ValidatingWebhookConfiguration, secret *corev1.Secret, now time.Time) error {
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		return fmt.Errorf("secret %s has no PEM certificate in %s", secret.Name, corev1.TLSCertKey)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse serving certificate: %w", err)
+	}
+
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("serving certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("serving certificate not valid until %s", cert.NotBefore.Format(time.RFC3339))
+	}
+
+	if len(webhookConfig.Webhooks) == 0 {
+		return fmt.Errorf("webhook configuration %s has no webhooks", webhookConfig.Name)
+	}
+
+	for _, webhook := range webhookConfig.Webhooks {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(webhook.ClientConfig.CABundle) {
+			return fmt.Errorf("webhook %s has no usable caBundle", webhook.Name)
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, CurrentTime: now}); err != nil {
+			return fmt.Errorf("webhook %s caBundle does not match serving certificate: %w", webhook.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Restart rolls the operator deployment and waits for it to become ready again
+func (co *CNPGOperator) Restart(t *testing.T) error {
+	t.Helper()
+
+	t.Logf("Restarting CNPG operator %s", co.ReleaseName)
+
+	if err := k8s.RunKubectlE(t, co.KubectlOptions, "rollout", "restart", "deployment", co.ReleaseName); err != nil {
+		return fmt.Errorf("failed to restart operator: %w", err)
+	}
+	if err := k8s.RunKubectlE(t, co.KubectlOptions, "rollout", "status", "deployment", co.ReleaseName, "--timeout=5m"); err != nil {
+		return fmt.Errorf("operator rollout did not complete: %w", err)
+	}
+
+	return co.waitForOperatorReady(t, 5*time.Minute)
+}
+
+// errSingleNode is returned when fewer than two nodes take regular workloads, where co-location
+// cannot be avoided
+var errSingleNode = errors.New("fewer than two schedulable nodes")
+
+// acceptsWorkloads reports whether regular pods can be scheduled on node: it is not cordoned and
+// has no NoSchedule or NoExecute taint, as control-plane nodes usually do
+func acceptsWorkloads(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPrimaryNotCoLocated returns an error if the primary of clusterName runs on the same node as
+// an operator pod in operatorNamespace
+func checkPrimaryNotCoLocated(ctx context.Context, clientset kubernetes.Interface, operatorNamespace, namespace, clusterName string) error {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	schedulable := 0
+	for i := range nodes.Items {
+		if acceptsWorkloads(&nodes.Items[i]) {
+			schedulable++
+		}
+	}
+	if schedulable < 2 {
+		return errSingleNode
+	}
+
+	primaries, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("cnpg.io/cluster=%s,cnpg.io/instanceRole=primary", clusterName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find primary of %s: %w", clusterName, err)
+	}
+	if len(primaries.Items) == 0 || primaries.Items[0].Spec.NodeName == "" {
+		return fmt.Errorf("cluster %s has no scheduled primary", clusterName)
+	}
+	primary := primaries.Items[0]
+
+	operators, err := clientset.CoreV1().Pods(operatorNamespace).List(ctx, metav1.ListOptions{LabelSelector: operatorPodSelector})
+	if err != nil {
+		return fmt.Errorf("failed to list operator pods: %w", err)
+	}
+	if len(operators.Items) == 0 {
+		return fmt.Errorf("no operator pods found in %s", operatorNamespace)
+	}
+	for _, pod := range operators.Items {
+		if pod.Spec.NodeName == primary.Spec.NodeName {
+			return fmt.Errorf("primary %s and operator pod %s both run on node %s", primary.Name, pod.Name, primary.Spec.NodeName)
+		}
+	}
+	return nil
+}
+
+// AssertPrimaryNotCoLocatedWithOperator checks that the primary of clusterName does not share a
+// node with the operator, so losing one node does not take out both. It is a best-practice check:
+// with fewer than two nodes taking workloads co-location is unavoidable and only logged.
+func AssertPrimaryNotCoLocatedWithOperator(t *testing.T, opts *k8s.KubectlOptions, operator *CNPGOperator, clusterName string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	err = checkPrimaryNotCoLocated(context.Background(), clientset, operator.Namespace, opts.Namespace, clusterName)
+	if errors.Is(err, errSingleNode) {
+		t.Logf("Warning: primary of %s and operator cannot be spread: %v", clusterName, err)
+		return
+	}
+	require.NoError(t, err)
+}
+
+// getOperatorDefaultImage reads POSTGRES_IMAGE_NAME from the operator config map
+func getOperatorDefaultImage(ctx context.Context, clientset kubernetes.Interface, namespace string) (string, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, operatorConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get operator config map %s/%s: %w", namespace, operatorConfigMapName, err)
+	}
+
+	image, ok := cm.Data["POSTGRES_IMAGE_NAME"]
+	if !ok || image == "" {
+		return "", fmt.Errorf("operator config map %s/%s has no POSTGRES_IMAGE_NAME", namespace, operatorConfigMapName)
+	}
+	return image, nil
+}
+
+// AssertOperatorDefaultImage checks that the operator's default PostgreSQL image is expectedImage.
+// opts must point at the operator namespace.
+func AssertOperatorDefaultImage(t *testing.T, opts *k8s.KubectlOptions, expectedImage string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	image, err := getOperatorDefaultImage(context.Background(), clientset, opts.Namespace)
+	require.NoError(t, err)
+	require.Equal(t, expectedImage, image, "Operator default PostgreSQL image")
+	require.NoError(t, checkAllowedImage(image, allowedImagePrefixes(t)), "Operator default image")
+}
+
+// checkDefaultImageAdmitted checks that a cluster without imageName was created. A rejection by
+// the image validation policy means the operator defaulted imageName to a non-pgEdge image.
+func checkDefaultImageAdmitted(createErr error) error {
+	if createErr == nil {
+		return nil
+	}
+	if strings.Contains(createErr.Error(), "must use pgEdge PostgreSQL images") {
+		return fmt.Errorf("cluster without imageName was rejected, the operator default image is not a pgEdge image: %w", createErr)
+	}
+	return fmt.Errorf("failed to create cluster without imageName: %w", createErr)
+}
+
+// AssertDefaultImageClusterSafe creates a cluster without imageName in opts.Namespace and checks
+// that it is admitted and resolves to a pgEdge image
+func AssertDefaultImageClusterSafe(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	manifest := fmt.Sprintf(`
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: %s
+spec:
+  instances: 1
+  storage:
+    size: 1Gi
+`, clusterName)
+
+	createErr := k8s.KubectlApplyFromStringE(t, opts, manifest)
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", clusterName, "--ignore-not-found=true")
+	}()
+	require.NoError(t, checkDefaultImageAdmitted(createErr))
+
+	image := AssertClusterUsesPgedgeImage(t, opts, clusterName)
+	t.Logf("Cluster %s without imageName runs %s", clusterName, image)
+}
+
+// AssertDefaultImagePreserved re-checks the default image guarantees after the operator has been
+// reconfigured, e.g. upgraded: the config map still carries co.PostgresImage and a cluster created
+// without imageName in clusterOpts.Namespace runs a pgEdge image
+func (co *CNPGOperator) AssertDefaultImagePreserved(t *testing.T, clusterOpts *k8s.KubectlOptions) {
+	t.Helper()
+
+	AssertOperatorDefaultImage(t, co.KubectlOptions, co.PostgresImage)
+	AssertDefaultImageClusterSafe(t, clusterOpts, "default-image-check")
+}
+
+// clusterImage returns the PostgreSQL image a CNPG Cluster runs: status.image once the operator
+// has resolved it, otherwise the postgres container image of its instance pods
+func clusterImage(ctx context.Context, clientset kubernetes.Interface, dynClient dynamic.Interface, namespace, clusterName string) (string, error) {
+	cluster, err := dynClient.Resource(clusterGVR).Namespace(namespace).Get(ctx, clusterName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get CNPG cluster %s/%s: %w", namespace, clusterName, err)
+	}
+	if image, _, _ := unstructured.NestedString(cluster.Object, "status", "image"); image != "" {
+		return image, nil
+	}
+
+	pods, err := listInstancePods(ctx, clientset, namespace, clusterName)
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == postgresContainerName && c.Image != "" {
+				return c.Image, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cluster %s has no resolved image yet", clusterName)
+}
+
+// allowedImagePrefixes returns the pgEdge image prefixes from the configuration, the same ones the
+// image validation policy admits
+func allowedImagePrefixes(t *testing.T) []string {
+	t.Helper()
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+	prefixes, err := cfg.AllowedImagePrefixes()
+	require.NoError(t, err)
+	return prefixes
+}
+
+// checkAllowedImage returns an error unless image starts with one of prefixes
+func checkAllowedImage(image string, prefixes []string) error {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(image, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s is not a pgEdge image (allowed prefixes: %s)", image, strings.Join(prefixes, ", "))
+}
+
+// AssertClusterUsesPgedgeImage waits for the operator to resolve the PostgreSQL image of
+// clusterName and checks it comes from one of the pgEdge registries in the configuration. It
+// returns the image for logging.
+func AssertClusterUsesPgedgeImage(t *testing.T, opts *k8s.KubectlOptions, clusterName string) string {
+	t.Helper()
+
+	prefixes := allowedImagePrefixes(t)
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+
+	image, err := retry.DoWithRetryE(t, fmt.Sprintf("Resolve image of cluster %s", clusterName), 24, 5*time.Second, func() (string, error) {
+		return clusterImage(context.Background(), clientset, dynClient, opts.Namespace, clusterName)
+	})
+	require.NoError(t, err)
+	require.NoError(t, checkAllowedImage(image, prefixes), "Cluster %s", clusterName)
+	return image
+}
+
+// cnpgAPIGroup is the API group of the CNPG custom resources
+const cnpgAPIGroup = "postgresql.cnpg.io"
+
+// chartAPIs are the CNPG apiVersions an operator chart serves through its CRDs and admits
+// through its webhooks
+type chartAPIs struct {
+	// Served maps each CRD kind to the versions the chart serves
+	Served map[string][]string
+	// Resources maps each CRD kind to its plural resource name
+	Resources map[string]string
+	// Webhooks maps each webhook to the apiVersions of the resources its rules match
+	Webhooks map[string][]schema.GroupVersionResource
+}
+
+// renderedChartAPIs collects the CNPG CRD served versions and webhook rules from rendered chart
+// manifests
+func renderedChartAPIs(rendered string) (chartAPIs, error) {
+	apis := chartAPIs{
+		Served:    make(map[string][]string),
+		Resources: make(map[string]string),
+		Webhooks:  make(map[string][]schema.GroupVersionResource),
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(rendered))
+	for {
+		var doc struct {
+			Kind string `yaml:"kind"`
+			Spec struct {
+				Group string `yaml:"group"`
+				Names struct {
+					Kind   string `yaml:"kind"`
+					Plural string `yaml:"plural"`
+				} `yaml:"names"`
+				Versions []struct {
+					Name   string `yaml:"name"`
+					Served bool   `yaml:"served"`
+				} `yaml:"versions"`
+			} `yaml:"spec"`
+			Webhooks []struct {
+				Name  string `yaml:"name"`
+				Rules []struct {
+					APIGroups   []string `yaml:"apiGroups"`
+					APIVersions []string `yaml:"apiVersions"`
+					Resources   []string `yaml:"resources"`
+				} `yaml:"rules"`
+			} `yaml:"webhooks"`
+		}
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return apis, fmt.Errorf("failed to parse rendered manifests: %w", err)
+		}
+
+		switch doc.Kind {
+		case "CustomResourceDefinition":
+			if doc.Spec.Group != cnpgAPIGroup {
+				continue
+			}
+			kind := doc.Spec.Names.Kind
+			apis.Resources[kind] = doc.Spec.Names.Plural
+			for _, v := range doc.Spec.Versions {
+				if v.Served {
+					apis.Served[kind] = append(apis.Served[kind], v.Name)
+				}
+			}
+		case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+			for _, webhook := range doc.Webhooks {
+				for _, rule := range webhook.Rules {
+					if !slices.Contains(rule.APIGroups, cnpgAPIGroup) {
+						continue
+					}
+					for _, version := range rule.APIVersions {
+						for _, resource := range rule.Resources {
+							apis.Webhooks[webhook.Name] = append(apis.Webhooks[webhook.Name],
+								schema.GroupVersionResource{Group: cnpgAPIGroup, Version: version, Resource: resource})
+						}
+					}
+				}
+			}
+		}
+	}
+	return apis, nil
+}
+
+// servedCNPGResources returns the CNPG kinds and resources the server serves, each mapped to
+// its served versions
+func servedCNPGResources(clientset kubernetes.Interface) (kinds, resources map[string][]string, err error) {
+	groups, err := clientset.Discovery().ServerGroups()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover API groups: %w", err)
+	}
+
+	kinds = make(map[string][]string)
+	resources = make(map[string][]string)
+	for _, group := range groups.Groups {
+		if group.Name != cnpgAPIGroup {
+			continue
+		}
+		for _, version := range group.Versions {
+			list, err := clientset.Discovery().ServerResourcesForGroupVersion(version.GroupVersion)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to discover %s: %w", version.GroupVersion, err)
+			}
+			for _, r := range list.APIResources {
+				if strings.Contains(r.Name, "/") {
+					continue
+				}
+				kinds[r.Kind] = append(kinds[r.Kind], version.Version)
+				resources[r.Name] = append(resources[r.Name], version.Version)
+			}
+		}
+	}
+	return kinds, resources, nil
+}
+
+// checkChartAPIs verifies the target chart keeps serving every CNPG version the server serves
+// today, so existing objects stay readable after the upgrade, and that its webhooks only match
+// versions served either by the server or by the chart's own CRDs
+func checkChartAPIs(clientset kubernetes.Interface, apis chartAPIs) error {
+	if len(apis.Served) == 0 {
+		return fmt.Errorf("chart renders no %s CRDs", cnpgAPIGroup)
+	}
+
+	kinds, resources, err := servedCNPGResources(clientset)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, kind := range slices.Sorted(maps.Keys(kinds)) {
+		for _, version := range kinds[kind] {
+			if !slices.Contains(apis.Served[kind], version) {
+				errs = append(errs, fmt.Errorf("chart stops serving %s/%s %s, which the cluster serves", cnpgAPIGroup, version, kind))
+			}
+		}
+	}
+
+	chartResources := make(map[string][]string)
+	for kind, plural := range apis.Resources {
+		chartResources[plural] = apis.Served[kind]
+	}
+	for _, name := range slices.Sorted(maps.Keys(apis.Webhooks)) {
+		for _, gvr := range apis.Webhooks[name] {
+			if !slices.Contains(resources[gvr.Resource], gvr.Version) && !slices.Contains(chartResources[gvr.Resource], gvr.Version) {
+				errs = append(errs, fmt.Errorf("webhook %s matches %s/%s %s, which neither the cluster nor the chart serves",
+					name, gvr.Group, gvr.Version, gvr.Resource))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// renderChart renders the chart at chartPath with its default values
+func renderChart(t *testing.T, opts *k8s.KubectlOptions, chartPath string) (string, error) {
+	return helm.RunHelmCommandAndGetStdOutE(t, &helm.Options{KubectlOptions: opts},
+		"template", "api-version-check", chartPath)
+}
+
+// AssertAPIVersionCompatibility renders the operator chart at chartPath and compares the served
+// versions of its CNPG CRDs and the apiVersions its webhooks match against discovery, catching
+// chart/operator API skew before upgrading
+func AssertAPIVersionCompatibility(t *testing.T, opts *k8s.KubectlOptions, chartPath string) {
+	t.Helper()
+
+	rendered, err := renderChart(t, opts, chartPath)
+	require.NoError(t, err, "Failed to render chart %s", chartPath)
+
+	apis, err := renderedChartAPIs(rendered)
+	require.NoError(t, err)
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	require.NoError(t, checkChartAPIs(clientset, apis), "Chart %s", chartPath)
+}
+
+const (
+	// dataPlaneIndependenceWindow is how long a cluster must keep serving without its operator
+	dataPlaneIndependenceWindow = 2 * time.Minute
+	// namespaceDeletionTimeout bounds how long the operator namespace may take to terminate
+	namespaceDeletionTimeout = 3 * time.Minute
+)
+
+// waitForNamespaceDeleted polls until the namespace no longer exists
+func waitForNamespaceDeleted(ctx context.Context, clientset kubernetes.Interface, name string, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to get namespace %s: %w", name, err)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("namespace %s was not deleted within %s", name, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// AssertDataPlaneIndependence uninstalls the operator and checks the cluster's primary keeps
+// answering queries for dataPlaneIndependenceWindow, then reinstalls the operator and checks it
+// reconciles the cluster again. Skipped in short mode.
+func AssertDataPlaneIndependence(t *testing.T, operator *CNPGOperator, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping data plane independence test in short mode")
+	}
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	conn, closeConn, err := OpenServiceConnection(t, opts, clusterName+"-rw", clusterName+"-app")
+	require.NoError(t, err)
+	defer closeConn()
+
+	AssertNoConnectionDrop(t, conn, func() {
+		require.NoError(t, operator.Uninstall(t), "Failed to uninstall operator")
+		t.Logf("Operator removed, checking cluster %s keeps serving for %s", clusterName, dataPlaneIndependenceWindow)
+		time.Sleep(dataPlaneIndependenceWindow)
+	})
+
+	require.NoError(t, waitForNamespaceDeleted(context.Background(), clientset, operator.Namespace,
+		namespaceDeletionTimeout, 5*time.Second))
+	require.NoError(t, operator.Install(t), "Failed to reinstall operator")
+
+	AssertDriftReconciliation(t, opts, clusterName)
+}
+
+// DeployCNPGOperatorWithConfig installs the CNPG operator described by cfg and uninstalls it when
+// the test finishes. ReleaseName defaults to cloudnative-pg and Proxy to the configured proxy.
+func DeployCNPGOperatorWithConfig(t *testing.T, kubeconfigPath string, cfg CNPGOperatorConfig) *CNPGOperator {
+	t.Helper()
+
+	if cfg.ReleaseName == "" {
+		cfg.ReleaseName = "cloudnative-pg"
+	}
+	if !cfg.Proxy.Enabled() {
+		cfg.Proxy = config.LoadProxyConfig()
+	}
+	if cfg.Proxy.Enabled() {
+		// client-go honours HTTPS_PROXY, so API server and instance traffic must be exempted
+		proxy, err := withClusterNoProxy(kubeconfigPath, cfg.Proxy)
+		require.NoError(t, err, "Failed to determine the cluster networks to exempt from the proxy")
+		cfg.Proxy = proxy
+	}
+
+	for _, image := range []string{cfg.OperatorImage, cfg.PostgresImage} {
+		if image != "" {
+			require.NoError(t, AssertImageSigned(t, image, cosignPublicKeyPath()))
+		}
+	}
+
+	operator := NewCNPGOperator(t, &cfg, kubeconfigPath)
 
 	err := operator.Install(t)
 	require.NoError(t, err, "Failed to install CNPG operator")
@@ -223,32 +909,35 @@ func DeployCNPGOperator(t *testing.T, kubeconfigPath, version, chartVersion, nam
 	return operator
 }
 
+// DeployCNPGOperator is a convenience wrapper around DeployCNPGOperatorWithConfig
+func DeployCNPGOperator(t *testing.T, kubeconfigPath, version, chartVersion, namespace, operatorImage, postgresImage string) *CNPGOperator {
+	t.Helper()
+
+	return DeployCNPGOperatorWithConfig(t, kubeconfigPath, CNPGOperatorConfig{
+		Version:       version,
+		ChartVersion:  chartVersion,
+		Namespace:     namespace,
+		OperatorImage: operatorImage,
+		PostgresImage: postgresImage,
+	})
+}
+
 // DeployCNPGOperatorFromManifest deploys CNPG operator using kubectl apply with the static manifest
 func DeployCNPGOperatorFromManifest(t *testing.T, kubeconfigPath, version, namespace string) *CNPGOperator {
 	t.Helper()
 
-	// Get project root
-	projectRoot, err := os.Getwd()
-	require.NoError(t, err, "Failed to get working directory")
-
-	// Find project root by looking for go.mod
-	for {
-		if _, err := os.Stat(filepath.Join(projectRoot, "go.mod")); err == nil {
-			break
-		}
-		parent := filepath.Dir(projectRoot)
-		if parent == projectRoot {
-			require.Fail(t, "Could not find project root (go.mod not found)")
-		}
-		projectRoot = parent
-	}
+	projectRoot := findProjectRoot(t)
 
 	manifestPath := filepath.Join(projectRoot, "manifests", "cloudnative-pg", fmt.Sprintf("v%s", version), fmt.Sprintf("cnpg-%s.yaml", version))
 
 	// Verify manifest exists
-	_, err = os.Stat(manifestPath)
+	_, err := os.Stat(manifestPath)
 	require.NoError(t, err, "Manifest not found at %s", manifestPath)
 
+	// The namespace is baked into the release manifest, only Helm installs can relocate it
+	require.Equal(t, DefaultOperatorNamespace, namespace,
+		"Manifest installs always use %s; use DeployCNPGOperator for a custom namespace", DefaultOperatorNamespace)
+
 	kubectlOptions := k8s.NewKubectlOptions("", kubeconfigPath, namespace)
 
 	t.Logf("Deploying CNPG operator %s from manifest: %s", version, manifestPath)
@@ -0,0 +1,375 @@
+package helpers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testCA is a throwaway certificate authority for webhook certificate tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a serving certificate valid until notAfter
+func (ca *testCA) issue(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "cnpg-webhook-service.cnpg-system.svc"},
+		DNSNames:     []string{"cnpg-webhook-service.cnpg-system.svc"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func webhookConfigWithCA(caBundle []byte) *admissionregistrationv1.ValidatingWebhookConfiguration {
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookConfigurationName},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{Name: "vcluster.cnpg.io", ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: caBundle}},
+		},
+	}
+}
+
+func TestCheckWebhookCert(t *testing.T) {
+	ca := newTestCA(t, "cnpg-ca")
+	otherCA := newTestCA(t, "other-ca")
+	now := time.Now()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookCertSecretName},
+		Data:       map[string][]byte{corev1.TLSCertKey: ca.issue(t, now.Add(12*time.Hour))},
+	}
+
+	t.Run("matching CA", func(t *testing.T) {
+		require.NoError(t, checkWebhookCert(webhookConfigWithCA(ca.pem), secret, now))
+	})
+
+	t.Run("mismatching CA", func(t *testing.T) {
+		err := checkWebhookCert(webhookConfigWithCA(otherCA.pem), secret, now)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not match")
+	})
+
+	t.Run("expired certificate", func(t *testing.T) {
+		err := checkWebhookCert(webhookConfigWithCA(ca.pem), secret, now.Add(13*time.Hour))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "expired")
+	})
+}
+
+func TestGetOperatorDefaultImage(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: operatorConfigMapName, Namespace: "cnpg-system"},
+		Data:       map[string]string{"POSTGRES_IMAGE_NAME": "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard"},
+	})
+
+	image, err := getOperatorDefaultImage(context.Background(), clientset, "cnpg-system")
+	require.NoError(t, err)
+	require.Equal(t, "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard", image)
+
+	_, err = getOperatorDefaultImage(context.Background(), fake.NewClientset(), "cnpg-system")
+	require.Error(t, err)
+}
+
+func TestCheckDefaultImageAdmitted(t *testing.T) {
+	require.NoError(t, checkDefaultImageAdmitted(nil))
+
+	err := checkDefaultImageAdmitted(errors.New(`admission policy denied request: CNPG Cluster must use pgEdge PostgreSQL images`))
+	require.ErrorContains(t, err, "operator default image is not a pgEdge image")
+
+	err = checkDefaultImageAdmitted(errors.New("connection refused"))
+	require.ErrorContains(t, err, "failed to create cluster")
+}
+
+func TestCNPGChartPath(t *testing.T) {
+	require.Equal(t, "/repo/charts/cloudnative-pg/v0.28.2",
+		cnpgChartPath("/repo", &CNPGOperatorConfig{Version: "1.29.1", ChartVersion: "0.28.2"}))
+	require.Equal(t, "/repo/charts/cloudnative-pg/v1.29.1",
+		cnpgChartPath("/repo", &CNPGOperatorConfig{Version: "1.29.1"}))
+}
+
+func TestUpgradeChartPath(t *testing.T) {
+	current := "/repo/charts/cloudnative-pg/v0.27.1"
+	require.Equal(t, "/repo/charts/cloudnative-pg/v0.28.2",
+		upgradeChartPath(current, &config.CNPGVersion{Version: "1.29.1", ChartVersion: "0.28.2"}))
+	require.Equal(t, "/repo/charts/cloudnative-pg/v1.29.1",
+		upgradeChartPath(current, &config.CNPGVersion{Version: "1.29.1"}))
+}
+
+// chartAPIsRender is a trimmed operator chart render with one CRD serving two versions and
+// webhooks on both
+const chartAPIsRender = `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusters.postgresql.cnpg.io
+spec:
+  group: postgresql.cnpg.io
+  names:
+    kind: Cluster
+    plural: clusters
+  versions:
+  - name: v1
+    served: true
+  - name: v2
+    served: true
+  - name: v1beta1
+    served: false
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: cnpg-validating-webhook-configuration
+webhooks:
+- name: vcluster.cnpg.io
+  rules:
+  - apiGroups:
+    - postgresql.cnpg.io
+    apiVersions:
+    - v1
+    - v2
+    resources:
+    - clusters
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cnpg-controller-manager-config
+`
+
+// newCNPGDiscovery returns a clientset whose discovery serves the given CNPG resource lists
+func newCNPGDiscovery(lists ...*metav1.APIResourceList) *fake.Clientset {
+	clientset := fake.NewClientset()
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = lists
+	return clientset
+}
+
+func TestCheckAPIVersionCompatibility(t *testing.T) {
+	apis, err := renderedChartAPIs(chartAPIsRender)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"Cluster": {"v1", "v2"}}, apis.Served)
+	require.Equal(t, map[string]string{"Cluster": "clusters"}, apis.Resources)
+	require.Len(t, apis.Webhooks["vcluster.cnpg.io"], 2)
+
+	v1 := &metav1.APIResourceList{
+		GroupVersion: "postgresql.cnpg.io/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "clusters", Kind: "Cluster", Namespaced: true},
+			{Name: "clusters/status", Kind: "Cluster", Namespaced: true},
+		},
+	}
+	// v2 is new in the chart, its webhook rule is covered by the chart's own CRD
+	require.NoError(t, checkChartAPIs(newCNPGDiscovery(v1), apis))
+
+	// Backup is served today but the chart has no CRD for it any more
+	withBackups := &metav1.APIResourceList{
+		GroupVersion: "postgresql.cnpg.io/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "clusters", Kind: "Cluster", Namespaced: true},
+			{Name: "backups", Kind: "Backup", Namespaced: true},
+		},
+	}
+	v1beta1 := &metav1.APIResourceList{
+		GroupVersion: "postgresql.cnpg.io/v1beta1",
+		APIResources: []metav1.APIResource{{Name: "clusters", Kind: "Cluster", Namespaced: true}},
+	}
+	err = checkChartAPIs(newCNPGDiscovery(withBackups, v1beta1), apis)
+	require.ErrorContains(t, err, "chart stops serving postgresql.cnpg.io/v1 Backup")
+	require.ErrorContains(t, err, "chart stops serving postgresql.cnpg.io/v1beta1 Cluster")
+
+	apis.Webhooks["vcluster.cnpg.io"] = append(apis.Webhooks["vcluster.cnpg.io"],
+		schema.GroupVersionResource{Group: "postgresql.cnpg.io", Version: "v3", Resource: "clusters"})
+	err = checkChartAPIs(newCNPGDiscovery(v1), apis)
+	require.ErrorContains(t, err, "webhook vcluster.cnpg.io matches postgresql.cnpg.io/v3 clusters")
+
+	err = checkChartAPIs(newCNPGDiscovery(v1), chartAPIs{})
+	require.ErrorContains(t, err, "chart renders no postgresql.cnpg.io CRDs")
+}
+
+func TestCheckAPIVersionCompatibilityChartRender(t *testing.T) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skip("helm is not installed")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	version := cfg.CNPGVersions[0]
+	chartPath := cnpgChartPath(findProjectRoot(t), &CNPGOperatorConfig{Version: version.Version, ChartVersion: version.ChartVersion})
+
+	rendered, err := renderChart(t, nil, chartPath)
+	require.NoError(t, err)
+	apis, err := renderedChartAPIs(rendered)
+	require.NoError(t, err)
+	require.Contains(t, apis.Served["Cluster"], "v1")
+	require.Equal(t, "clusters", apis.Resources["Cluster"])
+	require.NotEmpty(t, apis.Webhooks)
+
+	// A cluster serving exactly the chart's CRDs is compatible with it
+	lists := make(map[string]*metav1.APIResourceList)
+	var ordered []*metav1.APIResourceList
+	for kind, versions := range apis.Served {
+		for _, v := range versions {
+			gv := cnpgAPIGroup + "/" + v
+			if lists[gv] == nil {
+				lists[gv] = &metav1.APIResourceList{GroupVersion: gv}
+				ordered = append(ordered, lists[gv])
+			}
+			lists[gv].APIResources = append(lists[gv].APIResources,
+				metav1.APIResource{Name: apis.Resources[kind], Kind: kind, Namespaced: true})
+		}
+	}
+	require.NoError(t, checkChartAPIs(newCNPGDiscovery(ordered...), apis))
+}
+
+func TestWaitForNamespaceDeleted(t *testing.T) {
+	ctx := context.Background()
+
+	clientset := fake.NewClientset()
+	require.NoError(t, waitForNamespaceDeleted(ctx, clientset, "cnpg-system", time.Second, 10*time.Millisecond))
+
+	clientset = fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cnpg-system"}})
+	err := waitForNamespaceDeleted(ctx, clientset, "cnpg-system", 50*time.Millisecond, 10*time.Millisecond)
+	require.ErrorContains(t, err, "was not deleted within")
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = clientset.CoreV1().Namespaces().Delete(ctx, "cnpg-system", metav1.DeleteOptions{})
+	}()
+	require.NoError(t, waitForNamespaceDeleted(ctx, clientset, "cnpg-system", time.Second, 10*time.Millisecond))
+}
+
+func TestCheckPrimaryNotCoLocated(t *testing.T) {
+	ctx := context.Background()
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	primary := func(nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pg-1", Namespace: "default", Labels: map[string]string{
+				"cnpg.io/cluster": "pg", "cnpg.io/instanceRole": "primary",
+			}},
+			Spec: corev1.PodSpec{NodeName: nodeName},
+		}
+	}
+	operator := func(nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "cnpg-controller-manager-abc", Namespace: DefaultOperatorNamespace, Labels: map[string]string{
+				"app.kubernetes.io/name": "cloudnative-pg",
+			}},
+			Spec: corev1.PodSpec{NodeName: nodeName},
+		}
+	}
+
+	clientset := fake.NewClientset(node("worker"), primary("worker"), operator("worker"))
+	err := checkPrimaryNotCoLocated(ctx, clientset, DefaultOperatorNamespace, "default", "pg")
+	require.ErrorIs(t, err, errSingleNode)
+
+	// A tainted control plane does not give the scheduler room to separate them
+	controlPlane := node("control-plane")
+	controlPlane.Spec.Taints = []corev1.Taint{{Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule}}
+	clientset = fake.NewClientset(controlPlane, node("worker"), primary("worker"), operator("worker"))
+	err = checkPrimaryNotCoLocated(ctx, clientset, DefaultOperatorNamespace, "default", "pg")
+	require.ErrorIs(t, err, errSingleNode)
+
+	clientset = fake.NewClientset(node("worker"), node("worker2"), primary("worker"), operator("worker2"))
+	require.NoError(t, checkPrimaryNotCoLocated(ctx, clientset, DefaultOperatorNamespace, "default", "pg"))
+
+	clientset = fake.NewClientset(node("worker"), node("worker2"), primary("worker2"), operator("worker2"))
+	err = checkPrimaryNotCoLocated(ctx, clientset, DefaultOperatorNamespace, "default", "pg")
+	require.EqualError(t, err, "primary pg-1 and operator pod cnpg-controller-manager-abc both run on node worker2")
+
+	clientset = fake.NewClientset(node("worker"), node("worker2"), operator("worker2"))
+	err = checkPrimaryNotCoLocated(ctx, clientset, DefaultOperatorNamespace, "default", "pg")
+	require.ErrorContains(t, err, "cluster pg has no scheduled primary")
+}
+
+func TestClusterImage(t *testing.T) {
+	ctx := context.Background()
+	instance := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pgedge-1", Namespace: "default", Labels: map[string]string{
+			"cnpg.io/cluster": "pgedge", "cnpg.io/podRole": "instance",
+		}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: postgresContainerName, Image: "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard"}}},
+	}
+
+	_, err := clusterImage(ctx, fake.NewClientset(), newFakeDynamicClient(newCNPGCluster("default", "pgedge")), "default", "pgedge")
+	require.ErrorContains(t, err, "cluster pgedge has no resolved image yet")
+
+	// Before the operator reports status.image, the instance pods tell
+	image, err := clusterImage(ctx, fake.NewClientset(instance), newFakeDynamicClient(newCNPGCluster("default", "pgedge")), "default", "pgedge")
+	require.NoError(t, err)
+	require.Equal(t, "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard", image)
+
+	cluster := newCNPGCluster("default", "pgedge")
+	require.NoError(t, unstructured.SetNestedField(cluster.Object, "ghcr.io/pgedge/pgedge-postgres:18-spock5-standard", "status", "image"))
+	image, err = clusterImage(ctx, fake.NewClientset(instance), newFakeDynamicClient(cluster), "default", "pgedge")
+	require.NoError(t, err)
+	require.Equal(t, "ghcr.io/pgedge/pgedge-postgres:18-spock5-standard", image)
+
+	_, err = clusterImage(ctx, fake.NewClientset(), newFakeDynamicClient(), "default", "missing")
+	require.ErrorContains(t, err, "failed to get CNPG cluster default/missing")
+}
+
+func TestCheckAllowedImage(t *testing.T) {
+	prefixes := []string{"ghcr.io/pgedge/pgedge-postgres:", "mirror.example.com/pgedge/"}
+	require.NoError(t, checkAllowedImage("ghcr.io/pgedge/pgedge-postgres:17-spock5-standard", prefixes))
+	require.NoError(t, checkAllowedImage("mirror.example.com/pgedge/pgedge-postgres:17", prefixes))
+
+	err := checkAllowedImage("ghcr.io/cloudnative-pg/postgresql:17", prefixes)
+	require.ErrorContains(t, err, "image ghcr.io/cloudnative-pg/postgresql:17 is not a pgEdge image")
+}
@@ -0,0 +1,385 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ProvisionedObjects are the databases and roles a cluster chart declares in its values
+type ProvisionedObjects struct {
+	Databases []string
+	Roles     []string
+}
+
+// clusterValues mirrors the parts of the cluster chart values that provision databases and roles
+type clusterValues struct {
+	Cluster struct {
+		InitDB struct {
+			Database string `yaml:"database"`
+			Owner    string `yaml:"owner"`
+		} `yaml:"initdb"`
+		Roles []struct {
+			Name   string `yaml:"name"`
+			Ensure string `yaml:"ensure"`
+		} `yaml:"roles"`
+	} `yaml:"cluster"`
+}
+
+// ParseProvisionedObjects extracts the expected databases and roles from rendered chart values
+func ParseProvisionedObjects(values []byte) (ProvisionedObjects, error) {
+	var v clusterValues
+	if err := yaml.Unmarshal(values, &v); err != nil {
+		return ProvisionedObjects{}, fmt.Errorf("failed to parse chart values: %w", err)
+	}
+
+	var objects ProvisionedObjects
+	if v.Cluster.InitDB.Database != "" {
+		objects.Databases = append(objects.Databases, v.Cluster.InitDB.Database)
+	}
+	if v.Cluster.InitDB.Owner != "" {
+		objects.Roles = append(objects.Roles, v.Cluster.InitDB.Owner)
+	}
+	for _, role := range v.Cluster.Roles {
+		// Roles marked absent are expected to be dropped, not created
+		if role.Name == "" || role.Ensure == "absent" {
+			continue
+		}
+		objects.Roles = append(objects.Roles, role.Name)
+	}
+
+	return objects, nil
+}
+
+// databaseExists reports whether dbname is present in pg_database
+func databaseExists(ctx context.Context, conn *sql.DB, dbname string) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, dbname).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up database %s: %w", dbname, err)
+	}
+	return exists, nil
+}
+
+// roleExists reports whether role is present in pg_roles
+func roleExists(ctx context.Context, conn *sql.DB, role string) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, role).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up role %s: %w", role, err)
+	}
+	return exists, nil
+}
+
+// AssertDatabaseExists fails the test if dbname does not exist
+func AssertDatabaseExists(t *testing.T, conn *sql.DB, dbname string) {
+	t.Helper()
+
+	exists, err := databaseExists(context.Background(), conn, dbname)
+	require.NoError(t, err)
+	require.True(t, exists, "Database %s does not exist", dbname)
+}
+
+// AssertRoleExists fails the test if role does not exist
+func AssertRoleExists(t *testing.T, conn *sql.DB, role string) {
+	t.Helper()
+
+	exists, err := roleExists(context.Background(), conn, role)
+	require.NoError(t, err)
+	require.True(t, exists, "Role %s does not exist", role)
+}
+
+// AssertValuesProvisioned checks that every database and role declared in the chart values exists
+func AssertValuesProvisioned(t *testing.T, conn *sql.DB, values []byte) {
+	t.Helper()
+
+	objects, err := ParseProvisionedObjects(values)
+	require.NoError(t, err)
+
+	for _, db := range objects.Databases {
+		AssertDatabaseExists(t, conn, db)
+	}
+	for _, role := range objects.Roles {
+		AssertRoleExists(t, conn, role)
+	}
+}
+
+// OpenServiceConnection port-forwards to a PostgreSQL service and connects with the credentials
+// stored in a CNPG basic-auth secret (e.g. <cluster>-app). The returned func closes the
+// connection and the tunnel.
+func OpenServiceConnection(t *testing.T, opts *k8s.KubectlOptions, serviceName, secretName string) (*sql.DB, func(), error) {
+	t.Helper()
+	return OpenServiceConnectionToDatabase(t, opts, serviceName, secretName, "")
+}
+
+// OpenServiceConnectionToDatabase is OpenServiceConnection connecting to dbname instead of the
+// database named in the secret, e.g. for the <cluster>-superuser secret. An empty dbname keeps
+// the secret's database.
+func OpenServiceConnectionToDatabase(t *testing.T, opts *k8s.KubectlOptions, serviceName, secretName, dbname string) (*sql.DB, func(), error) {
+	t.Helper()
+
+	secret, err := k8s.GetSecretE(t, opts, secretName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read secret %s: %w", secretName, err)
+	}
+
+	secretData := secret.Data
+	if dbname != "" {
+		secretData = map[string][]byte{
+			"username": secret.Data["username"],
+			"password": secret.Data["password"],
+			"dbname":   []byte(dbname),
+		}
+	}
+
+	port, stopForward, err := PortForward(t, opts, "svc/"+serviceName, 0, postgresPort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dsn := connectionString(fmt.Sprintf("localhost:%d", port), secretData)
+	conn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		stopForward()
+		return nil, nil, fmt.Errorf("failed to open connection to %s: %w", serviceName, err)
+	}
+
+	closeFn := func() {
+		conn.Close()
+		stopForward()
+	}
+
+	if err := conn.PingContext(context.Background()); err != nil {
+		closeFn()
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", serviceName, err)
+	}
+
+	return conn, closeFn, nil
+}
+
+// connectionString builds a DSN for endpoint from the keys of a CNPG basic-auth secret
+func connectionString(endpoint string, secretData map[string][]byte) string {
+	dbname := string(secretData["dbname"])
+	if dbname == "" {
+		dbname = "app"
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(string(secretData["username"]), string(secretData["password"])),
+		Host:     endpoint,
+		Path:     "/" + dbname,
+		RawQuery: "sslmode=require",
+	}
+	return u.String()
+}
+
+// OpenDirectConnection connects to endpoint (host:port) with the credentials stored in a CNPG
+// basic-auth secret. Unlike OpenServiceConnection it does not tunnel through the API server.
+func OpenDirectConnection(t *testing.T, opts *k8s.KubectlOptions, endpoint, secretName string) (*sql.DB, error) {
+	t.Helper()
+
+	secret, err := k8s.GetSecretE(t, opts, secretName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", secretName, err)
+	}
+
+	conn, err := sql.Open("pgx", connectionString(endpoint, secret.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to %s: %w", endpoint, err)
+	}
+	if err := conn.PingContext(context.Background()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", endpoint, err)
+	}
+	return conn, nil
+}
+
+// connectionProbeInterval is how often AssertNoConnectionDrop queries the database
+const connectionProbeInterval = 500 * time.Millisecond
+
+// AssertNoConnectionDrop runs a trivial query on conn every connectionProbeInterval while during
+// executes, and fails if any query fails
+func AssertNoConnectionDrop(t *testing.T, conn *sql.DB, during func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	result := make(chan []string, 1)
+	go func() {
+		var failures []string
+		ticker := time.NewTicker(connectionProbeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				result <- failures
+				return
+			case now := <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				var one int
+				if err := conn.QueryRowContext(ctx, `SELECT 1`).Scan(&one); err != nil {
+					failures = append(failures, fmt.Sprintf("%s: %v", now.Format(time.RFC3339), err))
+				}
+				cancel()
+			}
+		}
+	}()
+
+	during()
+	close(done)
+
+	failures := <-result
+	require.Empty(t, failures, "Database connection dropped:\n%s", strings.Join(failures, "\n"))
+}
+
+// appSecretName returns the secret holding the app user's credentials and whether it is
+// managed externally, i.e. referenced by spec.bootstrap.initdb.secret rather than generated by
+// the operator as <cluster>-app
+func appSecretName(cluster *unstructured.Unstructured) (string, bool) {
+	if name, _, _ := unstructured.NestedString(cluster.Object, "spec", "bootstrap", "initdb", "secret", "name"); name != "" {
+		return name, true
+	}
+	return cluster.GetName() + "-app", false
+}
+
+// newPassword returns a random password for credential rotation
+func newPassword() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// appSecretURIKeys and appSecretJDBCKeys are the keys of an operator-generated app secret that
+// embed the password in a connection URI
+var (
+	appSecretURIKeys  = []string{"uri", "fqdn-uri"}
+	appSecretJDBCKeys = []string{"jdbc-uri", "fqdn-jdbc-uri"}
+)
+
+// rotatedSecretData returns a copy of data with password set to password and every key the
+// operator derives from it (uri, fqdn-uri, jdbc-uri, fqdn-jdbc-uri and pgpass) rewritten to match
+func rotatedSecretData(data map[string][]byte, password string) (map[string][]byte, error) {
+	rotated := make(map[string][]byte, len(data))
+	for k, v := range data {
+		rotated[k] = v
+	}
+	rotated["password"] = []byte(password)
+
+	for _, key := range appSecretURIKeys {
+		if _, ok := data[key]; !ok {
+			continue
+		}
+		u, err := url.Parse(string(data[key]))
+		if err != nil || u.User == nil {
+			return nil, fmt.Errorf("secret key %s is not a connection URI", key)
+		}
+		u.User = url.UserPassword(u.User.Username(), password)
+		rotated[key] = []byte(u.String())
+	}
+
+	for _, key := range appSecretJDBCKeys {
+		if _, ok := data[key]; !ok {
+			continue
+		}
+		u, err := url.Parse(strings.TrimPrefix(string(data[key]), "jdbc:"))
+		if err != nil {
+			return nil, fmt.Errorf("secret key %s is not a JDBC URI", key)
+		}
+		query := u.Query()
+		query.Set("password", password)
+		u.RawQuery = query.Encode()
+		rotated[key] = []byte("jdbc:" + u.String())
+	}
+
+	if pgpass, ok := data["pgpass"]; ok {
+		lines := strings.Split(string(pgpass), "\n")
+		for i, line := range lines {
+			// hostname:port:database:username:password
+			if fields := strings.SplitN(line, ":", 5); len(fields) == 5 {
+				fields[4] = password
+				lines[i] = strings.Join(fields, ":")
+			}
+		}
+		rotated["pgpass"] = []byte(strings.Join(lines, "\n"))
+	}
+	return rotated, nil
+}
+
+// pingWithCredentials opens a fresh connection to endpoint with the given secret data
+func pingWithCredentials(endpoint string, secretData map[string][]byte) error {
+	conn, err := sql.Open("pgx", connectionString(endpoint, secretData))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return conn.PingContext(ctx)
+}
+
+// RotateAppPassword sets a new password in the app user's secret, whether generated by the
+// operator or managed externally, along with the connection URIs and pgpass entry derived from it.
+// It waits for the operator to apply the password and checks that the new password works while
+// the old one is rejected. Skipped in short mode.
+func RotateAppPassword(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping credential rotation test in short mode")
+	}
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	cluster, err := dynClient.Resource(clusterGVR).Namespace(opts.Namespace).Get(ctx, clusterName, metav1.GetOptions{})
+	require.NoError(t, err, "Failed to get cluster %s", clusterName)
+	secretName, external := appSecretName(cluster)
+
+	secret, err := clientset.CoreV1().Secrets(opts.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	require.NoError(t, err, "Failed to get secret %s", secretName)
+	oldCredentials := secret.Data
+
+	password, err := newPassword()
+	require.NoError(t, err)
+	newCredentials, err := rotatedSecretData(oldCredentials, password)
+	require.NoError(t, err, "Failed to rotate secret %s", secretName)
+
+	patch, err := json.Marshal(map[string]interface{}{"data": newCredentials})
+	require.NoError(t, err)
+	_, err = clientset.CoreV1().Secrets(opts.Namespace).Patch(ctx, secretName, types.MergePatchType, patch, metav1.PatchOptions{})
+	require.NoError(t, err, "Failed to update password in secret %s", secretName)
+	t.Logf("Rotated password in secret %s (externally managed: %t)", secretName, external)
+
+	port, stopForward, err := PortForward(t, opts, "svc/"+clusterName+"-rw", 0, postgresPort)
+	require.NoError(t, err)
+	defer stopForward()
+	endpoint := fmt.Sprintf("localhost:%d", port)
+
+	_, err = retry.DoWithRetryE(t, "Wait for the new app password to be applied", 30, 5*time.Second, func() (string, error) {
+		return "", pingWithCredentials(endpoint, newCredentials)
+	})
+	require.NoError(t, err, "New app password was not applied")
+
+	require.Error(t, pingWithCredentials(endpoint, oldCredentials), "Old app password still works after rotation")
+}
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// driftReconcileTimeout bounds how long the operator may take to revert drift
+	driftReconcileTimeout = 2 * time.Minute
+	// driftPollInterval is how often the reverted resource is checked
+	driftPollInterval = 2 * time.Second
+)
+
+// waitForServiceRestored polls until the Service name exists again with a UID other than
+// deletedUID and the same selector it had before it was deleted
+func waitForServiceRestored(ctx context.Context, clientset kubernetes.Interface, namespace, name string, deletedUID types.UID, selector map[string]string, timeout, interval time.Duration) (time.Duration, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for {
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil && svc.UID != deletedUID:
+			if !reflect.DeepEqual(svc.Spec.Selector, selector) {
+				return 0, fmt.Errorf("service %s was recreated with selector %v, expected %v", name, svc.Spec.Selector, selector)
+			}
+			return time.Since(start), nil
+		case err != nil && !apierrors.IsNotFound(err):
+			return 0, fmt.Errorf("failed to get service %s: %w", name, err)
+		}
+
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("service %s/%s was not restored within %s", namespace, name, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// deleteAndAwaitService deletes a Service and waits for it to be restored
+func deleteAndAwaitService(ctx context.Context, clientset kubernetes.Interface, namespace, name string, timeout, interval time.Duration) (time.Duration, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get service %s: %w", name, err)
+	}
+	if err := clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return 0, fmt.Errorf("failed to delete service %s: %w", name, err)
+	}
+	return waitForServiceRestored(ctx, clientset, namespace, name, svc.UID, svc.Spec.Selector, timeout, interval)
+}
+
+// AssertDriftReconciliation deletes the read service (<cluster>-r) that CNPG manages and checks
+// the operator recreates it with the same selector within driftReconcileTimeout
+func AssertDriftReconciliation(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	serviceName := clusterName + "-r"
+	elapsed, err := deleteAndAwaitService(context.Background(), clientset, opts.Namespace, serviceName,
+		driftReconcileTimeout, driftPollInterval)
+	require.NoError(t, err, "Operator did not reconcile deleted service %s", serviceName)
+	t.Logf("Operator restored service %s after %s", serviceName, elapsed.Round(time.Second))
+}
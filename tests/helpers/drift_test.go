@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newClusterService returns a CNPG-style service selecting the instances of clusterName
+func newClusterService(namespace, name, clusterName string, uid types.UID) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: uid},
+		Spec: corev1.ServiceSpec{Selector: map[string]string{
+			"cnpg.io/cluster": clusterName,
+			"cnpg.io/podRole": "instance",
+		}},
+	}
+}
+
+func TestDeleteAndAwaitService(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset(newClusterService("default", "pg-r", "pg", "uid-1"))
+
+	// Simulate the operator recreating the service shortly after it is deleted
+	go func() {
+		for {
+			_, err := clientset.CoreV1().Services("default").Get(ctx, "pg-r", metav1.GetOptions{})
+			if err != nil {
+				time.Sleep(30 * time.Millisecond)
+				_, _ = clientset.CoreV1().Services("default").Create(ctx,
+					newClusterService("default", "pg-r", "pg", "uid-2"), metav1.CreateOptions{})
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	elapsed, err := deleteAndAwaitService(ctx, clientset, "default", "pg-r", time.Second, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Less(t, elapsed, time.Second)
+}
+
+func TestWaitForServiceRestored(t *testing.T) {
+	ctx := context.Background()
+	selector := newClusterService("default", "pg-r", "pg", "").Spec.Selector
+
+	// Never recreated
+	clientset := fake.NewClientset()
+	_, err := waitForServiceRestored(ctx, clientset, "default", "pg-r", "uid-1", selector, 50*time.Millisecond, 10*time.Millisecond)
+	require.ErrorContains(t, err, "not restored")
+
+	// Still the original object, so it was never deleted
+	clientset = fake.NewClientset(newClusterService("default", "pg-r", "pg", "uid-1"))
+	_, err = waitForServiceRestored(ctx, clientset, "default", "pg-r", "uid-1", selector, 50*time.Millisecond, 10*time.Millisecond)
+	require.ErrorContains(t, err, "not restored")
+
+	// Recreated pointing at another cluster
+	clientset = fake.NewClientset(newClusterService("default", "pg-r", "other", "uid-2"))
+	_, err = waitForServiceRestored(ctx, clientset, "default", "pg-r", "uid-1", selector, 50*time.Millisecond, 10*time.Millisecond)
+	require.ErrorContains(t, err, "recreated with selector")
+
+	clientset = fake.NewClientset(newClusterService("default", "pg-r", "pg", "uid-2"))
+	_, err = waitForServiceRestored(ctx, clientset, "default", "pg-r", "uid-1", selector, 50*time.Millisecond, 10*time.Millisecond)
+	require.NoError(t, err)
+}
@@ -2,16 +2,51 @@ package helpers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// clusterGVR identifies the CNPG Cluster custom resource
+var clusterGVR = schema.GroupVersionResource{Group: "postgresql.cnpg.io", Version: "v1", Resource: "clusters"}
+
+// systemNamespaces are never removed by ResetClusterState: the Kubernetes and Kind defaults plus
+// the shared operator and cert-manager installs tests reuse across runs
+var systemNamespaces = []string{
+	"default", "kube-system", "kube-public", "kube-node-lease", "local-path-storage",
+	DefaultOperatorNamespace, certManagerNamespace,
+}
+
+// InfrastructureNamespaceLabel marks the namespaces that exist once a provider has provisioned a
+// cluster, such as CSI, snapshot controller and cloud add-on namespaces. ResetClusterState keeps
+// them.
+const InfrastructureNamespaceLabel = "pgedge.io/test-infrastructure"
+
 // GetNodes returns the list of nodes in the cluster
 func GetNodes(t *testing.T, opts *k8s.KubectlOptions) ([]corev1.Node, error) {
 	t.Helper()
@@ -51,38 +86,100 @@ func GetStorageClasses(t *testing.T, opts *k8s.KubectlOptions) ([]string, error)
 	return names, nil
 }
 
+// volumeSnapshotClassGVR identifies the cluster-scoped CSI VolumeSnapshotClass resource
+var volumeSnapshotClassGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotclasses"}
+
+// VolumeSnapshotClass is a volume snapshot class and the CSI driver that takes its snapshots
+type VolumeSnapshotClass struct {
+	Name   string
+	Driver string
+}
+
+// listVolumeSnapshotClasses returns the volume snapshot classes sorted by name
+func listVolumeSnapshotClasses(ctx context.Context, dynClient dynamic.Interface) ([]VolumeSnapshotClass, error) {
+	list, err := dynClient.Resource(volumeSnapshotClassGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume snapshot classes: %w", err)
+	}
+
+	classes := make([]VolumeSnapshotClass, 0, len(list.Items))
+	for _, item := range list.Items {
+		driver, _, _ := unstructured.NestedString(item.Object, "driver")
+		classes = append(classes, VolumeSnapshotClass{Name: item.GetName(), Driver: driver})
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+	return classes, nil
+}
+
+// ListVolumeSnapshotClasses returns the volume snapshot classes with their drivers
+func ListVolumeSnapshotClasses(t *testing.T, opts *k8s.KubectlOptions) ([]VolumeSnapshotClass, error) {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return listVolumeSnapshotClasses(context.Background(), dynClient)
+}
+
 // GetVolumeSnapshotClasses returns the list of volume snapshot class names
 func GetVolumeSnapshotClasses(t *testing.T, opts *k8s.KubectlOptions) ([]string, error) {
 	t.Helper()
 
-	// Use kubectl to get volume snapshot classes since they require dynamic client
-	output, err := k8s.RunKubectlAndGetOutputE(t, opts, "get", "volumesnapshotclasses", "-o", "jsonpath={.items[*].metadata.name}")
+	classes, err := ListVolumeSnapshotClasses(t, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get volume snapshot classes: %w", err)
+		return nil, err
 	}
 
-	if output == "" {
-		return []string{}, nil
+	names := make([]string, len(classes))
+	for i, class := range classes {
+		names[i] = class.Name
 	}
+	return names, nil
+}
 
-	// Simple space-separated parsing
-	var names []string
-	current := ""
-	for _, c := range output {
-		if c == ' ' {
-			if current != "" {
-				names = append(names, current)
-				current = ""
+// checkE2EClasses verifies every *_STORAGE_CLASS and *_VOLUMESNAPSHOT_CLASS variable in env names
+// one of the given classes
+func checkE2EClasses(env map[string]string, storageClasses, snapshotClasses []string) error {
+	var keys []string
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		switch {
+		case strings.HasSuffix(key, "_VOLUMESNAPSHOT_CLASS"):
+			if !slices.Contains(snapshotClasses, env[key]) {
+				problems = append(problems, fmt.Sprintf("%s=%s: no such volume snapshot class (have %v)", key, env[key], snapshotClasses))
+			}
+		case strings.HasSuffix(key, "_STORAGE_CLASS"):
+			if !slices.Contains(storageClasses, env[key]) {
+				problems = append(problems, fmt.Sprintf("%s=%s: no such storage class (have %v)", key, env[key], storageClasses))
 			}
-		} else {
-			current += string(c)
 		}
 	}
-	if current != "" {
-		names = append(names, current)
+	if len(problems) > 0 {
+		return fmt.Errorf("E2E environment does not match the cluster:\n%s", strings.Join(problems, "\n"))
 	}
+	return nil
+}
 
-	return names, nil
+// VerifyE2EEnvMatchesCluster checks that the storage and volume snapshot classes the upstream
+// E2E environment refers to exist on the cluster, so a misconfigured run fails before ginkgo starts
+func VerifyE2EEnvMatchesCluster(t *testing.T, opts *k8s.KubectlOptions, env map[string]string) error {
+	t.Helper()
+
+	storageClasses, err := GetStorageClasses(t, opts)
+	if err != nil {
+		return err
+	}
+	snapshotClasses, err := GetVolumeSnapshotClasses(t, opts)
+	if err != nil {
+		return err
+	}
+	return checkE2EClasses(env, storageClasses, snapshotClasses)
 }
 
 // GetDeployment returns a deployment by name
@@ -110,8 +207,75 @@ func CRDExists(t *testing.T, opts *k8s.KubectlOptions, crdName string) (bool, er
 	return true, nil
 }
 
-// getClientset creates a Kubernetes clientset from kubeconfig
+// GetEvents returns the events of a namespace, oldest first
+func GetEvents(t *testing.T, opts *k8s.KubectlOptions, namespace string) ([]corev1.Event, error) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return getEvents(context.Background(), clientset, namespace)
+}
+
+// getEvents lists the events of a namespace ordered by when they last occurred
+func getEvents(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]corev1.Event, error) {
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events in %s: %w", namespace, err)
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+	})
+	return events.Items, nil
+}
+
+// findEvent returns the first event with the given reason whose message contains substr. An
+// empty reason matches any event.
+func findEvent(events []corev1.Event, reason, substr string) (*corev1.Event, bool) {
+	for i := range events {
+		e := &events[i]
+		if (reason == "" || e.Reason == reason) && strings.Contains(e.Message, substr) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// AssertEventContains checks that some event has the given reason and a message containing substr
+func AssertEventContains(t *testing.T, events []corev1.Event, reason, substr string) {
+	t.Helper()
+
+	if _, ok := findEvent(events, reason, substr); ok {
+		return
+	}
+	var seen []string
+	for _, e := range events {
+		seen = append(seen, fmt.Sprintf("%s %s/%s: %s", e.Reason, e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Message))
+	}
+	require.Failf(t, "Event not found", "No %q event containing %q among:\n%s", reason, substr, strings.Join(seen, "\n"))
+}
+
+// cachedClientset is a clientset built from a kubeconfig as it was at modTime
+type cachedClientset struct {
+	modTime   time.Time
+	clientset *kubernetes.Clientset
+}
+
+// clientsets caches a cachedClientset per kubeconfig path, so polling helpers don't parse the
+// kubeconfig on every call
+var clientsets sync.Map
+
+// getClientset creates a Kubernetes clientset from kubeconfig, reusing the one built before
+// unless the file has been modified since
 func getClientset(kubeconfigPath string) (*kubernetes.Clientset, error) {
+	info, statErr := os.Stat(kubeconfigPath)
+	if statErr == nil {
+		if cached, ok := clientsets.Load(kubeconfigPath); ok && cached.(cachedClientset).modTime.Equal(info.ModTime()) {
+			return cached.(cachedClientset).clientset, nil
+		}
+	}
+
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build config: %w", err)
@@ -122,9 +286,34 @@ func getClientset(kubeconfigPath string) (*kubernetes.Clientset, error) {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
+	// Without a file to watch for changes, e.g. an empty path, there is nothing to key the cache on
+	if statErr == nil {
+		clientsets.Store(kubeconfigPath, cachedClientset{modTime: info.ModTime(), clientset: clientset})
+	}
 	return clientset, nil
 }
 
+// GetClientset returns a clientset for the cluster of opts, shared with the other helpers using
+// the same kubeconfig
+func GetClientset(opts *k8s.KubectlOptions) (*kubernetes.Clientset, error) {
+	return getClientset(opts.ConfigPath)
+}
+
+// getDynamicClient creates a Kubernetes dynamic client from kubeconfig
+func getDynamicClient(kubeconfigPath string) (dynamic.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config: %w", err)
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	return client, nil
+}
+
 // ApplyManifest applies a Kubernetes manifest from a string
 func ApplyManifest(t *testing.T, opts *k8s.KubectlOptions, manifest string) error {
 	t.Helper()
@@ -149,6 +338,164 @@ func DeleteManifest(t *testing.T, opts *k8s.KubectlOptions, manifest string) err
 	return nil
 }
 
+// psqlExecArgs returns the kubectl arguments that run query with psql in pod, printing
+// unaligned tuples only
+func psqlExecArgs(pod, database, query string) []string {
+	args := []string{"exec", pod, "-c", postgresContainerName, "--", "psql", "-v", "ON_ERROR_STOP=1"}
+	if database != "" {
+		args = append(args, "-d", database)
+	}
+	return append(args, "-tAc", query)
+}
+
+// ExecSQL runs query with psql inside the primary of a CNPG cluster and returns its trimmed
+// output. On failure the error includes what psql printed to stderr.
+func ExecSQL(t *testing.T, opts *k8s.KubectlOptions, clusterName, database, query string) (string, error) {
+	t.Helper()
+
+	primary, err := primaryPodName(t, opts, clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := k8s.RunKubectlAndGetOutputE(t, opts, psqlExecArgs(primary, database, query)...)
+	if err != nil {
+		return "", fmt.Errorf("psql on %s failed: %w: %s", primary, err, strings.TrimSpace(output))
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// writeContainerLog streams a container's log into path
+func writeContainerLog(ctx context.Context, clientset kubernetes.Interface, namespace, pod, container string, previous bool, path string) error {
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+	}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get logs of %s/%s: %w", pod, container, err)
+	}
+	defer stream.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, stream); err != nil {
+		return fmt.Errorf("failed to write logs of %s/%s: %w", pod, container, err)
+	}
+	return nil
+}
+
+// collectLogs writes the current log of every container in namespace to
+// <outputDir>/<pod>_<container>.log, and the previous log of restarted containers to
+// <pod>_<container>.previous.log. It keeps going past individual failures and returns them all.
+func collectLogs(ctx context.Context, clientset kubernetes.Interface, namespace, outputDir string) error {
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods in %s: %w", namespace, err)
+	}
+
+	var errs []error
+	for _, pod := range pods.Items {
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			base := filepath.Join(outputDir, pod.Name+"_"+status.Name)
+			if err := writeContainerLog(ctx, clientset, namespace, pod.Name, status.Name, false, base+".log"); err != nil {
+				errs = append(errs, err)
+			}
+			if status.RestartCount == 0 {
+				continue
+			}
+			if err := writeContainerLog(ctx, clientset, namespace, pod.Name, status.Name, true, base+".previous.log"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CollectLogs writes the current and previous logs of every container in namespace, plus the
+// namespace's events, to files under outputDir
+func CollectLogs(t *testing.T, opts *k8s.KubectlOptions, namespace, outputDir string) error {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	logsErr := collectLogs(context.Background(), clientset, namespace, outputDir)
+
+	events, err := k8s.RunKubectlAndGetOutputE(t, opts, "get", "events", "-n", namespace, "--sort-by=.lastTimestamp")
+	if err != nil {
+		return errors.Join(logsErr, fmt.Errorf("failed to get events in %s: %w", namespace, err))
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "events.txt"), []byte(events+"\n"), 0o644); err != nil {
+		return errors.Join(logsErr, fmt.Errorf("failed to write events: %w", err))
+	}
+	return logsErr
+}
+
+// parsePortForwardResource splits a kubectl-style resource such as "svc/pgedge-rw" into its
+// tunnel type and name. A bare name is a pod.
+func parsePortForwardResource(resource string) (k8s.KubeResourceType, string, error) {
+	kind, name, found := strings.Cut(resource, "/")
+	if !found {
+		kind, name = "pod", resource
+	}
+	if name == "" {
+		return 0, "", fmt.Errorf("invalid port-forward resource %q", resource)
+	}
+
+	switch kind {
+	case "pod", "pods", "po":
+		return k8s.ResourceTypePod, name, nil
+	case "service", "services", "svc":
+		return k8s.ResourceTypeService, name, nil
+	case "deployment", "deployments", "deploy":
+		return k8s.ResourceTypeDeployment, name, nil
+	default:
+		return 0, "", fmt.Errorf("cannot port-forward to %q, only pods, services and deployments are supported", resource)
+	}
+}
+
+// PortForward forwards localPort to remotePort of resource (e.g. "svc/pgedge-rw" or "pod/pgedge-1-1")
+// and returns the local port in use with a function that stops the forward. With localPort 0 a
+// free port is picked.
+func PortForward(t *testing.T, opts *k8s.KubectlOptions, resource string, localPort, remotePort int) (int, func(), error) {
+	t.Helper()
+
+	resourceType, name, err := parsePortForwardResource(resource)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tunnel := k8s.NewTunnel(opts, resourceType, name, localPort, remotePort)
+	if err := tunnel.ForwardPortE(t); err != nil {
+		return 0, nil, fmt.Errorf("failed to port-forward to %s: %w", resource, err)
+	}
+
+	_, port, err := net.SplitHostPort(tunnel.Endpoint())
+	if err != nil {
+		tunnel.Close()
+		return 0, nil, fmt.Errorf("invalid tunnel endpoint %q: %w", tunnel.Endpoint(), err)
+	}
+	chosen, err := strconv.Atoi(port)
+	if err != nil {
+		tunnel.Close()
+		return 0, nil, fmt.Errorf("invalid tunnel endpoint %q: %w", tunnel.Endpoint(), err)
+	}
+	return chosen, tunnel.Close, nil
+}
+
 // CreateSecret creates a Kubernetes secret
 func CreateSecret(t *testing.T, opts *k8s.KubectlOptions, name string, data map[string]string) error {
 	t.Helper()
@@ -179,50 +526,134 @@ func CreateSecret(t *testing.T, opts *k8s.KubectlOptions, name string, data map[
 	return nil
 }
 
-// checkPodsReady returns true if at least expectedCount pods matching labelSelector are ready.
-func checkPodsReady(configPath, namespace, labelSelector string, expectedCount int) (bool, error) {
-	clientset, err := getClientset(configPath)
-	if err != nil {
-		return false, err
-	}
-	pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
+const (
+	// podsReadyRetryInterval is the time one retry of WaitForPodsReady stands for
+	podsReadyRetryInterval = 5 * time.Second
+	// podsListRetryInterval is the pause before listing pods again after a failed API call
+	podsListRetryInterval = 2 * time.Second
+)
+
+// listReadyPods lists the pods matching labelSelector, records the Ready ones in ready and
+// returns the resource version to watch from
+func listReadyPods(ctx context.Context, clientset kubernetes.Interface, namespace, labelSelector string, ready map[string]bool) (string, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 	if err != nil {
-		return false, err
+		return "", fmt.Errorf("failed to list pods: %w", err)
 	}
-	if len(pods.Items) < expectedCount {
-		return false, nil
-	}
-	readyCount := 0
-	for _, pod := range pods.Items {
-		if isPodReady(&pod) {
-			readyCount++
+	clear(ready)
+	for i := range pods.Items {
+		if isPodReady(&pods.Items[i]) {
+			ready[pods.Items[i].Name] = true
 		}
 	}
-	return readyCount >= expectedCount, nil
+	return pods.ResourceVersion, nil
 }
 
-// WaitForPodsReady waits for a number of pods matching a label selector to be ready
-func WaitForPodsReady(t *testing.T, opts *k8s.KubectlOptions, labelSelector string, expectedCount int, retries int) error {
-	t.Helper()
-
+// waitForPodsReady watches the pods matching labelSelector until expectedCount of them are
+// Ready, an error arrives on pullErrs or ctx is done. Failed API calls are retried every
+// retryInterval, since the API server may be briefly unavailable.
+func waitForPodsReady(ctx context.Context, clientset kubernetes.Interface, namespace, labelSelector string, expectedCount int, retryInterval time.Duration, pullErrs <-chan error) error {
+	ready := map[string]bool{}
 	var lastErr error
-	for i := 0; i < retries; i++ {
-		ready, err := checkPodsReady(opts.ConfigPath, opts.Namespace, labelSelector, expectedCount)
+	for {
+		if lastErr != nil {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("timeout waiting for %d pods to be ready: %w", expectedCount, lastErr)
+			case err := <-pullErrs:
+				return err
+			case <-time.After(retryInterval):
+			}
+		}
+
+		resourceVersion, err := listReadyPods(ctx, clientset, namespace, labelSelector, ready)
 		if err != nil {
 			lastErr = err
 			continue
 		}
-		if ready {
+		if len(ready) >= expectedCount {
 			return nil
 		}
+
+		watcher, err := clientset.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{
+			LabelSelector:   labelSelector,
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			lastErr = fmt.Errorf("failed to watch pods: %w", err)
+			continue
+		}
+		lastErr = nil
+
+		done, err := watchPodsReady(ctx, watcher, ready, expectedCount, pullErrs)
+		watcher.Stop()
+		if done || err != nil {
+			return err
+		}
+		// The watch closed, typically on a server-side timeout; list again and resume
 	}
+}
 
-	if lastErr != nil {
-		return fmt.Errorf("timeout waiting for %d pods to be ready: %w", expectedCount, lastErr)
+// watchPodsReady applies pod events to ready until expectedCount pods are Ready. done is false
+// when the watch closed before that.
+func watchPodsReady(ctx context.Context, watcher watch.Interface, ready map[string]bool, expectedCount int, pullErrs <-chan error) (done bool, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return true, fmt.Errorf("timeout waiting for %d pods to be ready (%d ready): %w", expectedCount, len(ready), ctx.Err())
+		case err := <-pullErrs:
+			return true, err
+		case ev, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			pod, ok := ev.Object.(*corev1.Pod)
+			if !ok {
+				continue
+			}
+			if ev.Type == watch.Deleted || !isPodReady(pod) {
+				delete(ready, pod.Name)
+			} else {
+				ready[pod.Name] = true
+			}
+			if len(ready) >= expectedCount {
+				return true, nil
+			}
+		}
 	}
-	return fmt.Errorf("timeout waiting for %d pods to be ready", expectedCount)
+}
+
+// WaitForPodsReadyWithContext waits until expectedCount pods matching labelSelector are Ready,
+// failing early when an image of one of those pods cannot be pulled
+func WaitForPodsReadyWithContext(ctx context.Context, t *testing.T, opts *k8s.KubectlOptions, labelSelector string, expectedCount int) error {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pullErrs := make(chan error, 1)
+	since := time.Now()
+	go func() {
+		if err := watchForImagePullErrors(ctx, clientset, opts.Namespace, labelSelector, since); err != nil {
+			pullErrs <- err
+		}
+	}()
+
+	return waitForPodsReady(ctx, clientset, opts.Namespace, labelSelector, expectedCount, podsListRetryInterval, pullErrs)
+}
+
+// WaitForPodsReady waits for a number of pods matching a label selector to be ready. Each retry
+// stands for podsReadyRetryInterval of waiting.
+func WaitForPodsReady(t *testing.T, opts *k8s.KubectlOptions, labelSelector string, expectedCount int, retries int) error {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(retries)*podsReadyRetryInterval)
+	defer cancel()
+	return WaitForPodsReadyWithContext(ctx, t, opts, labelSelector, expectedCount)
 }
 
 // isPodReady checks if a pod is ready
@@ -234,3 +665,309 @@ func isPodReady(pod *corev1.Pod) bool {
 	}
 	return false
 }
+
+// MarkInfrastructureNamespaces labels every namespace that exists now with
+// InfrastructureNamespaceLabel. Providers call it once provisioning is done, so a later
+// ResetClusterState keeps what they installed.
+func MarkInfrastructureNamespaces(t *testing.T, opts *k8s.KubectlOptions) error {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	return markInfrastructureNamespaces(context.Background(), clientset)
+}
+
+// markInfrastructureNamespaces implements MarkInfrastructureNamespaces against the given clientset
+func markInfrastructureNamespaces(ctx context.Context, clientset kubernetes.Interface) error {
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:"true"}}}`, InfrastructureNamespaceLabel)
+	for _, ns := range namespaces.Items {
+		if ns.Labels[InfrastructureNamespaceLabel] == "true" {
+			continue
+		}
+		_, err := clientset.CoreV1().Namespaces().Patch(ctx, ns.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to label namespace %s: %w", ns.Name, err)
+		}
+	}
+	return nil
+}
+
+// ResetClusterState deletes every CNPG Cluster and every namespace that is neither a system nor an
+// infrastructure namespace nor listed in preserveNamespaces, then waits for the namespaces to
+// finish terminating.
+// This gives tests running on a reused cluster a clean slate.
+func ResetClusterState(t *testing.T, opts *k8s.KubectlOptions, preserveNamespaces []string) error {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	t.Log("Resetting cluster state for reuse")
+	return resetClusterState(context.Background(), clientset, dynClient, preserveNamespaces, 5*time.Minute)
+}
+
+// resetClusterState implements ResetClusterState against the given clients.
+func resetClusterState(ctx context.Context, clientset kubernetes.Interface, dynClient dynamic.Interface, preserveNamespaces []string, timeout time.Duration) error {
+	clusters, err := dynClient.Resource(clusterGVR).Namespace("").List(ctx, metav1.ListOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to list CNPG clusters: %w", err)
+	}
+	if err == nil {
+		for _, c := range clusters.Items {
+			err := dynClient.Resource(clusterGVR).Namespace(c.GetNamespace()).Delete(ctx, c.GetName(), metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete CNPG cluster %s/%s: %w", c.GetNamespace(), c.GetName(), err)
+			}
+		}
+	}
+
+	preserved := make(map[string]bool)
+	for _, ns := range append(systemNamespaces, preserveNamespaces...) {
+		preserved[ns] = true
+	}
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var deleted []string
+	for _, ns := range namespaces.Items {
+		if preserved[ns.Name] || ns.Labels[InfrastructureNamespaceLabel] == "true" {
+			continue
+		}
+		err := clientset.CoreV1().Namespaces().Delete(ctx, ns.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete namespace %s: %w", ns.Name, err)
+		}
+		deleted = append(deleted, ns.Name)
+	}
+
+	// Namespaces stay in Terminating until finalizers on their contents clear
+	deadline := time.Now().Add(timeout)
+	for _, name := range deleted {
+		for {
+			_, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timeout waiting for namespace %s to be deleted", name)
+			}
+			time.Sleep(2 * time.Second)
+		}
+	}
+
+	return nil
+}
+
+// imagePullFailureMarkers identify kubelet events caused by an image that cannot be pulled
+var imagePullFailureMarkers = []string{"ErrImagePull", "ImagePullBackOff", "Failed to pull image", "Back-off pulling image"}
+
+// imageNamePattern extracts the quoted image name from kubelet pull event messages
+var imageNamePattern = regexp.MustCompile(`image "([^"]+)"`)
+
+// imagePullError returns an error naming the image if the event reports a pull failure
+func imagePullError(event *corev1.Event) error {
+	switch event.Reason {
+	case "Failed", "BackOff", "ErrImagePull", "ImagePullBackOff":
+	default:
+		return nil
+	}
+
+	for _, marker := range imagePullFailureMarkers {
+		if strings.Contains(event.Message, marker) || event.Reason == marker {
+			image := "unknown image"
+			if m := imageNamePattern.FindStringSubmatch(event.Message); len(m) == 2 {
+				image = m[1]
+			}
+			return fmt.Errorf("failed to pull image %s for %s/%s: %s",
+				image, strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name, event.Message)
+		}
+	}
+	return nil
+}
+
+// imagePullWatchRetryInterval is the pause before listing events again after the watch closed or
+// an API call failed
+const imagePullWatchRetryInterval = 2 * time.Second
+
+// WatchForImagePullErrors watches events in namespace and returns as soon as one reports an image
+// pull failure for a pod matching labelSelector, naming the image. Events last seen before the
+// call are ignored. It returns nil when ctx is cancelled.
+func WatchForImagePullErrors(ctx context.Context, t *testing.T, opts *k8s.KubectlOptions, namespace, labelSelector string) error {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return watchForImagePullErrors(ctx, clientset, namespace, labelSelector, time.Now())
+}
+
+// imagePullFilter picks the pull failures that concern a wait: events involving pods that match
+// selector, last seen no earlier than since
+type imagePullFilter struct {
+	clientset kubernetes.Interface
+	namespace string
+	selector  labels.Selector
+	since     time.Time
+	// matched caches whether an involved pod matches selector
+	matched map[string]bool
+}
+
+// eventTime returns when event was last seen
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// pullError returns the image pull failure event reports, if it concerns the wait
+func (f *imagePullFilter) pullError(ctx context.Context, event *corev1.Event) error {
+	pullErr := imagePullError(event)
+	if pullErr == nil || event.InvolvedObject.Kind != "Pod" || eventTime(event).Before(f.since) {
+		return nil
+	}
+
+	name := event.InvolvedObject.Name
+	matched, ok := f.matched[name]
+	if !ok {
+		pod, err := f.clientset.CoreV1().Pods(f.namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			matched = f.selector.Matches(labels.Set(pod.Labels))
+			f.matched[name] = matched
+		case apierrors.IsNotFound(err):
+			// A pod that is gone cannot hold up the wait
+			f.matched[name] = false
+		}
+	}
+	if !matched {
+		return nil
+	}
+	return pullErr
+}
+
+// check lists the namespace's events, since pods may already be backing off before the watch
+// starts, then watches from there until the watch closes
+func (f *imagePullFilter) check(ctx context.Context) error {
+	events, err := f.clientset.CoreV1().Events(f.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	for i := range events.Items {
+		if pullErr := f.pullError(ctx, &events.Items[i]); pullErr != nil {
+			return pullErr
+		}
+	}
+
+	watcher, err := f.clientset.CoreV1().Events(f.namespace).Watch(ctx, metav1.ListOptions{
+		ResourceVersion: events.ResourceVersion,
+	})
+	if err != nil {
+		return nil
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil
+			}
+			if ev.Type != watch.Added && ev.Type != watch.Modified {
+				continue
+			}
+			event, ok := ev.Object.(*corev1.Event)
+			if !ok {
+				continue
+			}
+			if pullErr := f.pullError(ctx, event); pullErr != nil {
+				return pullErr
+			}
+		}
+	}
+}
+
+// watchForImagePullErrors implements WatchForImagePullErrors against the given clientset. When
+// the server closes the watch or an API call fails, it lists and watches again.
+func watchForImagePullErrors(ctx context.Context, clientset kubernetes.Interface, namespace, labelSelector string, since time.Time) error {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return fmt.Errorf("invalid label selector %q: %w", labelSelector, err)
+	}
+	f := &imagePullFilter{
+		clientset: clientset,
+		namespace: namespace,
+		selector:  selector,
+		// Event timestamps only have second precision
+		since:   since.Truncate(time.Second),
+		matched: map[string]bool{},
+	}
+
+	for {
+		// Failed API calls are not pull errors; the wait this guards reports its own timeout
+		if pullErr := f.check(ctx); pullErr != nil {
+			return pullErr
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(imagePullWatchRetryInterval):
+		}
+	}
+}
+
+// watchImagePulls runs an image pull watch for the pods matching labelSelector in the background
+// for readiness waits. pullErr reports the pull failure seen so far, if any; stop ends the watch.
+func watchImagePulls(kubeconfigPath, namespace, labelSelector string) (pullErr func() error, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	since := time.Now()
+
+	go func() {
+		clientset, err := getClientset(kubeconfigPath)
+		if err != nil {
+			// Readiness waits report their own client errors
+			return
+		}
+		if err := watchForImagePullErrors(ctx, clientset, namespace, labelSelector, since); err != nil {
+			errCh <- err
+		}
+	}()
+
+	var seen error
+	pullErr = func() error {
+		if seen == nil {
+			select {
+			case seen = <-errCh:
+			default:
+			}
+		}
+		return seen
+	}
+
+	return pullErr, cancel
+}
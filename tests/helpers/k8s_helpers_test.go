@@ -0,0 +1,393 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeDynamicClient returns a fake dynamic client that knows how to list CNPG resources and
+// volume snapshot classes
+func newFakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			clusterGVR:             "ClusterList",
+			poolerGVR:              "PoolerList",
+			backupGVR:              "BackupList",
+			volumeSnapshotClassGVR: "VolumeSnapshotClassList",
+			serviceCIDRGVRs[0]:     "ServiceCIDRList",
+			serviceCIDRGVRs[1]:     "ServiceCIDRList",
+		}, objects...)
+}
+
+// newCNPGCluster returns an unstructured CNPG Cluster for fake clients
+func newCNPGCluster(namespace, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("postgresql.cnpg.io/v1")
+	u.SetKind("Cluster")
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+func TestResetClusterState(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: DefaultOperatorNamespace}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "amazon-cloudwatch"}},
+	)
+	// Provisioning is done; tests create namespaces from here on
+	require.NoError(t, markInfrastructureNamespaces(ctx, clientset))
+	for _, name := range []string{"test-created", "keep-me"} {
+		_, err := clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	dynClient := newFakeDynamicClient(newCNPGCluster("test-created", "leftover"))
+
+	err := resetClusterState(ctx, clientset, dynClient, []string{"keep-me"}, time.Minute)
+	require.NoError(t, err)
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.Name)
+	}
+	require.ElementsMatch(t, []string{"kube-system", DefaultOperatorNamespace, "amazon-cloudwatch", "keep-me"}, names)
+
+	clusters, err := dynClient.Resource(clusterGVR).Namespace("").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, clusters.Items)
+}
+
+func TestWatchForImagePullErrors(t *testing.T) {
+	since := time.Now()
+	pullFailed := func(name, pod, tag string, seen time.Time) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod},
+			Reason:         "Failed",
+			Message:        `Failed to pull image "ghcr.io/pgedge/pgedge-postgres:` + tag + `": not found`,
+			LastTimestamp:  metav1.NewTime(seen),
+		}
+	}
+
+	clientset := fake.NewClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-1", Namespace: "default", Labels: map[string]string{"app": "db"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other-1", Namespace: "default", Labels: map[string]string{"app": "other"}}},
+		// Left over from an earlier pod with the same name
+		pullFailed("stale", "db-1", "stale", since.Add(-time.Hour)),
+		// Belongs to a pod the wait is not about
+		pullFailed("unrelated-pod", "other-1", "unrelated", since),
+	)
+	watchers := []*watch.FakeWatcher{watch.NewFake(), watch.NewFake()}
+	var watches int
+	clientset.PrependWatchReactor("events", func(k8stesting.Action) (bool, watch.Interface, error) {
+		w := watchers[min(watches, len(watchers)-1)]
+		watches++
+		return true, w, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- watchForImagePullErrors(ctx, clientset, "default", "app=db", since)
+	}()
+
+	// An unrelated event must not trigger a failure
+	watchers[0].Add(&corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "scheduled", Namespace: "default"},
+		Reason:     "Scheduled",
+		Message:    "Successfully assigned default/db-1 to worker",
+	})
+	// The server closing the watch must not end it
+	watchers[0].Stop()
+	watchers[1].Add(pullFailed("pull-failed", "db-1", "99-missing", since.Add(time.Second)))
+
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "ghcr.io/pgedge/pgedge-postgres:99-missing")
+		require.Contains(t, err.Error(), "pod/db-1")
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for image pull error")
+	}
+}
+
+func TestWaitForPodsReady(t *testing.T) {
+	pod := func(name string, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "db"}},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}},
+		}
+	}
+
+	t.Run("already ready", func(t *testing.T) {
+		clientset := fake.NewClientset(pod("db-1", true), pod("db-2", true), pod("other", true))
+		require.NoError(t, waitForPodsReady(context.Background(), clientset, "default", "app=db", 2, time.Millisecond, nil))
+	})
+
+	t.Run("becomes ready", func(t *testing.T) {
+		clientset := fake.NewClientset(pod("db-1", true), pod("db-2", false))
+		fakeWatch := watch.NewFake()
+		clientset.PrependWatchReactor("pods", k8stesting.DefaultWatchReactor(fakeWatch, nil))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- waitForPodsReady(ctx, clientset, "default", "app=db", 2, time.Millisecond, nil)
+		}()
+
+		// Losing a ready pod must not count towards the total
+		fakeWatch.Delete(pod("db-1", true))
+		fakeWatch.Modify(pod("db-2", true))
+		fakeWatch.Add(pod("db-3", true))
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		clientset := fake.NewClientset(pod("db-1", false))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := waitForPodsReady(ctx, clientset, "default", "app=db", 1, time.Millisecond, nil)
+		require.ErrorContains(t, err, "timeout waiting for 1 pods to be ready (0 ready)")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("transient list error", func(t *testing.T) {
+		clientset := fake.NewClientset(pod("db-1", true))
+		failures := 2
+		clientset.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			if failures == 0 {
+				return false, nil, nil
+			}
+			failures--
+			return true, nil, errors.New("the server is currently unable to handle the request")
+		})
+		require.NoError(t, waitForPodsReady(context.Background(), clientset, "default", "app=db", 1, time.Millisecond, nil))
+		require.Zero(t, failures)
+	})
+
+	t.Run("list keeps failing", func(t *testing.T) {
+		clientset := fake.NewClientset(pod("db-1", true))
+		clientset.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := waitForPodsReady(ctx, clientset, "default", "app=db", 1, time.Millisecond, nil)
+		require.ErrorContains(t, err, "timeout waiting for 1 pods to be ready: failed to list pods: connection refused")
+	})
+
+	t.Run("image pull error", func(t *testing.T) {
+		clientset := fake.NewClientset(pod("db-1", false))
+		pullErrs := make(chan error, 1)
+		pullErrs <- errors.New("image pull failed")
+		err := waitForPodsReady(context.Background(), clientset, "default", "app=db", 1, time.Millisecond, pullErrs)
+		require.EqualError(t, err, "image pull failed")
+	})
+}
+
+func TestListVolumeSnapshotClasses(t *testing.T) {
+	snapshotClass := func(name, driver string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("snapshot.storage.k8s.io/v1")
+		u.SetKind("VolumeSnapshotClass")
+		u.SetName(name)
+		require.NoError(t, unstructured.SetNestedField(u.Object, driver, "driver"))
+		require.NoError(t, unstructured.SetNestedField(u.Object, "Delete", "deletionPolicy"))
+		return u
+	}
+
+	classes, err := listVolumeSnapshotClasses(context.Background(), newFakeDynamicClient())
+	require.NoError(t, err)
+	require.Empty(t, classes)
+
+	dynClient := newFakeDynamicClient(
+		snapshotClass("ebs-snapshot-class", "ebs.csi.aws.com"),
+		snapshotClass("csi-hostpath-snapclass", "hostpath.csi.k8s.io"),
+	)
+	classes, err = listVolumeSnapshotClasses(context.Background(), dynClient)
+	require.NoError(t, err)
+	require.Equal(t, []VolumeSnapshotClass{
+		{Name: "csi-hostpath-snapclass", Driver: "hostpath.csi.k8s.io"},
+		{Name: "ebs-snapshot-class", Driver: "ebs.csi.aws.com"},
+	}, classes)
+}
+
+func TestGetClientsetCache(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: secret
+`), 0o600))
+
+	first, err := getClientset(kubeconfig)
+	require.NoError(t, err)
+	second, err := GetClientset(&k8s.KubectlOptions{ConfigPath: kubeconfig})
+	require.NoError(t, err)
+	require.Same(t, first, second)
+
+	// A rewritten kubeconfig, e.g. after the cluster was recreated, is parsed again
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(kubeconfig, later, later))
+	third, err := getClientset(kubeconfig)
+	require.NoError(t, err)
+	require.NotSame(t, first, third)
+
+	_, err = getClientset(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestGetEvents(t *testing.T) {
+	now := time.Now()
+	event := func(name, reason, message string, at time.Time) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Cluster", Name: "pg"},
+			Reason:         reason,
+			Message:        message,
+			LastTimestamp:  metav1.NewTime(at),
+		}
+	}
+	clientset := fake.NewClientset(
+		event("pg.2", "CreatingPodDisruptionBudget", "Creating PodDisruptionBudget pg-primary", now),
+		event("pg.1", "CreatingServiceAccount", "Creating ServiceAccount", now.Add(-time.Minute)),
+	)
+
+	events, err := getEvents(context.Background(), clientset, "default")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, "pg.1", events[0].Name)
+
+	e, ok := findEvent(events, "CreatingPodDisruptionBudget", "pg-primary")
+	require.True(t, ok)
+	require.Equal(t, "pg.2", e.Name)
+	_, ok = findEvent(events, "", "ServiceAccount")
+	require.True(t, ok)
+	_, ok = findEvent(events, "CreatingServiceAccount", "pg-primary")
+	require.False(t, ok)
+
+	AssertEventContains(t, events, "CreatingServiceAccount", "Creating")
+}
+
+func TestPsqlExecArgs(t *testing.T) {
+	require.Equal(t,
+		[]string{"exec", "pg-1", "-c", "postgres", "--", "psql", "-v", "ON_ERROR_STOP=1", "-d", "app", "-tAc", "SELECT count(*) FROM t"},
+		psqlExecArgs("pg-1", "app", "SELECT count(*) FROM t"))
+	require.Equal(t,
+		[]string{"exec", "pg-1", "-c", "postgres", "--", "psql", "-v", "ON_ERROR_STOP=1", "-tAc", "SELECT 1"},
+		psqlExecArgs("pg-1", "", "SELECT 1"))
+}
+
+func TestCollectLogs(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "pgedge", Name: "pgedge-1-1"},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{Name: "bootstrap-controller"}},
+				ContainerStatuses:     []corev1.ContainerStatus{{Name: "postgres", RestartCount: 2}},
+			},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "ignored"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "main"}}}},
+	)
+	outputDir := filepath.Join(t.TempDir(), "logs")
+
+	require.NoError(t, collectLogs(context.Background(), clientset, "pgedge", outputDir))
+
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{
+		"pgedge-1-1_bootstrap-controller.log",
+		"pgedge-1-1_postgres.log",
+		"pgedge-1-1_postgres.previous.log",
+	}, names)
+
+	// The fake clientset returns a fixed body for every log request
+	data, err := os.ReadFile(filepath.Join(outputDir, "pgedge-1-1_postgres.log"))
+	require.NoError(t, err)
+	require.Equal(t, "fake logs", string(data))
+}
+
+func TestParsePortForwardResource(t *testing.T) {
+	for resource, expected := range map[string]struct {
+		kind k8s.KubeResourceType
+		name string
+	}{
+		"svc/pgedge-rw":       {k8s.ResourceTypeService, "pgedge-rw"},
+		"service/pgedge-r":    {k8s.ResourceTypeService, "pgedge-r"},
+		"pod/pgedge-1-1":      {k8s.ResourceTypePod, "pgedge-1-1"},
+		"pgedge-1-2":          {k8s.ResourceTypePod, "pgedge-1-2"},
+		"deploy/cnpg-manager": {k8s.ResourceTypeDeployment, "cnpg-manager"},
+	} {
+		kind, name, err := parsePortForwardResource(resource)
+		require.NoError(t, err, resource)
+		require.Equal(t, expected.kind, kind, resource)
+		require.Equal(t, expected.name, name, resource)
+	}
+
+	_, _, err := parsePortForwardResource("statefulset/pgedge")
+	require.ErrorContains(t, err, "only pods, services and deployments")
+	_, _, err = parsePortForwardResource("svc/")
+	require.Error(t, err)
+}
+
+func TestCheckE2EClasses(t *testing.T) {
+	env := map[string]string{
+		"E2E_DEFAULT_STORAGE_CLASS":        "csi-hostpath-sc",
+		"E2E_CSI_STORAGE_CLASS":            "csi-hostpath-sc",
+		"E2E_DEFAULT_VOLUMESNAPSHOT_CLASS": "csi-hostpath-snapclass",
+		"POSTGRES_IMG":                     "ghcr.io/pgedge/pgedge-postgres:17",
+	}
+	storageClasses := []string{"standard", "csi-hostpath-sc"}
+
+	require.NoError(t, checkE2EClasses(env, storageClasses, []string{"csi-hostpath-snapclass"}))
+
+	err := checkE2EClasses(env, storageClasses, nil)
+	require.ErrorContains(t, err, "E2E_DEFAULT_VOLUMESNAPSHOT_CLASS=csi-hostpath-snapclass: no such volume snapshot class")
+
+	err = checkE2EClasses(env, []string{"standard"}, []string{"csi-hostpath-snapclass"})
+	require.ErrorContains(t, err, "E2E_CSI_STORAGE_CLASS=csi-hostpath-sc: no such storage class (have [standard])")
+	require.ErrorContains(t, err, "E2E_DEFAULT_STORAGE_CLASS=csi-hostpath-sc: no such storage class")
+}
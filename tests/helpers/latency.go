@@ -0,0 +1,143 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// netemImage provides tc for the ephemeral containers shaping pod traffic
+	netemImage = "nicolaka/netshoot:v0.13"
+	// netemInterface is the pod network interface delayed by InjectNetworkLatency
+	netemInterface = "eth0"
+	// ephemeralContainerTimeout bounds how long a tc run in an ephemeral container may take,
+	// including pulling netemImage
+	ephemeralContainerTimeout = 3 * time.Minute
+)
+
+// errLatencyUnsupported is returned when tc cannot run with NET_ADMIN next to the instance, e.g.
+// because pod security forbids the capability or the kernel lacks netem
+var errLatencyUnsupported = errors.New("network latency injection is not supported")
+
+// netemCommand returns the tc command delaying all egress of netemInterface by delay, or removing
+// the delay when delay is zero. Removing succeeds when there is no delay to remove.
+func netemCommand(delay time.Duration) []string {
+	if delay == 0 {
+		return []string{"sh", "-c", fmt.Sprintf("tc qdisc del dev %s root 2>/dev/null || true", netemInterface)}
+	}
+	return []string{"tc", "qdisc", "replace", "dev", netemInterface, "root", "netem", "delay", fmt.Sprintf("%dms", delay.Milliseconds())}
+}
+
+// ephemeralContainerResult reports whether the ephemeral container name of pod has terminated and
+// returns an error if it failed
+func ephemeralContainerResult(pod *corev1.Pod, name string) (bool, error) {
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		if status.Name != name {
+			continue
+		}
+		terminated := status.State.Terminated
+		if terminated == nil {
+			return false, nil
+		}
+		if terminated.ExitCode != 0 {
+			return true, fmt.Errorf("container %s in pod %s exited with code %d: %s %s",
+				name, pod.Name, terminated.ExitCode, terminated.Reason, terminated.Message)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// waitForEphemeralContainer waits until the ephemeral container name of a pod has terminated
+func waitForEphemeralContainer(ctx context.Context, clientset kubernetes.Interface, namespace, podName, name string, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get pod %s: %w", podName, err)
+		}
+		done, err := ephemeralContainerResult(pod, name)
+		if done {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("container %s in pod %s did not finish within %s", name, podName, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// runNetem runs tc in an ephemeral NET_ADMIN container sharing the network namespace of every
+// instance pod of clusterName
+func runNetem(t *testing.T, opts *k8s.KubectlOptions, clusterName string, delay time.Duration) error {
+	clientset, err := getClientset(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	pods, err := listInstancePods(ctx, clientset, opts.Namespace, clusterName)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no instance pods found for cluster %s", clusterName)
+	}
+
+	for _, pod := range pods {
+		// Ephemeral containers cannot be removed, so every run needs a fresh name
+		name := "netem-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+		args := append([]string{"debug", pod.Name, "--image", netemImage, "--profile=netadmin",
+			"--container", name, "--target", postgresContainerName, "--"}, netemCommand(delay)...)
+		if err := k8s.RunKubectlE(t, opts, args...); err != nil {
+			return fmt.Errorf("%w: %v", errLatencyUnsupported, err)
+		}
+		if err := waitForEphemeralContainer(ctx, clientset, opts.Namespace, pod.Name, name, ephemeralContainerTimeout, 2*time.Second); err != nil {
+			return fmt.Errorf("%w: %v", errLatencyUnsupported, err)
+		}
+	}
+	return nil
+}
+
+// InjectNetworkLatency delays all traffic leaving the instance pods of clusterName by delay, using
+// tc netem in an ephemeral container, to simulate a WAN link. The delay is removed when the test
+// finishes. The test is skipped in short mode or where tc cannot run with NET_ADMIN.
+func InjectNetworkLatency(t *testing.T, opts *k8s.KubectlOptions, clusterName string, delay time.Duration) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping network latency injection in short mode")
+	}
+	require.Positive(t, delay, "Latency must be positive")
+
+	t.Logf("Injecting %s latency into cluster %s", delay, clusterName)
+	err := runNetem(t, opts, clusterName, delay)
+	if errors.Is(err, errLatencyUnsupported) {
+		t.Skipf("Cannot inject latency into cluster %s: %v", clusterName, err)
+	}
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		if err := runNetem(t, opts, clusterName, 0); err != nil {
+			t.Logf("Warning: failed to clear latency of cluster %s: %v", clusterName, err)
+		}
+	})
+}
+
+// ClearNetworkLatency removes latency added by InjectNetworkLatency from the instance pods of
+// clusterName
+func ClearNetworkLatency(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	t.Logf("Clearing latency of cluster %s", clusterName)
+	require.NoError(t, runNetem(t, opts, clusterName, 0))
+}
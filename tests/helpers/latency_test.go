@@ -0,0 +1,47 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNetemCommand(t *testing.T) {
+	require.Equal(t, []string{"tc", "qdisc", "replace", "dev", "eth0", "root", "netem", "delay", "150ms"},
+		netemCommand(150*time.Millisecond))
+	require.Equal(t, []string{"sh", "-c", "tc qdisc del dev eth0 root 2>/dev/null || true"}, netemCommand(0))
+}
+
+func TestWaitForEphemeralContainer(t *testing.T) {
+	ctx := context.Background()
+	pod := func(state corev1.ContainerState) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pg-1", Namespace: "default"},
+			Status: corev1.PodStatus{EphemeralContainerStatuses: []corev1.ContainerStatus{
+				{Name: "netem-old", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}},
+				{Name: "netem-new", State: state},
+			}},
+		}
+	}
+
+	clientset := fake.NewClientset(pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}))
+	require.NoError(t, waitForEphemeralContainer(ctx, clientset, "default", "pg-1", "netem-new", time.Second, time.Millisecond))
+
+	clientset = fake.NewClientset(pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		ExitCode: 2, Reason: "Error", Message: "RTNETLINK answers: Operation not permitted",
+	}}))
+	err := waitForEphemeralContainer(ctx, clientset, "default", "pg-1", "netem-new", time.Second, time.Millisecond)
+	require.EqualError(t, err, "container netem-new in pod pg-1 exited with code 2: Error RTNETLINK answers: Operation not permitted")
+
+	clientset = fake.NewClientset(pod(corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}))
+	err = waitForEphemeralContainer(ctx, clientset, "default", "pg-1", "netem-new", 10*time.Millisecond, time.Millisecond)
+	require.EqualError(t, err, "container netem-new in pod pg-1 did not finish within 10ms")
+
+	err = waitForEphemeralContainer(ctx, clientset, "default", "pg-1", "netem-missing", 10*time.Millisecond, time.Millisecond)
+	require.ErrorContains(t, err, "did not finish")
+}
@@ -0,0 +1,49 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ErrLocked is returned by LockFile when another process keeps the lock past the timeout
+var ErrLocked = errors.New("lock is held by another process")
+
+// LockFile takes a lock on path, shared (syscall.LOCK_SH) or exclusive (syscall.LOCK_EX), creating
+// the file and its parent as needed. It retries every interval while a conflicting lock is held,
+// giving up with ErrLocked after timeout. The lock is released by the returned func, or by the
+// kernel if the process dies, so a crashed run never leaves a stale lock behind.
+func LockFile(path string, how int, timeout, interval time.Duration) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockfile: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s is still locked after %s", ErrLocked, path, timeout)
+		}
+		time.Sleep(interval)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
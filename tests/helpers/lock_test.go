@@ -0,0 +1,88 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockFileSerializesExclusiveLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", ".shared.lock")
+
+	var inside atomic.Int32
+	var overlapped atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := LockFile(path, syscall.LOCK_EX, 10*time.Second, time.Millisecond)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if inside.Add(1) > 1 {
+				overlapped.Store(true)
+			}
+			time.Sleep(20 * time.Millisecond)
+			inside.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.False(t, overlapped.Load(), "Exclusive locks overlapped")
+}
+
+func TestLockFileContention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".shared.lock")
+
+	unlock, err := LockFile(path, syscall.LOCK_EX, 0, time.Millisecond)
+	require.NoError(t, err)
+
+	_, err = LockFile(path, syscall.LOCK_EX, 20*time.Millisecond, time.Millisecond)
+	require.ErrorIs(t, err, ErrLocked)
+	_, err = LockFile(path, syscall.LOCK_SH, 20*time.Millisecond, time.Millisecond)
+	require.ErrorIs(t, err, ErrLocked)
+
+	unlock()
+	unlock, err = LockFile(path, syscall.LOCK_EX, 0, time.Millisecond)
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestLockFileShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".shared.lock")
+
+	unlock, err := LockFile(path, syscall.LOCK_SH, 0, time.Millisecond)
+	require.NoError(t, err)
+
+	unlockShared, err := LockFile(path, syscall.LOCK_SH, 0, time.Millisecond)
+	require.NoError(t, err)
+	unlockShared()
+
+	_, err = LockFile(path, syscall.LOCK_EX, 20*time.Millisecond, time.Millisecond)
+	require.ErrorIs(t, err, ErrLocked)
+
+	unlock()
+	unlockExclusive, err := LockFile(path, syscall.LOCK_EX, 0, time.Millisecond)
+	require.NoError(t, err)
+	unlockExclusive()
+
+	// A lock under a regular file cannot be created
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	_, err = LockFile(filepath.Join(file, ".shared.lock"), syscall.LOCK_EX, 0, time.Millisecond)
+	require.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package helpers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// minioImage and minioClientImage are the MinIO server and client used as a test object store
+	minioImage       = "quay.io/minio/minio:RELEASE.2024-12-18T13-15-44Z"
+	minioClientImage = "quay.io/minio/mc:RELEASE.2024-11-21T17-21-54Z"
+)
+
+// MinIO is an S3-compatible object store deployed in the test cluster
+type MinIO struct {
+	Name   string
+	Bucket string
+	// Endpoint is the in-cluster URL of the S3 API
+	Endpoint string
+	// AccessKey and SecretKey are the generated root credentials, for clients outside the cluster
+	AccessKey string
+	SecretKey string
+	// CredentialsSecret holds the keys in ACCESS_KEY_ID and ACCESS_SECRET_KEY, the layout the
+	// Barman Cloud Plugin examples use
+	CredentialsSecret string
+}
+
+// minioManifest returns a single-node MinIO with its credentials secret and service, plus a Job
+// creating bucket once the server is up
+func minioManifest(name, bucket, accessKey, secretKey string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Secret
+metadata:
+  name: %[1]s-credentials
+stringData:
+  ACCESS_KEY_ID: %[3]s
+  ACCESS_SECRET_KEY: %[4]s
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %[1]s
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: %[1]s
+  template:
+    metadata:
+      labels:
+        app: %[1]s
+    spec:
+      containers:
+      - name: minio
+        image: %[5]s
+        args: ["server", "/data"]
+        env:
+        - name: MINIO_ROOT_USER
+          valueFrom:
+            secretKeyRef:
+              name: %[1]s-credentials
+              key: ACCESS_KEY_ID
+        - name: MINIO_ROOT_PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: %[1]s-credentials
+              key: ACCESS_SECRET_KEY
+        ports:
+        - containerPort: 9000
+        readinessProbe:
+          httpGet:
+            path: /minio/health/ready
+            port: 9000
+        volumeMounts:
+        - name: data
+          mountPath: /data
+      volumes:
+      - name: data
+        emptyDir: {}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: %[1]s
+spec:
+  selector:
+    app: %[1]s
+  ports:
+  - port: 9000
+    targetPort: 9000
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: %[1]s-create-bucket
+spec:
+  backoffLimit: 10
+  template:
+    spec:
+      restartPolicy: OnFailure
+      containers:
+      - name: mc
+        image: %[6]s
+        command: ["sh", "-c"]
+        args:
+        - mc alias set store http://%[1]s:9000 "$ACCESS_KEY_ID" "$ACCESS_SECRET_KEY" && mc mb --ignore-existing store/%[2]s
+        envFrom:
+        - secretRef:
+            name: %[1]s-credentials
+`, name, bucket, accessKey, secretKey, minioImage, minioClientImage)
+}
+
+// DeployMinIO deploys MinIO named name with an empty bucket and removes it when the test finishes
+func DeployMinIO(t *testing.T, opts *k8s.KubectlOptions, name, bucket string) *MinIO {
+	t.Helper()
+
+	accessKey, err := newPassword()
+	require.NoError(t, err)
+	secretKey, err := newPassword()
+	require.NoError(t, err)
+
+	manifest := minioManifest(name, bucket, accessKey, secretKey)
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, manifest), "Failed to deploy MinIO")
+	t.Cleanup(func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, manifest)
+	})
+
+	require.NoError(t, k8s.WaitUntilDeploymentAvailableE(t, opts, name, 60, 5*time.Second), "MinIO did not become available")
+	require.NoError(t, k8s.WaitUntilJobSucceedE(t, opts, name+"-create-bucket", 60, 5*time.Second), "Failed to create bucket %s", bucket)
+
+	t.Logf("MinIO %s is serving bucket %s", name, bucket)
+	return &MinIO{
+		Name:              name,
+		Bucket:            bucket,
+		Endpoint:          fmt.Sprintf("http://%s.%s.svc:9000", name, opts.Namespace),
+		AccessKey:         accessKey,
+		SecretKey:         secretKey,
+		CredentialsSecret: name + "-credentials",
+	}
+}
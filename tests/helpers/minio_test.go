@@ -0,0 +1,29 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMinIOManifest(t *testing.T) {
+	manifest := minioManifest("minio", "backups", "access", "secret")
+
+	var kinds []string
+	decoder := yaml.NewDecoder(strings.NewReader(manifest))
+	for {
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			break
+		}
+		kinds = append(kinds, doc["kind"].(string))
+	}
+	require.Equal(t, []string{"Secret", "Deployment", "Service", "Job"}, kinds)
+
+	require.Contains(t, manifest, "ACCESS_KEY_ID: access")
+	require.Contains(t, manifest, "ACCESS_SECRET_KEY: secret")
+	require.Contains(t, manifest, "mc alias set store http://minio:9000")
+	require.Contains(t, manifest, "mc mb --ignore-existing store/backups")
+}
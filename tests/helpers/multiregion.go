@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+)
+
+// multiRegionClusterTimeout bounds how long each region's cluster may take to become healthy
+const multiRegionClusterTimeout = 10 * time.Minute
+
+// multiRegionClusterManifest returns a single-instance Spock-enabled Cluster for one region, with
+// node as its snowflake node number. The operator fills in the pgEdge image.
+func multiRegionClusterManifest(clusterName string, node int) string {
+	return fmt.Sprintf(`
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: %s
+spec:
+  instances: 1
+  enableSuperuserAccess: true
+  postgresql:
+    shared_preload_libraries:
+      - spock
+    parameters:
+      wal_level: logical
+      track_commit_timestamp: "on"
+      spock.enable_ddl_replication: "on"
+      spock.include_ddl_repset: "on"
+      spock.allow_ddl_from_functions: "on"
+      snowflake.node: "%d"
+  storage:
+    size: 1Gi
+`, clusterName, node)
+}
+
+// regionDSN returns the DSN other regions use to reach clusterName in namespace over
+// cross-namespace service DNS
+func regionDSN(clusterName, namespace, password string) string {
+	return fmt.Sprintf("host=%s-rw.%s.svc.cluster.local port=5432 dbname=app user=postgres password=%s sslmode=require",
+		clusterName, namespace, password)
+}
+
+// regionSubscriptionName names the subscription on node i that pulls changes from node j
+func regionSubscriptionName(i, j int) string {
+	return fmt.Sprintf("sub_n%d_n%d", i+1, j+1)
+}
+
+// DeployMultiRegionMesh deploys one Spock-enabled pgEdge node per namespace in regions, checks
+// each can carry the mesh's replication slots and WAL senders, wires a full mesh of Spock
+// subscriptions over cross-namespace service DNS and asserts a row written in every region
+// reaches every other region. It returns a superuser connection to the app database
+// of each region, in the order of regions; connections and namespaces are removed on cleanup.
+func DeployMultiRegionMesh(t *testing.T, opts *k8s.KubectlOptions, regions []string) []*sql.DB {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping multi-region mesh in short mode")
+	}
+	require.GreaterOrEqual(t, len(regions), 2, "A mesh needs at least two regions")
+
+	ctx := context.Background()
+	clusterNames := make([]string, len(regions))
+	regionOpts := make([]*k8s.KubectlOptions, len(regions))
+
+	for i, region := range regions {
+		regionOpts[i] = k8s.NewKubectlOptions(opts.ContextName, opts.ConfigPath, region)
+		clusterNames[i] = fmt.Sprintf("pgedge-%d", i+1)
+
+		require.NoError(t, k8s.CreateNamespaceE(t, regionOpts[i], region), "Failed to create namespace %s", region)
+		t.Cleanup(func() {
+			_ = k8s.DeleteNamespaceE(t, regionOpts[i], region)
+		})
+
+		manifest := multiRegionClusterManifest(clusterNames[i], i+1)
+		AssertClusterImagesSigned(t, manifest)
+		require.NoError(t, k8s.KubectlApplyFromStringE(t, regionOpts[i], manifest),
+			"Failed to create cluster in region %s", region)
+	}
+
+	dsns := make([]string, len(regions))
+	conns := make([]*sql.DB, len(regions))
+	for i, region := range regions {
+		require.NoError(t, WaitForClusterHealthy(t, regionOpts[i], clusterNames[i], multiRegionClusterTimeout),
+			"Cluster %s in region %s did not become healthy", clusterNames[i], region)
+
+		secretName := clusterNames[i] + "-superuser"
+		secret, err := k8s.GetSecretE(t, regionOpts[i], secretName)
+		require.NoError(t, err)
+		dsns[i] = regionDSN(clusterNames[i], region, string(secret.Data["password"]))
+
+		conn, closeConn, err := OpenServiceConnectionToDatabase(t, regionOpts[i], clusterNames[i]+"-rw", secretName, "app")
+		require.NoError(t, err, "Failed to connect to region %s", region)
+		t.Cleanup(closeConn)
+		conns[i] = conn
+
+		AssertLogicalReplicationReady(t, conn, len(regions))
+		_, err = conn.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS spock`)
+		require.NoError(t, err, "Failed to create spock extension in region %s", region)
+		_, err = conn.ExecContext(ctx, `SELECT spock.node_create(node_name := $1, dsn := $2)`, fmt.Sprintf("n%d", i+1), dsns[i])
+		require.NoError(t, err, "Failed to create spock node in region %s", region)
+	}
+
+	for i := range regions {
+		for j := range regions {
+			if i == j {
+				continue
+			}
+			_, err := conns[i].ExecContext(ctx,
+				`SELECT spock.sub_create(subscription_name := $1, provider_dsn := $2, synchronize_structure := false, synchronize_data := false)`,
+				regionSubscriptionName(i, j), dsns[j])
+			require.NoError(t, err, "Failed to subscribe region %s to region %s", regions[i], regions[j])
+		}
+	}
+
+	for i, region := range regions {
+		status, err := getNodeReplicationStatus(ctx, conns[i])
+		require.NoError(t, err, "Failed to read replication status of region %s", region)
+		t.Logf("Region %s: cluster %s, PostgreSQL %s, subscriptions %v", region, clusterNames[i], status.Version, status.Subscriptions)
+	}
+
+	AssertFullMeshReplication(t, conns)
+	return conns
+}
@@ -0,0 +1,38 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMultiRegionClusterManifest(t *testing.T) {
+	var cluster struct {
+		Metadata struct {
+			Name string `yaml:"name"`
+		} `yaml:"metadata"`
+		Spec struct {
+			EnableSuperuserAccess bool `yaml:"enableSuperuserAccess"`
+			PostgreSQL            struct {
+				SharedPreloadLibraries []string          `yaml:"shared_preload_libraries"`
+				Parameters             map[string]string `yaml:"parameters"`
+			} `yaml:"postgresql"`
+		} `yaml:"spec"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(multiRegionClusterManifest("pgedge-2", 2)), &cluster))
+
+	require.Equal(t, "pgedge-2", cluster.Metadata.Name)
+	require.True(t, cluster.Spec.EnableSuperuserAccess)
+	require.Equal(t, []string{"spock"}, cluster.Spec.PostgreSQL.SharedPreloadLibraries)
+	require.Equal(t, "logical", cluster.Spec.PostgreSQL.Parameters["wal_level"])
+	require.Equal(t, "on", cluster.Spec.PostgreSQL.Parameters["track_commit_timestamp"])
+	require.Equal(t, "2", cluster.Spec.PostgreSQL.Parameters["snowflake.node"])
+}
+
+func TestRegionDSN(t *testing.T) {
+	require.Equal(t,
+		"host=pgedge-1-rw.us-east.svc.cluster.local port=5432 dbname=app user=postgres password=secret sslmode=require",
+		regionDSN("pgedge-1", "us-east", "secret"))
+	require.Equal(t, "sub_n1_n3", regionSubscriptionName(0, 2))
+}
@@ -0,0 +1,195 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// postgresPort is the PostgreSQL port on CNPG instance pods
+	postgresPort = 5432
+	// postgresPortName is the name CNPG gives the PostgreSQL container port
+	postgresPortName = "postgresql"
+)
+
+// selects reports whether selector matches podLabels. A nil selector matches nothing.
+func selects(selector *metav1.LabelSelector, podLabels map[string]string) bool {
+	if selector == nil {
+		return false
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(labels.Set(podLabels))
+}
+
+// isolates reports whether policy restricts traffic of policyType for the pods it selects
+func isolates(policy networkingv1.NetworkPolicy, policyType networkingv1.PolicyType) bool {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		// Without explicit policyTypes every policy affects ingress, and egress once it has
+		// egress rules
+		return policyType == networkingv1.PolicyTypeIngress || len(policy.Spec.Egress) > 0
+	}
+	for _, pt := range policy.Spec.PolicyTypes {
+		if pt == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+// rulePortAllows reports whether a rule's ports include the PostgreSQL port
+func rulePortAllows(ports []networkingv1.NetworkPolicyPort) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	for _, p := range ports {
+		if p.Protocol != nil && *p.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		if p.Port == nil {
+			return true
+		}
+		if p.Port.IntValue() == postgresPort || p.Port.String() == postgresPortName {
+			return true
+		}
+		if p.EndPort != nil && p.Port.IntValue() <= postgresPort && postgresPort <= int(*p.EndPort) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulePeerAllows reports whether a rule's peers include pod, which lives in the policy's namespace
+func rulePeerAllows(peers []networkingv1.NetworkPolicyPeer, pod corev1.Pod) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			continue
+		}
+		// Namespace labels are not inspected, so only an empty namespaceSelector is known to match
+		if peer.NamespaceSelector != nil && len(peer.NamespaceSelector.MatchLabels)+len(peer.NamespaceSelector.MatchExpressions) > 0 {
+			continue
+		}
+		if peer.PodSelector == nil || selects(peer.PodSelector, pod.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// ingressAllowed reports whether the policies admit PostgreSQL traffic from src to dst.
+// Traffic is allowed when no policy isolates dst, or when any isolating policy has a matching rule.
+func ingressAllowed(policies []networkingv1.NetworkPolicy, src, dst corev1.Pod) bool {
+	isolated := false
+	for _, policy := range policies {
+		if !isolates(policy, networkingv1.PolicyTypeIngress) || !selects(&policy.Spec.PodSelector, dst.Labels) {
+			continue
+		}
+		isolated = true
+		for _, rule := range policy.Spec.Ingress {
+			if rulePeerAllows(rule.From, src) && rulePortAllows(rule.Ports) {
+				return true
+			}
+		}
+	}
+	return !isolated
+}
+
+// egressAllowed reports whether the policies let src send PostgreSQL traffic to dst.
+// Traffic is allowed when no policy isolates src, or when any isolating policy has a matching rule.
+func egressAllowed(policies []networkingv1.NetworkPolicy, src, dst corev1.Pod) bool {
+	isolated := false
+	for _, policy := range policies {
+		if !isolates(policy, networkingv1.PolicyTypeEgress) || !selects(&policy.Spec.PodSelector, src.Labels) {
+			continue
+		}
+		isolated = true
+		for _, rule := range policy.Spec.Egress {
+			if rulePeerAllows(rule.To, dst) && rulePortAllows(rule.Ports) {
+				return true
+			}
+		}
+	}
+	return !isolated
+}
+
+// trafficAllowed reports whether PostgreSQL traffic from src reaches dst, which needs both the
+// egress policies of src and the ingress policies of dst to allow it
+func trafficAllowed(policies []networkingv1.NetworkPolicy, src, dst corev1.Pod) bool {
+	return egressAllowed(policies, src, dst) && ingressAllowed(policies, src, dst)
+}
+
+// checkNetworkPoliciesAllowReplication verifies PostgreSQL traffic is admitted between every pair
+// of CNPG instance pods and from every pooler pod to every instance pod
+func checkNetworkPoliciesAllowReplication(policies []networkingv1.NetworkPolicy, pods []corev1.Pod) error {
+	var instances, poolers []corev1.Pod
+	for _, pod := range pods {
+		switch {
+		case pod.Labels["cnpg.io/podRole"] == "instance":
+			instances = append(instances, pod)
+		case pod.Labels["cnpg.io/poolerName"] != "":
+			poolers = append(poolers, pod)
+		}
+	}
+	if len(instances) == 0 {
+		return fmt.Errorf("no CNPG instance pods found")
+	}
+
+	var blocked []string
+	for _, dst := range instances {
+		for _, src := range instances {
+			if src.Name != dst.Name && !trafficAllowed(policies, src, dst) {
+				blocked = append(blocked, fmt.Sprintf("replication %s -> %s", src.Name, dst.Name))
+			}
+		}
+		for _, src := range poolers {
+			if !trafficAllowed(policies, src, dst) {
+				blocked = append(blocked, fmt.Sprintf("pooler %s -> %s", src.Name, dst.Name))
+			}
+		}
+	}
+	if len(blocked) > 0 {
+		return fmt.Errorf("NetworkPolicies block PostgreSQL traffic on port %d:\n%s", postgresPort, strings.Join(blocked, "\n"))
+	}
+	return nil
+}
+
+// validateNetworkPolicies loads the policies and pods in namespace and checks them
+func validateNetworkPolicies(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	policies, err := clientset.NetworkingV1().NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list NetworkPolicies in %s: %w", namespace, err)
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods in %s: %w", namespace, err)
+	}
+	return checkNetworkPoliciesAllowReplication(policies.Items, pods.Items)
+}
+
+// AssertNetworkPoliciesAllowReplication inspects the NetworkPolicies in namespace and checks both
+// the egress policies of the sources and the ingress policies of the destinations let PostgreSQL
+// traffic through between pgEdge instance pods and from pooler pods to instances.
+// Missing allow rules silently break Spock replication under a default-deny CNI.
+func AssertNetworkPoliciesAllowReplication(t *testing.T, opts *k8s.KubectlOptions, namespace string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	require.NoError(t, validateNetworkPolicies(context.Background(), clientset, namespace))
+}
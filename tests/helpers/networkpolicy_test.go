@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newLabelledPod returns a pod in the pgedge namespace with the given labels
+func newLabelledPod(name string, podLabels map[string]string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pgedge", Labels: podLabels}}
+}
+
+// newPolicy returns an ingress NetworkPolicy in the pgedge namespace
+func newPolicy(name string, podSelector metav1.LabelSelector, rules ...networkingv1.NetworkPolicyIngressRule) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pgedge"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: podSelector,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     rules,
+		},
+	}
+}
+
+// newEgressPolicy returns an egress NetworkPolicy in the pgedge namespace
+func newEgressPolicy(name string, podSelector metav1.LabelSelector, rules ...networkingv1.NetworkPolicyEgressRule) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pgedge"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: podSelector,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress:      rules,
+		},
+	}
+}
+
+func TestValidateNetworkPolicies(t *testing.T) {
+	pods := []*corev1.Pod{
+		newLabelledPod("pgedge-1-1", map[string]string{"cnpg.io/cluster": "pgedge-1", "cnpg.io/podRole": "instance", "app": "pgedge"}),
+		newLabelledPod("pgedge-2-1", map[string]string{"cnpg.io/cluster": "pgedge-2", "cnpg.io/podRole": "instance", "app": "pgedge"}),
+		newLabelledPod("pooler-rw-1", map[string]string{"cnpg.io/poolerName": "pooler-rw"}),
+	}
+	denyAll := newPolicy("default-deny", metav1.LabelSelector{})
+	allowReplication := newPolicy("allow-replication",
+		metav1.LabelSelector{MatchLabels: map[string]string{"cnpg.io/podRole": "instance"}},
+		networkingv1.NetworkPolicyIngressRule{
+			From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "pgedge"}}}},
+			Ports: []networkingv1.NetworkPolicyPort{{Port: &intstr.IntOrString{Type: intstr.String, StrVal: "postgresql"}}},
+		})
+	allowPooler := newPolicy("allow-pooler",
+		metav1.LabelSelector{MatchLabels: map[string]string{"cnpg.io/podRole": "instance"}},
+		networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "cnpg.io/poolerName", Operator: metav1.LabelSelectorOpExists}},
+			}}},
+			Ports: []networkingv1.NetworkPolicyPort{{Port: &intstr.IntOrString{IntVal: 5432}}},
+		})
+	wrongPort := newPolicy("allow-metrics-only",
+		metav1.LabelSelector{MatchLabels: map[string]string{"cnpg.io/podRole": "instance"}},
+		networkingv1.NetworkPolicyIngressRule{Ports: []networkingv1.NetworkPolicyPort{{Port: &intstr.IntOrString{IntVal: 9187}}}})
+
+	ctx := context.Background()
+	clientsetWith := func(policies ...*networkingv1.NetworkPolicy) *fake.Clientset {
+		clientset := fake.NewClientset()
+		for _, pod := range pods {
+			_, err := clientset.CoreV1().Pods("pgedge").Create(ctx, pod, metav1.CreateOptions{})
+			require.NoError(t, err)
+		}
+		for _, policy := range policies {
+			_, err := clientset.NetworkingV1().NetworkPolicies("pgedge").Create(ctx, policy, metav1.CreateOptions{})
+			require.NoError(t, err)
+		}
+		return clientset
+	}
+
+	// No policies means no isolation
+	require.NoError(t, validateNetworkPolicies(ctx, clientsetWith(), "pgedge"))
+
+	require.NoError(t, validateNetworkPolicies(ctx, clientsetWith(denyAll, allowReplication, allowPooler), "pgedge"))
+
+	err := validateNetworkPolicies(ctx, clientsetWith(denyAll, allowReplication), "pgedge")
+	require.ErrorContains(t, err, "pooler pooler-rw-1 -> pgedge-1-1")
+	require.NotContains(t, err.Error(), "replication")
+
+	err = validateNetworkPolicies(ctx, clientsetWith(denyAll, wrongPort), "pgedge")
+	require.ErrorContains(t, err, "replication pgedge-1-1 -> pgedge-2-1")
+	require.ErrorContains(t, err, "replication pgedge-2-1 -> pgedge-1-1")
+
+	// Ingress is open but the sources may not send to port 5432
+	instances := metav1.LabelSelector{MatchLabels: map[string]string{"cnpg.io/podRole": "instance"}}
+	denyEgress := newEgressPolicy("deny-egress", metav1.LabelSelector{})
+	allowDNS := newEgressPolicy("allow-dns", metav1.LabelSelector{},
+		networkingv1.NetworkPolicyEgressRule{Ports: []networkingv1.NetworkPolicyPort{{Port: &intstr.IntOrString{IntVal: 53}}}})
+	err = validateNetworkPolicies(ctx, clientsetWith(denyEgress, allowDNS), "pgedge")
+	require.ErrorContains(t, err, "replication pgedge-1-1 -> pgedge-2-1")
+	require.ErrorContains(t, err, "pooler pooler-rw-1 -> pgedge-1-1")
+
+	allowPostgresEgress := newEgressPolicy("allow-postgres-egress", metav1.LabelSelector{},
+		networkingv1.NetworkPolicyEgressRule{
+			To:    []networkingv1.NetworkPolicyPeer{{PodSelector: &instances}},
+			Ports: []networkingv1.NetworkPolicyPort{{Port: &intstr.IntOrString{IntVal: 5432}}},
+		})
+	require.NoError(t, validateNetworkPolicies(ctx, clientsetWith(denyEgress, allowDNS, allowPostgresEgress), "pgedge"))
+
+	// Egress to the instances is allowed, ingress still has to be
+	err = validateNetworkPolicies(ctx, clientsetWith(denyEgress, allowPostgresEgress, denyAll, allowReplication), "pgedge")
+	require.ErrorContains(t, err, "pooler pooler-rw-1 -> pgedge-1-1")
+	require.NotContains(t, err.Error(), "replication")
+}
+
+func TestIsolates(t *testing.T) {
+	legacy := networkingv1.NetworkPolicy{}
+	require.True(t, isolates(legacy, networkingv1.PolicyTypeIngress))
+	require.False(t, isolates(legacy, networkingv1.PolicyTypeEgress))
+
+	legacy.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{}}
+	require.True(t, isolates(legacy, networkingv1.PolicyTypeEgress))
+
+	egressOnly := *newEgressPolicy("egress", metav1.LabelSelector{})
+	require.False(t, isolates(egressOnly, networkingv1.PolicyTypeIngress))
+	require.True(t, isolates(egressOnly, networkingv1.PolicyTypeEgress))
+}
@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// oomMarkerTable holds the row OOMKillPrimary checks survives the kill
+	oomMarkerTable = "pgedge_oom_marker"
+	// oomRecoveryTimeout bounds how long the cluster may take to recover from the OOMKill
+	oomRecoveryTimeout = 10 * time.Minute
+	// oomKilledReason is the termination reason of a container killed for exceeding its memory limit
+	oomKilledReason = "OOMKilled"
+)
+
+// postgresMemoryLimit returns the memory limit of the postgres container in bytes
+func postgresMemoryLimit(pod *corev1.Pod) (int64, error) {
+	for _, c := range pod.Spec.Containers {
+		if c.Name != postgresContainerName {
+			continue
+		}
+		limit, ok := c.Resources.Limits[corev1.ResourceMemory]
+		if !ok || limit.IsZero() {
+			return 0, fmt.Errorf("pod %s has no memory limit on %s; refusing to exhaust node memory", pod.Name, postgresContainerName)
+		}
+		return limit.Value(), nil
+	}
+	return 0, fmt.Errorf("pod %s has no %s container", pod.Name, postgresContainerName)
+}
+
+// wasOOMKilled reports whether the postgres container last terminated because of an OOMKill
+func wasOOMKilled(pod *corev1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != postgresContainerName {
+			continue
+		}
+		if term := status.LastTerminationState.Terminated; term != nil && term.Reason == oomKilledReason {
+			return true
+		}
+		if term := status.State.Terminated; term != nil && term.Reason == oomKilledReason {
+			return true
+		}
+	}
+	return false
+}
+
+// oomAllocationCommand returns a shell command that holds bytes of memory until it is killed
+func oomAllocationCommand(bytes int64) string {
+	return fmt.Sprintf(`x=$(head -c %d /dev/zero | tr '\0' x); sleep 300`, bytes)
+}
+
+// oomRecoveryOutcome describes how the cluster recovered from losing its primary
+func oomRecoveryOutcome(oldPrimary, newPrimary string) string {
+	if oldPrimary == newPrimary {
+		return fmt.Sprintf("restarted %s in place", oldPrimary)
+	}
+	return fmt.Sprintf("failed over from %s to %s", oldPrimary, newPrimary)
+}
+
+// OOMKillPrimary allocates more memory than the primary's limit inside its postgres container
+// to force an OOMKill, then checks the cluster returns to healthy, either by restarting the
+// primary in place or by failing over, and that data written before the kill is intact.
+// The postgres container must have a memory limit.
+func OOMKillPrimary(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping OOMKill of the primary in short mode")
+	}
+
+	ctx := context.Background()
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	primary, err := primaryPodName(t, opts, clusterName)
+	require.NoError(t, err)
+
+	pod, err := clientset.CoreV1().Pods(opts.Namespace).Get(ctx, primary, metav1.GetOptions{})
+	require.NoError(t, err)
+	limit, err := postgresMemoryLimit(pod)
+	require.NoError(t, err)
+
+	conn, closeConn, err := OpenServiceConnection(t, opts, clusterName+"-rw", clusterName+"-app")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id bigint PRIMARY KEY)`, oomMarkerTable))
+	require.NoError(t, err)
+	marker := time.Now().UnixNano()
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id) VALUES ($1)`, oomMarkerTable), marker)
+	require.NoError(t, err)
+	closeConn()
+
+	t.Logf("Allocating %d bytes in %s (limit %d bytes) to force an OOMKill", 2*limit, primary, limit)
+	if err := k8s.RunKubectlE(t, opts, "exec", primary, "-c", postgresContainerName, "--",
+		"sh", "-c", oomAllocationCommand(2*limit)); err != nil {
+		t.Logf("Allocation ended: %v", err)
+	}
+
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for %s to be OOMKilled", primary), 60, 5*time.Second, func() (string, error) {
+		pod, err := clientset.CoreV1().Pods(opts.Namespace).Get(ctx, primary, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if !wasOOMKilled(pod) {
+			return "", fmt.Errorf("pod %s has not been OOMKilled yet", primary)
+		}
+		return "", nil
+	})
+	require.NoError(t, err, "Primary %s was not OOMKilled", primary)
+
+	require.NoError(t, WaitForClusterHealthy(t, opts, clusterName, oomRecoveryTimeout),
+		"Cluster %s did not recover from the OOMKill", clusterName)
+
+	newPrimary, err := primaryPodName(t, opts, clusterName)
+	require.NoError(t, err)
+	t.Logf("Cluster %s %s after OOMKill", clusterName, oomRecoveryOutcome(primary, newPrimary))
+
+	conn, closeConn, err = OpenServiceConnection(t, opts, clusterName+"-rw", clusterName+"-app")
+	require.NoError(t, err)
+	defer closeConn()
+
+	var found bool
+	err = conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)`, oomMarkerTable), marker).Scan(&found)
+	require.NoError(t, err)
+	require.True(t, found, "Row written before the OOMKill is missing")
+}
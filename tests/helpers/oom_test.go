@@ -0,0 +1,47 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPostgresMemoryLimit(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name: postgresContainerName,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		},
+	}}}}
+	limit, err := postgresMemoryLimit(pod)
+	require.NoError(t, err)
+	require.Equal(t, int64(512*1024*1024), limit)
+
+	pod.Spec.Containers[0].Resources.Limits = nil
+	_, err = postgresMemoryLimit(pod)
+	require.ErrorContains(t, err, "no memory limit")
+
+	pod.Spec.Containers[0].Name = "bootstrap"
+	_, err = postgresMemoryLimit(pod)
+	require.ErrorContains(t, err, "no postgres container")
+}
+
+func TestWasOOMKilled(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+		Name: postgresContainerName,
+	}}}}
+	require.False(t, wasOOMKilled(pod))
+
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{Reason: "Error"}
+	require.False(t, wasOOMKilled(pod))
+
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.Reason = oomKilledReason
+	require.True(t, wasOOMKilled(pod))
+}
+
+func TestOOMRecoveryOutcome(t *testing.T) {
+	require.Equal(t, "restarted pg-1 in place", oomRecoveryOutcome("pg-1", "pg-1"))
+	require.Equal(t, "failed over from pg-1 to pg-2", oomRecoveryOutcome("pg-1", "pg-2"))
+}
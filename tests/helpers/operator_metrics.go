@@ -0,0 +1,170 @@
+package helpers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// operatorMetricsPort is the port the operator serves Prometheus metrics on
+	operatorMetricsPort = "8080"
+	// reconcileErrorTimeout bounds how long AssertReconcileErrorMetric waits for the counter to move
+	reconcileErrorTimeout = 2 * time.Minute
+	// reconcileErrorInterval is the pause between scrapes while waiting for the counter
+	reconcileErrorInterval = 5 * time.Second
+)
+
+// metricSeries selects the series of a metric, optionally only those carrying a label pair
+type metricSeries struct {
+	Name  string
+	Label string
+}
+
+// reconcileErrorMetrics are the series counting failed reconciles, in order of preference.
+// Operators built on controller-runtime releases without the errors counter only report the
+// result label of the reconcile total.
+var reconcileErrorMetrics = []metricSeries{
+	{Name: "controller_runtime_reconcile_errors_total"},
+	{Name: "controller_runtime_reconcile_total", Label: `result="error"`},
+}
+
+// metricValue sums the samples of the first candidate present in a Prometheus text exposition
+// and returns it with the name of the metric it came from
+func metricValue(exposition string, candidates []metricSeries) (float64, string, error) {
+	for _, candidate := range candidates {
+		total, found := 0.0, false
+		scanner := bufio.NewScanner(strings.NewReader(exposition))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			name, labels, rest := line, "", ""
+			if i := strings.IndexByte(line, '{'); i >= 0 {
+				end := strings.LastIndexByte(line, '}')
+				if end < i {
+					return 0, "", fmt.Errorf("malformed metric line %q", line)
+				}
+				name, labels, rest = line[:i], line[i+1:end], line[end+1:]
+			} else if i := strings.IndexByte(line, ' '); i >= 0 {
+				name, rest = line[:i], line[i:]
+			}
+			if name != candidate.Name || (candidate.Label != "" && !strings.Contains(labels, candidate.Label)) {
+				continue
+			}
+
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				return 0, "", fmt.Errorf("metric line %q has no value", line)
+			}
+			value, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return 0, "", fmt.Errorf("invalid value in metric line %q: %w", line, err)
+			}
+			total += value
+			found = true
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, "", fmt.Errorf("failed to read metrics: %w", err)
+		}
+		if found {
+			return total, candidate.Name, nil
+		}
+	}
+
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate.Name)
+	}
+	return 0, "", fmt.Errorf("none of %s found in metrics", strings.Join(names, ", "))
+}
+
+// scrapeOperatorMetrics fetches the metrics of a running operator pod in namespace through the
+// API server's pod proxy
+func scrapeOperatorMetrics(ctx context.Context, clientset kubernetes.Interface, namespace string) (string, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: operatorPodSelector})
+	if err != nil {
+		return "", fmt.Errorf("failed to list operator pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		body, err := clientset.CoreV1().Pods(namespace).ProxyGet("http", pod.Name, operatorMetricsPort, "metrics", nil).DoRaw(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to scrape metrics of operator pod %s: %w", pod.Name, err)
+		}
+		return string(body), nil
+	}
+	return "", fmt.Errorf("no running operator pod in %s", namespace)
+}
+
+// GetOperatorMetrics returns the Prometheus metrics exposed by the operator
+func (co *CNPGOperator) GetOperatorMetrics(t *testing.T) (string, error) {
+	t.Helper()
+
+	clientset, err := getClientset(co.KubectlOptions.ConfigPath)
+	if err != nil {
+		return "", err
+	}
+	return scrapeOperatorMetrics(context.Background(), clientset, co.Namespace)
+}
+
+// waitForMetricIncrease reads a counter until it exceeds before and returns the new value
+func waitForMetricIncrease(read func() (float64, error), before float64, timeout, interval time.Duration) (float64, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		value, err := read()
+		if err != nil {
+			return 0, err
+		}
+		if value > before {
+			return value, nil
+		}
+
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("counter still at %g after %s", value, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// AssertReconcileErrorMetric reads the operator's reconcile error counter, runs induce, which
+// must cause a failed reconcile (e.g. by creating an invalid cluster), and checks the counter
+// increments. It returns the increase.
+func AssertReconcileErrorMetric(t *testing.T, operator *CNPGOperator, induce func()) float64 {
+	t.Helper()
+
+	read := func() (float64, error) {
+		metrics, err := operator.GetOperatorMetrics(t)
+		if err != nil {
+			return 0, err
+		}
+		value, _, err := metricValue(metrics, reconcileErrorMetrics)
+		return value, err
+	}
+
+	metrics, err := operator.GetOperatorMetrics(t)
+	require.NoError(t, err)
+	before, name, err := metricValue(metrics, reconcileErrorMetrics)
+	require.NoError(t, err)
+
+	induce()
+
+	after, err := waitForMetricIncrease(read, before, reconcileErrorTimeout, reconcileErrorInterval)
+	require.NoError(t, err, "Operator did not count the induced reconcile error in %s", name)
+
+	t.Logf("%s went from %g to %g", name, before, after)
+	return after - before
+}
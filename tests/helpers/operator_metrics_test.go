@@ -0,0 +1,113 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeProxyResponse is a canned pod proxy response
+type fakeProxyResponse string
+
+func (r fakeProxyResponse) DoRaw(context.Context) ([]byte, error) {
+	return []byte(r), nil
+}
+
+func (r fakeProxyResponse) Stream(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(r))), nil
+}
+
+const testOperatorMetrics = `# HELP controller_runtime_reconcile_errors_total Total number of reconciliation errors per controller
+# TYPE controller_runtime_reconcile_errors_total counter
+controller_runtime_reconcile_errors_total{controller="cluster"} 3
+controller_runtime_reconcile_errors_total{controller="backup"} 1
+# TYPE controller_runtime_reconcile_total counter
+controller_runtime_reconcile_total{controller="cluster",result="error"} 4
+controller_runtime_reconcile_total{controller="cluster",result="success"} 120
+cnpg_collector_up 1
+`
+
+func TestMetricValue(t *testing.T) {
+	value, name, err := metricValue(testOperatorMetrics, reconcileErrorMetrics)
+	require.NoError(t, err)
+	require.Equal(t, "controller_runtime_reconcile_errors_total", name)
+	require.Equal(t, 4.0, value)
+
+	// Older operators only label the reconcile total with its result
+	older := `controller_runtime_reconcile_total{controller="cluster",result="error"} 2
+controller_runtime_reconcile_total{controller="cluster",result="success"} 7
+controller_runtime_reconcile_total{controller="pooler",result="error"} 1
+`
+	value, name, err = metricValue(older, reconcileErrorMetrics)
+	require.NoError(t, err)
+	require.Equal(t, "controller_runtime_reconcile_total", name)
+	require.Equal(t, 3.0, value)
+
+	value, _, err = metricValue(testOperatorMetrics, []metricSeries{{Name: "cnpg_collector_up"}})
+	require.NoError(t, err)
+	require.Equal(t, 1.0, value)
+
+	_, _, err = metricValue("cnpg_collector_up 1\n", reconcileErrorMetrics)
+	require.ErrorContains(t, err, "none of controller_runtime_reconcile_errors_total, controller_runtime_reconcile_total found")
+
+	_, _, err = metricValue(`controller_runtime_reconcile_errors_total{controller="cluster"} many`, reconcileErrorMetrics)
+	require.ErrorContains(t, err, "invalid value")
+}
+
+func TestScrapeOperatorMetrics(t *testing.T) {
+	ctx := context.Background()
+	operatorPod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cnpg-system", Labels: map[string]string{"app.kubernetes.io/name": "cloudnative-pg"}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	_, err := scrapeOperatorMetrics(ctx, fake.NewClientset(operatorPod("cnpg-old", corev1.PodFailed)), "cnpg-system")
+	require.ErrorContains(t, err, "no running operator pod in cnpg-system")
+
+	clientset := fake.NewClientset(operatorPod("cnpg-old", corev1.PodFailed), operatorPod("cnpg-new", corev1.PodRunning))
+	var scraped k8stesting.ProxyGetAction
+	clientset.PrependProxyReactor("pods", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		scraped = action.(k8stesting.ProxyGetAction)
+		return true, fakeProxyResponse(testOperatorMetrics), nil
+	})
+
+	metrics, err := scrapeOperatorMetrics(ctx, clientset, "cnpg-system")
+	require.NoError(t, err)
+	require.Equal(t, testOperatorMetrics, metrics)
+	require.Equal(t, "cnpg-new", scraped.GetName())
+	require.Equal(t, operatorMetricsPort, scraped.GetPort())
+	require.Equal(t, "metrics", scraped.GetPath())
+}
+
+func TestWaitForMetricIncrease(t *testing.T) {
+	values := []float64{4, 4, 5}
+	read := func() (float64, error) {
+		value := values[0]
+		if len(values) > 1 {
+			values = values[1:]
+		}
+		return value, nil
+	}
+	value, err := waitForMetricIncrease(read, 4, time.Second, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 5.0, value)
+
+	_, err = waitForMetricIncrease(func() (float64, error) { return 4, nil }, 4, 10*time.Millisecond, time.Millisecond)
+	require.ErrorContains(t, err, "counter still at 4")
+
+	scrapeErr := errors.New("connection refused")
+	_, err = waitForMetricIncrease(func() (float64, error) { return 0, scrapeErr }, 4, time.Second, time.Millisecond)
+	require.ErrorIs(t, err, scrapeErr)
+}
@@ -0,0 +1,217 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// policyProbeCluster is a Cluster the image validation policy must always deny
+const policyProbeCluster = `apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: image-policy-probe
+spec:
+  instances: 1
+  imageName: ghcr.io/cloudnative-pg/postgresql:17
+  storage:
+    size: 1Gi
+`
+
+// denialPattern extracts the policy message from a ValidatingAdmissionPolicy denial. Depending on
+// the Kubernetes version the message follows "denied request: " and may be wrapped in kubectl's
+// "Error from server (...)" prefix or end with a trailing reason.
+var denialPattern = regexp.MustCompile(`denied request: (.+)`)
+
+// parseDenialMessage returns the admission policy message contained in kubectl output
+func parseDenialMessage(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		m := denialPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		return strings.TrimSpace(m[1]), nil
+	}
+	return "", fmt.Errorf("no admission policy denial found in output: %s", strings.TrimSpace(output))
+}
+
+// dryRunPolicyProbe dry-run applies policyProbeCluster on the server and returns kubectl's output
+func dryRunPolicyProbe(t *testing.T, opts *k8s.KubectlOptions) (string, error) {
+	t.Helper()
+
+	f, err := os.CreateTemp("", "image-policy-probe-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create probe manifest: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(policyProbeCluster); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write probe manifest: %w", err)
+	}
+	f.Close()
+
+	return k8s.RunKubectlAndGetOutputE(t, opts, "apply", "--dry-run=server", "-f", f.Name())
+}
+
+// GetEffectivePolicyMessage dry-run applies a Cluster with an upstream image and returns the exact
+// denial message the image validation policy produces on this server, so tests can assert against
+// the real message instead of a hardcoded substring
+func GetEffectivePolicyMessage(t *testing.T, opts *k8s.KubectlOptions) (string, error) {
+	t.Helper()
+
+	output, err := dryRunPolicyProbe(t, opts)
+	if err == nil {
+		return "", fmt.Errorf("image validation policy did not deny an upstream image")
+	}
+
+	return parseDenialMessage(output)
+}
+
+// warningPattern extracts the policy message from the warning kubectl prints for a policy bound
+// with the Warn validation action
+var warningPattern = regexp.MustCompile(`Warning: Validation failed for ValidatingAdmissionPolicy '[^']+' with binding '[^']+': (.+)`)
+
+// parsePolicyWarning returns the admission policy warning contained in kubectl output
+func parsePolicyWarning(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		if m := warningPattern.FindStringSubmatch(line); m != nil {
+			return strings.TrimSpace(m[1]), nil
+		}
+	}
+	return "", fmt.Errorf("no admission policy warning found in output: %s", strings.TrimSpace(output))
+}
+
+// AssertPolicyWarns checks that, with the image validation policy bound in Warn mode, a Cluster
+// with an upstream image is admitted and the client gets the policy message as a warning
+func AssertPolicyWarns(t *testing.T, opts *k8s.KubectlOptions, expectedMessage string) {
+	t.Helper()
+
+	output, err := dryRunPolicyProbe(t, opts)
+	require.NoError(t, err, "Upstream image was rejected in Warn mode: %s", output)
+
+	warning, err := parsePolicyWarning(output)
+	require.NoError(t, err)
+	require.Contains(t, warning, expectedMessage)
+}
+
+// imageValidationPolicyName is the ValidatingAdmissionPolicy rendered by config.RenderImageValidationPolicy
+const imageValidationPolicyName = "pgedge-postgres-only"
+
+// paramResource resolves the resource name and scope of a policy's paramKind through discovery
+func paramResource(clientset kubernetes.Interface, kind *admissionregistrationv1.ParamKind) (schema.GroupVersionResource, bool, error) {
+	gv, err := schema.ParseGroupVersion(kind.APIVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("invalid paramKind apiVersion %q: %w", kind.APIVersion, err)
+	}
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(kind.APIVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("paramKind %s/%s is not served: %w", kind.APIVersion, kind.Kind, err)
+	}
+	for _, r := range resources.APIResources {
+		if r.Kind == kind.Kind && !strings.Contains(r.Name, "/") {
+			return gv.WithResource(r.Name), r.Namespaced, nil
+		}
+	}
+	return schema.GroupVersionResource{}, false, fmt.Errorf("paramKind %s/%s is not served", kind.APIVersion, kind.Kind)
+}
+
+// checkPolicyParams verifies that the params referenced by every binding of policyName exist and
+// can be read. It returns false when the policy takes no params.
+func checkPolicyParams(ctx context.Context, clientset kubernetes.Interface, dynClient dynamic.Interface, policyName string) (bool, error) {
+	admission := clientset.AdmissionregistrationV1()
+	policy, err := admission.ValidatingAdmissionPolicies().Get(ctx, policyName, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get ValidatingAdmissionPolicy %s: %w", policyName, err)
+	}
+	if policy.Spec.ParamKind == nil {
+		return false, nil
+	}
+
+	gvr, namespaced, err := paramResource(clientset, policy.Spec.ParamKind)
+	if err != nil {
+		return true, err
+	}
+
+	bindings, err := admission.ValidatingAdmissionPolicyBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return true, fmt.Errorf("failed to list ValidatingAdmissionPolicyBindings: %w", err)
+	}
+
+	var errs []error
+	bound := false
+	for _, b := range bindings.Items {
+		if b.Spec.PolicyName != policyName {
+			continue
+		}
+		bound = true
+		ref := b.Spec.ParamRef
+		if ref == nil {
+			errs = append(errs, fmt.Errorf("binding %s has no paramRef but policy %s expects %s params", b.Name, policyName, policy.Spec.ParamKind.Kind))
+			continue
+		}
+		if namespaced && ref.Namespace == "" {
+			// Params come from the namespace of each admitted object, so there is nothing fixed to check
+			continue
+		}
+
+		resource := dynClient.Resource(gvr)
+		var client dynamic.ResourceInterface = resource
+		if namespaced {
+			client = resource.Namespace(ref.Namespace)
+		}
+
+		if ref.Name != "" {
+			if _, err := client.Get(ctx, ref.Name, metav1.GetOptions{}); err != nil {
+				errs = append(errs, fmt.Errorf("binding %s: cannot read %s %s: %w", b.Name, policy.Spec.ParamKind.Kind, ref.Name, err))
+			}
+			continue
+		}
+
+		selector := ""
+		if ref.Selector != nil {
+			selector = metav1.FormatLabelSelector(ref.Selector)
+		}
+		list, err := client.List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("binding %s: cannot list %s params: %w", b.Name, policy.Spec.ParamKind.Kind, err))
+		} else if len(list.Items) == 0 {
+			errs = append(errs, fmt.Errorf("binding %s: no %s matches selector %q", b.Name, policy.Spec.ParamKind.Kind, selector))
+		}
+	}
+	if !bound {
+		errs = append(errs, fmt.Errorf("policy %s has no bindings", policyName))
+	}
+
+	return true, errors.Join(errs...)
+}
+
+// AssertPolicyParamAccessible checks that, when policyName is parameterized, the params its
+// bindings reference exist and are readable, so the policy evaluates instead of failing on a
+// missing param. It skips when the policy takes no params.
+func AssertPolicyParamAccessible(t *testing.T, opts *k8s.KubectlOptions, policyName string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+
+	used, err := checkPolicyParams(context.Background(), clientset, dynClient, policyName)
+	if !used && err == nil {
+		t.Skipf("Policy %s does not use a paramRef", policyName)
+	}
+	require.NoError(t, err)
+}
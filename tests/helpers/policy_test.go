@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseDenialMessage(t *testing.T) {
+	const message = "CNPG Cluster must use pgEdge PostgreSQL images (ghcr.io/pgedge/pgedge-postgres or ghcr.io/pgedge/pgedge-postgres-internal). Upstream CNPG images are not allowed in these tests."
+
+	output := `Error from server (Forbidden): error when creating "/tmp/image-policy-probe-1.yaml": clusters.postgresql.cnpg.io "image-policy-probe" is forbidden: ValidatingAdmissionPolicy 'pgedge-postgres-only' with binding 'pgedge-postgres-only-binding' denied request: ` + message + "\n"
+
+	got, err := parseDenialMessage(output)
+	require.NoError(t, err)
+	require.Equal(t, message, got)
+
+	_, err = parseDenialMessage(`Error from server (InternalError): Internal error occurred: failed calling webhook "vcluster.cnpg.io"`)
+	require.Error(t, err)
+}
+
+func TestParsePolicyWarning(t *testing.T) {
+	const message = "CNPG Cluster must use pgEdge PostgreSQL images (ghcr.io/pgedge/pgedge-postgres or ghcr.io/pgedge/pgedge-postgres-internal). Upstream CNPG images are not allowed in these tests."
+
+	output := "Warning: Validation failed for ValidatingAdmissionPolicy 'pgedge-postgres-only' with binding 'pgedge-postgres-only-binding': " + message + "\n" +
+		"cluster.postgresql.cnpg.io/image-policy-probe created (server dry run)\n"
+
+	got, err := parsePolicyWarning(output)
+	require.NoError(t, err)
+	require.Equal(t, message, got)
+
+	_, err = parsePolicyWarning("cluster.postgresql.cnpg.io/image-policy-probe created (server dry run)")
+	require.Error(t, err)
+}
+
+func TestCheckPolicyParams(t *testing.T) {
+	ctx := context.Background()
+	configMapGVR := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	policy := func(paramKind *admissionregistrationv1.ParamKind) *admissionregistrationv1.ValidatingAdmissionPolicy {
+		return &admissionregistrationv1.ValidatingAdmissionPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: imageValidationPolicyName},
+			Spec:       admissionregistrationv1.ValidatingAdmissionPolicySpec{ParamKind: paramKind},
+		}
+	}
+	binding := func(ref *admissionregistrationv1.ParamRef) *admissionregistrationv1.ValidatingAdmissionPolicyBinding {
+		return &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: imageValidationPolicyName + "-binding"},
+			Spec:       admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{PolicyName: imageValidationPolicyName, ParamRef: ref},
+		}
+	}
+	newClientset := func(objects ...runtime.Object) *fake.Clientset {
+		clientset := fake.NewClientset(objects...)
+		clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}},
+		}}
+		return clientset
+	}
+	allowedRegistries := &unstructured.Unstructured{}
+	allowedRegistries.SetAPIVersion("v1")
+	allowedRegistries.SetKind("ConfigMap")
+	allowedRegistries.SetNamespace("kube-system")
+	allowedRegistries.SetName("allowed-registries")
+	allowedRegistries.SetLabels(map[string]string{"pgedge.com/policy-params": "true"})
+	dynClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapGVR: "ConfigMapList"}, allowedRegistries)
+	configMapKind := &admissionregistrationv1.ParamKind{APIVersion: "v1", Kind: "ConfigMap"}
+
+	// Not parameterized
+	used, err := checkPolicyParams(ctx, newClientset(policy(nil), binding(nil)), dynClient, imageValidationPolicyName)
+	require.NoError(t, err)
+	require.False(t, used)
+
+	used, err = checkPolicyParams(ctx, newClientset(policy(configMapKind),
+		binding(&admissionregistrationv1.ParamRef{Namespace: "kube-system", Name: "allowed-registries"})), dynClient, imageValidationPolicyName)
+	require.NoError(t, err)
+	require.True(t, used)
+
+	_, err = checkPolicyParams(ctx, newClientset(policy(configMapKind), binding(&admissionregistrationv1.ParamRef{
+		Namespace: "kube-system",
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"pgedge.com/policy-params": "true"}},
+	})), dynClient, imageValidationPolicyName)
+	require.NoError(t, err)
+
+	_, err = checkPolicyParams(ctx, newClientset(policy(configMapKind),
+		binding(&admissionregistrationv1.ParamRef{Namespace: "kube-system", Name: "missing"})), dynClient, imageValidationPolicyName)
+	require.ErrorContains(t, err, "cannot read ConfigMap missing")
+
+	_, err = checkPolicyParams(ctx, newClientset(policy(configMapKind), binding(&admissionregistrationv1.ParamRef{
+		Namespace: "default",
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"pgedge.com/policy-params": "true"}},
+	})), dynClient, imageValidationPolicyName)
+	require.ErrorContains(t, err, "no ConfigMap matches selector")
+
+	_, err = checkPolicyParams(ctx, newClientset(policy(configMapKind), binding(nil)), dynClient, imageValidationPolicyName)
+	require.ErrorContains(t, err, "has no paramRef")
+
+	_, err = checkPolicyParams(ctx, newClientset(policy(&admissionregistrationv1.ParamKind{APIVersion: "pgedge.com/v1", Kind: "RegistryList"}),
+		binding(&admissionregistrationv1.ParamRef{Name: "registries"})), dynClient, imageValidationPolicyName)
+	require.ErrorContains(t, err, "is not served")
+}
@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// poolerGVR identifies the CNPG Pooler custom resource
+var poolerGVR = schema.GroupVersionResource{Group: "postgresql.cnpg.io", Version: "v1", Resource: "poolers"}
+
+// poolerTarget describes which cluster a Pooler fronts and how it routes
+type poolerTarget struct {
+	ClusterName string
+	Type        string
+}
+
+// getPoolerTarget reads the target cluster and routing type from a Pooler
+func getPoolerTarget(ctx context.Context, dynClient dynamic.Interface, namespace, name string) (poolerTarget, error) {
+	pooler, err := dynClient.Resource(poolerGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return poolerTarget{}, fmt.Errorf("failed to get pooler %s/%s: %w", namespace, name, err)
+	}
+
+	clusterName, _, _ := unstructured.NestedString(pooler.Object, "spec", "cluster", "name")
+	if clusterName == "" {
+		return poolerTarget{}, fmt.Errorf("pooler %s/%s has no spec.cluster.name", namespace, name)
+	}
+	poolerType, _, _ := unstructured.NestedString(pooler.Object, "spec", "type")
+	if poolerType == "" {
+		// CNPG defaults the pooler type to rw
+		poolerType = "rw"
+	}
+
+	return poolerTarget{ClusterName: clusterName, Type: poolerType}, nil
+}
+
+// AssertPoolerRouting connects through a Pooler's service and checks pg_is_in_recovery() to
+// confirm RW poolers reach the primary and RO poolers reach a standby
+func AssertPoolerRouting(t *testing.T, opts *k8s.KubectlOptions, poolerName string, expectReadOnly bool) {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+
+	target, err := getPoolerTarget(context.Background(), dynClient, opts.Namespace, poolerName)
+	require.NoError(t, err)
+	t.Logf("Pooler %s (type %s) fronts cluster %s", poolerName, target.Type, target.ClusterName)
+
+	// CNPG exposes each pooler through a service with the pooler's name
+	conn, closeConn, err := OpenServiceConnection(t, opts, poolerName, target.ClusterName+"-app")
+	require.NoError(t, err)
+	defer closeConn()
+
+	var inRecovery bool
+	err = conn.QueryRowContext(context.Background(), `SELECT pg_is_in_recovery()`).Scan(&inRecovery)
+	require.NoError(t, err, "Failed to query through pooler %s", poolerName)
+
+	if expectReadOnly {
+		require.True(t, inRecovery, "Pooler %s should route to a standby but reached the primary", poolerName)
+	} else {
+		require.False(t, inRecovery, "Pooler %s should route to the primary but reached a standby", poolerName)
+	}
+}
@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newCNPGPooler returns an unstructured CNPG Pooler for fake clients
+func newCNPGPooler(namespace, name, cluster, poolerType string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{},
+	}}
+	u.SetAPIVersion("postgresql.cnpg.io/v1")
+	u.SetKind("Pooler")
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	if cluster != "" {
+		_ = unstructured.SetNestedField(u.Object, cluster, "spec", "cluster", "name")
+	}
+	if poolerType != "" {
+		_ = unstructured.SetNestedField(u.Object, poolerType, "spec", "type")
+	}
+	return u
+}
+
+func TestGetPoolerTarget(t *testing.T) {
+	dynClient := newFakeDynamicClient(
+		newCNPGPooler("pgedge", "pooler-ro", "pgedge-1", "ro"),
+		newCNPGPooler("pgedge", "pooler-default", "pgedge-1", ""),
+		newCNPGPooler("pgedge", "pooler-orphan", "", "rw"),
+	)
+	ctx := context.Background()
+
+	target, err := getPoolerTarget(ctx, dynClient, "pgedge", "pooler-ro")
+	require.NoError(t, err)
+	require.Equal(t, poolerTarget{ClusterName: "pgedge-1", Type: "ro"}, target)
+
+	target, err = getPoolerTarget(ctx, dynClient, "pgedge", "pooler-default")
+	require.NoError(t, err)
+	require.Equal(t, "rw", target.Type)
+
+	_, err = getPoolerTarget(ctx, dynClient, "pgedge", "pooler-orphan")
+	require.ErrorContains(t, err, "no spec.cluster.name")
+
+	_, err = getPoolerTarget(ctx, dynClient, "pgedge", "missing")
+	require.Error(t, err)
+}
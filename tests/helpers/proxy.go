@@ -0,0 +1,170 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// serviceCIDRGVRs are the versions of the ServiceCIDR API, GA in Kubernetes 1.33 and beta before
+var serviceCIDRGVRs = []schema.GroupVersionResource{
+	{Group: "networking.k8s.io", Version: "v1", Resource: "servicecidrs"},
+	{Group: "networking.k8s.io", Version: "v1beta1", Resource: "servicecidrs"},
+}
+
+// clusterNetworks returns the service and pod networks of the cluster, which in-cluster clients
+// such as the operator must reach without the proxy. The service network comes from the default
+// ServiceCIDR, or the kubernetes Service IPs where that API is not served, and the pod networks
+// from the nodes' podCIDRs.
+func clusterNetworks(ctx context.Context, clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	var networks []string
+	for _, gvr := range serviceCIDRGVRs {
+		serviceCIDR, err := dynClient.Resource(gvr).Get(ctx, "kubernetes", metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		cidrs, _, _ := unstructured.NestedStringSlice(serviceCIDR.Object, "spec", "cidrs")
+		networks = append(networks, cidrs...)
+		break
+	}
+	if len(networks) == 0 {
+		svc, err := clientset.CoreV1().Services(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the kubernetes service: %w", err)
+		}
+		networks = append(networks, svc.Spec.ClusterIPs...)
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		for _, cidr := range node.Spec.PodCIDRs {
+			if !slices.Contains(networks, cidr) {
+				networks = append(networks, cidr)
+			}
+		}
+	}
+	return networks, nil
+}
+
+// withClusterNoProxy returns proxy with the cluster-internal destinations and networks of the
+// cluster behind kubeconfigPath added to NO_PROXY
+func withClusterNoProxy(kubeconfigPath string, proxy config.ProxyConfig) (config.ProxyConfig, error) {
+	clientset, err := getClientset(kubeconfigPath)
+	if err != nil {
+		return proxy, err
+	}
+	dynClient, err := getDynamicClient(kubeconfigPath)
+	if err != nil {
+		return proxy, err
+	}
+	networks, err := clusterNetworks(context.Background(), clientset, dynClient)
+	if err != nil {
+		return proxy, err
+	}
+	return proxy.WithClusterNoProxy(networks...), nil
+}
+
+// proxyEnvJSON renders the proxy as a JSON list of container env vars, sorted by name
+func proxyEnvJSON(proxy config.ProxyConfig) (string, error) {
+	env := proxy.Env()
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]corev1.EnvVar, 0, len(names))
+	for _, name := range names {
+		vars = append(vars, corev1.EnvVar{Name: name, Value: env[name]})
+	}
+
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode proxy env: %w", err)
+	}
+	return string(data), nil
+}
+
+// noProxyEntries splits a NO_PROXY value into its trimmed, non-empty entries
+func noProxyEntries(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// proxyValueMatches reports whether actual satisfies the expected value of the proxy variable
+// name. NO_PROXY only needs to contain the expected entries, since the operator install adds
+// the cluster-internal ones.
+func proxyValueMatches(name, expected, actual string) bool {
+	if !strings.EqualFold(name, "NO_PROXY") {
+		return actual == expected
+	}
+	entries := noProxyEntries(actual)
+	for _, entry := range noProxyEntries(expected) {
+		if !slices.Contains(entries, entry) {
+			return false
+		}
+	}
+	return actual != ""
+}
+
+// checkPodProxyEnv verifies every container in pod carries the expected proxy variables
+func checkPodProxyEnv(pod corev1.Pod, expected map[string]string) error {
+	for _, container := range pod.Spec.Containers {
+		env := make(map[string]string, len(container.Env))
+		for _, e := range container.Env {
+			env[e.Name] = e.Value
+		}
+		for name, value := range expected {
+			if !proxyValueMatches(name, value, env[name]) {
+				return fmt.Errorf("container %s in pod %s has %s=%q, expected %q",
+					container.Name, pod.Name, name, env[name], value)
+			}
+		}
+	}
+	return nil
+}
+
+// AssertProxyRespected checks that the pods in opts.Namespace carry the configured proxy settings,
+// allowing extra NO_PROXY entries. It skips when no proxy is configured.
+func AssertProxyRespected(t *testing.T, opts *k8s.KubectlOptions) {
+	t.Helper()
+
+	proxy := config.LoadProxyConfig()
+	if !proxy.Enabled() {
+		t.Skip("No proxy configured")
+	}
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	pods, err := clientset.CoreV1().Pods(opts.Namespace).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, pods.Items, "No pods found in %s", opts.Namespace)
+
+	expected := proxy.Env()
+	for _, pod := range pods.Items {
+		require.NoError(t, checkPodProxyEnv(pod, expected))
+	}
+}
@@ -0,0 +1,106 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProxyEnv(t *testing.T) {
+	proxy := config.ProxyConfig{HTTPSProxy: "http://proxy:3128", NoProxy: ".svc"}
+
+	data, err := proxyEnvJSON(proxy)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"name":"HTTPS_PROXY","value":"http://proxy:3128"},
+		{"name":"NO_PROXY","value":".svc"},
+		{"name":"https_proxy","value":"http://proxy:3128"},
+		{"name":"no_proxy","value":".svc"}
+	]`, data)
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "manager",
+			Env: []corev1.EnvVar{
+				{Name: "HTTPS_PROXY", Value: "http://proxy:3128"},
+				{Name: "https_proxy", Value: "http://proxy:3128"},
+				{Name: "NO_PROXY", Value: ".svc"},
+				{Name: "no_proxy", Value: ".svc"},
+			},
+		}}},
+	}
+	require.NoError(t, checkPodProxyEnv(pod, proxy.Env()))
+
+	// The chart may append its own NO_PROXY entries
+	pod.Spec.Containers[0].Env[2].Value = "10.96.0.0/12, .svc,.cluster.local"
+	pod.Spec.Containers[0].Env[3].Value = ".svc,kubernetes.default"
+	require.NoError(t, checkPodProxyEnv(pod, proxy.Env()))
+
+	pod.Spec.Containers[0].Env[3].Value = "kubernetes.default"
+	err = checkPodProxyEnv(pod, proxy.Env())
+	require.ErrorContains(t, err, `has no_proxy="kubernetes.default", expected ".svc"`)
+
+	pod.Spec.Containers[0].Env = pod.Spec.Containers[0].Env[:1]
+	err = checkPodProxyEnv(pod, proxy.Env())
+	require.ErrorContains(t, err, `container manager in pod operator has`)
+}
+
+func TestClusterNetworks(t *testing.T) {
+	ctx := context.Background()
+	node := func(name string, podCIDRs ...string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: corev1.NodeSpec{PodCIDRs: podCIDRs}}
+	}
+	clientset := fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceDefault, Name: "kubernetes"},
+			Spec:       corev1.ServiceSpec{ClusterIPs: []string{"10.21.0.1"}},
+		},
+		node("control-plane", "10.20.0.0/24"),
+		node("worker", "10.20.1.0/24"),
+		node("eks-node"),
+	)
+
+	// Without the ServiceCIDR API the kubernetes Service IP stands in for the service network
+	networks, err := clusterNetworks(ctx, clientset, newFakeDynamicClient())
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.21.0.1", "10.20.0.0/24", "10.20.1.0/24"}, networks)
+
+	serviceCIDR := &unstructured.Unstructured{}
+	serviceCIDR.SetAPIVersion("networking.k8s.io/v1beta1")
+	serviceCIDR.SetKind("ServiceCIDR")
+	serviceCIDR.SetName("kubernetes")
+	require.NoError(t, unstructured.SetNestedStringSlice(serviceCIDR.Object, []string{"10.21.0.0/16"}, "spec", "cidrs"))
+	networks, err = clusterNetworks(ctx, clientset, newFakeDynamicClient(serviceCIDR))
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.21.0.0/16", "10.20.0.0/24", "10.20.1.0/24"}, networks)
+}
+
+func TestOperatorProxyEnv(t *testing.T) {
+	proxy := config.ProxyConfig{HTTPSProxy: "http://proxy:3128"}
+	operator := &CNPGOperator{
+		OperatorImage: "ghcr.io/pgedge/cloudnative-pg:1.29.1",
+		Proxy:         proxy.WithClusterNoProxy("10.21.0.0/16", "10.20.0.0/24"),
+	}
+	helmOptions, err := operator.helmOptions(nil)
+	require.NoError(t, err)
+
+	var env []corev1.EnvVar
+	require.NoError(t, json.Unmarshal([]byte(helmOptions.SetJsonValues["additionalEnv"]), &env))
+	values := make(map[string]string)
+	for _, e := range env {
+		values[e.Name] = e.Value
+	}
+	require.Equal(t, "http://proxy:3128", values["HTTPS_PROXY"])
+	// The operator reaches the API server and instance pods directly even with no NO_PROXY configured
+	for _, name := range []string{"NO_PROXY", "no_proxy"} {
+		require.Equal(t, "localhost,127.0.0.1,.svc,.cluster.local,kubernetes.default,10.21.0.0/16,10.20.0.0/24", values[name])
+	}
+}
@@ -0,0 +1,235 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+)
+
+// renderedPod is a pod template of a rendered workload and how many pods it creates
+type renderedPod struct {
+	Name     string
+	Replicas int64
+	Spec     corev1.PodSpec
+}
+
+// renderedPods returns the pods the workloads in rendered manifests create. DaemonSets count as
+// one pod, since the node count is not known before deploying.
+func renderedPods(rendered string) ([]renderedPod, error) {
+	var pods []renderedPod
+	decoder := k8syaml.NewYAMLOrJSONDecoder(strings.NewReader(rendered), 4096)
+	for {
+		var doc struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				Replicas    *int64                 `json:"replicas"`
+				Parallelism *int64                 `json:"parallelism"`
+				Template    corev1.PodTemplateSpec `json:"template"`
+				corev1.PodSpec
+			} `json:"spec"`
+		}
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse rendered manifests: %w", err)
+		}
+
+		pod := renderedPod{Name: doc.Kind + "/" + doc.Metadata.Name, Replicas: 1, Spec: doc.Spec.Template.Spec}
+		switch doc.Kind {
+		case "Deployment", "StatefulSet", "ReplicaSet":
+			if doc.Spec.Replicas != nil {
+				pod.Replicas = *doc.Spec.Replicas
+			}
+		case "Job":
+			if doc.Spec.Parallelism != nil {
+				pod.Replicas = *doc.Spec.Parallelism
+			}
+		case "DaemonSet":
+		case "Pod":
+			pod.Spec = doc.Spec.PodSpec
+		default:
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// containerLimitRanges returns the Container limits of every LimitRange
+func containerLimitRanges(limitRanges []corev1.LimitRange) []corev1.LimitRangeItem {
+	var items []corev1.LimitRangeItem
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type == corev1.LimitTypeContainer {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// effectiveResources returns the requests and limits of a container after LimitRange defaulting
+func effectiveResources(c corev1.Container, items []corev1.LimitRangeItem) (requests, limits corev1.ResourceList) {
+	requests, limits = c.Resources.Requests.DeepCopy(), c.Resources.Limits.DeepCopy()
+	if requests == nil {
+		requests = corev1.ResourceList{}
+	}
+	if limits == nil {
+		limits = corev1.ResourceList{}
+	}
+	for _, item := range items {
+		for name, value := range item.Default {
+			if _, ok := limits[name]; !ok {
+				limits[name] = value
+			}
+		}
+		for name, value := range item.DefaultRequest {
+			if _, ok := requests[name]; !ok {
+				requests[name] = value
+			}
+		}
+	}
+	// As in the API server, a limit without a request also sets the request
+	for name, value := range limits {
+		if _, ok := requests[name]; !ok {
+			requests[name] = value
+		}
+	}
+	return requests, limits
+}
+
+// checkContainerLimits verifies a container's resources are within the min and max of items
+func checkContainerLimits(pod, container string, requests, limits corev1.ResourceList, items []corev1.LimitRangeItem) []string {
+	var problems []string
+	for _, item := range items {
+		for name, maxValue := range item.Max {
+			if value, ok := limits[name]; ok && value.Cmp(maxValue) > 0 {
+				problems = append(problems, fmt.Sprintf("%s container %s: %s limit %s exceeds LimitRange max %s", pod, container, name, value.String(), maxValue.String()))
+			}
+		}
+		for name, minValue := range item.Min {
+			if value, ok := requests[name]; ok && value.Cmp(minValue) < 0 {
+				problems = append(problems, fmt.Sprintf("%s container %s: %s request %s is below LimitRange min %s", pod, container, name, value.String(), minValue.String()))
+			}
+		}
+	}
+	return problems
+}
+
+// addQuantity adds value times n to list[name]
+func addQuantity(list corev1.ResourceList, name corev1.ResourceName, value resource.Quantity, n int64) {
+	for i := int64(0); i < n; i++ {
+		total := list[name]
+		total.Add(value)
+		list[name] = total
+	}
+}
+
+// podsDemand returns what the pods count against a ResourceQuota, keyed like ResourceQuota hard
+// limits, and any LimitRange violations
+func podsDemand(pods []renderedPod, limitRanges []corev1.LimitRange) (corev1.ResourceList, []string) {
+	items := containerLimitRanges(limitRanges)
+	demand := corev1.ResourceList{}
+	var problems []string
+	for _, pod := range pods {
+		addQuantity(demand, corev1.ResourcePods, *resource.NewQuantity(1, resource.DecimalSI), pod.Replicas)
+		for _, c := range pod.Spec.Containers {
+			requests, limits := effectiveResources(c, items)
+			problems = append(problems, checkContainerLimits(pod.Name, c.Name, requests, limits, items)...)
+			for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+				if value, ok := requests[name]; ok {
+					addQuantity(demand, corev1.ResourceName("requests."+name), value, pod.Replicas)
+					addQuantity(demand, name, value, pod.Replicas)
+				}
+				if value, ok := limits[name]; ok {
+					addQuantity(demand, corev1.ResourceName("limits."+name), value, pod.Replicas)
+				}
+			}
+		}
+	}
+	return demand, problems
+}
+
+// checkQuotas verifies demand fits in what every quota has left
+func checkQuotas(demand corev1.ResourceList, quotas []corev1.ResourceQuota) []string {
+	var problems []string
+	for _, quota := range quotas {
+		names := make([]string, 0, len(quota.Spec.Hard))
+		for name := range quota.Spec.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		for _, n := range names {
+			name := corev1.ResourceName(n)
+			needed, ok := demand[name]
+			if !ok {
+				continue
+			}
+			total := quota.Status.Used[name]
+			total.Add(needed)
+			if hard := quota.Spec.Hard[name]; total.Cmp(hard) > 0 {
+				used := quota.Status.Used[name]
+				problems = append(problems, fmt.Sprintf("ResourceQuota %s: %s would be %s (used %s + chart %s), hard limit %s",
+					quota.Name, name, total.String(), used.String(), needed.String(), hard.String()))
+			}
+		}
+	}
+	return problems
+}
+
+// checkDeploymentFitsQuota verifies the pods of rendered manifests satisfy the LimitRanges of
+// namespace and fit in what its ResourceQuotas have left
+func checkDeploymentFitsQuota(ctx context.Context, clientset kubernetes.Interface, namespace, rendered string) error {
+	pods, err := renderedPods(rendered)
+	if err != nil {
+		return err
+	}
+	quotas, err := clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list resource quotas in %s: %w", namespace, err)
+	}
+	limitRanges, err := clientset.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list limit ranges in %s: %w", namespace, err)
+	}
+
+	demand, problems := podsDemand(pods, limitRanges.Items)
+	problems = append(problems, checkQuotas(demand, quotas.Items)...)
+	if len(problems) > 0 {
+		return fmt.Errorf("deployment does not fit namespace %s:\n%s", namespace, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// AssertDeploymentFitsQuota renders the chart at chartPath for namespace and checks, before
+// anything is deployed, that its pods satisfy the namespace's LimitRanges and fit in what its
+// ResourceQuotas have left. Failures name every exceeded dimension.
+func AssertDeploymentFitsQuota(t *testing.T, opts *k8s.KubectlOptions, namespace, chartPath string) {
+	t.Helper()
+
+	rendered, err := helm.RunHelmCommandAndGetStdOutE(t, &helm.Options{KubectlOptions: opts},
+		"template", "quota-check", chartPath, "--namespace", namespace)
+	require.NoError(t, err, "Failed to render chart %s", chartPath)
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	require.NoError(t, checkDeploymentFitsQuota(context.Background(), clientset, namespace, rendered))
+}
@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const quotaTestChart = `---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cnpg
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cnpg-operator
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: manager
+        resources:
+          requests:
+            cpu: 100m
+            memory: 200Mi
+          limits:
+            memory: 400Mi
+      - name: sidecar
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: cnpg-setup
+spec:
+  template:
+    spec:
+      containers:
+      - name: setup
+        resources:
+          limits:
+            cpu: 50m
+`
+
+func TestRenderedPods(t *testing.T) {
+	pods, err := renderedPods(quotaTestChart)
+	require.NoError(t, err)
+	require.Len(t, pods, 2)
+	require.Equal(t, "Deployment/cnpg-operator", pods[0].Name)
+	require.Equal(t, int64(2), pods[0].Replicas)
+	require.Len(t, pods[0].Spec.Containers, 2)
+	require.Equal(t, "Job/cnpg-setup", pods[1].Name)
+	require.Equal(t, int64(1), pods[1].Replicas)
+
+	_, err = renderedPods("kind: [")
+	require.ErrorContains(t, err, "failed to parse rendered manifests")
+}
+
+func TestCheckDeploymentFitsQuota(t *testing.T) {
+	ctx := context.Background()
+	quota := func(hard, used corev1.ResourceList) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "cnpg-system"},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+		}
+	}
+	limitRange := func(item corev1.LimitRangeItem) *corev1.LimitRange {
+		item.Type = corev1.LimitTypeContainer
+		return &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "cnpg-system"},
+			Spec:       corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{item}},
+		}
+	}
+
+	require.NoError(t, checkDeploymentFitsQuota(ctx, fake.NewClientset(), "cnpg-system", quotaTestChart))
+
+	// Operator requests 2x100m, the Job's limit defaults its request to 50m
+	roomy := quota(corev1.ResourceList{
+		corev1.ResourceRequestsCPU: resource.MustParse("1"),
+		corev1.ResourcePods:        resource.MustParse("10"),
+	}, corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("750m")})
+	require.NoError(t, checkDeploymentFitsQuota(ctx, fake.NewClientset(roomy), "cnpg-system", quotaTestChart))
+
+	tight := quota(corev1.ResourceList{
+		corev1.ResourceRequestsCPU:    resource.MustParse("1"),
+		corev1.ResourceLimitsMemory:   resource.MustParse("1Gi"),
+		corev1.ResourcePods:           resource.MustParse("10"),
+		corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+	}, corev1.ResourceList{
+		corev1.ResourceRequestsCPU: resource.MustParse("800m"),
+		corev1.ResourcePods:        resource.MustParse("8"),
+	})
+	err := checkDeploymentFitsQuota(ctx, fake.NewClientset(tight), "cnpg-system", quotaTestChart)
+	require.ErrorContains(t, err, "ResourceQuota compute: requests.cpu would be 1050m (used 800m + chart 250m), hard limit 1")
+	require.ErrorContains(t, err, "ResourceQuota compute: pods would be 11 (used 8 + chart 3), hard limit 10")
+	require.NotContains(t, err.Error(), "memory")
+
+	// Defaults apply to containers without resources and count against the quota
+	defaults := limitRange(corev1.LimitRangeItem{
+		Default:        corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		DefaultRequest: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+	})
+	err = checkDeploymentFitsQuota(ctx, fake.NewClientset(defaults, tight), "cnpg-system", quotaTestChart)
+	require.ErrorContains(t, err, "ResourceQuota compute: limits.memory would be 2336Mi (used 0 + chart 2336Mi), hard limit 1Gi")
+	require.ErrorContains(t, err, "ResourceQuota compute: requests.memory would be 1168Mi (used 0 + chart 1168Mi), hard limit 1Gi")
+
+	bounded := limitRange(corev1.LimitRangeItem{
+		Max: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+		Min: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("60m")},
+	})
+	err = checkDeploymentFitsQuota(ctx, fake.NewClientset(bounded), "cnpg-system", quotaTestChart)
+	require.ErrorContains(t, err, "Deployment/cnpg-operator container manager: memory limit 400Mi exceeds LimitRange max 256Mi")
+	require.ErrorContains(t, err, "Job/cnpg-setup container setup: cpu request 50m is below LimitRange min 60m")
+}
@@ -0,0 +1,215 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// pitrMarkerTable holds the rows written by WritePITRMarker
+const pitrMarkerTable = "pgedge_pitr_marker"
+
+// pitrRestoreTimeout bounds how long a point-in-time restore may take to become healthy
+const pitrRestoreTimeout = 15 * time.Minute
+
+// WritePITRMarker inserts a marker row on the source cluster and returns a time read after the
+// insert committed, so recovering to it keeps the marker. recovery_target_time stops before any
+// commit later than the target, and the row's written_at precedes its commit.
+func WritePITRMarker(t *testing.T, conn *sql.DB, name string) time.Time {
+	t.Helper()
+
+	ctx := context.Background()
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (name text PRIMARY KEY, written_at timestamptz NOT NULL DEFAULT clock_timestamp())`,
+		pitrMarkerTable))
+	require.NoError(t, err, "Failed to create %s", pitrMarkerTable)
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (name) VALUES ($1)`, pitrMarkerTable), name)
+	require.NoError(t, err, "Failed to write PITR marker %s", name)
+
+	var committedBy time.Time
+	require.NoError(t, conn.QueryRowContext(ctx, `SELECT clock_timestamp()`).Scan(&committedBy))
+	return committedBy
+}
+
+// pitrMarker is a row of pitrMarkerTable
+type pitrMarker struct {
+	Name      string
+	WrittenAt time.Time
+}
+
+// listPITRMarkers returns every marker row
+func listPITRMarkers(ctx context.Context, conn *sql.DB) ([]pitrMarker, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(`SELECT name, written_at FROM %s`, pitrMarkerTable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", pitrMarkerTable, err)
+	}
+	defer rows.Close()
+
+	var markers []pitrMarker
+	for rows.Next() {
+		var m pitrMarker
+		if err := rows.Scan(&m.Name, &m.WrittenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", pitrMarkerTable, err)
+		}
+		markers = append(markers, m)
+	}
+	return markers, rows.Err()
+}
+
+// checkRestoredMarkers verifies restored holds exactly the source markers written at or before
+// targetTime
+func checkRestoredMarkers(source, restored []pitrMarker, targetTime time.Time) error {
+	present := make(map[string]bool, len(restored))
+	for _, m := range restored {
+		present[m.Name] = true
+	}
+
+	for _, m := range source {
+		expected := !m.WrittenAt.After(targetTime)
+		switch {
+		case expected && !present[m.Name]:
+			return fmt.Errorf("marker %s written at %s is missing after restoring to %s",
+				m.Name, m.WrittenAt.Format(time.RFC3339Nano), targetTime.Format(time.RFC3339Nano))
+		case !expected && present[m.Name]:
+			return fmt.Errorf("marker %s written at %s is present after restoring to %s",
+				m.Name, m.WrittenAt.Format(time.RFC3339Nano), targetTime.Format(time.RFC3339Nano))
+		}
+	}
+	return nil
+}
+
+// barmanCloudSource returns the externalClusters entry that reads source's backups and WAL
+// through the Barman Cloud Plugin, from the ObjectStore its WAL archiver plugin writes to
+func barmanCloudSource(source *unstructured.Unstructured) (map[string]interface{}, error) {
+	plugins, _, err := unstructured.NestedSlice(source.Object, "spec", "plugins")
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s has invalid spec.plugins: %w", source.GetName(), err)
+	}
+	for _, p := range plugins {
+		plugin, ok := p.(map[string]interface{})
+		if !ok || plugin["name"] != BarmanCloudPluginName {
+			continue
+		}
+		objectStore, _, _ := unstructured.NestedString(plugin, "parameters", "barmanObjectName")
+		if objectStore == "" {
+			return nil, fmt.Errorf("cluster %s plugin %s has no barmanObjectName", source.GetName(), BarmanCloudPluginName)
+		}
+		serverName, _, _ := unstructured.NestedString(plugin, "parameters", "serverName")
+		if serverName == "" {
+			serverName = source.GetName()
+		}
+		return map[string]interface{}{
+			"name": source.GetName(),
+			"plugin": map[string]interface{}{
+				"name": BarmanCloudPluginName,
+				"parameters": map[string]interface{}{
+					"barmanObjectName": objectStore,
+					"serverName":       serverName,
+				},
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("cluster %s does not use the %s plugin to recover from", source.GetName(), BarmanCloudPluginName)
+}
+
+// buildRecoveryCluster returns a single-instance Cluster that recovers source to targetTime
+// through the Barman Cloud Plugin ObjectStore source archives to
+func buildRecoveryCluster(source *unstructured.Unstructured, targetName string, targetTime time.Time) (*unstructured.Unstructured, error) {
+	external, err := barmanCloudSource(source)
+	if err != nil {
+		return nil, err
+	}
+	storage, found, err := unstructured.NestedMap(source.Object, "spec", "storage")
+	if err != nil || !found {
+		return nil, fmt.Errorf("cluster %s has no spec.storage", source.GetName())
+	}
+
+	spec := map[string]interface{}{
+		"instances": int64(1),
+		"storage":   storage,
+		"bootstrap": map[string]interface{}{
+			"recovery": map[string]interface{}{
+				"source":   source.GetName(),
+				"database": "app",
+				"owner":    "app",
+				"recoveryTarget": map[string]interface{}{
+					"targetTime": targetTime.UTC().Format(time.RFC3339Nano),
+				},
+			},
+		},
+		"externalClusters": []interface{}{external},
+	}
+	if image, found, _ := unstructured.NestedString(source.Object, "spec", "imageName"); found {
+		spec["imageName"] = image
+	}
+
+	target := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	target.SetAPIVersion("postgresql.cnpg.io/v1")
+	target.SetKind("Cluster")
+	target.SetNamespace(source.GetNamespace())
+	target.SetName(targetName)
+	return target, nil
+}
+
+// RestoreToPointInTime recovers sourceCluster into a new targetCluster at targetTime and checks
+// the restored data: markers written with WritePITRMarker at or before targetTime must exist and
+// later ones must not. sourceCluster must archive WAL through the Barman Cloud Plugin and needs a
+// completed base backup taken before targetTime.
+func RestoreToPointInTime(t *testing.T, opts *k8s.KubectlOptions, sourceCluster, targetCluster string, targetTime time.Time) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping point-in-time recovery in short mode")
+	}
+
+	ctx := context.Background()
+
+	sourceConn, closeSource, err := OpenServiceConnection(t, opts, sourceCluster+"-rw", sourceCluster+"-app")
+	require.NoError(t, err)
+	defer closeSource()
+
+	sourceMarkers, err := listPITRMarkers(ctx, sourceConn)
+	require.NoError(t, err)
+
+	// Close the current WAL segment so everything up to targetTime reaches the archive. The app
+	// user may not switch WAL, so this runs as postgres inside the primary.
+	_, err = ExecSQL(t, opts, sourceCluster, "", "SELECT pg_switch_wal()")
+	require.NoError(t, err, "Failed to switch WAL on %s", sourceCluster)
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+
+	source, err := dynClient.Resource(clusterGVR).Namespace(opts.Namespace).Get(ctx, sourceCluster, metav1.GetOptions{})
+	require.NoError(t, err, "Failed to get source cluster %s", sourceCluster)
+
+	target, err := buildRecoveryCluster(source, targetCluster, targetTime)
+	require.NoError(t, err)
+
+	_, err = dynClient.Resource(clusterGVR).Namespace(opts.Namespace).Create(ctx, target, metav1.CreateOptions{})
+	require.NoError(t, err, "Failed to create recovery cluster %s", targetCluster)
+	t.Cleanup(func() {
+		_ = dynClient.Resource(clusterGVR).Namespace(opts.Namespace).Delete(context.Background(), targetCluster, metav1.DeleteOptions{})
+	})
+
+	require.NoError(t, WaitForClusterHealthy(t, opts, targetCluster, pitrRestoreTimeout),
+		"Recovery cluster %s did not become healthy", targetCluster)
+
+	targetConn, closeTarget, err := OpenServiceConnection(t, opts, targetCluster+"-rw", targetCluster+"-app")
+	require.NoError(t, err)
+	defer closeTarget()
+
+	restoredMarkers, err := listPITRMarkers(ctx, targetConn)
+	require.NoError(t, err)
+
+	require.NoError(t, checkRestoredMarkers(sourceMarkers, restoredMarkers, targetTime))
+	t.Logf("Restored %s to %s: %d of %d markers present", targetCluster,
+		targetTime.Format(time.RFC3339Nano), len(restoredMarkers), len(sourceMarkers))
+}
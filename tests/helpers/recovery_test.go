@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCheckRestoredMarkers(t *testing.T) {
+	target := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	source := []pitrMarker{
+		{Name: "before", WrittenAt: target.Add(-time.Minute)},
+		{Name: "at", WrittenAt: target},
+		{Name: "after", WrittenAt: target.Add(time.Second)},
+	}
+
+	require.NoError(t, checkRestoredMarkers(source, source[:2], target))
+
+	err := checkRestoredMarkers(source, source[:1], target)
+	require.ErrorContains(t, err, "marker at")
+	require.ErrorContains(t, err, "missing")
+
+	err = checkRestoredMarkers(source, source, target)
+	require.ErrorContains(t, err, "marker after")
+	require.ErrorContains(t, err, "present")
+}
+
+func TestBuildRecoveryCluster(t *testing.T) {
+	source := newCNPGCluster("default", "pitr-source")
+	_ = unstructured.SetNestedField(source.Object, "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard", "spec", "imageName")
+	_ = unstructured.SetNestedMap(source.Object, map[string]interface{}{"size": "1Gi"}, "spec", "storage")
+
+	_, err := buildRecoveryCluster(source, "pitr-target", time.Now())
+	require.ErrorContains(t, err, "does not use the "+BarmanCloudPluginName+" plugin")
+
+	plugin := map[string]interface{}{"name": BarmanCloudPluginName, "isWALArchiver": true}
+	_ = unstructured.SetNestedSlice(source.Object, []interface{}{plugin}, "spec", "plugins")
+	_, err = buildRecoveryCluster(source, "pitr-target", time.Now())
+	require.ErrorContains(t, err, "no barmanObjectName")
+
+	plugin["parameters"] = map[string]interface{}{"barmanObjectName": "minio-store"}
+	_ = unstructured.SetNestedSlice(source.Object, []interface{}{plugin}, "spec", "plugins")
+
+	target, err := buildRecoveryCluster(source, "pitr-target", time.Date(2025, 6, 1, 12, 0, 0, 500000000, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, "pitr-target", target.GetName())
+	require.Equal(t, "default", target.GetNamespace())
+
+	targetTime, _, _ := unstructured.NestedString(target.Object, "spec", "bootstrap", "recovery", "recoveryTarget", "targetTime")
+	require.Equal(t, "2025-06-01T12:00:00.5Z", targetTime)
+
+	recoverySource, _, _ := unstructured.NestedString(target.Object, "spec", "bootstrap", "recovery", "source")
+	require.Equal(t, "pitr-source", recoverySource)
+
+	external, _, _ := unstructured.NestedSlice(target.Object, "spec", "externalClusters")
+	require.Len(t, external, 1)
+	require.Equal(t, "pitr-source", external[0].(map[string]interface{})["name"])
+	parameters, _, _ := unstructured.NestedStringMap(external[0].(map[string]interface{}), "plugin", "parameters")
+	require.Equal(t, map[string]string{"barmanObjectName": "minio-store", "serverName": "pitr-source"}, parameters)
+
+	image, _, _ := unstructured.NestedString(target.Object, "spec", "imageName")
+	require.Equal(t, "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard", image)
+}
@@ -0,0 +1,100 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// runCosign runs a cosign command and returns its combined output.
+// It is a variable so tests can replace the cosign call.
+var runCosign = func(args ...string) (string, error) {
+	out, err := exec.Command("cosign", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cosign %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// signatureVerificationEnabled reports whether VERIFY_SIGNATURES=true asks for image signatures
+// to be checked before deploying
+func signatureVerificationEnabled() bool {
+	return os.Getenv("VERIFY_SIGNATURES") == "true"
+}
+
+// cosignPublicKeyPath returns the key images are verified against, from COSIGN_PUBLIC_KEY
+func cosignPublicKeyPath() string {
+	return os.Getenv("COSIGN_PUBLIC_KEY")
+}
+
+// AssertImageSigned verifies the cosign signature of image against publicKeyPath. It does nothing
+// unless VERIFY_SIGNATURES=true.
+func AssertImageSigned(t *testing.T, image, publicKeyPath string) error {
+	t.Helper()
+
+	if !signatureVerificationEnabled() {
+		return nil
+	}
+	if publicKeyPath == "" {
+		return fmt.Errorf("VERIFY_SIGNATURES=true but no public key given (set COSIGN_PUBLIC_KEY)")
+	}
+
+	if _, err := runCosign("verify", "--key", publicKeyPath, image); err != nil {
+		return fmt.Errorf("image %s failed signature verification: %w", image, err)
+	}
+	t.Logf("Verified signature of %s", image)
+	return nil
+}
+
+// manifestCluster is the part of a CNPG Cluster manifest that names its PostgreSQL image
+type manifestCluster struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		ImageName string `yaml:"imageName"`
+	} `yaml:"spec"`
+}
+
+// clusterImages returns the PostgreSQL images the Clusters in manifest set explicitly. Clusters
+// without imageName run the operator default, which DeployCNPGOperator verifies.
+func clusterImages(manifest string) ([]string, error) {
+	var images []string
+	decoder := yaml.NewDecoder(strings.NewReader(manifest))
+	for {
+		var doc manifestCluster
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if doc.Kind == "Cluster" && doc.Spec.ImageName != "" && !slices.Contains(images, doc.Spec.ImageName) {
+			images = append(images, doc.Spec.ImageName)
+		}
+	}
+	return images, nil
+}
+
+// AssertClusterImagesSigned verifies the cosign signature of every PostgreSQL image the Clusters
+// in manifest name, before the manifest is applied. It does nothing unless VERIFY_SIGNATURES=true.
+func AssertClusterImagesSigned(t *testing.T, manifest string) {
+	t.Helper()
+
+	if !signatureVerificationEnabled() {
+		return
+	}
+
+	images, err := clusterImages(manifest)
+	require.NoError(t, err)
+	for _, image := range images {
+		require.NoError(t, AssertImageSigned(t, image, cosignPublicKeyPath()))
+	}
+}
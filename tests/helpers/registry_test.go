@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertImageSigned(t *testing.T) {
+	const (
+		signed   = "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard"
+		unsigned = "ghcr.io/cloudnative-pg/postgresql:17"
+		key      = "/keys/cosign.pub"
+	)
+
+	var calls [][]string
+	orig := runCosign
+	runCosign = func(args ...string) (string, error) {
+		calls = append(calls, args)
+		if args[len(args)-1] != signed {
+			return "", fmt.Errorf("no matching signatures")
+		}
+		return "Verification for " + signed + " --", nil
+	}
+	t.Cleanup(func() { runCosign = orig })
+
+	// Disabled: nothing is verified
+	t.Setenv("VERIFY_SIGNATURES", "")
+	require.NoError(t, AssertImageSigned(t, unsigned, key))
+	require.Empty(t, calls)
+
+	t.Setenv("VERIFY_SIGNATURES", "true")
+	require.NoError(t, AssertImageSigned(t, signed, key))
+	require.Equal(t, []string{"verify", "--key", key, signed}, calls[0])
+
+	err := AssertImageSigned(t, unsigned, key)
+	require.ErrorContains(t, err, unsigned)
+	require.ErrorContains(t, err, "no matching signatures")
+
+	require.ErrorContains(t, AssertImageSigned(t, signed, ""), "COSIGN_PUBLIC_KEY")
+}
+
+func TestClusterImages(t *testing.T) {
+	images, err := clusterImages(`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+---
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: explicit
+spec:
+  imageName: ghcr.io/pgedge/pgedge-postgres:17-spock5-standard
+---
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: defaulted
+spec:
+  instances: 1
+---
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: shared
+spec:
+  imageName: ghcr.io/pgedge/pgedge-postgres:17-spock5-standard
+`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ghcr.io/pgedge/pgedge-postgres:17-spock5-standard"}, images)
+
+	_, err = clusterImages("kind: [")
+	require.ErrorContains(t, err, "failed to parse manifest")
+}
@@ -0,0 +1,191 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// parseReleaseValues decodes the output of `helm get values -o json`. A release installed
+// without overrides prints null.
+func parseReleaseValues(output string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(output), &values); err != nil {
+		return nil, fmt.Errorf("failed to parse helm values: %w", err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return values, nil
+}
+
+// lookupValue resolves a dotted path such as "config.data.POSTGRES_IMAGE_NAME" or
+// "additionalEnv.0.name" in decoded values
+func lookupValue(values map[string]interface{}, path string) (interface{}, error) {
+	var current interface{} = values
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("value %s not set (missing %q)", path, key)
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("value %s not set (no index %q)", path, key)
+			}
+			current = node[i]
+		default:
+			return nil, fmt.Errorf("value %s not set (%q is not a map or list)", path, key)
+		}
+	}
+	return current, nil
+}
+
+// GetReleaseValues returns the user-supplied values of a Helm release, as reported by
+// `helm get values -o json`
+func GetReleaseValues(t *testing.T, kubeconfigPath, releaseName, namespace string) (map[string]interface{}, error) {
+	t.Helper()
+
+	options := &helm.Options{KubectlOptions: k8s.NewKubectlOptions("", kubeconfigPath, namespace)}
+	output, err := helm.RunHelmCommandAndGetStdOutE(t, options, "get", "values", releaseName, "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get values of release %s: %w", releaseName, err)
+	}
+	return parseReleaseValues(output)
+}
+
+// AssertReleaseValue checks the value at a dotted path. Numbers decode from JSON as float64,
+// so expected is compared by its string form.
+func AssertReleaseValue(t *testing.T, values map[string]interface{}, path string, expected interface{}) {
+	t.Helper()
+
+	actual, err := lookupValue(values, path)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprint(expected), fmt.Sprint(actual), "Release value %s", path)
+}
+
+// releaseInstanceLabel is the standard label Helm charts put on every resource of a release
+const releaseInstanceLabel = "app.kubernetes.io/instance"
+
+// findReleaseLeftovers lists the resources of releaseName still present in namespace. CNPG
+// labels PVCs and instance pods with cnpg.io/cluster rather than the release label, so those
+// are matched too. PersistentVolumes retained by their reclaim policy are expected to survive;
+// any others still claimed from namespace are reported.
+func findReleaseLeftovers(ctx context.Context, clientset kubernetes.Interface, dynClient dynamic.Interface, namespace, releaseName string) ([]string, error) {
+	releaseSelector := metav1.ListOptions{LabelSelector: releaseInstanceLabel + "=" + releaseName}
+	cnpgSelector := metav1.ListOptions{LabelSelector: "cnpg.io/cluster"}
+	var leftovers []string
+
+	clusters, err := dynClient.Resource(clusterGVR).Namespace(namespace).List(ctx, releaseSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CNPG clusters in %s: %w", namespace, err)
+	}
+	for _, c := range clusters.Items {
+		leftovers = append(leftovers, "cluster/"+c.GetName())
+	}
+
+	seen := map[string]bool{}
+	for _, opts := range []metav1.ListOptions{releaseSelector, cnpgSelector} {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods in %s: %w", namespace, err)
+		}
+		for _, pod := range pods.Items {
+			if name := "pod/" + pod.Name; !seen[name] {
+				seen[name] = true
+				leftovers = append(leftovers, name)
+			}
+		}
+
+		pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list PVCs in %s: %w", namespace, err)
+		}
+		for _, pvc := range pvcs.Items {
+			if name := "pvc/" + pvc.Name; !seen[name] {
+				seen[name] = true
+				leftovers = append(leftovers, name)
+			}
+		}
+	}
+
+	configMaps, err := clientset.CoreV1().ConfigMaps(namespace).List(ctx, releaseSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ConfigMaps in %s: %w", namespace, err)
+	}
+	for _, cm := range configMaps.Items {
+		leftovers = append(leftovers, "configmap/"+cm.Name)
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, releaseSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs in %s: %w", namespace, err)
+	}
+	for _, job := range jobs.Items {
+		leftovers = append(leftovers, "job/"+job.Name)
+	}
+
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PersistentVolumes: %w", err)
+	}
+	for _, pv := range pvs.Items {
+		if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.Namespace != namespace {
+			continue
+		}
+		if pv.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimRetain {
+			continue
+		}
+		leftovers = append(leftovers, "pv/"+pv.Name)
+	}
+
+	return leftovers, nil
+}
+
+// waitForReleaseRemoved waits for nothing of releaseName to be left in namespace after
+// `helm uninstall`, giving the operator time to finish garbage collection, and lists any
+// leftovers in the error
+func waitForReleaseRemoved(t *testing.T, kubeconfigPath, namespace, releaseName string) error {
+	t.Helper()
+
+	clientset, err := getClientset(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	dynClient, err := getDynamicClient(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	var leftovers []string
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for release %s to be removed", releaseName), 24, 5*time.Second, func() (string, error) {
+		leftovers, err = findReleaseLeftovers(context.Background(), clientset, dynClient, namespace, releaseName)
+		if err != nil {
+			return "", retry.FatalError{Underlying: err}
+		}
+		if len(leftovers) > 0 {
+			return "", fmt.Errorf("%d resources left", len(leftovers))
+		}
+		return "", nil
+	})
+	if err != nil {
+		return fmt.Errorf("release %s left resources behind in %s: %s", releaseName, namespace, strings.Join(leftovers, ", "))
+	}
+	return nil
+}
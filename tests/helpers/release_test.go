@@ -0,0 +1,84 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReleaseValues(t *testing.T) {
+	output := `{"additionalEnv":[{"name":"HTTPS_PROXY","value":"http://proxy:3128"}],"config":{"data":{"POSTGRES_IMAGE_NAME":"ghcr.io/pgedge/pgedge-postgres:17-spock5-standard"}},"image":{"repository":"ghcr.io/pgedge/cloudnative-pg","tag":"1.29.1"},"replicaCount":3}`
+
+	values, err := parseReleaseValues(output)
+	require.NoError(t, err)
+
+	AssertReleaseValue(t, values, "config.data.POSTGRES_IMAGE_NAME", "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard")
+	AssertReleaseValue(t, values, "image.tag", "1.29.1")
+	AssertReleaseValue(t, values, "replicaCount", 3)
+	AssertReleaseValue(t, values, "additionalEnv.0.name", "HTTPS_PROXY")
+
+	_, err = lookupValue(values, "image.pullPolicy")
+	require.ErrorContains(t, err, `missing "pullPolicy"`)
+	_, err = lookupValue(values, "additionalEnv.1.name")
+	require.ErrorContains(t, err, `no index "1"`)
+	_, err = lookupValue(values, "replicaCount.value")
+	require.Error(t, err)
+
+	values, err = parseReleaseValues("null\n")
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	_, err = parseReleaseValues("Error: release: not found")
+	require.Error(t, err)
+}
+
+func TestFindReleaseLeftovers(t *testing.T) {
+	ctx := context.Background()
+	release := map[string]string{releaseInstanceLabel: "pgedge"}
+	meta := func(name string, labels map[string]string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "pgedge", Name: name, Labels: labels}
+	}
+	pv := func(name string, policy corev1.PersistentVolumeReclaimPolicy) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeReclaimPolicy: policy,
+				ClaimRef:                      &corev1.ObjectReference{Namespace: "pgedge", Name: "pgedge-1-1"},
+			},
+		}
+	}
+
+	// Clean uninstall: only a retained volume and unrelated resources remain
+	clientset := fake.NewClientset(
+		pv("pv-retained", corev1.PersistentVolumeReclaimRetain),
+		&corev1.ConfigMap{ObjectMeta: meta("unrelated", map[string]string{releaseInstanceLabel: "other"})},
+	)
+	leftovers, err := findReleaseLeftovers(ctx, clientset, newFakeDynamicClient(), "pgedge", "pgedge")
+	require.NoError(t, err)
+	require.Empty(t, leftovers)
+
+	cluster := newCNPGCluster("pgedge", "pgedge-1")
+	cluster.SetLabels(release)
+	clientset = fake.NewClientset(
+		&corev1.Pod{ObjectMeta: meta("pgedge-1-1", map[string]string{"cnpg.io/cluster": "pgedge-1"})},
+		&corev1.PersistentVolumeClaim{ObjectMeta: meta("pgedge-1-1", map[string]string{"cnpg.io/cluster": "pgedge-1"})},
+		&corev1.ConfigMap{ObjectMeta: meta("pgedge-config", release)},
+		&batchv1.Job{ObjectMeta: meta("pgedge-init-spock", release)},
+		pv("pv-deleted", corev1.PersistentVolumeReclaimDelete),
+	)
+	leftovers, err = findReleaseLeftovers(ctx, clientset, newFakeDynamicClient(cluster), "pgedge", "pgedge")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"cluster/pgedge-1",
+		"pod/pgedge-1-1",
+		"pvc/pgedge-1-1",
+		"configmap/pgedge-config",
+		"job/pgedge-init-spock",
+		"pv/pv-deleted",
+	}, leftovers)
+}
@@ -0,0 +1,306 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podMetricsGVR identifies the PodMetrics served by metrics-server
+var podMetricsGVR = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+const (
+	// resourceUsageWindow is how long MeasureClusterResourceUsage samples for
+	resourceUsageWindow = 2 * time.Minute
+	// resourceUsageInterval matches metrics-server's default resolution
+	resourceUsageInterval = 15 * time.Second
+)
+
+// usagePoint is the CPU and memory of all instances of a cluster at one point in time
+type usagePoint struct {
+	CPUMillicores int64
+	MemoryBytes   int64
+}
+
+// ResourceUsage summarizes the CPU and memory a CNPG cluster used over a sampling window
+type ResourceUsage struct {
+	Samples          int
+	AvgCPUMillicores int64
+	MaxCPUMillicores int64
+	AvgMemoryBytes   int64
+	MaxMemoryBytes   int64
+}
+
+// String renders the usage for logs
+func (u ResourceUsage) String() string {
+	return fmt.Sprintf("cpu avg %dm max %dm, memory avg %s max %s (%d samples)",
+		u.AvgCPUMillicores, u.MaxCPUMillicores,
+		resource.NewQuantity(u.AvgMemoryBytes, resource.BinarySI), resource.NewQuantity(u.MaxMemoryBytes, resource.BinarySI),
+		u.Samples)
+}
+
+// samplePodMetrics sums the usage of every container of the cluster's pods
+func samplePodMetrics(ctx context.Context, dynClient dynamic.Interface, namespace, clusterName string) (usagePoint, error) {
+	list, err := dynClient.Resource(podMetricsGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "cnpg.io/cluster=" + clusterName,
+	})
+	if err != nil {
+		return usagePoint{}, fmt.Errorf("failed to get pod metrics for cluster %s: %w", clusterName, err)
+	}
+	if len(list.Items) == 0 {
+		return usagePoint{}, fmt.Errorf("no pod metrics for cluster %s yet", clusterName)
+	}
+
+	var point usagePoint
+	for _, pod := range list.Items {
+		containers, _, _ := unstructured.NestedSlice(pod.Object, "containers")
+		for _, c := range containers {
+			usage, _, _ := unstructured.NestedStringMap(c.(map[string]interface{}), "usage")
+			cpu, err := resource.ParseQuantity(usage["cpu"])
+			if err != nil {
+				return usagePoint{}, fmt.Errorf("invalid cpu usage %q of pod %s: %w", usage["cpu"], pod.GetName(), err)
+			}
+			memory, err := resource.ParseQuantity(usage["memory"])
+			if err != nil {
+				return usagePoint{}, fmt.Errorf("invalid memory usage %q of pod %s: %w", usage["memory"], pod.GetName(), err)
+			}
+			point.CPUMillicores += cpu.MilliValue()
+			point.MemoryBytes += memory.Value()
+		}
+	}
+	return point, nil
+}
+
+// summarizeUsage reduces sampled points to averages and peaks
+func summarizeUsage(points []usagePoint) ResourceUsage {
+	usage := ResourceUsage{Samples: len(points)}
+	if len(points) == 0 {
+		return usage
+	}
+
+	var cpu, memory int64
+	for _, p := range points {
+		cpu += p.CPUMillicores
+		memory += p.MemoryBytes
+		usage.MaxCPUMillicores = max(usage.MaxCPUMillicores, p.CPUMillicores)
+		usage.MaxMemoryBytes = max(usage.MaxMemoryBytes, p.MemoryBytes)
+	}
+	usage.AvgCPUMillicores = cpu / int64(len(points))
+	usage.AvgMemoryBytes = memory / int64(len(points))
+	return usage
+}
+
+// percentChange returns how much after differs from before, in percent
+func percentChange(before, after int64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return float64(after-before) * 100 / float64(before)
+}
+
+// FormatResourceUsageDelta describes how usage changed between two measurements, e.g. of the
+// same load on two image tags
+func FormatResourceUsageDelta(before, after ResourceUsage) string {
+	return fmt.Sprintf("cpu avg %+dm (%+.1f%%), max %+dm (%+.1f%%); memory avg %+d bytes (%+.1f%%), max %+d bytes (%+.1f%%)",
+		after.AvgCPUMillicores-before.AvgCPUMillicores, percentChange(before.AvgCPUMillicores, after.AvgCPUMillicores),
+		after.MaxCPUMillicores-before.MaxCPUMillicores, percentChange(before.MaxCPUMillicores, after.MaxCPUMillicores),
+		after.AvgMemoryBytes-before.AvgMemoryBytes, percentChange(before.AvgMemoryBytes, after.AvgMemoryBytes),
+		after.MaxMemoryBytes-before.MaxMemoryBytes, percentChange(before.MaxMemoryBytes, after.MaxMemoryBytes))
+}
+
+// MeasureClusterResourceUsage samples the CPU and memory of a CNPG cluster's pods from the
+// metrics API for resourceUsageWindow. The test is skipped when metrics-server is not installed.
+func MeasureClusterResourceUsage(t *testing.T, opts *k8s.KubectlOptions, clusterName string) ResourceUsage {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var points []usagePoint
+	deadline := time.Now().Add(resourceUsageWindow)
+	for {
+		point, err := samplePodMetrics(ctx, dynClient, opts.Namespace, clusterName)
+		switch {
+		case apierrors.IsNotFound(err):
+			t.Skipf("Metrics API is not available (is metrics-server installed?): %v", err)
+		case err != nil:
+			t.Logf("Skipping sample: %v", err)
+		default:
+			points = append(points, point)
+		}
+
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(resourceUsageInterval)
+	}
+
+	require.NotEmpty(t, points, "No resource usage samples collected for cluster %s", clusterName)
+	usage := summarizeUsage(points)
+	t.Logf("Cluster %s: %s", clusterName, usage)
+	return usage
+}
+
+// nodeMetricsGVR identifies the NodeMetrics served by metrics-server
+var nodeMetricsGVR = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}
+
+// NodeSample is the CPU and memory use of one node at one point in time. The percentages are of
+// the node's allocatable resources.
+type NodeSample struct {
+	Time          time.Time `json:"time"`
+	Node          string    `json:"node"`
+	CPUMillicores int64     `json:"cpu_millicores"`
+	MemoryBytes   int64     `json:"memory_bytes"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	MemoryPercent float64   `json:"memory_percent"`
+}
+
+// sampleNodeMetrics returns the current usage of every node reported by the metrics API
+func sampleNodeMetrics(ctx context.Context, clientset kubernetes.Interface, dynClient dynamic.Interface, now time.Time) ([]NodeSample, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	allocatable := make(map[string]corev1.ResourceList, len(nodes.Items))
+	for _, node := range nodes.Items {
+		allocatable[node.Name] = node.Status.Allocatable
+	}
+
+	list, err := dynClient.Resource(nodeMetricsGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node metrics: %w", err)
+	}
+
+	var samples []NodeSample
+	for _, m := range list.Items {
+		usage, _, _ := unstructured.NestedStringMap(m.Object, "usage")
+		cpu, err := resource.ParseQuantity(usage["cpu"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu usage %q of node %s: %w", usage["cpu"], m.GetName(), err)
+		}
+		memory, err := resource.ParseQuantity(usage["memory"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory usage %q of node %s: %w", usage["memory"], m.GetName(), err)
+		}
+
+		sample := NodeSample{Time: now, Node: m.GetName(), CPUMillicores: cpu.MilliValue(), MemoryBytes: memory.Value()}
+		if capacity, ok := allocatable[m.GetName()]; ok {
+			sample.CPUPercent = percentOf(sample.CPUMillicores, capacity.Cpu().MilliValue())
+			sample.MemoryPercent = percentOf(sample.MemoryBytes, capacity.Memory().Value())
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// percentOf returns part as a percentage of total
+func percentOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+// NodePeak is the highest CPU and memory utilization sampled on a node, not necessarily at the
+// same time
+type NodePeak struct {
+	Node          string
+	CPUPercent    float64
+	MemoryPercent float64
+}
+
+// peakNodeUtilization returns the peak utilization of every sampled node, sorted by node name
+func peakNodeUtilization(samples []NodeSample) []NodePeak {
+	peaks := make(map[string]*NodePeak)
+	for _, s := range samples {
+		peak, ok := peaks[s.Node]
+		if !ok {
+			peak = &NodePeak{Node: s.Node}
+			peaks[s.Node] = peak
+		}
+		peak.CPUPercent = max(peak.CPUPercent, s.CPUPercent)
+		peak.MemoryPercent = max(peak.MemoryPercent, s.MemoryPercent)
+	}
+
+	result := make([]NodePeak, 0, len(peaks))
+	for _, peak := range peaks {
+		result = append(result, *peak)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Node < result[j].Node })
+	return result
+}
+
+// SampleNodeResources samples the CPU and memory of every node from the metrics API each
+// interval, appending each sample to path as a JSON line, until the returned stop function is
+// called. stop logs the peak utilization of every node. Sampling errors, e.g. metrics-server not
+// being installed, are logged and do not fail the test.
+func SampleNodeResources(t *testing.T, kubeconfigPath, path string, interval time.Duration) (stop func()) {
+	t.Helper()
+
+	clientset, err := getClientset(kubeconfigPath)
+	require.NoError(t, err)
+	dynClient, err := getDynamicClient(kubeconfigPath)
+	require.NoError(t, err)
+	out, err := os.Create(path)
+	require.NoError(t, err, "Failed to create %s", path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan []NodeSample)
+	go func() {
+		var all []NodeSample
+		encoder := json.NewEncoder(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			samples, err := sampleNodeMetrics(ctx, clientset, dynClient, time.Now())
+			if err != nil && ctx.Err() == nil {
+				t.Logf("Skipping node resource sample: %v", err)
+			}
+			for _, s := range samples {
+				if err := encoder.Encode(s); err != nil {
+					t.Logf("Failed to write node resource sample: %v", err)
+				}
+			}
+			all = append(all, samples...)
+
+			select {
+			case <-ctx.Done():
+				done <- all
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		samples := <-done
+		out.Close()
+
+		peaks := peakNodeUtilization(samples)
+		if len(peaks) == 0 {
+			t.Logf("No node resource samples collected, see %s", path)
+			return
+		}
+		t.Logf("Peak node utilization over %d samples (written to %s):", len(samples), path)
+		for _, peak := range peaks {
+			t.Logf("  %s: cpu %.1f%%, memory %.1f%%", peak.Node, peak.CPUPercent, peak.MemoryPercent)
+		}
+	}
+}
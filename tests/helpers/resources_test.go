@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newPodMetrics returns an unstructured PodMetrics with one entry per container usage
+func newPodMetrics(namespace, name, clusterName string, usage ...map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("metrics.k8s.io/v1beta1")
+	u.SetKind("PodMetrics")
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	u.SetLabels(map[string]string{"cnpg.io/cluster": clusterName})
+
+	var containers []interface{}
+	for _, usage := range usage {
+		containers = append(containers, map[string]interface{}{"name": "postgres", "usage": usage})
+	}
+	u.Object["containers"] = containers
+	return u
+}
+
+func TestSamplePodMetrics(t *testing.T) {
+	dynClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{podMetricsGVR: "PodMetricsList"})
+	// The resource of PodMetrics is "pods", which the fake cannot guess from the kind
+	for _, m := range []*unstructured.Unstructured{
+		newPodMetrics("default", "pg-1", "pg", map[string]interface{}{"cpu": "12345678n", "memory": "64Mi"}),
+		newPodMetrics("default", "pg-2", "pg", map[string]interface{}{"cpu": "8m", "memory": "32Mi"}),
+		newPodMetrics("default", "other-1", "other", map[string]interface{}{"cpu": "1", "memory": "1Gi"}),
+	} {
+		require.NoError(t, dynClient.Tracker().Create(podMetricsGVR, m, m.GetNamespace()))
+	}
+	ctx := context.Background()
+
+	point, err := samplePodMetrics(ctx, dynClient, "default", "pg")
+	require.NoError(t, err)
+	require.Equal(t, usagePoint{CPUMillicores: 21, MemoryBytes: 96 << 20}, point)
+
+	_, err = samplePodMetrics(ctx, dynClient, "default", "missing")
+	require.ErrorContains(t, err, "no pod metrics")
+}
+
+func TestSummarizeUsage(t *testing.T) {
+	require.Equal(t, ResourceUsage{}, summarizeUsage(nil))
+
+	usage := summarizeUsage([]usagePoint{
+		{CPUMillicores: 100, MemoryBytes: 200 << 20},
+		{CPUMillicores: 300, MemoryBytes: 260 << 20},
+		{CPUMillicores: 200, MemoryBytes: 230 << 20},
+	})
+	require.Equal(t, ResourceUsage{
+		Samples:          3,
+		AvgCPUMillicores: 200,
+		MaxCPUMillicores: 300,
+		AvgMemoryBytes:   230 << 20,
+		MaxMemoryBytes:   260 << 20,
+	}, usage)
+
+	bumped := usage
+	bumped.AvgMemoryBytes += 23 << 20
+	require.Equal(t,
+		"cpu avg +0m (+0.0%), max +0m (+0.0%); memory avg +24117248 bytes (+10.0%), max +0 bytes (+0.0%)",
+		FormatResourceUsageDelta(usage, bumped))
+}
+
+func TestSampleNodeMetrics(t *testing.T) {
+	node := func(name, cpu, memory string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			}},
+		}
+	}
+	nodeMetrics := func(name, cpu, memory string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("metrics.k8s.io/v1beta1")
+		u.SetKind("NodeMetrics")
+		u.SetName(name)
+		u.Object["usage"] = map[string]interface{}{"cpu": cpu, "memory": memory}
+		return u
+	}
+	clientset := fake.NewClientset(node("worker", "4", "8Gi"), node("control-plane", "2", "4Gi"))
+	dynClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{nodeMetricsGVR: "NodeMetricsList"})
+	for _, m := range []*unstructured.Unstructured{
+		nodeMetrics("worker", "1", "2Gi"),
+		nodeMetrics("control-plane", "500m", "1Gi"),
+	} {
+		require.NoError(t, dynClient.Tracker().Create(nodeMetricsGVR, m, ""))
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	samples, err := sampleNodeMetrics(context.Background(), clientset, dynClient, now)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []NodeSample{
+		{Time: now, Node: "worker", CPUMillicores: 1000, MemoryBytes: 2 << 30, CPUPercent: 25, MemoryPercent: 25},
+		{Time: now, Node: "control-plane", CPUMillicores: 500, MemoryBytes: 1 << 30, CPUPercent: 25, MemoryPercent: 25},
+	}, samples)
+}
+
+func TestPeakNodeUtilization(t *testing.T) {
+	require.Empty(t, peakNodeUtilization(nil))
+
+	peaks := peakNodeUtilization([]NodeSample{
+		{Node: "worker", CPUPercent: 40, MemoryPercent: 70},
+		{Node: "control-plane", CPUPercent: 20, MemoryPercent: 30},
+		{Node: "worker", CPUPercent: 95, MemoryPercent: 60},
+		{Node: "worker", CPUPercent: 50, MemoryPercent: 65},
+	})
+	require.Equal(t, []NodePeak{
+		{Node: "control-plane", CPUPercent: 20, MemoryPercent: 30},
+		{Node: "worker", CPUPercent: 95, MemoryPercent: 70},
+	}, peaks)
+}
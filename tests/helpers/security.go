@@ -0,0 +1,113 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// postgresContainerName is the PostgreSQL container in CNPG instance pods
+const postgresContainerName = "postgres"
+
+// containerFailureReason describes why a container is crashing, or returns "" if it is not
+func containerFailureReason(status corev1.ContainerStatus) string {
+	waiting := status.State.Waiting
+	if waiting == nil || (waiting.Reason != "CrashLoopBackOff" && waiting.Reason != "CreateContainerError" && waiting.Reason != "RunContainerError") {
+		return ""
+	}
+
+	reason := waiting.Reason
+	if waiting.Message != "" {
+		reason += ": " + waiting.Message
+	}
+	if last := status.LastTerminationState.Terminated; last != nil {
+		reason += fmt.Sprintf(" (last exit %d %s", last.ExitCode, last.Reason)
+		if last.Message != "" {
+			reason += ": " + strings.TrimSpace(last.Message)
+		}
+		reason += ")"
+	}
+	return reason
+}
+
+// checkReadOnlyRootFilesystem verifies each instance pod runs PostgreSQL with a read-only root
+// filesystem. It returns ready=false while pods are still starting and an error once the
+// configuration is wrong or a container is crash looping.
+func checkReadOnlyRootFilesystem(pods []corev1.Pod, expectedCount int) (bool, error) {
+	ready := 0
+	for _, pod := range pods {
+		var container *corev1.Container
+		for i := range pod.Spec.Containers {
+			if pod.Spec.Containers[i].Name == postgresContainerName {
+				container = &pod.Spec.Containers[i]
+			}
+		}
+		if container == nil {
+			return false, fmt.Errorf("pod %s has no %s container", pod.Name, postgresContainerName)
+		}
+		sc := container.SecurityContext
+		if sc == nil || sc.ReadOnlyRootFilesystem == nil || !*sc.ReadOnlyRootFilesystem {
+			return false, fmt.Errorf("pod %s does not run %s with readOnlyRootFilesystem", pod.Name, postgresContainerName)
+		}
+
+		for _, status := range pod.Status.ContainerStatuses {
+			if reason := containerFailureReason(status); reason != "" {
+				return false, fmt.Errorf("container %s in pod %s is failing with a read-only root filesystem: %s",
+					status.Name, pod.Name, reason)
+			}
+		}
+
+		if isPodReady(&pod) {
+			ready++
+		}
+	}
+	return len(pods) >= expectedCount && ready >= expectedCount, nil
+}
+
+// listInstancePods returns the instance pods of a CNPG cluster
+func listInstancePods(ctx context.Context, clientset kubernetes.Interface, namespace, clusterName string) ([]corev1.Pod, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("cnpg.io/cluster=%s,cnpg.io/podRole=instance", clusterName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of cluster %s: %w", clusterName, err)
+	}
+	return pods.Items, nil
+}
+
+// AssertReadOnlyRootFilesystem waits for the instance pods of clusterName to become ready and checks
+// that PostgreSQL runs with a read-only root filesystem, so our images only write to PGDATA and
+// mounted volumes. CNPG enforces readOnlyRootFilesystem on instance containers itself, there is
+// no Cluster field to toggle it. A crash looping container fails immediately with its reason.
+func AssertReadOnlyRootFilesystem(t *testing.T, opts *k8s.KubectlOptions, clusterName string, instances int, timeout time.Duration) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+
+	maxRetries := int(timeout.Seconds() / 5)
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for cluster %s with read-only rootfs", clusterName), maxRetries, 5*time.Second, func() (string, error) {
+		pods, err := listInstancePods(context.Background(), clientset, opts.Namespace, clusterName)
+		if err != nil {
+			return "", err
+		}
+		ready, err := checkReadOnlyRootFilesystem(pods, instances)
+		if err != nil {
+			return "", retry.FatalError{Underlying: err}
+		}
+		if !ready {
+			return "", fmt.Errorf("%d instance pods found, waiting for %d ready", len(pods), instances)
+		}
+		return "ready", nil
+	})
+	require.NoError(t, err)
+}
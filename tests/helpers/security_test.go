@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newInstancePod returns a CNPG instance pod with the given root filesystem setting and status
+func newInstancePod(name string, readOnly bool, ready bool, status corev1.ContainerStatus) corev1.Pod {
+	podReady := corev1.ConditionFalse
+	if ready {
+		podReady = corev1.ConditionTrue
+	}
+	status.Name = postgresContainerName
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:            postgresContainerName,
+			SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnly},
+		}}},
+		Status: corev1.PodStatus{
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: podReady}},
+			ContainerStatuses: []corev1.ContainerStatus{status},
+		},
+	}
+}
+
+func TestCheckReadOnlyRootFilesystem(t *testing.T) {
+	running := corev1.ContainerStatus{State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+
+	ready, err := checkReadOnlyRootFilesystem([]corev1.Pod{newInstancePod("c-1", true, true, running)}, 1)
+	require.NoError(t, err)
+	require.True(t, ready)
+
+	ready, err = checkReadOnlyRootFilesystem([]corev1.Pod{newInstancePod("c-1", true, false, running)}, 1)
+	require.NoError(t, err)
+	require.False(t, ready)
+
+	_, err = checkReadOnlyRootFilesystem([]corev1.Pod{newInstancePod("c-1", false, true, running)}, 1)
+	require.ErrorContains(t, err, "does not run postgres with readOnlyRootFilesystem")
+
+	crashing := corev1.ContainerStatus{
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode: 1,
+			Reason:   "Error",
+			Message:  "mkdir /var/run/postgresql: read-only file system",
+		}},
+	}
+	_, err = checkReadOnlyRootFilesystem([]corev1.Pod{newInstancePod("c-1", true, false, crashing)}, 1)
+	require.ErrorContains(t, err, "CrashLoopBackOff (last exit 1 Error: mkdir /var/run/postgresql: read-only file system)")
+}
@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// volumeSnapshotGVR identifies the CSI VolumeSnapshot resource
+var volumeSnapshotGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+
+// checkSnapshotReady returns an error unless the VolumeSnapshot is ready to use. Snapshot errors
+// are wrapped in retry.FatalError to stop waiting.
+func checkSnapshotReady(snapshot *unstructured.Unstructured) error {
+	if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+		return retry.FatalError{Underlying: fmt.Errorf("volume snapshot %s failed: %s", snapshot.GetName(), message)}
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	if !ready {
+		return fmt.Errorf("volume snapshot %s is not ready to use", snapshot.GetName())
+	}
+	return nil
+}
+
+// WaitForSnapshotReady waits for the VolumeSnapshot snapshotName to become ready to use, failing
+// fast if the CSI driver reports an error
+func WaitForSnapshotReady(t *testing.T, opts *k8s.KubectlOptions, snapshotName string, timeout time.Duration) error {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	maxRetries := int(timeout.Seconds() / 5)
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for volume snapshot %s to be ready", snapshotName), maxRetries, 5*time.Second, func() (string, error) {
+		snapshot, err := dynClient.Resource(volumeSnapshotGVR).Namespace(opts.Namespace).Get(context.Background(), snapshotName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return "", checkSnapshotReady(snapshot)
+	})
+	var fatalErr retry.FatalError
+	if errors.As(err, &fatalErr) {
+		return fatalErr.Underlying
+	}
+	return err
+}
+
+// getBackupSnapshots returns the names of the VolumeSnapshots taken by a completed Backup of
+// method volumeSnapshot, in the order CNPG lists them
+func getBackupSnapshots(ctx context.Context, dynClient dynamic.Interface, namespace, backupName string) ([]string, error) {
+	backup, err := dynClient.Resource(backupGVR).Namespace(namespace).Get(ctx, backupName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup %s: %w", backupName, err)
+	}
+
+	elements, _, _ := unstructured.NestedSlice(backup.Object, "status", "backupSnapshotStatus", "elements")
+	var names []string
+	for _, e := range elements {
+		element, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := element["name"].(string); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("backup %s lists no volume snapshots", backupName)
+	}
+	return names, nil
+}
+
+// GetBackupSnapshots returns the names of the VolumeSnapshots taken by the Backup backupName
+func GetBackupSnapshots(t *testing.T, opts *k8s.KubectlOptions, backupName string) ([]string, error) {
+	t.Helper()
+
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return getBackupSnapshots(context.Background(), dynClient, opts.Namespace, backupName)
+}
@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCheckSnapshotReady(t *testing.T) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetName("pg-backup")
+
+	err := checkSnapshotReady(snapshot)
+	require.ErrorContains(t, err, "volume snapshot pg-backup is not ready to use")
+	require.False(t, errors.As(err, new(retry.FatalError)))
+
+	_ = unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse")
+	require.NoError(t, checkSnapshotReady(snapshot))
+
+	_ = unstructured.SetNestedField(snapshot.Object, false, "status", "readyToUse")
+	_ = unstructured.SetNestedField(snapshot.Object, "csi driver unavailable", "status", "error", "message")
+	err = checkSnapshotReady(snapshot)
+	require.ErrorContains(t, err, "volume snapshot pg-backup failed: csi driver unavailable")
+	require.True(t, errors.As(err, new(retry.FatalError)))
+}
+
+func TestGetBackupSnapshots(t *testing.T) {
+	backup := newCNPGBackup("default", "pg-backup", "pg", "completed")
+	_ = unstructured.SetNestedSlice(backup.Object, []interface{}{
+		map[string]interface{}{"name": "pg-backup", "type": "PG_DATA"},
+		map[string]interface{}{"name": "pg-backup-wal", "type": "PG_WAL"},
+	}, "status", "backupSnapshotStatus", "elements")
+	dynClient := newFakeDynamicClient(backup, newCNPGBackup("default", "pg-empty", "pg", "completed"))
+
+	names, err := getBackupSnapshots(context.Background(), dynClient, "default", "pg-backup")
+	require.NoError(t, err)
+	require.Equal(t, []string{"pg-backup", "pg-backup-wal"}, names)
+
+	_, err = getBackupSnapshots(context.Background(), dynClient, "default", "pg-empty")
+	require.ErrorContains(t, err, "backup pg-empty lists no volume snapshots")
+
+	_, err = getBackupSnapshots(context.Background(), dynClient, "default", "missing")
+	require.ErrorContains(t, err, "failed to get backup missing")
+}
@@ -0,0 +1,719 @@
+package helpers
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// SpockNode is a row of the spock.node catalog
+type SpockNode struct {
+	ID   int64
+	Name string
+}
+
+// spockNodeView is what a single pgEdge node reports about itself and its peers
+type spockNodeView struct {
+	Local SpockNode
+	Nodes []SpockNode
+}
+
+// getSpockNodeView reads the local Spock node and the full spock.node table from conn
+func getSpockNodeView(ctx context.Context, conn *sql.DB) (spockNodeView, error) {
+	var view spockNodeView
+
+	err := conn.QueryRowContext(ctx,
+		`SELECT n.node_id, n.node_name FROM spock.local_node l JOIN spock.node n ON n.node_id = l.node_id`,
+	).Scan(&view.Local.ID, &view.Local.Name)
+	if err != nil {
+		return view, fmt.Errorf("failed to read local spock node: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT node_id, node_name FROM spock.node ORDER BY node_id`)
+	if err != nil {
+		return view, fmt.Errorf("failed to query spock.node: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n SpockNode
+		if err := rows.Scan(&n.ID, &n.Name); err != nil {
+			return view, fmt.Errorf("failed to scan spock.node row: %w", err)
+		}
+		view.Nodes = append(view.Nodes, n)
+	}
+
+	return view, rows.Err()
+}
+
+// formatSpockNodeViews renders every node's view of spock.node for failure messages
+func formatSpockNodeViews(views []spockNodeView) string {
+	var b strings.Builder
+	for i, v := range views {
+		fmt.Fprintf(&b, "connection %d (local %s, id %d):\n", i, v.Local.Name, v.Local.ID)
+		for _, n := range v.Nodes {
+			fmt.Fprintf(&b, "  %d\t%s\n", n.ID, n.Name)
+		}
+	}
+	return b.String()
+}
+
+// checkSpockNodeViews verifies local node IDs and names are unique and every node sees all peers
+func checkSpockNodeViews(views []spockNodeView) error {
+	ids := make(map[int64]int)
+	names := make(map[string]int)
+	var problems []string
+
+	for i, v := range views {
+		if prev, ok := ids[v.Local.ID]; ok {
+			problems = append(problems, fmt.Sprintf("connections %d and %d share node_id %d", prev, i, v.Local.ID))
+		}
+		ids[v.Local.ID] = i
+		if prev, ok := names[v.Local.Name]; ok {
+			problems = append(problems, fmt.Sprintf("connections %d and %d share node_name %q", prev, i, v.Local.Name))
+		}
+		names[v.Local.Name] = i
+	}
+
+	for i, v := range views {
+		known := make(map[int64]bool)
+		for _, n := range v.Nodes {
+			known[n.ID] = true
+		}
+		for _, peer := range views {
+			if !known[peer.Local.ID] {
+				problems = append(problems, fmt.Sprintf("connection %d does not know node %s (id %d)", i, peer.Local.Name, peer.Local.ID))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("spock node check failed:\n%s\n%s", strings.Join(problems, "\n"), formatSpockNodeViews(views))
+	}
+	return nil
+}
+
+// AssertUniqueSpockNodeIDs checks that each connection is a distinct Spock node and that every
+// node sees all of its peers. conns should hold one connection per pgEdge node.
+func AssertUniqueSpockNodeIDs(t *testing.T, conns []*sql.DB) {
+	t.Helper()
+
+	views := make([]spockNodeView, 0, len(conns))
+	for i, conn := range conns {
+		view, err := getSpockNodeView(context.Background(), conn)
+		require.NoError(t, err, "Failed to read spock nodes from connection %d", i)
+		views = append(views, view)
+	}
+
+	require.NoError(t, checkSpockNodeViews(views))
+}
+
+// replicationTimeout bounds how long assertions wait for a change to reach a peer
+const replicationTimeout = 2 * time.Minute
+
+// largeValueTable holds the payloads written by AssertLargeValueReplicated
+const largeValueTable = "pgedge_large_value_test"
+
+// deterministicPayload returns sizeBytes of incompressible bytes derived from seed,
+// so the value is stored out of line in TOAST rather than compressed inline
+func deterministicPayload(seed int64, sizeBytes int) []byte {
+	payload := make([]byte, sizeBytes)
+	rand.New(rand.NewSource(seed)).Read(payload)
+	return payload
+}
+
+// waitForRow polls query on conn until it returns a row, scanning it into dest
+func waitForRow(ctx context.Context, conn *sql.DB, timeout time.Duration, query string, args []interface{}, dest ...interface{}) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := conn.QueryRowContext(ctx, query, args...).Scan(dest...)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("row not found after %s", timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// AssertLargeValueReplicated writes a sizeBytes bytea value on origin, forcing TOAST storage,
+// and checks it arrives intact on replica by comparing MD5 checksums
+func AssertLargeValueReplicated(t *testing.T, origin, replica *sql.DB, sizeBytes int) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping large value replication check in short mode")
+	}
+
+	ctx := context.Background()
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id bigint PRIMARY KEY, payload bytea NOT NULL)`, largeValueTable)
+	for name, conn := range map[string]*sql.DB{"origin": origin, "replica": replica} {
+		_, err := conn.ExecContext(ctx, createTable)
+		require.NoError(t, err, "Failed to create %s on %s", largeValueTable, name)
+	}
+
+	id := time.Now().UnixNano()
+	payload := deterministicPayload(id, sizeBytes)
+	sum := md5.Sum(payload)
+	expected := hex.EncodeToString(sum[:])
+
+	_, err := origin.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, payload) VALUES ($1, $2)`, largeValueTable), id, payload)
+	require.NoError(t, err, "Failed to insert large value on origin")
+
+	var replicated string
+	var replicatedSize int
+	err = waitForRow(ctx, replica, replicationTimeout,
+		fmt.Sprintf(`SELECT md5(payload), octet_length(payload) FROM %s WHERE id = $1`, largeValueTable),
+		[]interface{}{id}, &replicated, &replicatedSize)
+	require.NoError(t, err, "Large value (%d bytes) did not replicate", sizeBytes)
+
+	require.Equal(t, sizeBytes, replicatedSize, "Replicated value has the wrong size")
+	require.Equal(t, expected, replicated, "Replicated value checksum does not match")
+	t.Logf("Large value of %d bytes replicated intact (md5 %s)", sizeBytes, expected)
+}
+
+// sequenceRowsPerNode is how many rows each node inserts in AssertSequenceConsistency
+const sequenceRowsPerNode = 50
+
+// duplicateKeys returns the keys generated by more than one node, with the nodes that generated them
+func duplicateKeys(keysByNode [][]int64) map[int64][]int {
+	owners := make(map[int64][]int)
+	for node, keys := range keysByNode {
+		for _, k := range keys {
+			owners[k] = append(owners[k], node)
+		}
+	}
+	for k, nodes := range owners {
+		if len(nodes) < 2 {
+			delete(owners, k)
+		}
+	}
+	return owners
+}
+
+// checkSnowflakeNodes returns an error unless every node has its own snowflake.node setting;
+// snowflake IDs only stay unique across nodes with distinct node numbers
+func checkSnowflakeNodes(nodeIDs []string) error {
+	seen := make(map[string]int)
+	for i, id := range nodeIDs {
+		if id == "" {
+			return fmt.Errorf("snowflake.node is not set on node %d", i)
+		}
+		if prev, ok := seen[id]; ok {
+			return fmt.Errorf("nodes %d and %d share snowflake.node %s", prev, i, id)
+		}
+		seen[id] = i
+	}
+	return nil
+}
+
+// AssertSequenceConsistency inserts rows through a pgEdge snowflake sequence on every node
+// concurrently and checks that no two nodes generated the same key and that every node converges
+// to all rows. Each node must have its own snowflake.node setting.
+func AssertSequenceConsistency(t *testing.T, conns []*sql.DB, table string) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping sequence consistency check in short mode")
+	}
+
+	ctx := context.Background()
+	nodeIDs := make([]string, len(conns))
+	for i, conn := range conns {
+		_, err := conn.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS snowflake`)
+		require.NoError(t, err, "Failed to create snowflake extension on node %d", i)
+		require.NoError(t, conn.QueryRowContext(ctx, `SELECT coalesce(current_setting('snowflake.node', true), '')`).Scan(&nodeIDs[i]))
+	}
+	require.NoError(t, checkSnowflakeNodes(nodeIDs))
+
+	sequence := table + "_id_seq"
+	createSequence := fmt.Sprintf(`CREATE SEQUENCE IF NOT EXISTS %s`, sequence)
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id bigint PRIMARY KEY DEFAULT snowflake.nextval('%s'::regclass), node int NOT NULL)`,
+		table, sequence)
+	for i, conn := range conns {
+		_, err := conn.ExecContext(ctx, createSequence)
+		require.NoError(t, err, "Failed to create %s on node %d", sequence, i)
+		_, err = conn.ExecContext(ctx, createTable)
+		require.NoError(t, err, "Failed to create %s on node %d", table, i)
+	}
+
+	baselines := make([]int, len(conns))
+	for i, conn := range conns {
+		err := conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s`, table)).Scan(&baselines[i])
+		require.NoError(t, err, "Failed to count %s on node %d", table, i)
+	}
+
+	keysByNode := make([][]int64, len(conns))
+	errs := make([]error, len(conns))
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *sql.DB) {
+			defer wg.Done()
+			insert := fmt.Sprintf(`INSERT INTO %s (node) VALUES ($1) RETURNING id`, table)
+			for n := 0; n < sequenceRowsPerNode; n++ {
+				var id int64
+				if err := conn.QueryRowContext(ctx, insert, i).Scan(&id); err != nil {
+					errs[i] = fmt.Errorf("insert %d on node %d failed: %w", n, i, err)
+					return
+				}
+				keysByNode[i] = append(keysByNode[i], id)
+			}
+		}(i, conn)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	if dups := duplicateKeys(keysByNode); len(dups) > 0 {
+		keys := make([]int64, 0, len(dups))
+		for k := range dups {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+		var lines []string
+		for _, k := range keys {
+			lines = append(lines, fmt.Sprintf("id %d generated by nodes %v", k, dups[k]))
+		}
+		t.Fatalf("Sequence collisions across nodes:\n%s", strings.Join(lines, "\n"))
+	}
+
+	for i, conn := range conns {
+		expected := baselines[i] + sequenceRowsPerNode*len(conns)
+		var count int
+		deadline := time.Now().Add(replicationTimeout)
+		for {
+			err := conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s`, table)).Scan(&count)
+			require.NoError(t, err)
+			if count >= expected || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(2 * time.Second)
+		}
+		require.Equal(t, expected, count, "Node %d did not converge to all rows", i)
+	}
+}
+
+// logicalReplicationSettings are the server settings Spock depends on
+type logicalReplicationSettings struct {
+	WalLevel            string
+	MaxReplicationSlots int
+	MaxWalSenders       int
+}
+
+// parseLogicalReplicationSettings converts raw SHOW output, keyed by setting name
+func parseLogicalReplicationSettings(raw map[string]string) (logicalReplicationSettings, error) {
+	s := logicalReplicationSettings{WalLevel: raw["wal_level"]}
+	if s.WalLevel == "" {
+		return s, errors.New("wal_level is not set")
+	}
+
+	for name, dest := range map[string]*int{
+		"max_replication_slots": &s.MaxReplicationSlots,
+		"max_wal_senders":       &s.MaxWalSenders,
+	} {
+		v, err := strconv.Atoi(strings.TrimSpace(raw[name]))
+		if err != nil {
+			return s, fmt.Errorf("invalid %s %q: %w", name, raw[name], err)
+		}
+		*dest = v
+	}
+
+	return s, nil
+}
+
+// checkLogicalReplicationSettings verifies the settings can carry a Spock mesh of meshSize nodes,
+// where each node needs one replication slot and WAL sender per peer
+func checkLogicalReplicationSettings(s logicalReplicationSettings, usedSlots, meshSize int) error {
+	var problems []string
+
+	if s.WalLevel != "logical" {
+		problems = append(problems, fmt.Sprintf("wal_level is %q, expected \"logical\"", s.WalLevel))
+	}
+
+	required := meshSize - 1
+	if free := s.MaxReplicationSlots - usedSlots; free < required {
+		problems = append(problems, fmt.Sprintf("%d free replication slots (max_replication_slots=%d, %d in use), need %d",
+			free, s.MaxReplicationSlots, usedSlots, required))
+	}
+	if s.MaxWalSenders < required {
+		problems = append(problems, fmt.Sprintf("max_wal_senders is %d, need at least %d", s.MaxWalSenders, required))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("not ready for logical replication: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// AssertLogicalReplicationReady checks wal_level, max_replication_slots and max_wal_senders and that
+// enough replication slots are free for a Spock mesh of meshSize nodes
+func AssertLogicalReplicationReady(t *testing.T, conn *sql.DB, meshSize int) {
+	t.Helper()
+
+	ctx := context.Background()
+	raw := make(map[string]string)
+	for _, name := range []string{"wal_level", "max_replication_slots", "max_wal_senders"} {
+		var value string
+		err := conn.QueryRowContext(ctx, "SHOW "+name).Scan(&value)
+		require.NoError(t, err, "Failed to read %s", name)
+		raw[name] = value
+	}
+
+	settings, err := parseLogicalReplicationSettings(raw)
+	require.NoError(t, err)
+
+	var usedSlots int
+	err = conn.QueryRowContext(ctx, `SELECT count(*) FROM pg_replication_slots`).Scan(&usedSlots)
+	require.NoError(t, err, "Failed to count replication slots")
+
+	require.NoError(t, checkLogicalReplicationSettings(settings, usedSlots, meshSize))
+}
+
+// meshReplicationTable holds the rows written by AssertFullMeshReplication
+const meshReplicationTable = "pgedge_mesh_replication_test"
+
+// nodeReplicationStatus is a node's PostgreSQL version and the state of its Spock subscriptions
+type nodeReplicationStatus struct {
+	Version       string
+	Subscriptions []string
+}
+
+// getNodeReplicationStatus reads the server version and Spock subscription states from conn
+func getNodeReplicationStatus(ctx context.Context, conn *sql.DB) (nodeReplicationStatus, error) {
+	var status nodeReplicationStatus
+
+	if err := conn.QueryRowContext(ctx, `SHOW server_version`).Scan(&status.Version); err != nil {
+		return status, fmt.Errorf("failed to read server version: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT subscription_name, status FROM spock.sub_show_status() ORDER BY subscription_name`)
+	if err != nil {
+		return status, fmt.Errorf("failed to read spock subscription status: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, state string
+		if err := rows.Scan(&name, &state); err != nil {
+			return status, fmt.Errorf("failed to scan subscription status: %w", err)
+		}
+		status.Subscriptions = append(status.Subscriptions, fmt.Sprintf("%s=%s", name, state))
+	}
+
+	return status, rows.Err()
+}
+
+// AssertFullMeshReplication checks that a row written on every node reaches every other node.
+// Each node's version and subscription status is logged and included in the failure report.
+func AssertFullMeshReplication(t *testing.T, conns []*sql.DB) {
+	t.Helper()
+
+	// A single node has no peers to replicate to
+	if len(conns) == 1 {
+		AssertSingleNodeSpock(t, conns[0])
+		return
+	}
+
+	ctx := context.Background()
+	statuses := make([]nodeReplicationStatus, len(conns))
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id bigint PRIMARY KEY, origin int NOT NULL, version text NOT NULL)`, meshReplicationTable)
+	for i, conn := range conns {
+		status, err := getNodeReplicationStatus(ctx, conn)
+		require.NoError(t, err, "Failed to read replication status of node %d", i)
+		statuses[i] = status
+		t.Logf("Node %d: PostgreSQL %s, subscriptions %v", i, status.Version, status.Subscriptions)
+
+		_, err = conn.ExecContext(ctx, createTable)
+		require.NoError(t, err, "Failed to create %s on node %d", meshReplicationTable, i)
+	}
+
+	base := time.Now().UnixNano()
+	for i, conn := range conns {
+		_, err := conn.ExecContext(ctx,
+			fmt.Sprintf(`INSERT INTO %s (id, origin, version) VALUES ($1, $2, $3)`, meshReplicationTable),
+			base+int64(i), i, statuses[i].Version)
+		require.NoError(t, err, "Failed to insert on node %d", i)
+	}
+
+	var failures []string
+	for i := range conns {
+		for j, conn := range conns {
+			if i == j {
+				continue
+			}
+			var origin int
+			err := waitForRow(ctx, conn, replicationTimeout,
+				fmt.Sprintf(`SELECT origin FROM %s WHERE id = $1`, meshReplicationTable),
+				[]interface{}{base + int64(i)}, &origin)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("node %d (PostgreSQL %s) -> node %d (PostgreSQL %s): %v",
+					i, statuses[i].Version, j, statuses[j].Version, err))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		var report []string
+		for i, status := range statuses {
+			report = append(report, fmt.Sprintf("node %d: PostgreSQL %s, subscriptions %v", i, status.Version, status.Subscriptions))
+		}
+		t.Fatalf("Replication failed across the mesh:\n%s\nNodes:\n%s", strings.Join(failures, "\n"), strings.Join(report, "\n"))
+	}
+}
+
+// checkSingleNodeSpock verifies a node is the only member of spock.node and has no subscriptions
+func checkSingleNodeSpock(view spockNodeView, status nodeReplicationStatus) error {
+	if len(view.Nodes) != 1 || view.Nodes[0].ID != view.Local.ID {
+		return fmt.Errorf("expected only the local spock node %s (id %d), found:\n%s",
+			view.Local.Name, view.Local.ID, formatSpockNodeViews([]spockNodeView{view}))
+	}
+	if len(status.Subscriptions) > 0 {
+		return fmt.Errorf("expected no spock subscriptions on a single node, found %v", status.Subscriptions)
+	}
+	return nil
+}
+
+// AssertSingleNodeSpock checks that a single-node deployment has exactly one Spock node and
+// no subscriptions, since init-spock has no peers to subscribe to
+func AssertSingleNodeSpock(t *testing.T, conn *sql.DB) {
+	t.Helper()
+
+	ctx := context.Background()
+	view, err := getSpockNodeView(ctx, conn)
+	require.NoError(t, err)
+	status, err := getNodeReplicationStatus(ctx, conn)
+	require.NoError(t, err)
+
+	require.NoError(t, checkSingleNodeSpock(view, status))
+}
+
+// maxClockSkew is the largest clock difference between nodes that Spock's last-update-wins
+// conflict resolution tolerates in our tests
+const maxClockSkew = time.Second
+
+// nodeClockOffset estimates how far the node's clock is ahead of the local clock, comparing
+// clock_timestamp() with the midpoint of the query round trip
+func nodeClockOffset(ctx context.Context, conn *sql.DB) (time.Duration, error) {
+	var serverTime time.Time
+	before := time.Now()
+	if err := conn.QueryRowContext(ctx, `SELECT clock_timestamp()`).Scan(&serverTime); err != nil {
+		return 0, fmt.Errorf("failed to read clock_timestamp(): %w", err)
+	}
+	after := time.Now()
+
+	midpoint := before.Add(after.Sub(before) / 2)
+	return serverTime.Sub(midpoint), nil
+}
+
+// clockSkew returns the spread between the fastest and slowest node clock offsets
+func clockSkew(offsets []time.Duration) time.Duration {
+	if len(offsets) == 0 {
+		return 0
+	}
+	lowest, highest := offsets[0], offsets[0]
+	for _, offset := range offsets[1:] {
+		if offset < lowest {
+			lowest = offset
+		}
+		if offset > highest {
+			highest = offset
+		}
+	}
+	return highest - lowest
+}
+
+// AssertClockSkewTolerance measures each node's clock against the test host and fails if the
+// skew between nodes exceeds maxClockSkew. The measured offset of every node is logged.
+func AssertClockSkewTolerance(t *testing.T, conns []*sql.DB) {
+	t.Helper()
+
+	offsets := make([]time.Duration, 0, len(conns))
+	for i, conn := range conns {
+		offset, err := nodeClockOffset(context.Background(), conn)
+		require.NoError(t, err, "Failed to read clock of node %d", i)
+		t.Logf("Node %d clock offset: %s", i, offset)
+		offsets = append(offsets, offset)
+	}
+
+	skew := clockSkew(offsets)
+	t.Logf("Clock skew across %d nodes: %s", len(conns), skew)
+	require.LessOrEqual(t, skew, maxClockSkew, "Clock skew %s exceeds %s", skew, maxClockSkew)
+}
+
+// replicationLagTable holds the probe rows written by MeasureReplicationLag
+const replicationLagTable = "pgedge_replication_lag_probe"
+
+// replicationLagPollInterval is how often MeasureReplicationLag looks for a probe row on the replica
+const replicationLagPollInterval = 20 * time.Millisecond
+
+// ReplicationLag summarizes how long probe rows took to become visible on a replica
+type ReplicationLag struct {
+	Samples int
+	Avg     time.Duration
+	Max     time.Duration
+}
+
+// String renders the lag for logs
+func (l ReplicationLag) String() string {
+	return fmt.Sprintf("avg %s max %s (%d samples)", l.Avg, l.Max, l.Samples)
+}
+
+// summarizeLag reduces measured lags to their average and maximum
+func summarizeLag(lags []time.Duration) ReplicationLag {
+	summary := ReplicationLag{Samples: len(lags)}
+	if len(lags) == 0 {
+		return summary
+	}
+	var total time.Duration
+	for _, lag := range lags {
+		total += lag
+		summary.Max = max(summary.Max, lag)
+	}
+	summary.Avg = total / time.Duration(len(lags))
+	return summary
+}
+
+// MeasureReplicationLag writes samples probe rows on origin, one at a time, and measures how long
+// each takes to become visible on replica. The lag includes the round trip of the replica query,
+// so latency on the replica's link shows up in it.
+func MeasureReplicationLag(t *testing.T, origin, replica *sql.DB, samples int) ReplicationLag {
+	t.Helper()
+
+	ctx := context.Background()
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id bigint PRIMARY KEY)`, replicationLagTable)
+	for _, conn := range []*sql.DB{origin, replica} {
+		_, err := conn.ExecContext(ctx, createTable)
+		require.NoError(t, err, "Failed to create %s", replicationLagTable)
+	}
+
+	base := time.Now().UnixNano()
+	lags := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		id := base + int64(i)
+		_, err := origin.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id) VALUES ($1)`, replicationLagTable), id)
+		require.NoError(t, err, "Failed to insert probe row")
+
+		start := time.Now()
+		for {
+			var found int64
+			err := replica.QueryRowContext(ctx, fmt.Sprintf(`SELECT id FROM %s WHERE id = $1`, replicationLagTable), id).Scan(&found)
+			if err == nil {
+				break
+			}
+			require.ErrorIs(t, err, sql.ErrNoRows, "Failed to look for probe row")
+			require.Less(t, time.Since(start), replicationTimeout, "Probe row did not replicate within %s", replicationTimeout)
+			time.Sleep(replicationLagPollInterval)
+		}
+		lags = append(lags, time.Since(start))
+	}
+
+	return summarizeLag(lags)
+}
+
+// pausedReplicationTable holds the rows written by AssertReplicationResumesAfterPause
+const pausedReplicationTable = "pgedge_paused_replication_test"
+
+// subscriptionFrom returns the name of the Spock subscription on replica that receives changes
+// from the node called originNode
+func subscriptionFrom(ctx context.Context, replica *sql.DB, originNode string) (string, error) {
+	var name string
+	err := replica.QueryRowContext(ctx,
+		`SELECT s.sub_name FROM spock.subscription s JOIN spock.node n ON n.node_id = s.sub_origin WHERE n.node_name = $1`,
+		originNode,
+	).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("no subscription from node %s", originNode)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up subscription from node %s: %w", originNode, err)
+	}
+	return name, nil
+}
+
+// PauseSubscription disables the Spock subscription subName on conn, stopping its apply worker
+// before returning
+func PauseSubscription(t *testing.T, conn *sql.DB, subName string) {
+	t.Helper()
+
+	_, err := conn.ExecContext(context.Background(), `SELECT spock.sub_disable($1, immediate := true)`, subName)
+	require.NoError(t, err, "Failed to pause subscription %s", subName)
+}
+
+// ResumeSubscription enables the Spock subscription subName on conn
+func ResumeSubscription(t *testing.T, conn *sql.DB, subName string) {
+	t.Helper()
+
+	_, err := conn.ExecContext(context.Background(), `SELECT spock.sub_enable($1, immediate := true)`, subName)
+	require.NoError(t, err, "Failed to resume subscription %s", subName)
+}
+
+// AssertReplicationResumesAfterPause pauses replica's subscription from origin for paused and
+// checks a row written on origin meanwhile does not reach replica, then resumes the subscription
+// and checks the row arrives. The lag at the end of the pause and the catch-up time are logged.
+func AssertReplicationResumesAfterPause(t *testing.T, origin, replica *sql.DB, paused time.Duration) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping subscription pause check in short mode")
+	}
+
+	ctx := context.Background()
+	originView, err := getSpockNodeView(ctx, origin)
+	require.NoError(t, err)
+	subName, err := subscriptionFrom(ctx, replica, originView.Local.Name)
+	require.NoError(t, err)
+
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id bigint PRIMARY KEY)`, pausedReplicationTable)
+	for _, conn := range []*sql.DB{origin, replica} {
+		_, err := conn.ExecContext(ctx, createTable)
+		require.NoError(t, err, "Failed to create %s", pausedReplicationTable)
+	}
+
+	PauseSubscription(t, replica, subName)
+	resumed := false
+	t.Cleanup(func() {
+		if !resumed {
+			_, _ = replica.ExecContext(context.Background(), `SELECT spock.sub_enable($1, immediate := true)`, subName)
+		}
+	})
+
+	id := time.Now().UnixNano()
+	_, err = origin.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id) VALUES ($1)`, pausedReplicationTable), id)
+	require.NoError(t, err, "Failed to insert on origin")
+	written := time.Now()
+
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE id = $1`, pausedReplicationTable)
+	var found int64
+	err = waitForRow(ctx, replica, paused, query, []interface{}{id}, &found)
+	require.Error(t, err, "Row reached the replica while subscription %s was paused", subName)
+	require.ErrorContains(t, err, "row not found", "Failed to look for the row on the replica")
+	t.Logf("Subscription %s paused: row written on origin not on replica after %s", subName, time.Since(written).Round(time.Millisecond))
+
+	ResumeSubscription(t, replica, subName)
+	resumed = true
+	resumedAt := time.Now()
+
+	err = waitForRow(ctx, replica, replicationTimeout, query, []interface{}{id}, &found)
+	require.NoError(t, err, "Replication did not resume after subscription %s was enabled", subName)
+	t.Logf("Subscription %s resumed: replica caught up %s after resume, %s after the write",
+		subName, time.Since(resumedAt).Round(time.Millisecond), time.Since(written).Round(time.Millisecond))
+}
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogicalReplicationSettings(t *testing.T) {
+	settings, err := parseLogicalReplicationSettings(map[string]string{
+		"wal_level":             "logical",
+		"max_replication_slots": "10",
+		"max_wal_senders":       " 10 ",
+	})
+	require.NoError(t, err)
+	require.Equal(t, logicalReplicationSettings{WalLevel: "logical", MaxReplicationSlots: 10, MaxWalSenders: 10}, settings)
+
+	require.NoError(t, checkLogicalReplicationSettings(settings, 2, 3))
+
+	err = checkLogicalReplicationSettings(settings, 9, 3)
+	require.ErrorContains(t, err, "1 free replication slots")
+
+	err = checkLogicalReplicationSettings(logicalReplicationSettings{WalLevel: "replica", MaxReplicationSlots: 10, MaxWalSenders: 1}, 0, 3)
+	require.ErrorContains(t, err, `wal_level is "replica"`)
+	require.ErrorContains(t, err, "max_wal_senders is 1")
+
+	_, err = parseLogicalReplicationSettings(map[string]string{"wal_level": "logical", "max_replication_slots": "ten", "max_wal_senders": "10"})
+	require.ErrorContains(t, err, "invalid max_replication_slots")
+
+	_, err = parseLogicalReplicationSettings(map[string]string{})
+	require.Error(t, err)
+}
+
+func TestClockSkew(t *testing.T) {
+	require.Zero(t, clockSkew(nil))
+	require.Zero(t, clockSkew([]time.Duration{42 * time.Millisecond}))
+	require.Equal(t, 350*time.Millisecond, clockSkew([]time.Duration{
+		100 * time.Millisecond,
+		-250 * time.Millisecond,
+		20 * time.Millisecond,
+	}))
+}
+
+func TestCheckSingleNodeSpock(t *testing.T) {
+	local := SpockNode{ID: 49708, Name: "n1"}
+
+	err := checkSingleNodeSpock(spockNodeView{Local: local, Nodes: []SpockNode{local}}, nodeReplicationStatus{})
+	require.NoError(t, err)
+
+	err = checkSingleNodeSpock(spockNodeView{Local: local}, nodeReplicationStatus{})
+	require.ErrorContains(t, err, "expected only the local spock node n1")
+
+	err = checkSingleNodeSpock(spockNodeView{Local: local, Nodes: []SpockNode{local, {ID: 26863, Name: "n2"}}}, nodeReplicationStatus{})
+	require.ErrorContains(t, err, "26863\tn2")
+
+	err = checkSingleNodeSpock(spockNodeView{Local: local, Nodes: []SpockNode{local}},
+		nodeReplicationStatus{Subscriptions: []string{"sub_n1_n2=down"}})
+	require.ErrorContains(t, err, "sub_n1_n2=down")
+}
+
+func TestSummarizeLag(t *testing.T) {
+	require.Equal(t, ReplicationLag{}, summarizeLag(nil))
+
+	lag := summarizeLag([]time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 200 * time.Millisecond})
+	require.Equal(t, ReplicationLag{Samples: 3, Avg: 200 * time.Millisecond, Max: 300 * time.Millisecond}, lag)
+	require.Equal(t, "avg 200ms max 300ms (3 samples)", lag.String())
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	require.Empty(t, duplicateKeys([][]int64{{1, 3, 5}, {2, 4, 6}}))
+	require.Equal(t, map[int64][]int{3: {0, 2}, 4: {1, 2}},
+		duplicateKeys([][]int64{{1, 3}, {2, 4}, {3, 4, 7}}))
+}
+
+func TestCheckSnowflakeNodes(t *testing.T) {
+	require.NoError(t, checkSnowflakeNodes([]string{"1", "2", "3"}))
+	require.ErrorContains(t, checkSnowflakeNodes([]string{"1", ""}), "not set on node 1")
+	require.ErrorContains(t, checkSnowflakeNodes([]string{"1", "2", "1"}), "nodes 0 and 2 share snowflake.node 1")
+}
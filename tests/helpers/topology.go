@@ -0,0 +1,143 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// clusterZones returns the zones a CNPG Cluster's required node affinity pins it to, or nil if
+// it is not pinned to zones, and whether its affinity topologyKey spreads instances across zones
+func clusterZones(cluster *unstructured.Unstructured) ([]string, bool) {
+	topologyKey, _, _ := unstructured.NestedString(cluster.Object, "spec", "affinity", "topologyKey")
+	terms, _, _ := unstructured.NestedSlice(cluster.Object, "spec", "affinity", "nodeAffinity",
+		"requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+
+	var zones []string
+	for _, t := range terms {
+		term, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		expressions, _, _ := unstructured.NestedSlice(term, "matchExpressions")
+		for _, e := range expressions {
+			expression, ok := e.(map[string]interface{})
+			if !ok || expression["key"] != corev1.LabelTopologyZone || expression["operator"] != string(corev1.NodeSelectorOpIn) {
+				continue
+			}
+			values, _, _ := unstructured.NestedStringSlice(expression, "values")
+			zones = append(zones, values...)
+		}
+	}
+	return zones, len(zones) > 0 && topologyKey == corev1.LabelTopologyZone
+}
+
+// nodeZones returns the zone label of every node, keyed by node name, and the number of
+// distinct zones
+func nodeZones(ctx context.Context, clientset kubernetes.Interface) (map[string]string, int, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	zones := make(map[string]string)
+	distinct := make(map[string]bool)
+	for _, node := range nodes.Items {
+		if zone := node.Labels[corev1.LabelTopologyZone]; zone != "" {
+			zones[node.Name] = zone
+			distinct[zone] = true
+		}
+	}
+	return zones, len(distinct), nil
+}
+
+// GetNodeZones returns the distinct topology.kubernetes.io/zone values of the cluster's nodes,
+// sorted
+func GetNodeZones(t *testing.T, opts *k8s.KubectlOptions) []string {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	zonesByNode, _, err := nodeZones(context.Background(), clientset)
+	require.NoError(t, err)
+
+	var zones []string
+	for _, zone := range zonesByNode {
+		if !slices.Contains(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// checkZoneDistribution verifies every instance pod runs on a node in one of allowedZones and,
+// when spread is set, that the pods use as many distinct zones as they can
+func checkZoneDistribution(pods []corev1.Pod, zonesByNode map[string]string, allowedZones []string, spread bool, availableZones int) error {
+	if len(pods) == 0 {
+		return fmt.Errorf("no instance pods found")
+	}
+
+	used := make(map[string]bool)
+	for _, pod := range pods {
+		zone, ok := zonesByNode[pod.Spec.NodeName]
+		if !ok {
+			return fmt.Errorf("pod %s runs on node %q without a zone label", pod.Name, pod.Spec.NodeName)
+		}
+		if !slices.Contains(allowedZones, zone) {
+			return fmt.Errorf("pod %s runs in zone %s, expected one of %v", pod.Name, zone, allowedZones)
+		}
+		used[zone] = true
+	}
+	if !spread {
+		return nil
+	}
+
+	if expected := min(len(pods), availableZones, len(allowedZones)); len(used) < expected {
+		var zones []string
+		for zone := range used {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+		return fmt.Errorf("%d instances run in zones %v, expected them spread over %d zones", len(pods), zones, expected)
+	}
+	return nil
+}
+
+// AssertZoneDistribution checks that the instances of a CNPG cluster run in the zones its node
+// affinity pins it to and, when its topologyKey is the zone label, are spread across them. It is
+// skipped on single-zone clusters like Kind and fails for clusters not pinned to zones.
+func AssertZoneDistribution(t *testing.T, opts *k8s.KubectlOptions, clusterName string) {
+	t.Helper()
+
+	clientset, err := getClientset(opts.ConfigPath)
+	require.NoError(t, err)
+	dynClient, err := getDynamicClient(opts.ConfigPath)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	zonesByNode, availableZones, err := nodeZones(ctx, clientset)
+	require.NoError(t, err)
+	if availableZones < 2 {
+		t.Skipf("Nodes span %d zones, zone distribution needs at least 2", availableZones)
+	}
+
+	cluster, err := dynClient.Resource(clusterGVR).Namespace(opts.Namespace).Get(ctx, clusterName, metav1.GetOptions{})
+	require.NoError(t, err, "Failed to get cluster %s", clusterName)
+
+	zones, spread := clusterZones(cluster)
+	require.NotEmpty(t, zones, "Cluster %s is not pinned to zones", clusterName)
+
+	pods, err := listInstancePods(ctx, clientset, opts.Namespace, clusterName)
+	require.NoError(t, err)
+	require.NoError(t, checkZoneDistribution(pods, zonesByNode, zones, spread, availableZones))
+}
@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterZones(t *testing.T) {
+	for name, tc := range map[string]struct {
+		spec     ClusterSpec
+		expected []string
+	}{
+		"unpinned": {ClusterSpec{Name: "pgedge"}, nil},
+		"pinned":   {ClusterSpec{Name: "pgedge", Zones: []string{"us-east-1a", "us-east-1b"}}, []string{"us-east-1a", "us-east-1b"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cluster := &unstructured.Unstructured{}
+			require.NoError(t, yaml.Unmarshal([]byte(tc.spec.Manifest()), &cluster.Object))
+			zones, spread := clusterZones(cluster)
+			require.Equal(t, tc.expected, zones)
+			require.Equal(t, tc.expected != nil, spread)
+		})
+	}
+
+	t.Run("pinned without zone topologyKey", func(t *testing.T) {
+		cluster := &unstructured.Unstructured{}
+		manifest := ClusterSpec{Name: "pgedge", Zones: []string{"us-east-1a"}}.Manifest()
+		manifest = strings.Replace(manifest, "topologyKey: "+corev1.LabelTopologyZone, "topologyKey: "+corev1.LabelHostname, 1)
+		require.NoError(t, yaml.Unmarshal([]byte(manifest), &cluster.Object))
+		zones, spread := clusterZones(cluster)
+		require.Equal(t, []string{"us-east-1a"}, zones)
+		require.False(t, spread)
+	})
+}
+
+func TestCheckZoneDistribution(t *testing.T) {
+	node := func(name, zone string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelTopologyZone: zone}}}
+	}
+	clientset := fake.NewClientset(
+		node("node-a1", "zone-a"),
+		node("node-a2", "zone-a"),
+		node("node-b1", "zone-b"),
+		node("node-c1", "zone-c"),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}},
+	)
+	zonesByNode, available, err := nodeZones(context.Background(), clientset)
+	require.NoError(t, err)
+	require.Equal(t, 3, available)
+	require.Equal(t, "zone-b", zonesByNode["node-b1"])
+
+	pods := func(nodes ...string) []corev1.Pod {
+		var pods []corev1.Pod
+		for i, n := range nodes {
+			pods = append(pods, corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pgedge-%d", i+1)},
+				Spec:       corev1.PodSpec{NodeName: n},
+			})
+		}
+		return pods
+	}
+
+	all := []string{"zone-a", "zone-b", "zone-c"}
+	require.NoError(t, checkZoneDistribution(pods("node-a1", "node-b1", "node-c1"), zonesByNode, all, true, available))
+	require.NoError(t, checkZoneDistribution(pods("node-a1", "node-b1", "node-a2"), zonesByNode, []string{"zone-a", "zone-b"}, true, available))
+	// Without the zone topologyKey co-located instances are allowed
+	require.NoError(t, checkZoneDistribution(pods("node-a1", "node-a2"), zonesByNode, []string{"zone-a", "zone-b"}, false, available))
+
+	err = checkZoneDistribution(nil, zonesByNode, all, true, available)
+	require.ErrorContains(t, err, "no instance pods found")
+
+	err = checkZoneDistribution(pods("node-a1", "node-c1"), zonesByNode, []string{"zone-a", "zone-b"}, false, available)
+	require.ErrorContains(t, err, "pod pgedge-2 runs in zone zone-c, expected one of [zone-a zone-b]")
+
+	err = checkZoneDistribution(pods("node-a1", "node-a2"), zonesByNode, []string{"zone-a", "zone-b"}, true, available)
+	require.ErrorContains(t, err, "2 instances run in zones [zone-a], expected them spread over 2 zones")
+
+	err = checkZoneDistribution(pods("unlabeled"), zonesByNode, all, true, available)
+	require.ErrorContains(t, err, `pod pgedge-1 runs on node "unlabeled" without a zone label`)
+}
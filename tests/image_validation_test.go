@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/k8s"
@@ -10,6 +12,53 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// paramsPolicyFixture is the image validation rule reading its allowed prefixes, filled in as a
+// comma-separated list, from a ConfigMap param instead of embedding them in the expression
+const paramsPolicyFixture = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: pgedge-image-prefixes
+  namespace: default
+data:
+  prefixes: "%s"
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: pgedge-image-prefixes
+spec:
+  failurePolicy: Fail
+  paramKind:
+    apiVersion: v1
+    kind: ConfigMap
+  matchConstraints:
+    resourceRules:
+    - apiGroups: ["postgresql.cnpg.io"]
+      apiVersions: ["v1"]
+      operations: ["CREATE", "UPDATE"]
+      resources: ["clusters"]
+  validations:
+  - expression: |
+      !has(object.spec.imageName) ||
+      params.data.prefixes.split(',').exists(p, object.spec.imageName.startsWith(p))
+    message: "CNPG Cluster must use an image from the pgedge-image-prefixes ConfigMap"
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: pgedge-image-prefixes-binding
+spec:
+  policyName: pgedge-image-prefixes
+  validationActions: ["Warn"]
+  paramRef:
+    name: pgedge-image-prefixes
+    namespace: default
+    parameterNotFoundAction: Deny
+  matchResources:
+    namespaceSelector: {}
+`
+
 // TestImageValidation verifies that non-pgEdge PostgreSQL images are blocked
 func TestImageValidation(t *testing.T) {
 	t.Parallel()
@@ -29,24 +78,44 @@ func TestImageValidation(t *testing.T) {
 		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
 
 	// Get pgEdge PostgreSQL image
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
 	pgEdgeImage := cfg.GetPostgresImageName(
 		cfg.PostgresImages.DefaultRegistry,
 		postgresVersion,
-		"standard",
+		variant,
 	)
 
 	// Deploy CNPG operator
-	helpers.DeployCNPGOperator(t,
+	operator := helpers.DeployCNPGOperator(t,
 		provider.GetKubeConfigPath(),
 		cnpgVersion.Version,
 		cnpgVersion.ChartVersion,
-		"cnpg-system",
+		helpers.DefaultOperatorNamespace,
 		cnpgVersion.GetOperatorImageName(),
 		pgEdgeImage,
 	)
 
 	opts := provider.GetKubectlOptions("default")
 
+	// Assert against the denial message this server actually produces
+	policyMessage, err := helpers.GetEffectivePolicyMessage(t, opts)
+	require.NoError(t, err, "Failed to determine image validation policy message")
+
+	t.Run("Policy params are accessible", func(t *testing.T) {
+		prefixes, err := cfg.AllowedImagePrefixes()
+		require.NoError(t, err)
+		// The pgEdge policy embeds its prefixes, so check a copy that reads them from a ConfigMap.
+		// It only warns, leaving admission to the pgEdge policy.
+		policy := fmt.Sprintf(paramsPolicyFixture, strings.Join(prefixes, ","))
+		require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, policy), "Failed to create parameterized policy")
+		defer func() {
+			_ = k8s.KubectlDeleteFromStringE(t, opts, policy)
+		}()
+
+		helpers.AssertPolicyParamAccessible(t, opts, "pgedge-image-prefixes")
+	})
+
 	t.Run("Allow pgEdge public registry image", func(t *testing.T) {
 		// This should succeed - pgEdge public image
 		validCluster := `
@@ -87,6 +156,37 @@ spec:
 		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "valid-pgedge-internal-cluster", "--ignore-not-found=true")
 	})
 
+	t.Run("Allow image from an extra allowed prefix", func(t *testing.T) {
+		prefixes, err := cfg.AllowedImagePrefixes()
+		require.NoError(t, err)
+		registryPrefixes := len(cfg.PostgresImages.Registries)
+		if len(prefixes) == registryPrefixes {
+			t.Skipf("%s is not set", config.AllowedImagePrefixesEnvVar)
+		}
+
+		// A prefix either ends in a repository path or in a repository name followed by ":"
+		image := prefixes[registryPrefixes] + "pgedge-postgres:17-spock5-standard"
+		if strings.HasSuffix(prefixes[registryPrefixes], ":") {
+			image = prefixes[registryPrefixes] + "17-spock5-standard"
+		}
+		mirrorCluster := fmt.Sprintf(`
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: valid-mirror-cluster
+spec:
+  instances: 1
+  imageName: %s
+  storage:
+    size: 1Gi
+`, image)
+		err = k8s.KubectlApplyFromStringE(t, opts, mirrorCluster)
+		require.NoError(t, err, "Image %s should be allowed", image)
+
+		// Cleanup
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "valid-mirror-cluster", "--ignore-not-found=true")
+	})
+
 	t.Run("Block upstream CNPG image", func(t *testing.T) {
 		// This should fail - upstream CNPG image
 		invalidCluster := `
@@ -102,7 +202,7 @@ spec:
 `
 		err := k8s.KubectlApplyFromStringE(t, opts, invalidCluster)
 		require.Error(t, err, "Upstream CNPG image should be blocked")
-		require.Contains(t, err.Error(), "must use pgEdge PostgreSQL images",
+		require.Contains(t, err.Error(), policyMessage,
 			"Error message should indicate pgEdge images are required")
 	})
 
@@ -121,7 +221,7 @@ spec:
 `
 		err := k8s.KubectlApplyFromStringE(t, opts, invalidDockerCluster)
 		require.Error(t, err, "Docker Hub postgres image should be blocked")
-		require.Contains(t, err.Error(), "must use pgEdge PostgreSQL images",
+		require.Contains(t, err.Error(), policyMessage,
 			"Error message should indicate pgEdge images are required")
 	})
 
@@ -140,8 +240,63 @@ spec:
 `
 		err := k8s.KubectlApplyFromStringE(t, opts, defaultImageCluster)
 		require.NoError(t, err, "Cluster without explicit imageName should be allowed (uses operator default)")
+		defer func() {
+			_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "default-image-cluster", "--ignore-not-found=true")
+		}()
 
-		// Cleanup
-		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "default-image-cluster", "--ignore-not-found=true")
+		// Admission only sees the defaulted spec; check what the operator actually resolved
+		image := helpers.AssertClusterUsesPgedgeImage(t, opts, "default-image-cluster")
+		t.Logf("Cluster without imageName runs %s", image)
+	})
+
+	t.Run("Warn mode admits upstream image with a warning", func(t *testing.T) {
+		require.NoError(t, provider.InstallImageValidationPolicy(t, config.ValidationActionWarn))
+		defer func() {
+			require.NoError(t, provider.InstallImageValidationPolicy(t, config.ValidationActionDeny))
+		}()
+
+		helpers.AssertPolicyWarns(t, opts, policyMessage)
+	})
+
+	// Runs last: it deletes the operator config map and restarts the operator.
+	//
+	// Neither Helm nor the operator recreates cnpg-controller-manager-config once deleted. After a
+	// restart the operator falls back to its built-in upstream default image, so the CNPG defaulting
+	// webhook fills imageName with it and the image validation policy must reject the cluster. If a
+	// future operator does self-heal the config map, the default must still be the pgEdge image.
+	t.Run("Default image stays pgEdge after operator config map deletion", func(t *testing.T) {
+		helpers.AssertOperatorDefaultImage(t, operator.KubectlOptions, pgEdgeImage)
+
+		err := k8s.RunKubectlE(t, operator.KubectlOptions, "delete", "configmap", "cnpg-controller-manager-config")
+		require.NoError(t, err, "Failed to delete operator config map")
+
+		// The operator only reads its configuration at startup
+		require.NoError(t, operator.Restart(t))
+
+		if _, err := k8s.GetConfigMapE(t, operator.KubectlOptions, "cnpg-controller-manager-config"); err == nil {
+			t.Log("Operator config map was recreated")
+			helpers.AssertOperatorDefaultImage(t, operator.KubectlOptions, pgEdgeImage)
+			helpers.AssertDefaultImageClusterSafe(t, opts, "default-image-after-configmap-loss")
+			return
+		}
+
+		t.Log("Operator config map was not recreated; expecting clusters without imageName to be rejected")
+		upstreamDefaultCluster := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: default-image-after-configmap-loss
+spec:
+  instances: 1
+  storage:
+    size: 1Gi
+`
+		err = k8s.KubectlApplyFromStringE(t, opts, upstreamDefaultCluster)
+		defer func() {
+			_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "default-image-after-configmap-loss", "--ignore-not-found=true")
+		}()
+		require.Error(t, err, "Cluster defaulted to the upstream image should be blocked")
+		require.Contains(t, err.Error(), policyMessage,
+			"Error message should indicate pgEdge images are required")
 	})
 }
@@ -1,12 +1,15 @@
 package tests
 
 import (
+	"context"
 	"testing"
 
+	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
 	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
 	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // TestInfra validates that we can create a Kind cluster with CSI support
@@ -57,17 +60,25 @@ func TestInfra(t *testing.T) {
 
 	t.Run("Verify volume snapshot class exists", func(t *testing.T) {
 		opts := provider.GetKubectlOptions("")
-		snapshotClasses, err := helpers.GetVolumeSnapshotClasses(t, opts)
+		snapshotClasses, err := helpers.ListVolumeSnapshotClasses(t, opts)
 		require.NoError(t, err)
 
-		found := false
-		for _, vsc := range snapshotClasses {
-			if vsc == storageConfig.SnapshotClass {
-				found = true
+		var snapshotClass *helpers.VolumeSnapshotClass
+		for i := range snapshotClasses {
+			if snapshotClasses[i].Name == storageConfig.SnapshotClass {
+				snapshotClass = &snapshotClasses[i]
 				break
 			}
 		}
-		require.True(t, found, "Volume snapshot class %s not found", storageConfig.SnapshotClass)
+		require.NotNil(t, snapshotClass, "Volume snapshot class %s not found", storageConfig.SnapshotClass)
+
+		// Snapshots of CSI volumes are taken by the driver that provisions them
+		clientset, err := k8s.GetKubernetesClientFromOptionsE(t, opts)
+		require.NoError(t, err)
+		csiClass, err := clientset.StorageV1().StorageClasses().Get(context.Background(), storageConfig.CSIClass, metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, csiClass.Provisioner, snapshotClass.Driver,
+			"Volume snapshot class %s does not use the provisioner of storage class %s", snapshotClass.Name, csiClass.Name)
 	})
 }
 
@@ -94,7 +105,7 @@ func TestOperator(t *testing.T) {
 	operator := helpers.DeployCNPGOperatorFromManifest(t,
 		provider.GetKubeConfigPath(),
 		cnpgVersion.Version,
-		"cnpg-system",
+		helpers.DefaultOperatorNamespace,
 	)
 
 	t.Run("Verify operator is running", func(t *testing.T) {
@@ -102,6 +113,10 @@ func TestOperator(t *testing.T) {
 		require.NoError(t, err, "Operator deployment should exist and be accessible")
 	})
 
+	t.Run("Verify operator webhook certificate is valid", func(t *testing.T) {
+		helpers.AssertWebhookCertValid(t, operator.KubectlOptions)
+	})
+
 	t.Run("Verify operator CRDs are installed", func(t *testing.T) {
 		crds := []string{
 			"backups.postgresql.cnpg.io",
@@ -123,3 +138,102 @@ func TestOperator(t *testing.T) {
 		}
 	})
 }
+
+// TestOperatorCustomNamespace installs the operator into a non-default namespace to confirm
+// nothing in the install or the helpers assumes cnpg-system
+func TestOperatorCustomNamespace(t *testing.T) {
+	t.Parallel()
+
+	const operatorNamespace = "postgres-operator"
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  Kubernetes=%s  Provider=%s  Namespace=%s",
+		cnpgVersion.Version, providers.GetKubernetesVersion(), providers.GetProviderType(), operatorNamespace)
+
+	provider := providers.NewProvider(t, "cnpg-custom-ns-test")
+	providers.Setup(t, provider)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	operator := helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		operatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+	require.Equal(t, operatorNamespace, operator.KubectlOptions.Namespace)
+
+	t.Run("Verify operator is running", func(t *testing.T) {
+		err := helpers.GetDeployment(t, operator.KubectlOptions, operator.ReleaseName)
+		require.NoError(t, err, "Operator deployment should exist in %s", operatorNamespace)
+	})
+
+	t.Run("Verify operator logs are retrievable", func(t *testing.T) {
+		logs, err := operator.GetOperatorLogs(t)
+		require.NoError(t, err)
+		require.NotEmpty(t, logs)
+	})
+
+	t.Run("Verify operator webhook certificate is valid", func(t *testing.T) {
+		helpers.AssertWebhookCertValid(t, operator.KubectlOptions)
+	})
+
+	t.Run("Verify operator default image", func(t *testing.T) {
+		helpers.AssertOperatorDefaultImage(t, operator.KubectlOptions, postgresImage)
+	})
+
+	t.Run("Verify release values were applied", func(t *testing.T) {
+		values, err := helpers.GetReleaseValues(t, provider.GetKubeConfigPath(), operator.ReleaseName, operatorNamespace)
+		require.NoError(t, err)
+		helpers.AssertReleaseValue(t, values, "config.data.POSTGRES_IMAGE_NAME", postgresImage)
+	})
+
+	t.Run("Verify operator honors proxy settings", func(t *testing.T) {
+		helpers.AssertProxyRespected(t, operator.KubectlOptions)
+	})
+
+	t.Run("Verify webhooks admit clusters", func(t *testing.T) {
+		// Cluster admission goes through the operator webhook service in the custom namespace
+		helpers.AssertDefaultImageClusterSafe(t, provider.GetKubectlOptions("default"), "custom-ns-cluster")
+	})
+
+	t.Run("Verify operator counts reconcile errors", func(t *testing.T) {
+		opts := provider.GetKubectlOptions("default")
+		// The operator refuses to take over a service it does not own, so a Service squatting on
+		// the cluster's rw service name fails every reconcile of the cluster
+		squatter := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: reconcile-error-rw
+spec:
+  ports:
+    - port: 5432
+`
+		cluster := helpers.ClusterSpec{Name: "reconcile-error", Instances: 1}.Manifest()
+		defer func() {
+			_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "reconcile-error", "--ignore-not-found=true")
+			_ = k8s.KubectlDeleteFromStringE(t, opts, squatter)
+		}()
+
+		increase := helpers.AssertReconcileErrorMetric(t, operator, func() {
+			require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, squatter), "Failed to create squatting service")
+			require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+		})
+		t.Logf("Operator counted %g reconcile errors", increase)
+	})
+}
@@ -0,0 +1,301 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	http_helper "github.com/gruntwork-io/terratest/modules/http-helper"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TestKindExtraMounts verifies a host directory mounted into the Kind nodes is visible to pods
+func TestKindExtraMounts(t *testing.T) {
+	t.Parallel()
+
+	if providers.GetProviderType() != "kind" {
+		t.Skipf("Extra mounts are not supported on %s", providers.GetProviderType())
+	}
+
+	hostDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "marker"), []byte("from-host"), 0o644))
+
+	provider := providers.NewKind(&providers.Config{
+		Name:              "cnpg-mounts-test",
+		KubernetesVersion: providers.GetKubernetesVersion(),
+		NodeCount:         1,
+		ExtraMounts: []providers.Mount{
+			{HostPath: hostDir, ContainerPath: "/mnt/host", ReadOnly: true},
+		},
+	})
+	require.NoError(t, provider.Create(t), "Failed to create cluster")
+	if providers.GetClusterCleanup() {
+		t.Cleanup(func() {
+			if err := provider.Delete(t); err != nil {
+				t.Logf("Warning: failed to cleanup cluster: %v", err)
+			}
+		})
+	}
+
+	opts := provider.GetKubectlOptions("default")
+	manifest := `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: mount-check
+spec:
+  tolerations:
+    - key: node-role.kubernetes.io/control-plane
+      operator: Exists
+      effect: NoSchedule
+  containers:
+    - name: check
+      image: busybox:1.36
+      command: ["sleep", "3600"]
+      volumeMounts:
+        - name: host
+          mountPath: /host
+          readOnly: true
+  volumes:
+    - name: host
+      hostPath:
+        path: /mnt/host
+        type: Directory
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, manifest))
+	require.NoError(t, k8s.WaitUntilPodAvailableE(t, opts, "mount-check", 60, 5*time.Second))
+
+	out, err := k8s.RunKubectlAndGetOutputE(t, opts, "exec", "mount-check", "--", "cat", "/host/marker")
+	require.NoError(t, err)
+	require.Equal(t, "from-host", out)
+}
+
+// TestKindPortMappings verifies a NodePort is reachable from the host through a Kind port mapping
+func TestKindPortMappings(t *testing.T) {
+	t.Parallel()
+
+	if providers.GetProviderType() != "kind" {
+		t.Skipf("Port mappings are not supported on %s", providers.GetProviderType())
+	}
+
+	provider := providers.NewKind(&providers.Config{
+		Name:              "cnpg-ports-test",
+		KubernetesVersion: providers.GetKubernetesVersion(),
+		NodeCount:         1,
+		PortMappings: []providers.PortMapping{
+			{ContainerPort: 30080, HostPort: 18080},
+		},
+	})
+	require.NoError(t, provider.Create(t), "Failed to create cluster")
+	if providers.GetClusterCleanup() {
+		t.Cleanup(func() {
+			if err := provider.Delete(t); err != nil {
+				t.Logf("Warning: failed to cleanup cluster: %v", err)
+			}
+		})
+	}
+
+	opts := provider.GetKubectlOptions("default")
+	manifest := `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: echo
+  labels:
+    app: echo
+spec:
+  tolerations:
+    - key: node-role.kubernetes.io/control-plane
+      operator: Exists
+      effect: NoSchedule
+  containers:
+    - name: echo
+      image: hashicorp/http-echo:1.0
+      args: ["-text=port-mapping-ok", "-listen=:8080"]
+      ports:
+        - containerPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: echo
+spec:
+  type: NodePort
+  selector:
+    app: echo
+  ports:
+    - port: 8080
+      targetPort: 8080
+      nodePort: 30080
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, manifest))
+	require.NoError(t, k8s.WaitUntilPodAvailableE(t, opts, "echo", 60, 5*time.Second))
+
+	err := http_helper.HttpGetWithRetryWithCustomValidationE(t, "http://localhost:18080", nil, 30, 2*time.Second,
+		func(status int, body string) bool {
+			return status == 200 && strings.TrimSpace(body) == "port-mapping-ok"
+		})
+	require.NoError(t, err, "NodePort 30080 was not reachable on host port 18080")
+}
+
+// TestKindCSILoss verifies storage degrades gracefully while the CSI driver is down
+func TestKindCSILoss(t *testing.T) {
+	t.Parallel()
+
+	if providers.GetProviderType() != "kind" {
+		t.Skipf("The CSI driver cannot be toggled on %s", providers.GetProviderType())
+	}
+
+	provider := providers.NewKind(&providers.Config{
+		Name:              "cnpg-csi-loss-test",
+		KubernetesVersion: providers.GetKubernetesVersion(),
+		NodeCount:         1,
+	})
+	providers.Setup(t, provider)
+
+	providers.AssertGracefulCSILoss(t, provider, provider.GetKubectlOptions("default"))
+}
+
+// TestKindLocalRegistry pushes the pgEdge Postgres image to the cluster's local registry and
+// checks a Cluster referencing it by its local registry name comes up
+func TestKindLocalRegistry(t *testing.T) {
+	t.Parallel()
+
+	if providers.GetProviderType() != "kind" {
+		t.Skipf("The local registry is only available on kind, not %s", providers.GetProviderType())
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	// Created without the image validation policy, which only admits the pgEdge registries
+	provider := providers.NewKind(&providers.Config{
+		Name:              "cnpg-registry-test",
+		KubernetesVersion: providers.GetKubernetesVersion(),
+		NodeCount:         1,
+	})
+	require.NoError(t, provider.Create(t), "Failed to create cluster")
+	if providers.GetClusterCleanup() {
+		t.Cleanup(func() {
+			if err := provider.Delete(t); err != nil {
+				t.Logf("Warning: failed to cleanup cluster: %v", err)
+			}
+		})
+	}
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+
+	// Deployed first so postgresImage is signature-checked before it is pushed, the local re-tag
+	// has no signature of its own
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	host, err := provider.CreateLocalRegistry(t)
+	require.NoError(t, err, "Failed to create local registry")
+	localImage, err := provider.PushToLocalRegistry(t, postgresImage)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(localImage, host+"/"), "%s is not in registry %s", localImage, host)
+
+	opts := provider.GetKubectlOptions("default")
+	cluster := helpers.ClusterSpec{Name: "local-registry", Instances: 1, ImageName: localImage}.Manifest()
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "local-registry", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "local-registry", 10*time.Minute))
+
+	image, err := k8s.RunKubectlAndGetOutputE(t, opts, "get", "pod", "local-registry-1",
+		"-o", `jsonpath={.spec.containers[?(@.name=="postgres")].image}`)
+	require.NoError(t, err)
+	require.Equal(t, localImage, image)
+}
+
+// TestKindImagePullPolicy preloads the pgEdge Postgres image into the nodes and checks a Cluster
+// with imagePullPolicy IfNotPresent starts from the cached image without pulling it
+func TestKindImagePullPolicy(t *testing.T) {
+	t.Parallel()
+
+	if providers.GetProviderType() != "kind" {
+		t.Skipf("Images cannot be preloaded on %s", providers.GetProviderType())
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	provider := providers.NewKind(&providers.Config{
+		Name:              "cnpg-pull-policy-test",
+		KubernetesVersion: providers.GetKubernetesVersion(),
+		NodeCount:         1,
+	})
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+
+	require.NoError(t, provider.LoadImage(t, postgresImage), "Failed to preload the Postgres image")
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+	cluster := helpers.ClusterSpec{
+		Name:            "pull-policy",
+		Instances:       1,
+		ImageName:       postgresImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+	}.Manifest()
+	helpers.AssertClusterImagesSigned(t, cluster)
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "pull-policy", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "pull-policy", 10*time.Minute))
+
+	helpers.AssertImagePullPolicy(t, opts, "pull-policy", corev1.PullIfNotPresent)
+	helpers.AssertImageNotPulled(t, opts, "pull-policy")
+
+	events, err := helpers.GetEvents(t, opts, "default")
+	require.NoError(t, err)
+	helpers.AssertEventContains(t, events, "Pulled", fmt.Sprintf("%q already present on machine", postgresImage))
+}
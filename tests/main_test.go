@@ -0,0 +1,25 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+)
+
+// staleClusterAge is how old a leaked Kind cluster must be before CLEANUP_STALE removes it
+const staleClusterAge = 2 * time.Hour
+
+// TestMain optionally removes Kind clusters leaked by interrupted runs before the suite starts
+// Set CLEANUP_STALE=true to enable
+func TestMain(m *testing.M) {
+	if os.Getenv("CLEANUP_STALE") == "true" && providers.GetProviderType() == "kind" {
+		if err := providers.CleanupStaleKindClusters(nil, "cnpg-", staleClusterAge); err != nil {
+			fmt.Printf("Warning: failed to clean up stale Kind clusters: %v\n", err)
+		}
+	}
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// operatorNamespaceQuota constrains the operator namespace the way a quota-managed cluster would.
+// The LimitRange gives the chart's pods, which set no resources, requests the quota can count.
+const operatorNamespaceQuota = `
+apiVersion: v1
+kind: LimitRange
+metadata:
+  name: operator-limits
+spec:
+  limits:
+    - type: Container
+      defaultRequest:
+        cpu: 100m
+        memory: 128Mi
+      default:
+        cpu: 500m
+        memory: 512Mi
+      max:
+        cpu: "1"
+        memory: 1Gi
+---
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: operator-quota
+spec:
+  hard:
+    pods: "4"
+    requests.cpu: "1"
+    requests.memory: 1Gi
+    limits.cpu: "2"
+    limits.memory: 2Gi
+`
+
+// TestCNPGOperatorUpgrade installs the second newest CNPG version in versions.yaml, creates a
+// cluster and upgrades the operator in place to the newest version. Every instance must be
+// rolled onto the new instance manager, the cluster must return to healthy without container
+// restarts and the default image must still be pgEdge's.
+func TestCNPGOperatorUpgrade(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping operator upgrade test in short mode")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	// cnpg_versions lists the newest version first
+	if len(cfg.CNPGVersions) < 2 {
+		t.Skip("Operator upgrade needs at least two CNPG versions in versions.yaml")
+	}
+	from, to := cfg.CNPGVersions[1], cfg.CNPGVersions[0]
+	postgresVersion := from.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s->%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		from.Version, to.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-operator-upgrade-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	operator := helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		from.Version,
+		from.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		from.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+	cluster := helpers.ClusterSpec{Name: "upgrade-test", Instances: 2}.Manifest()
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, cluster)
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "upgrade-test", 10*time.Minute))
+
+	restarts, err := helpers.GetInstanceRestarts(t, opts, "upgrade-test")
+	require.NoError(t, err)
+	pods, err := helpers.GetInstancePods(t, opts, "upgrade-test")
+	require.NoError(t, err)
+
+	var usageBefore helpers.ResourceUsage
+	t.Run("Resource usage before upgrade", func(t *testing.T) {
+		usageBefore = helpers.MeasureClusterResourceUsage(t, opts, "upgrade-test")
+	})
+
+	targetChart, err := operator.UpgradeChartPath(to.Version)
+	require.NoError(t, err)
+	// The target chart must keep serving every CNPG apiVersion the cluster serves today
+	helpers.AssertAPIVersionCompatibility(t, opts, targetChart)
+	// The rolling update runs the new operator pod next to the old one, so the constrained
+	// operator namespace must have room for the target chart's pods
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, operator.KubectlOptions, operatorNamespaceQuota),
+		"Failed to constrain the operator namespace")
+	helpers.AssertDeploymentFitsQuota(t, operator.KubectlOptions, operator.Namespace, targetChart)
+
+	require.NoError(t, operator.Upgrade(t, to.Version), "Failed to upgrade operator")
+
+	t.Run("Cluster stays healthy", func(t *testing.T) {
+		// The cluster may still report healthy before the new operator starts rolling the
+		// instance manager out, so wait for every instance to run it first
+		require.NoError(t, helpers.WaitForInstanceManagerRollout(t, opts, "upgrade-test", operator.OperatorImage, 10*time.Minute))
+		require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "upgrade-test", 10*time.Minute))
+		helpers.AssertInstancesReplaced(t, opts, "upgrade-test", pods)
+		helpers.AssertNoNewRestarts(t, opts, "upgrade-test", restarts)
+	})
+
+	t.Run("Resource usage after upgrade", func(t *testing.T) {
+		if usageBefore.Samples == 0 {
+			t.Skip("No resource usage was measured before the upgrade")
+		}
+		usageAfter := helpers.MeasureClusterResourceUsage(t, opts, "upgrade-test")
+		t.Logf("Resource usage change with the %s instance manager: %s", to.Version,
+			helpers.FormatResourceUsageDelta(usageBefore, usageAfter))
+	})
+
+	t.Run("Default image is preserved", func(t *testing.T) {
+		operator.AssertDefaultImagePreserved(t, opts)
+	})
+}
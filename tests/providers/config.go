@@ -2,6 +2,7 @@ package providers
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -17,6 +18,26 @@ func GetProviderType() string {
 	return providerType
 }
 
+// GetClusterReuse reports whether an existing cluster should be reused instead of recreated
+func GetClusterReuse() bool {
+	return os.Getenv("CLUSTER_REUSE") == "true"
+}
+
+// GetClusterCleanup reports whether clusters should be deleted when a test finishes.
+// Set CLUSTER_CLEANUP=false to keep them running.
+func GetClusterCleanup() bool {
+	return os.Getenv("CLUSTER_CLEANUP") != "false"
+}
+
+// GetDiagnosticsDir returns where diagnostics of failed tests are written, DIAGNOSTICS_DIR or
+// a directory under the system temp dir
+func GetDiagnosticsDir() string {
+	if dir := os.Getenv("DIAGNOSTICS_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "pgedge-test-diagnostics")
+}
+
 // getProviderDefaults returns the ProviderDefaults for the active provider from versions.yaml
 func getProviderDefaults() *config.ProviderDefaults {
 	if cfg, err := config.LoadConfig(); err == nil {
@@ -100,6 +121,7 @@ func NewProvider(t *testing.T, clusterName string) Provider {
 	providerType := GetProviderType()
 	t.Logf("Creating cluster %s using provider: %s (K8s: %s, Nodes: %d, Arch: %s, Instance: %s)",
 		clusterName, providerType, config.KubernetesVersion, config.NodeCount, config.NodeArch, config.InstanceType)
+	requireSupportedK8sVersion(t, config.KubernetesVersion)
 
 	return Create(t, providerType, config)
 }
@@ -0,0 +1,206 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// csiPluginNamespace and csiPluginStatefulSet locate the CSI hostpath plugin installed on Kind
+	csiPluginNamespace   = "default"
+	csiPluginStatefulSet = "csi-hostpathplugin"
+	// csiLossPendingWindow is how long a new PVC must stay pending while the driver is down
+	csiLossPendingWindow = 30 * time.Second
+)
+
+// csiLossWorkload is a PVC mounted by a running pod, used to check existing volumes survive
+// the loss of the CSI driver
+const csiLossWorkload = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: csi-loss-existing
+spec:
+  accessModes: ["ReadWriteOnce"]
+  storageClassName: csi-hostpath-sc
+  resources:
+    requests:
+      storage: 100Mi
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: csi-loss-writer
+spec:
+  tolerations:
+  - key: node-role.kubernetes.io/control-plane
+    operator: Exists
+    effect: NoSchedule
+  containers:
+  - name: writer
+    image: busybox:1.36
+    command: ["sleep", "3600"]
+    volumeMounts:
+    - name: data
+      mountPath: /data
+  volumes:
+  - name: data
+    persistentVolumeClaim:
+      claimName: csi-loss-existing
+`
+
+// csiLossNewClaim is provisioned while the CSI driver is down
+const csiLossNewClaim = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: csi-loss-new
+spec:
+  accessModes: ["ReadWriteOnce"]
+  storageClassName: csi-hostpath-sc
+  resources:
+    requests:
+      storage: 100Mi
+`
+
+// provisioningPendingReason returns the latest event explaining why pvc is not provisioned, and
+// an error if the claim is no longer pending or nothing explains the wait
+func provisioningPendingReason(pvc *corev1.PersistentVolumeClaim, events []corev1.Event) (string, error) {
+	if pvc.Status.Phase != corev1.ClaimPending {
+		return "", fmt.Errorf("PVC %s is %s while the CSI driver is down", pvc.Name, pvc.Status.Phase)
+	}
+
+	var latest *corev1.Event
+	for i := range events {
+		e := &events[i]
+		if e.InvolvedObject.Kind != "PersistentVolumeClaim" || e.InvolvedObject.Name != pvc.Name {
+			continue
+		}
+		if latest == nil || e.LastTimestamp.After(latest.LastTimestamp.Time) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("PVC %s is pending with no event explaining why", pvc.Name)
+	}
+	return fmt.Sprintf("%s: %s", latest.Reason, latest.Message), nil
+}
+
+// scaleCSIPlugin scales the CSI hostpath plugin and waits for the change to take effect
+func scaleCSIPlugin(t *testing.T, clientset kubernetes.Interface, replicas int32) error {
+	t.Helper()
+
+	ctx := context.Background()
+	statefulSets := clientset.AppsV1().StatefulSets(csiPluginNamespace)
+	scale, err := statefulSets.GetScale(ctx, csiPluginStatefulSet, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get scale of %s: %w", csiPluginStatefulSet, err)
+	}
+	scale.Spec.Replicas = replicas
+	if _, err := statefulSets.UpdateScale(ctx, csiPluginStatefulSet, scale, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to scale %s to %d: %w", csiPluginStatefulSet, replicas, err)
+	}
+
+	_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for %s to have %d ready replicas", csiPluginStatefulSet, replicas), 60, 5*time.Second, func() (string, error) {
+		sts, err := statefulSets.Get(ctx, csiPluginStatefulSet, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if sts.Status.Replicas != replicas || sts.Status.ReadyReplicas != replicas {
+			return "", fmt.Errorf("%s has %d replicas, %d ready", csiPluginStatefulSet, sts.Status.Replicas, sts.Status.ReadyReplicas)
+		}
+		return "", nil
+	})
+	return err
+}
+
+// AssertGracefulCSILoss scales the CSI plugin down and checks that a mounted volume keeps
+// working while new claims wait with a clear reason, then restores the driver and checks
+// provisioning resumes. Only Kind, where the hostpath plugin runs in the cluster, is supported.
+func AssertGracefulCSILoss(t *testing.T, provider Provider, opts *k8s.KubectlOptions) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping CSI loss test in short mode")
+	}
+	if _, ok := provider.(*Kind); !ok {
+		t.Skipf("CSI loss on %s: %v", provider.Name(), ErrUnsupported)
+	}
+
+	clientset, err := k8s.GetKubernetesClientFromOptionsE(t, opts)
+	if err != nil {
+		t.Fatalf("Failed to create kubernetes client: %v", err)
+	}
+	ctx := context.Background()
+
+	k8s.KubectlApplyFromString(t, opts, csiLossWorkload)
+	defer k8s.KubectlDeleteFromStringE(t, opts, csiLossWorkload)
+	k8s.WaitUntilPodAvailable(t, opts, "csi-loss-writer", 60, 5*time.Second)
+
+	t.Log("Scaling down the CSI hostpath plugin")
+	if err := scaleCSIPlugin(t, clientset, 0); err != nil {
+		t.Fatalf("Failed to stop CSI driver: %v", err)
+	}
+	restored := false
+	defer func() {
+		if !restored {
+			if err := scaleCSIPlugin(t, clientset, 1); err != nil {
+				t.Logf("Warning: failed to restore CSI driver: %v", err)
+			}
+		}
+	}()
+
+	output, err := k8s.RunKubectlAndGetOutputE(t, opts, "exec", "csi-loss-writer", "--",
+		"sh", "-c", "echo still-writable > /data/probe && sync && cat /data/probe")
+	if err != nil || strings.TrimSpace(output) != "still-writable" {
+		t.Fatalf("Mounted volume stopped working without the CSI driver: %v: %s", err, output)
+	}
+
+	k8s.KubectlApplyFromString(t, opts, csiLossNewClaim)
+	defer k8s.KubectlDeleteFromStringE(t, opts, csiLossNewClaim)
+
+	time.Sleep(csiLossPendingWindow)
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Get(ctx, "csi-loss-new", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get PVC csi-loss-new: %v", err)
+	}
+	events, err := clientset.CoreV1().Events(opts.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.name", "csi-loss-new").String(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to list events of csi-loss-new: %v", err)
+	}
+	reason, err := provisioningPendingReason(pvc, events.Items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("New PVC pending as expected: %s", reason)
+
+	t.Log("Restoring the CSI hostpath plugin")
+	if err := scaleCSIPlugin(t, clientset, 1); err != nil {
+		t.Fatalf("Failed to restore CSI driver: %v", err)
+	}
+	restored = true
+
+	_, err = retry.DoWithRetryE(t, "Wait for csi-loss-new to bind", 36, 5*time.Second, func() (string, error) {
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Get(ctx, "csi-loss-new", metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if pvc.Status.Phase != corev1.ClaimBound {
+			return "", fmt.Errorf("PVC csi-loss-new is %s", pvc.Status.Phase)
+		}
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("Provisioning did not resume after restoring the CSI driver: %v", err)
+	}
+}
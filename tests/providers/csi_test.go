@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProvisioningPendingReason(t *testing.T) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-loss-new"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+	}
+	event := func(object, reason, message string, age time.Duration) corev1.Event {
+		return corev1.Event{
+			InvolvedObject: corev1.ObjectReference{Kind: "PersistentVolumeClaim", Name: object},
+			Reason:         reason,
+			Message:        message,
+			LastTimestamp:  metav1.NewTime(time.Now().Add(-age)),
+		}
+	}
+
+	_, err := provisioningPendingReason(pvc, nil)
+	require.ErrorContains(t, err, "no event explaining why")
+
+	reason, err := provisioningPendingReason(pvc, []corev1.Event{
+		event("csi-loss-new", "Provisioning", "External provisioner is provisioning volume", time.Minute),
+		event("csi-loss-new", "ExternalProvisioning", "Waiting for a volume to be created by the external provisioner 'hostpath.csi.k8s.io'", time.Second),
+		event("other", "ProvisioningSucceeded", "Successfully provisioned volume", 0),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ExternalProvisioning: Waiting for a volume to be created by the external provisioner 'hostpath.csi.k8s.io'", reason)
+
+	pvc.Status.Phase = corev1.ClaimBound
+	_, err = provisioningPendingReason(pvc, nil)
+	require.ErrorContains(t, err, "is Bound while the CSI driver is down")
+}
@@ -0,0 +1,33 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+)
+
+// DevClusterName is the name of the long-lived Kind cluster used for local development
+const DevClusterName = "cnpg-dev"
+
+// NewDevCluster returns the Kind provider for the local development cluster
+func NewDevCluster() *Kind {
+	return NewKind(&Config{
+		Name:              DevClusterName,
+		KubernetesVersion: GetKubernetesVersion(),
+		NodeCount:         GetNodeCount(),
+	})
+}
+
+// AttachToDevCluster returns kubectl options for the running dev cluster without provisioning anything.
+// The test is skipped when the dev cluster is not running; start it with `make dev-cluster`.
+func AttachToDevCluster(t *testing.T) *k8s.KubectlOptions {
+	t.Helper()
+
+	dev := NewDevCluster()
+	if !dev.IsReady(t) {
+		t.Skipf("Dev cluster %s is not running (start it with `make dev-cluster`)", DevClusterName)
+	}
+
+	t.Logf("Attached to dev cluster %s (kubeconfig: %s)", DevClusterName, dev.GetKubeConfigPath())
+	return dev.GetKubectlOptions("")
+}
@@ -1,10 +1,15 @@
 package providers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,6 +17,7 @@ import (
 	"github.com/gruntwork-io/terratest/modules/retry"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"golang.org/x/sync/errgroup"
 )
 
 // EKS implements the Provider interface for AWS EKS
@@ -37,24 +43,94 @@ func NewEKS(config *Config) *EKS {
 	// eks relate terraform information
 	tfDir := findTerraformDir("eks")
 
+	vars := map[string]interface{}{
+		"cluster_name":       config.Name,
+		"region":             config.Region,
+		"kubernetes_version": config.KubernetesVersion,
+		"node_count":         config.NodeCount,
+		"instance_type":      config.InstanceType,
+		"node_arch":          config.NodeArch,
+	}
+	if len(config.NodeGroups) > 0 {
+		vars["node_groups"] = eksNodeGroupVars(config.NodeGroups)
+	}
+
+	// Each cluster keeps its own state and working directory, so parallel runs with different
+	// cluster names never share a terraform.tfstate
+	stateDir := eksStateDir(tfDir, config.Name)
+
 	return &EKS{
 		config:         config,
 		kubeConfigPath: kubeConfigPath,
 		baseTfOpts: &terraform.Options{
-			TerraformDir: tfDir,
-			Vars: map[string]interface{}{
-				"cluster_name":       config.Name,
-				"region":             config.Region,
-				"kubernetes_version": config.KubernetesVersion,
-				"node_count":         config.NodeCount,
-				"instance_type":      config.InstanceType,
-				"node_arch":          config.NodeArch,
-			},
-			NoColor: true,
+			TerraformDir:  tfDir,
+			Vars:          vars,
+			BackendConfig: map[string]interface{}{"path": filepath.Join(stateDir, "terraform.tfstate")},
+			EnvVars:       map[string]string{"TF_DATA_DIR": filepath.Join(stateDir, ".terraform")},
+			NoColor:       true,
 		},
 	}
 }
 
+// eksStateDir is the directory holding the Terraform state of clusterName
+func eksStateDir(tfDir, clusterName string) string {
+	return filepath.Join(tfDir, ".state", clusterName)
+}
+
+// eksTaintEffects maps Kubernetes taint effects to the form the EKS API expects
+var eksTaintEffects = map[string]string{
+	"NoSchedule":       "NO_SCHEDULE",
+	"NoExecute":        "NO_EXECUTE",
+	"PreferNoSchedule": "PREFER_NO_SCHEDULE",
+}
+
+// eksNodeGroupVars converts node groups to the node_groups Terraform variable
+func eksNodeGroupVars(groups []NodeGroup) []map[string]interface{} {
+	vars := make([]map[string]interface{}, 0, len(groups))
+	for _, g := range groups {
+		taints := make([]map[string]interface{}, 0, len(g.Taints))
+		for _, taint := range g.Taints {
+			effect, ok := eksTaintEffects[taint.Effect]
+			if !ok {
+				effect = taint.Effect
+			}
+			taints = append(taints, map[string]interface{}{
+				"key":    taint.Key,
+				"value":  taint.Value,
+				"effect": effect,
+			})
+		}
+
+		group := map[string]interface{}{
+			"name":       g.Name,
+			"node_count": g.Count,
+			"labels":     g.Labels,
+			"taints":     taints,
+		}
+		if g.Labels == nil {
+			group["labels"] = map[string]string{}
+		}
+		if g.InstanceType != "" {
+			group["instance_type"] = g.InstanceType
+		}
+		vars = append(vars, group)
+	}
+	return vars
+}
+
+// expectedNodeCount is the number of nodes across all node groups, matching the node_groups
+// Terraform output
+func (e *EKS) expectedNodeCount() int {
+	if len(e.config.NodeGroups) == 0 {
+		return e.config.NodeCount
+	}
+	total := 0
+	for _, g := range e.config.NodeGroups {
+		total += g.Count
+	}
+	return total
+}
+
 // findTerraformDir locates the terraform/<provider> directory relative to the project root
 func findTerraformDir(provider string) string {
 	dir, err := os.Getwd()
@@ -80,6 +156,11 @@ func (e *EKS) tfOpts(t *testing.T) *terraform.Options {
 	return terraform.WithDefaultRetryableErrors(t, e.baseTfOpts)
 }
 
+// lockPath is the lockfile guarding operations on this cluster, kept beside its Terraform state
+func (e *EKS) lockPath() string {
+	return filepath.Join(eksStateDir(e.baseTfOpts.TerraformDir, e.config.Name), ".lock")
+}
+
 // Name returns the provider name
 func (e *EKS) Name() string {
 	return "eks"
@@ -89,10 +170,16 @@ func (e *EKS) Name() string {
 func (e *EKS) Create(t *testing.T) (retErr error) {
 	t.Helper()
 
+	unlock, err := lockCluster(t, e.lockPath(), e.config.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	t.Logf("Creating EKS cluster: %s in region %s (via Terraform)", e.config.Name, e.config.Region)
 
 	// Initialize and apply Terraform
-	_, err := terraform.InitAndApplyE(t, e.tfOpts(t))
+	_, err = terraform.InitAndApplyE(t, e.tfOpts(t))
 	if err != nil {
 		return fmt.Errorf("terraform apply failed: %w", err)
 	}
@@ -130,9 +217,15 @@ func (e *EKS) Create(t *testing.T) (retErr error) {
 func (e *EKS) Delete(t *testing.T) error {
 	t.Helper()
 
+	unlock, err := lockCluster(t, e.lockPath(), e.config.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	t.Logf("Deleting EKS cluster: %s (via Terraform destroy)", e.config.Name)
 
-	_, err := terraform.DestroyE(t, e.tfOpts(t))
+	_, err = terraform.DestroyE(t, e.tfOpts(t))
 	if err != nil {
 		return fmt.Errorf("terraform destroy failed: %w", err)
 	}
@@ -177,7 +270,11 @@ func waitForEBSCSIPods(t *testing.T, opts *k8s.KubectlOptions) error {
 	return fmt.Errorf("EBS CSI driver pods not ready after 5 minutes")
 }
 
-// applyEKSManifests loads the EKS provider manifests from config and applies them.
+// eksManifestConcurrency bounds how many manifests are applied at once
+const eksManifestConcurrency = 4
+
+// applyEKSManifests loads the EKS provider manifests from config and applies them concurrently,
+// reporting every manifest that failed rather than just the first.
 func applyEKSManifests(t *testing.T, opts *k8s.KubectlOptions) error {
 	t.Helper()
 	cfg, err := config.LoadConfig()
@@ -188,13 +285,39 @@ func applyEKSManifests(t *testing.T, opts *k8s.KubectlOptions) error {
 	if !ok || len(eksDefaults.Manifests) == 0 {
 		return fmt.Errorf("no manifests found for eks provider in versions.yaml")
 	}
-	for _, m := range eksDefaults.Manifests {
+	manifests, err := eksDefaults.ResolvedManifests()
+	if err != nil {
+		return fmt.Errorf("invalid eks manifests: %w", err)
+	}
+	return applyManifestsConcurrently(manifests, eksManifestConcurrency, func(m config.Manifest) error {
 		t.Logf("Applying %s", m.Name)
-		if err := k8s.RunKubectlE(t, opts, "apply", "-f", m.URL); err != nil {
-			return fmt.Errorf("failed to apply %s: %w", m.Name, err)
-		}
+		return applyWithRetry(t, fmt.Sprintf("Apply %s", m.Name), func() error {
+			return k8s.RunKubectlE(t, opts, "apply", "-f", m.URL)
+		})
+	})
+}
+
+// applyManifestsConcurrently runs apply for each manifest with at most limit in flight and
+// joins the errors of all failed manifests
+func applyManifestsConcurrently(manifests []config.Manifest, limit int, apply func(config.Manifest) error) error {
+	var (
+		mu   sync.Mutex
+		errs []error
+		g    errgroup.Group
+	)
+	g.SetLimit(limit)
+	for _, m := range manifests {
+		g.Go(func() error {
+			if err := apply(m); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to apply %s: %w", m.Name, err))
+				mu.Unlock()
+			}
+			return nil
+		})
 	}
-	return nil
+	_ = g.Wait()
+	return errors.Join(errs...)
 }
 
 // InstallCSIDriver verifies the EBS CSI driver (already installed via Terraform addon)
@@ -228,7 +351,10 @@ reclaimPolicy: Delete
 volumeBindingMode: WaitForFirstConsumer
 allowVolumeExpansion: true
 `
-	if err := k8s.KubectlApplyFromStringE(t, opts, storageClass); err != nil {
+	err := applyWithRetry(t, "Create gp3 storage class", func() error {
+		return k8s.KubectlApplyFromStringE(t, opts, storageClass)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to create gp3 storage class: %w", err)
 	}
 
@@ -241,7 +367,10 @@ metadata:
 driver: ebs.csi.aws.com
 deletionPolicy: Delete
 `
-	if err := k8s.KubectlApplyFromStringE(t, opts, snapshotClass); err != nil {
+	err = applyWithRetry(t, "Create volume snapshot class", func() error {
+		return k8s.KubectlApplyFromStringE(t, opts, snapshotClass)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to create volume snapshot class: %w", err)
 	}
 
@@ -250,9 +379,9 @@ deletionPolicy: Delete
 }
 
 // InstallImageValidationPolicy installs the ValidatingAdmissionPolicy to block non-pgEdge images
-func (e *EKS) InstallImageValidationPolicy(t *testing.T) error {
+func (e *EKS) InstallImageValidationPolicy(t *testing.T, validationAction string) error {
 	t.Helper()
-	return installImageValidationPolicy(t, e.GetKubectlOptions(""))
+	return installImageValidationPolicy(t, e.GetKubectlOptions(""), validationAction)
 }
 
 // IsReady checks if the cluster is ready for use
@@ -269,11 +398,106 @@ func (e *EKS) GetClusterName() string {
 	return e.config.Name
 }
 
-// waitForClusterReady waits for the EKS cluster to be fully ready
+// GetKubernetesVersion returns the control plane version from the Terraform state as major.minor,
+// falling back to the API server and then to the configured version
+func (e *EKS) GetKubernetesVersion(t *testing.T) string {
+	t.Helper()
+
+	if out, err := terraform.OutputE(t, e.tfOpts(t), "cluster_version"); err == nil {
+		if version, err := normalizeK8sVersion(out); err == nil {
+			return version
+		}
+	}
+
+	version, err := liveKubernetesVersion(t, e.GetKubectlOptions(""))
+	if err != nil {
+		t.Logf("Warning: %v, using configured version %s", err, e.config.KubernetesVersion)
+		return e.config.KubernetesVersion
+	}
+	return version
+}
+
+// runAWS runs an AWS CLI command and returns its stdout.
+// It is a variable so tests can replace the AWS call.
+var runAWS = func(args ...string) (string, error) {
+	cmd := exec.Command("aws", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("aws %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// capacityIssueCodes are managed node group health issues meaning the requested nodes cannot be
+// launched, as opposed to nodes that are still joining
+var capacityIssueCodes = map[string]bool{
+	"AsgInstanceLaunchFailures": true,
+	"InstanceLimitExceeded":     true,
+	"InsufficientFreeAddresses": true,
+	"Ec2LaunchTemplateNotFound": true,
+}
+
+// errInsufficientCapacity is returned when a node group cannot launch the requested nodes
+var errInsufficientCapacity = errors.New("EKS cannot provide the requested node capacity")
+
+// nodeGroupIssue is an entry of nodegroup.health.issues in `aws eks describe-nodegroup`
+type nodeGroupIssue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// nodeGroupNames returns the EKS names of the managed node groups Terraform creates
+func (e *EKS) nodeGroupNames() []string {
+	if len(e.config.NodeGroups) == 0 {
+		return []string{e.config.Name + "-nodes"}
+	}
+	names := make([]string, 0, len(e.config.NodeGroups))
+	for _, g := range e.config.NodeGroups {
+		names = append(names, e.config.Name+"-"+g.Name)
+	}
+	return names
+}
+
+// checkNodeGroupCapacity returns an error if any node group reports that it cannot launch
+// its instances
+func (e *EKS) checkNodeGroupCapacity() error {
+	var problems []string
+	for _, name := range e.nodeGroupNames() {
+		out, err := runAWS("eks", "describe-nodegroup",
+			"--cluster-name", e.config.Name, "--nodegroup-name", name, "--region", e.config.Region,
+			"--query", "nodegroup.health.issues", "--output", "json")
+		if err != nil {
+			return err
+		}
+
+		var issues []nodeGroupIssue
+		if err := json.Unmarshal([]byte(out), &issues); err != nil {
+			return fmt.Errorf("failed to parse health of node group %s: %w", name, err)
+		}
+		for _, issue := range issues {
+			if capacityIssueCodes[issue.Code] {
+				problems = append(problems, fmt.Sprintf("%s: %s: %s", name, issue.Code, issue.Message))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n%s", errInsufficientCapacity, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// waitForClusterReady waits until every node of every managed node group has joined and is
+// ready. The node_groups Terraform output lists the desired size of each group.
 func (e *EKS) waitForClusterReady(t *testing.T, timeout time.Duration) error {
 	t.Helper()
 
 	opts := e.GetKubectlOptions("")
+	expected := e.expectedNodeCount()
+	if groups, err := terraform.OutputMapE(t, e.tfOpts(t), "node_groups"); err == nil {
+		t.Logf("EKS node groups: %v", groups)
+	}
 
 	maxRetries := int(timeout.Seconds() / 10)
 	_, err := retry.DoWithRetryE(t, "Wait for EKS nodes ready", maxRetries, 10*time.Second, func() (string, error) {
@@ -282,8 +506,14 @@ func (e *EKS) waitForClusterReady(t *testing.T, timeout time.Duration) error {
 			return "", fmt.Errorf("failed to get nodes: %w", getErr)
 		}
 
-		if len(nodes) == 0 {
-			return "", fmt.Errorf("no nodes found")
+		if len(nodes) < expected {
+			// Stop waiting if the missing nodes can never be launched
+			if err := e.checkNodeGroupCapacity(); errors.Is(err, errInsufficientCapacity) {
+				return "", retry.FatalError{Underlying: err}
+			} else if err != nil {
+				t.Logf("Warning: could not check node group health: %v", err)
+			}
+			return "", fmt.Errorf("%d of %d nodes joined", len(nodes), expected)
 		}
 
 		for _, node := range nodes {
@@ -295,5 +525,9 @@ func (e *EKS) waitForClusterReady(t *testing.T, timeout time.Duration) error {
 		return "All nodes ready", nil
 	})
 
+	var fatalErr retry.FatalError
+	if errors.As(err, &fatalErr) {
+		return fatalErr.Underlying
+	}
 	return err
 }
@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEKSNodeGroups(t *testing.T) {
+	// Without node groups the single default group comes from node_count and instance_type
+	eks := NewEKS(&Config{Name: "cnpg-eks", InstanceType: "m5.large"})
+	require.NotContains(t, eks.baseTfOpts.Vars, "node_groups")
+	require.Equal(t, 3, eks.baseTfOpts.Vars["node_count"])
+	require.Equal(t, 3, eks.expectedNodeCount())
+
+	eks = NewEKS(&Config{
+		Name:         "cnpg-eks",
+		InstanceType: "m5.large",
+		NodeGroups: []NodeGroup{
+			{Name: "system", Count: 2},
+			{
+				Name:         "postgres",
+				InstanceType: "r6i.xlarge",
+				Count:        3,
+				Labels:       map[string]string{"workload": "postgres"},
+				Taints:       []Taint{{Key: "workload", Value: "postgres", Effect: "NoSchedule"}},
+			},
+		},
+	})
+	require.Equal(t, 5, eks.expectedNodeCount())
+	require.Equal(t, []map[string]interface{}{
+		{
+			"name":       "system",
+			"node_count": 2,
+			"labels":     map[string]string{},
+			"taints":     []map[string]interface{}{},
+		},
+		{
+			"name":          "postgres",
+			"instance_type": "r6i.xlarge",
+			"node_count":    3,
+			"labels":        map[string]string{"workload": "postgres"},
+			"taints": []map[string]interface{}{
+				{"key": "workload", "value": "postgres", "effect": "NO_SCHEDULE"},
+			},
+		},
+	}, eks.baseTfOpts.Vars["node_groups"])
+}
+
+func TestNewEKSStatePerCluster(t *testing.T) {
+	a := NewEKS(&Config{Name: "cnpg-a"})
+	b := NewEKS(&Config{Name: "cnpg-b"})
+
+	require.Equal(t, a.baseTfOpts.TerraformDir, b.baseTfOpts.TerraformDir)
+	require.NotEqual(t, a.baseTfOpts.BackendConfig["path"], b.baseTfOpts.BackendConfig["path"])
+	require.NotEqual(t, a.baseTfOpts.EnvVars["TF_DATA_DIR"], b.baseTfOpts.EnvVars["TF_DATA_DIR"])
+	require.NotEqual(t, a.lockPath(), b.lockPath())
+	require.Equal(t, filepath.Dir(a.baseTfOpts.BackendConfig["path"].(string)), filepath.Dir(a.lockPath()))
+}
+
+func TestCheckNodeGroupCapacity(t *testing.T) {
+	health := map[string]string{
+		"cnpg-eks-system":   `[]`,
+		"cnpg-eks-postgres": `[{"code":"AsgInstanceLaunchFailures","message":"Could not launch Spot Instances. InsufficientInstanceCapacity","resourceIds":["eks-postgres-asg"]}]`,
+	}
+	var called []string
+	orig := runAWS
+	runAWS = func(args ...string) (string, error) {
+		name := args[5]
+		called = append(called, name)
+		return health[name], nil
+	}
+	t.Cleanup(func() { runAWS = orig })
+
+	eks := NewEKS(&Config{Name: "cnpg-eks", NodeGroups: []NodeGroup{{Name: "system", Count: 2}, {Name: "postgres", Count: 3}}})
+	err := eks.checkNodeGroupCapacity()
+	require.ErrorIs(t, err, errInsufficientCapacity)
+	require.ErrorContains(t, err, "cnpg-eks-postgres: AsgInstanceLaunchFailures: Could not launch Spot Instances")
+	require.Equal(t, []string{"cnpg-eks-system", "cnpg-eks-postgres"}, called)
+
+	// Issues unrelated to capacity keep the wait going
+	health["cnpg-eks-postgres"] = `[{"code":"NodeCreationFailure","message":"Instances failed to join the kubernetes cluster"}]`
+	require.NoError(t, eks.checkNodeGroupCapacity())
+
+	called = nil
+	eks = NewEKS(&Config{Name: "cnpg-eks"})
+	health["cnpg-eks-nodes"] = `[]`
+	require.NoError(t, eks.checkNodeGroupCapacity())
+	require.Equal(t, []string{"cnpg-eks-nodes"}, called)
+}
+
+func TestApplyManifestsConcurrently(t *testing.T) {
+	manifests := []config.Manifest{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	var inFlight, peak atomic.Int32
+	err := applyManifestsConcurrently(manifests, 2, func(m config.Manifest) error {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if m.Name == "b" || m.Name == "d" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	require.LessOrEqual(t, peak.Load(), int32(2))
+	require.ErrorContains(t, err, "failed to apply b: boom")
+	require.ErrorContains(t, err, "failed to apply d: boom")
+
+	require.NoError(t, applyManifestsConcurrently(manifests, 2, func(config.Manifest) error { return nil }))
+}
@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+)
+
+// ErrUnsupported is returned when a provider cannot simulate the requested fault
+var ErrUnsupported = errors.New("not supported by this provider")
+
+// runDocker runs a docker command and returns its trimmed output.
+// It is a variable so tests can replace the Docker call.
+var runDocker = func(args ...string) (string, error) {
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("docker %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// pauseContainer freezes a container for duration and always unpauses it afterwards
+func pauseContainer(container string, duration time.Duration) error {
+	if _, err := runDocker("pause", container); err != nil {
+		return err
+	}
+	time.Sleep(duration)
+	_, err := runDocker("unpause", container)
+	return err
+}
+
+// SimulateAPIServerBlip makes the API server unavailable for duration and waits for it to come
+// back. On Kind the control-plane container is paused; other providers return ErrUnsupported.
+func SimulateAPIServerBlip(t *testing.T, provider Provider, duration time.Duration) error {
+	t.Helper()
+
+	if _, ok := provider.(*Kind); !ok {
+		return fmt.Errorf("API server blip on %s: %w", provider.Name(), ErrUnsupported)
+	}
+
+	container := provider.GetClusterName() + "-control-plane"
+	t.Logf("Pausing %s for %s", container, duration)
+	if err := pauseContainer(container, duration); err != nil {
+		return fmt.Errorf("failed to pause control plane: %w", err)
+	}
+
+	opts := provider.GetKubectlOptions("")
+	_, err := retry.DoWithRetryE(t, "Wait for API server", 24, 5*time.Second, func() (string, error) {
+		if _, err := k8s.GetNodesE(t, opts); err != nil {
+			return "", err
+		}
+		return "API server reachable", nil
+	})
+	if err != nil {
+		return fmt.Errorf("API server did not recover after blip: %w", err)
+	}
+	return nil
+}
+
+// NodeAddress returns the IP address of a Kind node container on the Docker network, which is
+// reachable from the host without going through the API server
+func (p *Kind) NodeAddress(nodeName string) (string, error) {
+	addr, err := runDocker("inspect", "--format", "{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}", nodeName)
+	if err != nil {
+		return "", err
+	}
+	if addr == "" {
+		return "", fmt.Errorf("node %s has no IP address", nodeName)
+	}
+	return addr, nil
+}
@@ -0,0 +1,36 @@
+package providers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateAPIServerBlipUnsupported(t *testing.T) {
+	err := SimulateAPIServerBlip(t, &EKS{}, time.Second)
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestPauseContainer(t *testing.T) {
+	var calls []string
+	orig := runDocker
+	runDocker = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return "", nil
+	}
+	defer func() { runDocker = orig }()
+
+	require.NoError(t, pauseContainer("cnpg-test-control-plane", 0))
+	require.Equal(t, []string{"pause cnpg-test-control-plane", "unpause cnpg-test-control-plane"}, calls)
+
+	calls = nil
+	runDocker = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return "", errors.New("no such container")
+	}
+	require.Error(t, pauseContainer("missing", 0))
+	require.Equal(t, []string{"pause missing"}, calls)
+}
@@ -0,0 +1,262 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+)
+
+// runK3d runs a k3d command and returns its stdout.
+// It is a variable so tests can replace the CLI call.
+var runK3d = func(args ...string) (string, error) {
+	cmd := exec.Command("k3d", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("k3d %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// K3d implements the Provider interface for k3d (k3s in Docker) clusters
+type K3d struct {
+	config *Config
+	image  string
+	// imageErr is returned by Create when no k3s image matches the requested version
+	imageErr       error
+	kubeConfigPath string
+}
+
+// NewK3d creates a new k3d provider. The k3s image comes from the k3d provider defaults in
+// versions.yaml when it matches KubernetesVersion, otherwise from the requested patch version.
+func NewK3d(config *Config) *K3d {
+	var configured string
+	if cfg, err := loadK3dDefaults(); err == nil {
+		configured = cfg.Image
+	}
+	image, err := k3sImage(configured, config.KubernetesVersion)
+
+	return &K3d{
+		config:         config,
+		image:          image,
+		imageErr:       err,
+		kubeConfigPath: filepath.Join(os.TempDir(), fmt.Sprintf("%s.kubeconfig", config.Name)),
+	}
+}
+
+// k3sImage returns the k3s image for the requested Kubernetes version. The configured image is
+// used when it runs that minor version. A requested patch version (e.g. 1.34.2) maps to its
+// rancher/k3s release; a minor version the configured image does not run is an error, since the
+// k3s patch release cannot be guessed.
+func k3sImage(configured, version string) (string, error) {
+	if version == "" {
+		return configured, nil
+	}
+	version = strings.TrimPrefix(version, "v")
+	parts := strings.Split(version, ".")
+	minor := strings.Join(parts[:min(len(parts), 2)], ".")
+	if configured != "" && extractK8sVersion(configured) == minor {
+		// A bare minor version, or exactly the patch release of the configured image
+		if len(parts) < 3 || strings.Contains(configured, ":v"+version+"-") {
+			return configured, nil
+		}
+	}
+	if len(parts) == 3 {
+		return fmt.Sprintf("rancher/k3s:v%s-k3s1", version), nil
+	}
+	if configured == "" {
+		return "", fmt.Errorf("no k3s image configured for Kubernetes %s, set the k3d image in versions.yaml or request a patch version such as %s.0", version, version)
+	}
+	return "", fmt.Errorf("k3s image %s does not run the requested Kubernetes %s, set a matching k3d image in versions.yaml or request a patch version such as %s.0",
+		configured, version, version)
+}
+
+// loadK3dDefaults returns the k3d section of provider_defaults
+func loadK3dDefaults() (config.ProviderDefaults, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return config.ProviderDefaults{}, err
+	}
+	defaults, ok := cfg.ProviderDefaults["k3d"]
+	if !ok {
+		return config.ProviderDefaults{}, fmt.Errorf("no k3d provider defaults found in versions.yaml")
+	}
+	return defaults, nil
+}
+
+// createArgs returns the k3d arguments that create the cluster: one server plus NodeCount-1
+// agents, without Traefik and without touching the user's default kubeconfig
+func (p *K3d) createArgs() []string {
+	agents := p.config.NodeCount - 1
+	if agents < 0 {
+		agents = 0
+	}
+
+	args := []string{
+		"cluster", "create", p.config.Name,
+		"--agents", strconv.Itoa(agents),
+		"--k3s-arg", "--disable=traefik@server:*",
+		"--kubeconfig-update-default=false",
+		"--kubeconfig-switch-context=false",
+		"--wait",
+		"--timeout", "5m",
+	}
+	if p.image != "" {
+		args = append(args, "--image", p.image)
+	}
+	return args
+}
+
+// Name returns the provider name
+func (p *K3d) Name() string {
+	return "k3d"
+}
+
+// Create provisions the k3d cluster and writes its kubeconfig
+func (p *K3d) Create(t *testing.T) error {
+	t.Helper()
+
+	if p.imageErr != nil {
+		return p.imageErr
+	}
+	t.Logf("Creating k3d cluster: %s", p.config.Name)
+
+	if p.exists() {
+		t.Logf("k3d cluster %s already exists, deleting first", p.config.Name)
+		if err := p.Delete(t); err != nil {
+			return fmt.Errorf("failed to delete existing cluster: %w", err)
+		}
+	}
+
+	if _, err := runK3d(p.createArgs()...); err != nil {
+		return fmt.Errorf("failed to create k3d cluster: %w", err)
+	}
+
+	kubeconfig, err := runK3d("kubeconfig", "get", p.config.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+	if err := os.WriteFile(p.kubeConfigPath, []byte(kubeconfig), 0o600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+
+	t.Logf("k3d cluster %s created successfully", p.config.Name)
+	return nil
+}
+
+// exists reports whether a k3d cluster with this name is present
+func (p *K3d) exists() bool {
+	_, err := runK3d("cluster", "get", p.config.Name)
+	return err == nil
+}
+
+// Delete destroys the k3d cluster
+func (p *K3d) Delete(t *testing.T) error {
+	t.Helper()
+
+	t.Logf("Deleting k3d cluster: %s", p.config.Name)
+
+	if _, err := runK3d("cluster", "delete", p.config.Name); err != nil {
+		return fmt.Errorf("failed to delete cluster: %w", err)
+	}
+
+	if err := os.Remove(p.kubeConfigPath); err != nil && !os.IsNotExist(err) {
+		t.Logf("Warning: failed to remove kubeconfig: %v", err)
+	}
+
+	t.Logf("k3d cluster %s deleted successfully", p.config.Name)
+	return nil
+}
+
+// GetKubeConfigPath returns the path to the kubeconfig file
+func (p *K3d) GetKubeConfigPath() string {
+	return p.kubeConfigPath
+}
+
+// GetKubectlOptions returns kubectl options for the cluster
+func (p *K3d) GetKubectlOptions(namespace string) *k8s.KubectlOptions {
+	return k8s.NewKubectlOptions("", p.kubeConfigPath, namespace)
+}
+
+// InstallCSIDriver installs the CSI hostpath driver with the same classes as Kind
+// (csi-hostpath-sc and csi-hostpath-snapclass)
+func (p *K3d) InstallCSIDriver(t *testing.T) error {
+	t.Helper()
+
+	t.Log("Installing CSI hostpath driver")
+
+	opts := p.GetKubectlOptions("")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	manifests, err := resolveCSIManifests(t, cfg, p.GetKubernetesVersion(t))
+	if err != nil {
+		return err
+	}
+
+	if err := applyCSIManifests(t, opts, manifests); err != nil {
+		return err
+	}
+
+	if err := applyKindStorageClass(t, opts); err != nil {
+		return err
+	}
+
+	if err := applyKindSnapshotClass(t, opts); err != nil {
+		return err
+	}
+
+	t.Log("Waiting for CSI driver pods to be ready")
+	if err := waitForCSIPods(t, opts); err != nil {
+		return err
+	}
+
+	t.Log("CSI hostpath driver installed successfully")
+	return nil
+}
+
+// InstallImageValidationPolicy installs the pgEdge image validation policy
+func (p *K3d) InstallImageValidationPolicy(t *testing.T, validationAction string) error {
+	t.Helper()
+	return installImageValidationPolicy(t, p.GetKubectlOptions(""), validationAction)
+}
+
+// IsReady checks if the cluster is ready
+func (p *K3d) IsReady(t *testing.T) bool {
+	t.Helper()
+
+	if _, err := os.Stat(p.kubeConfigPath); err != nil {
+		return false
+	}
+	_, err := k8s.GetNodesE(t, p.GetKubectlOptions(""))
+	return err == nil
+}
+
+// GetClusterName returns the cluster name
+func (p *K3d) GetClusterName() string {
+	return p.config.Name
+}
+
+// GetKubernetesVersion returns the cluster's Kubernetes version as major.minor, falling back to
+// the configured version if the API server cannot be queried
+func (p *K3d) GetKubernetesVersion(t *testing.T) string {
+	t.Helper()
+
+	version, err := liveKubernetesVersion(t, p.GetKubectlOptions(""))
+	if err != nil {
+		t.Logf("Warning: %v, using configured version %s", err, p.config.KubernetesVersion)
+		return p.config.KubernetesVersion
+	}
+	return version
+}
@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestK3dCreateArgs(t *testing.T) {
+	p := &K3d{config: &Config{Name: "cnpg-k3d", NodeCount: 3}}
+	require.Equal(t, []string{
+		"cluster", "create", "cnpg-k3d",
+		"--agents", "2",
+		"--k3s-arg", "--disable=traefik@server:*",
+		"--kubeconfig-update-default=false",
+		"--kubeconfig-switch-context=false",
+		"--wait",
+		"--timeout", "5m",
+	}, p.createArgs())
+
+	p = &K3d{config: &Config{Name: "single", NodeCount: 1}, image: "rancher/k3s:v1.33.1-k3s1"}
+	args := p.createArgs()
+	require.Contains(t, args, "0")
+	require.Equal(t, []string{"--image", "rancher/k3s:v1.33.1-k3s1"}, args[len(args)-2:])
+}
+
+func TestK3sImage(t *testing.T) {
+	const configured = "rancher/k3s:v1.33.1-k3s1"
+	for _, tc := range []struct {
+		configured, version, image, err string
+	}{
+		{configured: configured, version: "", image: configured},
+		{configured: configured, version: "1.33", image: configured},
+		{configured: configured, version: "v1.33.1", image: configured},
+		{configured: configured, version: "1.33.4", image: "rancher/k3s:v1.33.4-k3s1"},
+		{configured: configured, version: "1.34.2", image: "rancher/k3s:v1.34.2-k3s1"},
+		{configured: "", version: "1.34.2", image: "rancher/k3s:v1.34.2-k3s1"},
+		{configured: configured, version: "1.34", err: "does not run the requested Kubernetes 1.34"},
+		{configured: "", version: "1.34", err: "no k3s image configured for Kubernetes 1.34"},
+	} {
+		image, err := k3sImage(tc.configured, tc.version)
+		if tc.err != "" {
+			require.ErrorContains(t, err, tc.err, "version %q", tc.version)
+			continue
+		}
+		require.NoError(t, err, "version %q", tc.version)
+		require.Equal(t, tc.image, image, "version %q", tc.version)
+	}
+}
+
+func TestK3dCreateFailsOnVersionMismatch(t *testing.T) {
+	called := false
+	orig := runK3d
+	runK3d = func(args ...string) (string, error) {
+		called = true
+		return "", nil
+	}
+	defer func() { runK3d = orig }()
+
+	p := &K3d{config: &Config{Name: "cnpg-k3d"}, imageErr: errors.New("k3s image mismatch")}
+	require.ErrorContains(t, p.Create(t), "k3s image mismatch")
+	require.False(t, called)
+}
+
+var errNotFound = errors.New("cluster not found")
+
+func TestK3dCreateWritesKubeconfig(t *testing.T) {
+	var calls [][]string
+	orig := runK3d
+	runK3d = func(args ...string) (string, error) {
+		calls = append(calls, args)
+		switch args[0] + " " + args[1] {
+		case "cluster get":
+			return "", errNotFound
+		case "kubeconfig get":
+			return "apiVersion: v1\nkind: Config\n", nil
+		}
+		return "", nil
+	}
+	defer func() { runK3d = orig }()
+
+	p := &K3d{config: &Config{Name: "cnpg-k3d", NodeCount: 2}, kubeConfigPath: t.TempDir() + "/k3d.kubeconfig"}
+	require.NoError(t, p.Create(t))
+
+	require.Len(t, calls, 3)
+	require.Equal(t, []string{"cluster", "create", "cnpg-k3d"}, calls[1][:3])
+	require.FileExists(t, p.GetKubeConfigPath())
+}
@@ -3,8 +3,10 @@ package providers
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,6 +34,94 @@ type kindConfig struct {
 	ServiceSubnet string
 	PodSubnet     string
 	ConfigPath    string
+	Proxy         config.ProxyConfig
+	ExtraMounts   []Mount
+	PortMappings  []PortMapping
+}
+
+// containerdProxyDropInPath is where the proxy drop-in is mounted in each Kind node
+const containerdProxyDropInPath = "/etc/systemd/system/containerd.service.d/http-proxy.conf"
+
+// noProxy returns the configured NO_PROXY extended with the cluster-internal destinations that
+// must never go through the proxy
+func (c *kindConfig) noProxy() string {
+	return c.Proxy.WithClusterNoProxy(c.ServiceSubnet, c.PodSubnet).NoProxy
+}
+
+// containerdProxyDropIn renders a systemd drop-in that makes containerd pull images through the proxy
+func (c *kindConfig) containerdProxyDropIn() string {
+	var b strings.Builder
+	b.WriteString("[Service]\n")
+	if c.Proxy.HTTPProxy != "" {
+		fmt.Fprintf(&b, "Environment=\"HTTP_PROXY=%s\"\n", c.Proxy.HTTPProxy)
+	}
+	if c.Proxy.HTTPSProxy != "" {
+		fmt.Fprintf(&b, "Environment=\"HTTPS_PROXY=%s\"\n", c.Proxy.HTTPSProxy)
+	}
+	fmt.Fprintf(&b, "Environment=\"NO_PROXY=%s\"\n", c.noProxy())
+	return b.String()
+}
+
+// buildKindClusterConfig returns the Kind cluster definition. When proxyDropIn is set it is
+// mounted into every node as a containerd drop-in so image pulls honor the proxy. The extra
+// mounts are added to every node as well, the port mappings only to the control plane.
+// containerd reads registry hosts from containerdCertsDir so a local registry can be added later.
+func buildKindClusterConfig(c *kindConfig, proxyDropIn string) *v1alpha4.Cluster {
+	kindConfig := &v1alpha4.Cluster{
+		Networking: v1alpha4.Networking{
+			ServiceSubnet: c.ServiceSubnet,
+			PodSubnet:     c.PodSubnet,
+		},
+		ContainerdConfigPatches: []string{containerdRegistryConfigPatch},
+	}
+
+	var mounts []v1alpha4.Mount
+	if proxyDropIn != "" {
+		mounts = append(mounts, v1alpha4.Mount{
+			HostPath:      proxyDropIn,
+			ContainerPath: containerdProxyDropInPath,
+			Readonly:      true,
+		})
+	}
+	for _, m := range c.ExtraMounts {
+		mounts = append(mounts, v1alpha4.Mount{
+			HostPath:      m.HostPath,
+			ContainerPath: m.ContainerPath,
+			Readonly:      m.ReadOnly,
+		})
+	}
+
+	var portMappings []v1alpha4.PortMapping
+	for _, pm := range c.PortMappings {
+		protocol := v1alpha4.PortMappingProtocolTCP
+		if pm.Protocol != "" {
+			protocol = v1alpha4.PortMappingProtocol(strings.ToUpper(pm.Protocol))
+		}
+		portMappings = append(portMappings, v1alpha4.PortMapping{
+			ContainerPort: pm.ContainerPort,
+			HostPort:      pm.HostPort,
+			Protocol:      protocol,
+		})
+	}
+
+	// Add control plane node
+	kindConfig.Nodes = append(kindConfig.Nodes, v1alpha4.Node{
+		Role:              v1alpha4.ControlPlaneRole,
+		Image:             c.Image,
+		ExtraMounts:       mounts,
+		ExtraPortMappings: portMappings,
+	})
+
+	// Add worker nodes (NodeCount - 1 since we already have control plane)
+	for i := 1; i < c.Nodes; i++ {
+		kindConfig.Nodes = append(kindConfig.Nodes, v1alpha4.Node{
+			Role:        v1alpha4.WorkerRole,
+			Image:       c.Image,
+			ExtraMounts: mounts,
+		})
+	}
+
+	return kindConfig
 }
 
 // newKindCluster creates a new Kind cluster
@@ -79,32 +169,22 @@ func (kc *kindCluster) Create(t *testing.T) error {
 		}
 	}
 
+	var proxyDropIn string
+	if kc.Config.Proxy.Enabled() {
+		proxyDropIn = filepath.Join(os.TempDir(), fmt.Sprintf("%s-containerd-proxy.conf", kc.Name))
+		if err := os.WriteFile(proxyDropIn, []byte(kc.Config.containerdProxyDropIn()), 0o644); err != nil {
+			return fmt.Errorf("failed to write containerd proxy drop-in: %w", err)
+		}
+		t.Logf("Kind nodes will pull images through proxy (NO_PROXY=%s)", kc.Config.noProxy())
+	}
+
 	// Retry cluster creation with backoff
 	maxRetries := 3
 	timeBetweenRetries := 10 * time.Second
 
 	_, err = retry.DoWithRetryE(t, "Create Kind cluster", maxRetries, timeBetweenRetries, func() (string, error) {
 		// Build Kind cluster configuration with multiple nodes
-		kindConfig := &v1alpha4.Cluster{
-			Networking: v1alpha4.Networking{
-				ServiceSubnet: kc.Config.ServiceSubnet,
-				PodSubnet:     kc.Config.PodSubnet,
-			},
-		}
-
-		// Add control plane node
-		kindConfig.Nodes = append(kindConfig.Nodes, v1alpha4.Node{
-			Role:  v1alpha4.ControlPlaneRole,
-			Image: kc.Config.Image,
-		})
-
-		// Add worker nodes (NodeCount - 1 since we already have control plane)
-		for i := 1; i < kc.Config.Nodes; i++ {
-			kindConfig.Nodes = append(kindConfig.Nodes, v1alpha4.Node{
-				Role:  v1alpha4.WorkerRole,
-				Image: kc.Config.Image,
-			})
-		}
+		kindConfig := buildKindClusterConfig(kc.Config, proxyDropIn)
 
 		// Create cluster with retry logic
 		createErr := kc.Provider.Create(
@@ -153,6 +233,11 @@ func (kc *kindCluster) Delete(t *testing.T) error {
 	if err := os.Remove(kc.KubeConfigPath); err != nil && !os.IsNotExist(err) {
 		t.Logf("Warning: failed to remove kubeconfig: %v", err)
 	}
+	_ = os.Remove(filepath.Join(os.TempDir(), fmt.Sprintf("%s-containerd-proxy.conf", kc.Name)))
+
+	if err := kc.deleteLocalRegistry(); err != nil {
+		t.Logf("Warning: failed to remove local registry: %v", err)
+	}
 
 	t.Logf("Kind cluster %s deleted successfully", kc.Name)
 	return nil
@@ -218,8 +303,8 @@ func (kc *kindCluster) waitForClusterReady(t *testing.T, timeout time.Duration)
 	return nil
 }
 
-// resolveCSIManifests returns the CSI manifests for the given K8s version,
-// falling back to the configured default version if an exact match is not found.
+// resolveCSIManifests returns the CSI manifests for the given K8s version, falling back to the
+// configured default version if an exact match is not found, with placeholders filled in.
 func resolveCSIManifests(t *testing.T, cfg *config.Config, k8sVersion string) ([]config.Manifest, error) {
 	t.Helper()
 	kindDefaults, ok := cfg.ProviderDefaults["kind"]
@@ -237,7 +322,7 @@ func resolveCSIManifests(t *testing.T, cfg *config.Config, k8sVersion string) ([
 	if len(entry.Manifests) == 0 {
 		return nil, fmt.Errorf("no manifests found for K8s version %s", k8sVersion)
 	}
-	return entry.Manifests, nil
+	return kindDefaults.ResolveManifests(entry.Manifests)
 }
 
 // applyCSIManifests applies each manifest URL via kubectl apply.
@@ -245,7 +330,10 @@ func applyCSIManifests(t *testing.T, opts *k8s.KubectlOptions, manifests []confi
 	t.Helper()
 	for _, m := range manifests {
 		t.Logf("Applying %s", m.Name)
-		if err := k8s.RunKubectlE(t, opts, "apply", "-f", m.URL); err != nil {
+		err := applyWithRetry(t, fmt.Sprintf("Apply %s", m.Name), func() error {
+			return k8s.RunKubectlE(t, opts, "apply", "-f", m.URL)
+		})
+		if err != nil {
 			return fmt.Errorf("failed to apply %s: %w", m.Name, err)
 		}
 	}
@@ -283,7 +371,10 @@ reclaimPolicy: Delete
 volumeBindingMode: Immediate
 allowVolumeExpansion: true
 `
-	if err := k8s.KubectlApplyFromStringE(t, opts, manifest); err != nil {
+	err := applyWithRetry(t, "Create storage class", func() error {
+		return k8s.KubectlApplyFromStringE(t, opts, manifest)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to create storage class: %w", err)
 	}
 	return nil
@@ -303,7 +394,10 @@ deletionPolicy: Delete
 parameters:
   ignoreFailedRead: "true"
 `
-	if err := k8s.KubectlApplyFromStringE(t, opts, manifest); err != nil {
+	err := applyWithRetry(t, "Create snapshot class", func() error {
+		return k8s.KubectlApplyFromStringE(t, opts, manifest)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to create snapshot class: %w", err)
 	}
 	return nil
@@ -322,7 +416,7 @@ func (kc *kindCluster) InstallCSIDriver(t *testing.T) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	k8sVersion := extractK8sVersion(kc.Config.Image)
+	k8sVersion := kc.kubernetesVersion(t)
 	t.Logf("Using K8s version %s", k8sVersion)
 
 	manifests, err := resolveCSIManifests(t, cfg, k8sVersion)
@@ -352,9 +446,22 @@ func (kc *kindCluster) InstallCSIDriver(t *testing.T) error {
 }
 
 // InstallImageValidationPolicy installs the ValidatingAdmissionPolicy to block non-pgEdge images
-func (kc *kindCluster) InstallImageValidationPolicy(t *testing.T) error {
+func (kc *kindCluster) InstallImageValidationPolicy(t *testing.T, validationAction string) error {
 	t.Helper()
-	return installImageValidationPolicy(t, kc.GetKubectlOptions(""))
+	return installImageValidationPolicy(t, kc.GetKubectlOptions(""), validationAction)
+}
+
+// kubernetesVersion returns the major.minor version reported by the API server, falling back to
+// the version in the node image name if the server cannot be queried
+func (kc *kindCluster) kubernetesVersion(t *testing.T) string {
+	t.Helper()
+
+	version, err := liveKubernetesVersion(t, kc.GetKubectlOptions(""))
+	if err != nil {
+		t.Logf("Warning: %v, using the version from node image %s", err, kc.Config.Image)
+		return extractK8sVersion(kc.Config.Image)
+	}
+	return version
 }
 
 // extractK8sVersion extracts the major.minor version from a Kind node image name
@@ -373,27 +480,32 @@ func extractK8sVersion(image string) string {
 type Kind struct {
 	cluster *kindCluster
 	config  *Config
+	// registryHost is set once CreateLocalRegistry has started the cluster's registry
+	registryHost string
 }
 
 // NewKind creates a new Kind provider
-func NewKind(config *Config) *Kind {
+func NewKind(cfg *Config) *Kind {
 	// Determine Kind node image based on K8s version
-	kindImage := fmt.Sprintf("kindest/node:v%s.0", config.KubernetesVersion)
-	if config.KubernetesVersion == "" {
+	kindImage := fmt.Sprintf("kindest/node:v%s.0", cfg.KubernetesVersion)
+	if cfg.KubernetesVersion == "" {
 		kindImage = "kindest/node:v1.32.0" // Default
 	}
 
 	kindConfig := &kindConfig{
-		Name:          config.Name,
+		Name:          cfg.Name,
 		Image:         kindImage,
-		Nodes:         config.NodeCount,
+		Nodes:         cfg.NodeCount,
 		ServiceSubnet: "10.21.0.0/16",
 		PodSubnet:     "10.20.0.0/16",
+		Proxy:         config.LoadProxyConfig(),
+		ExtraMounts:   cfg.ExtraMounts,
+		PortMappings:  cfg.PortMappings,
 	}
 
 	return &Kind{
 		cluster: newKindCluster(nil, kindConfig),
-		config:  config,
+		config:  cfg,
 	}
 }
 
@@ -402,15 +514,32 @@ func (p *Kind) Name() string {
 	return "kind"
 }
 
+// lockPath is the lockfile guarding operations on this cluster, shared by every process on the host
+func (p *Kind) lockPath() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("pgedge-cnpg-kind-%s.lock", p.config.Name))
+}
+
 // Create provisions the Kind cluster
 func (p *Kind) Create(t *testing.T) error {
 	t.Helper()
+
+	unlock, err := lockCluster(t, p.lockPath(), p.config.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	return p.cluster.Create(t)
 }
 
 // Delete destroys the Kind cluster
 func (p *Kind) Delete(t *testing.T) error {
 	t.Helper()
+
+	unlock, err := lockCluster(t, p.lockPath(), p.config.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	return p.cluster.Delete(t)
 }
 
@@ -431,9 +560,9 @@ func (p *Kind) InstallCSIDriver(t *testing.T) error {
 }
 
 // InstallImageValidationPolicy installs the pgEdge image validation policy
-func (p *Kind) InstallImageValidationPolicy(t *testing.T) error {
+func (p *Kind) InstallImageValidationPolicy(t *testing.T, validationAction string) error {
 	t.Helper()
-	return p.cluster.InstallImageValidationPolicy(t)
+	return p.cluster.InstallImageValidationPolicy(t, validationAction)
 }
 
 // IsReady checks if the cluster is ready
@@ -449,3 +578,81 @@ func (p *Kind) IsReady(t *testing.T) bool {
 func (p *Kind) GetClusterName() string {
 	return p.cluster.Name
 }
+
+// GetKubernetesVersion returns the cluster's Kubernetes version as major.minor
+func (p *Kind) GetKubernetesVersion(t *testing.T) string {
+	t.Helper()
+	return p.cluster.kubernetesVersion(t)
+}
+
+// kindContainerCreatedAt returns the creation time of a Kind node container.
+// It is a variable so tests can replace the Docker call.
+var kindContainerCreatedAt = func(containerName string) (time.Time, error) {
+	out, err := exec.Command("docker", "inspect", "--format", "{{.Created}}", containerName).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to inspect container %s: %w", containerName, err)
+	}
+	created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse creation time of container %s: %w", containerName, err)
+	}
+	return created, nil
+}
+
+// staleKindClusters returns the clusters matching prefix whose control-plane container
+// was created more than olderThan before now. Clusters whose age cannot be determined are skipped.
+func staleKindClusters(clusters []string, prefix string, olderThan time.Duration, now time.Time) []string {
+	var stale []string
+	for _, name := range clusters {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		created, err := kindContainerCreatedAt(name + "-control-plane")
+		if err != nil {
+			continue
+		}
+		if now.Sub(created) > olderThan {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// CleanupStaleKindClusters deletes Kind clusters left behind by interrupted runs.
+// Only clusters whose name starts with prefix and whose control-plane container is
+// older than olderThan are removed. t may be nil when called from TestMain.
+func CleanupStaleKindClusters(t *testing.T, prefix string, olderThan time.Duration) error {
+	if t != nil {
+		t.Helper()
+	}
+
+	logf := func(format string, args ...interface{}) {
+		if t != nil {
+			t.Logf(format, args...)
+			return
+		}
+		fmt.Printf(format+"\n", args...)
+	}
+
+	provider := cluster.NewProvider(
+		cluster.ProviderWithLogger(cmd.NewLogger()),
+	)
+
+	clusters, err := provider.List()
+	if err != nil {
+		return fmt.Errorf("failed to list clusters: %w", err)
+	}
+
+	for _, name := range staleKindClusters(clusters, prefix, olderThan, time.Now()) {
+		logf("Deleting stale Kind cluster: %s", name)
+		kubeConfigPath := filepath.Join(os.TempDir(), fmt.Sprintf("%s.kubeconfig", name))
+		if err := provider.Delete(name, kubeConfigPath); err != nil {
+			return fmt.Errorf("failed to delete stale cluster %s: %w", name, err)
+		}
+		if err := os.Remove(kubeConfigPath); err != nil && !os.IsNotExist(err) {
+			logf("Warning: failed to remove kubeconfig: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package providers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+func TestStaleKindClusters(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	created := map[string]time.Time{
+		"cnpg-old-control-plane":   now.Add(-3 * time.Hour),
+		"cnpg-fresh-control-plane": now.Add(-10 * time.Minute),
+		"other-old-control-plane":  now.Add(-3 * time.Hour),
+	}
+
+	orig := kindContainerCreatedAt
+	kindContainerCreatedAt = func(name string) (time.Time, error) {
+		if ts, ok := created[name]; ok {
+			return ts, nil
+		}
+		return time.Time{}, fmt.Errorf("no such container: %s", name)
+	}
+	t.Cleanup(func() { kindContainerCreatedAt = orig })
+
+	clusters := []string{"cnpg-old", "cnpg-fresh", "other-old", "cnpg-missing"}
+	stale := staleKindClusters(clusters, "cnpg-", time.Hour, now)
+	require.Equal(t, []string{"cnpg-old"}, stale)
+}
+
+func TestBuildKindClusterConfigProxy(t *testing.T) {
+	kc := &kindConfig{
+		Name:          "cnpg-proxy",
+		Image:         "kindest/node:v1.33.0",
+		Nodes:         3,
+		ServiceSubnet: "10.21.0.0/16",
+		PodSubnet:     "10.20.0.0/16",
+		Proxy: config.ProxyConfig{
+			HTTPProxy:  "http://proxy.example.com:3128",
+			HTTPSProxy: "http://proxy.example.com:3128",
+			NoProxy:    "registry.internal",
+		},
+	}
+
+	cluster := buildKindClusterConfig(kc, "/tmp/cnpg-proxy-containerd-proxy.conf")
+	require.Len(t, cluster.Nodes, 3)
+	for _, node := range cluster.Nodes {
+		require.Equal(t, []v1alpha4.Mount{{
+			HostPath:      "/tmp/cnpg-proxy-containerd-proxy.conf",
+			ContainerPath: containerdProxyDropInPath,
+			Readonly:      true,
+		}}, node.ExtraMounts)
+	}
+
+	dropIn := kc.containerdProxyDropIn()
+	require.Contains(t, dropIn, "[Service]\n")
+	require.Contains(t, dropIn, `Environment="HTTP_PROXY=http://proxy.example.com:3128"`)
+	require.Contains(t, dropIn, `Environment="HTTPS_PROXY=http://proxy.example.com:3128"`)
+	require.Contains(t, dropIn, `Environment="NO_PROXY=registry.internal,localhost,127.0.0.1,.svc,.cluster.local,kubernetes.default,10.21.0.0/16,10.20.0.0/16"`)
+
+	// Without a proxy the nodes get no extra mounts
+	cluster = buildKindClusterConfig(kc, "")
+	for _, node := range cluster.Nodes {
+		require.Empty(t, node.ExtraMounts)
+	}
+}
+
+func TestBuildKindClusterConfigExtraMounts(t *testing.T) {
+	kc := &kindConfig{
+		Name:  "cnpg-mounts",
+		Image: "kindest/node:v1.33.0",
+		Nodes: 2,
+		ExtraMounts: []Mount{
+			{HostPath: "/tmp/wal-archive", ContainerPath: "/var/lib/wal-archive"},
+			{HostPath: "/tmp/fixtures", ContainerPath: "/fixtures", ReadOnly: true},
+		},
+	}
+
+	cluster := buildKindClusterConfig(kc, "")
+	require.Len(t, cluster.Nodes, 2)
+	for _, node := range cluster.Nodes {
+		require.Equal(t, []v1alpha4.Mount{
+			{HostPath: "/tmp/wal-archive", ContainerPath: "/var/lib/wal-archive"},
+			{HostPath: "/tmp/fixtures", ContainerPath: "/fixtures", Readonly: true},
+		}, node.ExtraMounts)
+	}
+
+	// The proxy drop-in comes first when both are set
+	cluster = buildKindClusterConfig(kc, "/tmp/proxy.conf")
+	require.Len(t, cluster.Nodes[0].ExtraMounts, 3)
+	require.Equal(t, containerdProxyDropInPath, cluster.Nodes[0].ExtraMounts[0].ContainerPath)
+}
+
+func TestBuildKindClusterConfigPortMappings(t *testing.T) {
+	kc := &kindConfig{
+		Name:  "cnpg-ports",
+		Image: "kindest/node:v1.33.0",
+		Nodes: 3,
+		PortMappings: []PortMapping{
+			{ContainerPort: 30432, HostPort: 15432},
+			{ContainerPort: 30053, HostPort: 15353, Protocol: "udp"},
+		},
+	}
+
+	cluster := buildKindClusterConfig(kc, "")
+	require.Equal(t, v1alpha4.ControlPlaneRole, cluster.Nodes[0].Role)
+	require.Equal(t, []v1alpha4.PortMapping{
+		{ContainerPort: 30432, HostPort: 15432, Protocol: v1alpha4.PortMappingProtocolTCP},
+		{ContainerPort: 30053, HostPort: 15353, Protocol: v1alpha4.PortMappingProtocolUDP},
+	}, cluster.Nodes[0].ExtraPortMappings)
+
+	// Workers never get port mappings
+	for _, node := range cluster.Nodes[1:] {
+		require.Empty(t, node.ExtraPortMappings)
+	}
+}
@@ -0,0 +1,35 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+)
+
+const (
+	// clusterLockTimeout bounds how long Create and Delete wait for another process working on the
+	// same cluster, long enough for an EKS create or destroy to finish
+	clusterLockTimeout = 30 * time.Minute
+	// clusterLockInterval is the pause between attempts to take a held cluster lock
+	clusterLockInterval = 5 * time.Second
+)
+
+// lockCluster serializes Create and Delete of the cluster behind lockPath across test processes,
+// so two runs using the same cluster name don't race on its state
+func lockCluster(t *testing.T, lockPath, clusterName string) (func(), error) {
+	t.Helper()
+
+	unlock, err := helpers.LockFile(lockPath, syscall.LOCK_EX, 0, clusterLockInterval)
+	if errors.Is(err, helpers.ErrLocked) {
+		t.Logf("Another process is working on cluster %s, waiting up to %s for %s", clusterName, clusterLockTimeout, lockPath)
+		unlock, err = helpers.LockFile(lockPath, syscall.LOCK_EX, clusterLockTimeout, clusterLockInterval)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", clusterName, err)
+	}
+	return unlock, nil
+}
@@ -1,52 +1,287 @@
 package providers
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	admissionregistrationv1ac "k8s.io/client-go/applyconfigurations/admissionregistration/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
 )
 
-// installImageValidationPolicy is shared across providers: finds the project root,
-// locates the policy YAML, and applies it via kubectl.
-func installImageValidationPolicy(t *testing.T, opts *k8s.KubectlOptions) error {
+const (
+	// kubectlApplyRetries is how many times a transiently failing kubectl apply is attempted
+	kubectlApplyRetries = 5
+	// kubectlApplyRetryInterval is the pause between kubectl apply attempts
+	kubectlApplyRetryInterval = 5 * time.Second
+)
+
+// transientKubectlErrors are substrings of kubectl failures caused by an API server that is
+// briefly unavailable, typically right after cluster creation
+var transientKubectlErrors = []string{
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"context deadline exceeded",
+	"unexpected EOF",
+	"no route to host",
+	"the server is currently unable to handle the request",
+	"ServiceUnavailable",
+	"etcdserver: request timed out",
+	"Client.Timeout exceeded",
+}
+
+// isRetryableKubectlError reports whether a kubectl failure is transient and worth retrying.
+// Anything else, such as manifest validation errors, is treated as fatal.
+func isRetryableKubectlError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, marker := range transientKubectlErrors {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyWithRetry runs a kubectl apply, retrying transient API server failures
+func applyWithRetry(t *testing.T, description string, apply func() error) error {
 	t.Helper()
 
-	t.Log("Installing image validation policy to block non-pgEdge PostgreSQL images")
+	_, err := retry.DoWithRetryE(t, description, kubectlApplyRetries, kubectlApplyRetryInterval, func() (string, error) {
+		err := apply()
+		if err != nil && !isRetryableKubectlError(err) {
+			return "", retry.FatalError{Underlying: err}
+		}
+		return "", err
+	})
 
-	projectRoot, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get working directory: %w", err)
+	var fatalErr retry.FatalError
+	if errors.As(err, &fatalErr) {
+		return fatalErr.Underlying
 	}
+	return err
+}
+
+// policyFieldManager owns the fields of the image validation policy applied server-side
+const policyFieldManager = "pgedge-cnpg-tests"
+
+// applyImageValidationPolicy server-side applies the policy and binding in manifest, so applying
+// it again on a reused cluster updates them in place, then checks the binding enforces the policy
+func applyImageValidationPolicy(ctx context.Context, clientset kubernetes.Interface, manifest string) error {
+	var policy *admissionregistrationv1ac.ValidatingAdmissionPolicyApplyConfiguration
+	var binding *admissionregistrationv1ac.ValidatingAdmissionPolicyBindingApplyConfiguration
 
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(strings.NewReader(manifest)))
 	for {
-		if _, err := os.Stat(filepath.Join(projectRoot, "go.mod")); err == nil {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
 			break
 		}
-		parent := filepath.Dir(projectRoot)
-		if parent == projectRoot {
-			return fmt.Errorf("could not find project root (go.mod not found)")
+		if err != nil {
+			return fmt.Errorf("failed to read image validation policy: %w", err)
 		}
-		projectRoot = parent
+		var meta struct {
+			Kind string `json:"kind"`
+		}
+		if err := yaml.Unmarshal(doc, &meta); err != nil {
+			return fmt.Errorf("failed to parse image validation policy: %w", err)
+		}
+		switch meta.Kind {
+		case "ValidatingAdmissionPolicy":
+			policy = &admissionregistrationv1ac.ValidatingAdmissionPolicyApplyConfiguration{}
+			if err := yaml.Unmarshal(doc, policy); err != nil {
+				return fmt.Errorf("failed to parse ValidatingAdmissionPolicy: %w", err)
+			}
+		case "ValidatingAdmissionPolicyBinding":
+			binding = &admissionregistrationv1ac.ValidatingAdmissionPolicyBindingApplyConfiguration{}
+			if err := yaml.Unmarshal(doc, binding); err != nil {
+				return fmt.Errorf("failed to parse ValidatingAdmissionPolicyBinding: %w", err)
+			}
+		}
+	}
+	if policy == nil || policy.Name == nil || binding == nil || binding.Name == nil {
+		return fmt.Errorf("image validation policy manifest must contain a named policy and binding")
+	}
+
+	admission := clientset.AdmissionregistrationV1()
+	opts := metav1.ApplyOptions{FieldManager: policyFieldManager, Force: true}
+	if _, err := admission.ValidatingAdmissionPolicies().Apply(ctx, policy, opts); err != nil {
+		return fmt.Errorf("failed to apply ValidatingAdmissionPolicy %s: %w", *policy.Name, err)
+	}
+	if _, err := admission.ValidatingAdmissionPolicyBindings().Apply(ctx, binding, opts); err != nil {
+		return fmt.Errorf("failed to apply ValidatingAdmissionPolicyBinding %s: %w", *binding.Name, err)
 	}
 
-	policyPath := filepath.Join(projectRoot, "tests", "manifests", "image-validation-policy.yaml")
+	return checkImageValidationPolicyActive(ctx, clientset, *policy.Name, *binding.Name)
+}
 
-	if _, err := os.Stat(policyPath); os.IsNotExist(err) {
-		return fmt.Errorf("image validation policy not found at %s", policyPath)
+// checkImageValidationPolicyActive verifies policyName exists and bindingName binds it with at
+// least one validation action
+func checkImageValidationPolicyActive(ctx context.Context, clientset kubernetes.Interface, policyName, bindingName string) error {
+	admission := clientset.AdmissionregistrationV1()
+	if _, err := admission.ValidatingAdmissionPolicies().Get(ctx, policyName, metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("failed to get ValidatingAdmissionPolicy %s: %w", policyName, err)
+	}
+	binding, err := admission.ValidatingAdmissionPolicyBindings().Get(ctx, bindingName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get ValidatingAdmissionPolicyBinding %s: %w", bindingName, err)
+	}
+	if binding.Spec.PolicyName != policyName {
+		return fmt.Errorf("binding %s binds policy %q, expected %s", bindingName, binding.Spec.PolicyName, policyName)
 	}
+	if len(binding.Spec.ValidationActions) == 0 {
+		return fmt.Errorf("binding %s has no validation actions", bindingName)
+	}
+	return nil
+}
 
-	if err := k8s.RunKubectlE(t, opts, "apply", "-f", policyPath); err != nil {
+// installImageValidationPolicy is shared across providers: renders the policy from the
+// registries in config, bound with validationAction, and applies it server-side. Installing it
+// again, as setup does on a reused cluster, updates the existing policy.
+func installImageValidationPolicy(t *testing.T, opts *k8s.KubectlOptions, validationAction string) error {
+	t.Helper()
+
+	t.Logf("Installing image validation policy for non-pgEdge PostgreSQL images (action: %s)", validationAction)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	policy, err := cfg.RenderImageValidationPolicy(validationAction)
+	if err != nil {
+		return err
+	}
+
+	clientset, err := k8s.GetKubernetesClientFromOptionsE(t, opts)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	err = applyWithRetry(t, "Apply image validation policy", func() error {
+		return applyImageValidationPolicy(context.Background(), clientset, policy)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to apply image validation policy: %w", err)
 	}
 
-	t.Log("Image validation policy installed - only pgEdge PostgreSQL images will be allowed")
+	t.Logf("Image validation policy installed - non-pgEdge PostgreSQL images will get %s", validationAction)
 	return nil
 }
 
-// Provider represents a Kubernetes cluster provider (Kind, EKS, AKS, GKE, etc.)
+// serverVersion returns the Kubernetes API server version (e.g. "v1.33.1") of a cluster
+func serverVersion(t *testing.T, opts *k8s.KubectlOptions) (string, error) {
+	t.Helper()
+
+	clientset, err := k8s.GetKubernetesClientFromOptionsE(t, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	info, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to get server version: %w", err)
+	}
+	return info.GitVersion, nil
+}
+
+// k8sVersionPattern matches the major.minor prefix of a Kubernetes version
+var k8sVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// normalizeK8sVersion reduces a version such as "v1.33.1-eks-2f008fe" to "1.33"
+func normalizeK8sVersion(version string) (string, error) {
+	matches := k8sVersionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if matches == nil {
+		return "", fmt.Errorf("invalid kubernetes version %q", version)
+	}
+	return matches[1] + "." + matches[2], nil
+}
+
+// liveKubernetesVersion returns the normalized major.minor version reported by the API server
+func liveKubernetesVersion(t *testing.T, opts *k8s.KubectlOptions) (string, error) {
+	t.Helper()
+
+	version, err := serverVersion(t, opts)
+	if err != nil {
+		return "", err
+	}
+	return normalizeK8sVersion(version)
+}
+
+// checkSupportedK8sVersion returns an error if version is outside supportedRange
+func checkSupportedK8sVersion(version, supportedRange string) error {
+	ok, err := config.VersionInRange(version, supportedRange)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("kubernetes %s is not supported, supported versions are %q", version, supportedRange)
+	}
+	return nil
+}
+
+// AssertSupportedK8sVersion fails the test immediately if the cluster's Kubernetes version is
+// outside supportedRange (e.g. ">=1.32 <=1.34", see supported_kubernetes_versions in versions.yaml)
+func AssertSupportedK8sVersion(t *testing.T, provider Provider, supportedRange string) {
+	t.Helper()
+
+	version, err := serverVersion(t, provider.GetKubectlOptions(""))
+	if err != nil {
+		t.Fatalf("Failed to determine Kubernetes version of %s: %v", provider.GetClusterName(), err)
+	}
+	if err := checkSupportedK8sVersion(version, supportedRange); err != nil {
+		t.Fatalf("Cluster %s: %v", provider.GetClusterName(), err)
+	}
+	t.Logf("Kubernetes %s is within the supported range %q", version, supportedRange)
+}
+
+// supportedK8sRange returns supported_kubernetes_versions of the CNPG version under test, empty
+// when versions.yaml declares no range
+func supportedK8sRange() (string, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	if err != nil {
+		return "", err
+	}
+	return cnpgVersion.SupportedKubernetesVersions, nil
+}
+
+// requireSupportedK8sVersion fails the test before any cluster is created if the requested
+// Kubernetes version is outside the range the CNPG version under test supports
+func requireSupportedK8sVersion(t *testing.T, version string) {
+	t.Helper()
+
+	supportedRange, err := supportedK8sRange()
+	if err != nil {
+		t.Fatalf("Failed to determine supported Kubernetes versions: %v", err)
+	}
+	if supportedRange == "" {
+		return
+	}
+	if err := checkSupportedK8sVersion(version, supportedRange); err != nil {
+		t.Fatalf("Requested %v", err)
+	}
+}
+
+// Provider represents a Kubernetes cluster provider (Kind, k3d, EKS, AKS, GKE, etc.)
 type Provider interface {
 	// Name returns the provider name (e.g., "kind", "eks", "aks", "gke")
 	Name() string
@@ -66,24 +301,61 @@ type Provider interface {
 	// InstallCSIDriver installs CSI storage driver (implementation varies by provider)
 	InstallCSIDriver(t *testing.T) error
 
-	// InstallImageValidationPolicy installs the pgEdge image validation policy
-	InstallImageValidationPolicy(t *testing.T) error
+	// InstallImageValidationPolicy installs the pgEdge image validation policy, binding it with
+	// validationAction: config.ValidationActionDeny, ValidationActionWarn or ValidationActionAudit
+	InstallImageValidationPolicy(t *testing.T, validationAction string) error
 
 	// IsReady checks if the cluster is ready for use
 	IsReady(t *testing.T) bool
 
 	// GetClusterName returns the cluster name
 	GetClusterName() string
+
+	// GetKubernetesVersion returns the running cluster's Kubernetes version as major.minor (e.g. "1.33")
+	GetKubernetesVersion(t *testing.T) string
 }
 
 // Config represents common configuration for all providers
 type Config struct {
-	Name              string // Cluster name
-	KubernetesVersion string // K8s version (e.g., "1.32")
-	NodeCount         int    // Number of nodes
-	Region            string // Cloud region (for cloud providers)
-	InstanceType      string // Instance type (for cloud providers, e.g., "m5.large", "m7g.large")
-	NodeArch          string // Node architecture: "amd64" or "arm64"
+	Name              string        // Cluster name
+	KubernetesVersion string        // K8s version (e.g., "1.32")
+	NodeCount         int           // Number of nodes
+	Region            string        // Cloud region (for cloud providers)
+	InstanceType      string        // Instance type (for cloud providers, e.g., "m5.large", "m7g.large")
+	NodeArch          string        // Node architecture: "amd64" or "arm64"
+	ExtraMounts       []Mount       // Host paths mounted into every node (Kind only)
+	PortMappings      []PortMapping // Host ports forwarded to the control-plane node (Kind only)
+	NodeGroups        []NodeGroup   // Managed node groups, replacing the NodeCount/InstanceType group (EKS only)
+}
+
+// Mount is a host path mounted into the cluster nodes
+type Mount struct {
+	HostPath      string
+	ContainerPath string
+	ReadOnly      bool
+}
+
+// NodeGroup is a managed node group, e.g. dedicated Postgres nodes with their own instance type
+type NodeGroup struct {
+	Name         string
+	InstanceType string // Defaults to Config.InstanceType
+	Count        int
+	Labels       map[string]string
+	Taints       []Taint
+}
+
+// Taint is a node taint in Kubernetes form, e.g. Effect "NoSchedule"
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+// PortMapping forwards a host port to a port on the control-plane node, e.g. a NodePort
+type PortMapping struct {
+	ContainerPort int32
+	HostPort      int32
+	Protocol      string // TCP (default), UDP or SCTP
 }
 
 // Create creates a provider based on the provider type
@@ -95,6 +367,8 @@ func Create(t *testing.T, providerType string, config *Config) Provider {
 		return NewKind(config)
 	case "eks":
 		return NewEKS(config)
+	case "k3d":
+		return NewK3d(config)
 	case "aks":
 		// TODO: Implement AKS provider
 		t.Fatalf("AKS provider not yet implemented")
@@ -109,14 +383,34 @@ func Create(t *testing.T, providerType string, config *Config) Provider {
 	}
 }
 
-// Setup provisions a cluster with all required components
+// Setup provisions a cluster with all required components.
+// With CLUSTER_REUSE=true an already running cluster is reset and reused instead of
+// recreated, and it is left running after the test, as it is with CLUSTER_CLEANUP=false.
 func Setup(t *testing.T, provider Provider) {
 	t.Helper()
 
-	// Create cluster
-	err := provider.Create(t)
+	reuse := GetClusterReuse()
+
+	if reuse && provider.IsReady(t) {
+		t.Logf("Reusing existing cluster %s", provider.GetClusterName())
+		if err := helpers.ResetClusterState(t, provider.GetKubectlOptions(""), nil); err != nil {
+			t.Fatalf("Failed to reset reused cluster: %v", err)
+		}
+	} else {
+		// Create cluster
+		err := provider.Create(t)
+		if err != nil {
+			t.Fatalf("Failed to create cluster: %v", err)
+		}
+	}
+
+	// A reused cluster, or a provider picking a patch release, may not run what was requested
+	supportedRange, err := supportedK8sRange()
 	if err != nil {
-		t.Fatalf("Failed to create cluster: %v", err)
+		t.Fatalf("Failed to determine supported Kubernetes versions: %v", err)
+	}
+	if supportedRange != "" {
+		AssertSupportedK8sVersion(t, provider, supportedRange)
 	}
 
 	// Install CSI driver
@@ -126,11 +420,21 @@ func Setup(t *testing.T, provider Provider) {
 	}
 
 	// Install image validation policy
-	err = provider.InstallImageValidationPolicy(t)
+	err = provider.InstallImageValidationPolicy(t, config.ValidationActionDeny)
 	if err != nil {
 		t.Fatalf("Failed to install image validation policy: %v", err)
 	}
 
+	// Whatever exists now was installed by the provider and survives resets on reuse
+	if err := helpers.MarkInfrastructureNamespaces(t, provider.GetKubectlOptions("")); err != nil {
+		t.Fatalf("Failed to mark infrastructure namespaces: %v", err)
+	}
+
+	if reuse || !GetClusterCleanup() {
+		t.Logf("Leaving cluster %s running (kubeconfig: %s)", provider.GetClusterName(), provider.GetKubeConfigPath())
+		return
+	}
+
 	// Register cleanup
 	t.Cleanup(func() {
 		if err := provider.Delete(t); err != nil {
@@ -138,3 +442,21 @@ func Setup(t *testing.T, provider Provider) {
 		}
 	})
 }
+
+// DumpDiagnosticsOnFailure registers a cleanup that, if the test failed, writes the pod logs and
+// events of namespace to GetDiagnosticsDir()/<test name>/<namespace>. Call it after Setup so it
+// runs before the cluster is deleted.
+func DumpDiagnosticsOnFailure(t *testing.T, provider Provider, namespace string) {
+	t.Helper()
+
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		outputDir := filepath.Join(GetDiagnosticsDir(), strings.ReplaceAll(t.Name(), "/", "_"), namespace)
+		if err := helpers.CollectLogs(t, provider.GetKubectlOptions(namespace), namespace, outputDir); err != nil {
+			t.Logf("Warning: failed to collect diagnostics from %s: %v", namespace, err)
+		}
+		t.Logf("Diagnostics for %s written to %s", namespace, outputDir)
+	})
+}
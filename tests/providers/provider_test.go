@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIsRetryableKubectlError(t *testing.T) {
+	retryable := []string{
+		`The connection to the server 127.0.0.1:6443 was refused - did you specify the right host or port?: dial tcp 127.0.0.1:6443: connect: connection refused`,
+		`Unable to connect to the server: net/http: TLS handshake timeout`,
+		`error: unable to recognize "policy.yaml": Get "https://127.0.0.1:6443/api?timeout=32s": dial tcp 127.0.0.1:6443: i/o timeout`,
+		`Error from server (ServiceUnavailable): the server is currently unable to handle the request`,
+		`Error from server: etcdserver: request timed out`,
+	}
+	for _, msg := range retryable {
+		require.True(t, isRetryableKubectlError(errors.New(msg)), msg)
+	}
+
+	fatal := []string{
+		`error: error validating "policy.yaml": error validating data: ValidationError(ValidatingAdmissionPolicy.spec): unknown field "foo"`,
+		`The StorageClass "csi-hostpath-sc" is invalid: provisioner: Forbidden: updates to provisioner are forbidden.`,
+		`error: the path "missing.yaml" does not exist`,
+	}
+	for _, msg := range fatal {
+		require.False(t, isRetryableKubectlError(errors.New(msg)), msg)
+	}
+
+	require.False(t, isRetryableKubectlError(nil))
+}
+
+func TestApplyWithRetryStopsOnFatalError(t *testing.T) {
+	calls := 0
+	validationErr := errors.New(`error validating data: unknown field "foo"`)
+
+	err := applyWithRetry(t, "apply", func() error {
+		calls++
+		return validationErr
+	})
+
+	require.ErrorIs(t, err, validationErr)
+	require.Equal(t, 1, calls)
+}
+
+func TestCheckSupportedK8sVersion(t *testing.T) {
+	require.NoError(t, checkSupportedK8sVersion("v1.33.1", ">=1.32 <=1.34"))
+	require.NoError(t, checkSupportedK8sVersion("v1.34.2-eks-abcdef", ">=1.32 <=1.34"))
+
+	err := checkSupportedK8sVersion("v1.31.4", ">=1.32 <=1.34")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not supported")
+
+	require.Error(t, checkSupportedK8sVersion("v1.35.0", ">=1.32 <=1.34"))
+	require.Error(t, checkSupportedK8sVersion("v1.33.1", "1.32-1.34"))
+}
+
+func TestNormalizeK8sVersion(t *testing.T) {
+	cases := map[string]string{
+		"v1.33.1":             "1.33",
+		"1.32":                "1.32",
+		"v1.34.2-eks-2f008fe": "1.34",
+		"v1.33.1+k3s1":        "1.33",
+	}
+	for in, want := range cases {
+		got, err := normalizeK8sVersion(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+
+	_, err := normalizeK8sVersion("latest")
+	require.Error(t, err)
+}
+
+func TestApplyImageValidationPolicyIsIdempotent(t *testing.T) {
+	cfg := &config.Config{PostgresImages: config.PostgresImages{
+		Registries: map[string]config.Registry{"ghcr": {Base: "ghcr.io/pgedge/pgedge-postgres"}},
+	}}
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+
+	for _, action := range []string{config.ValidationActionDeny, config.ValidationActionDeny, config.ValidationActionWarn} {
+		policy, err := cfg.RenderImageValidationPolicy(action)
+		require.NoError(t, err)
+		require.NoError(t, applyImageValidationPolicy(ctx, clientset, policy))
+
+		binding, err := clientset.AdmissionregistrationV1().ValidatingAdmissionPolicyBindings().Get(ctx, "pgedge-postgres-only-binding", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "pgedge-postgres-only", binding.Spec.PolicyName)
+		require.Equal(t, []admissionregistrationv1.ValidationAction{admissionregistrationv1.ValidationAction(action)}, binding.Spec.ValidationActions)
+	}
+
+	require.NoError(t, checkImageValidationPolicyActive(ctx, clientset, "pgedge-postgres-only", "pgedge-postgres-only-binding"))
+	require.ErrorContains(t, checkImageValidationPolicyActive(ctx, clientset, "other-policy", "pgedge-postgres-only-binding"),
+		"failed to get ValidatingAdmissionPolicy other-policy")
+
+	err := applyImageValidationPolicy(ctx, clientset, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n")
+	require.ErrorContains(t, err, "must contain a named policy and binding")
+}
@@ -0,0 +1,249 @@
+package providers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+)
+
+const (
+	// localRegistryImage is the image of the local registry container
+	localRegistryImage = "registry:2"
+	// registryContainerPort is the port the registry listens on inside its container. Docker
+	// publishes it on a free host port so parallel clusters each get their own registry.
+	registryContainerPort = 5000
+	// kindNetwork is the Docker network Kind attaches its nodes to
+	kindNetwork = "kind"
+	// containerdCertsDir is where containerd looks up per-registry hosts.toml files
+	containerdCertsDir = "/etc/containerd/certs.d"
+)
+
+// containerdRegistryConfigPatch points containerd at containerdCertsDir so registry mirrors
+// can be added to running nodes
+const containerdRegistryConfigPatch = `[plugins."io.containerd.grpc.v1.cri".registry]
+  config_path = "` + containerdCertsDir + `"`
+
+// localRegistryHost is the address tests push to and reference in image names, for a registry
+// published on hostPort
+func localRegistryHost(hostPort int) string {
+	return fmt.Sprintf("localhost:%d", hostPort)
+}
+
+// parseDockerPort returns the host port from `docker port` output such as "127.0.0.1:32768"
+func parseDockerPort(output string) (int, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	i := strings.LastIndex(line, ":")
+	if i < 0 {
+		return 0, fmt.Errorf("unexpected docker port output %q", output)
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(line[i+1:]))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected docker port output %q: %w", output, err)
+	}
+	return port, nil
+}
+
+// localRegistryRef returns the reference of image in the local registry at host, keeping its
+// repository path and tag but dropping the registry it came from
+func localRegistryRef(host, image string) string {
+	first, rest, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		image = rest
+	}
+	return host + "/" + image
+}
+
+// nodeNames returns the container names of the cluster's nodes
+func (kc *kindCluster) nodeNames() ([]string, error) {
+	nodes, err := kc.Provider.ListNodes(kc.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.String())
+	}
+	return names, nil
+}
+
+// registryContainerName returns the name of the local registry container of a cluster
+func (kc *kindCluster) registryContainerName() string {
+	return kc.Name + "-registry"
+}
+
+// localRegistryHostsTOML renders a containerd hosts.toml that resolves localRegistryHost to the
+// registry container over the Kind network
+func localRegistryHostsTOML(registryName string) string {
+	return fmt.Sprintf("[host.\"http://%s:%d\"]\n", registryName, registryContainerPort)
+}
+
+// configureRegistryMirror writes the hosts.toml resolving host to the local registry into every
+// node
+func configureRegistryMirror(nodes []string, registryName, host string) error {
+	dir := fmt.Sprintf("%s/%s", containerdCertsDir, host)
+	script := fmt.Sprintf("mkdir -p %s && printf '%%s' '%s' > %s/hosts.toml", dir, localRegistryHostsTOML(registryName), dir)
+	for _, node := range nodes {
+		if _, err := runDocker("exec", node, "sh", "-c", script); err != nil {
+			return fmt.Errorf("failed to configure registry mirror on node %s: %w", node, err)
+		}
+	}
+	return nil
+}
+
+// localRegistryHostingConfigMap documents the local registry for tools that follow KEP-1755
+func localRegistryHostingConfigMap(host string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "%s"
+`, host)
+}
+
+// CreateLocalRegistry starts a registry:2 container on the Kind network, published on a free
+// host port, and configures containerd on every node to pull localhost:<port>/... images from
+// it. It returns the registry host.
+func (kc *kindCluster) CreateLocalRegistry(t *testing.T) (string, error) {
+	t.Helper()
+
+	name := kc.registryContainerName()
+	if running, err := runDocker("inspect", "--format", "{{.State.Running}}", name); err != nil || running != "true" {
+		_, _ = runDocker("rm", "-f", name)
+		_, err := runDocker("run", "-d", "--restart=always",
+			"-p", fmt.Sprintf("127.0.0.1::%d", registryContainerPort),
+			"--name", name, localRegistryImage)
+		if err != nil {
+			return "", fmt.Errorf("failed to start local registry: %w", err)
+		}
+	}
+
+	output, err := runDocker("port", name, fmt.Sprintf("%d/tcp", registryContainerPort))
+	if err != nil {
+		return "", fmt.Errorf("failed to find the host port of local registry: %w", err)
+	}
+	hostPort, err := parseDockerPort(output)
+	if err != nil {
+		return "", err
+	}
+	host := localRegistryHost(hostPort)
+	t.Logf("Local registry %s listens on %s", name, host)
+
+	networks, err := runDocker("inspect", "--format", "{{range $k, $v := .NetworkSettings.Networks}}{{$k}} {{end}}", name)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect local registry: %w", err)
+	}
+	if !strings.Contains(" "+networks+" ", " "+kindNetwork+" ") {
+		if _, err := runDocker("network", "connect", kindNetwork, name); err != nil {
+			return "", fmt.Errorf("failed to connect local registry to the %s network: %w", kindNetwork, err)
+		}
+	}
+
+	nodeNames, err := kc.nodeNames()
+	if err != nil {
+		return "", err
+	}
+	if err := configureRegistryMirror(nodeNames, name, host); err != nil {
+		return "", err
+	}
+
+	err = applyWithRetry(t, "Publish local registry config map", func() error {
+		return k8s.KubectlApplyFromStringE(t, kc.GetKubectlOptions(""), localRegistryHostingConfigMap(host))
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish local registry config map: %w", err)
+	}
+
+	t.Logf("Local registry ready: push images to %s/<image>", host)
+	return host, nil
+}
+
+// deleteLocalRegistry removes the local registry container if one was created
+func (kc *kindCluster) deleteLocalRegistry() error {
+	name := kc.registryContainerName()
+	if _, err := runDocker("inspect", name); err != nil {
+		return nil
+	}
+	_, err := runDocker("rm", "-f", name)
+	return err
+}
+
+// CreateLocalRegistry starts a local registry for the cluster and returns the host to push
+// images to (localhost:<port>, the port differs per cluster)
+func (p *Kind) CreateLocalRegistry(t *testing.T) (string, error) {
+	t.Helper()
+
+	host, err := p.cluster.CreateLocalRegistry(t)
+	if err != nil {
+		return "", err
+	}
+	p.registryHost = host
+	return host, nil
+}
+
+// PushToLocalRegistry pulls image on the host, pushes it to the local registry created by
+// CreateLocalRegistry and returns the reference the cluster pulls it by
+func (p *Kind) PushToLocalRegistry(t *testing.T, image string) (string, error) {
+	t.Helper()
+
+	if p.registryHost == "" {
+		return "", fmt.Errorf("cluster %s has no local registry, call CreateLocalRegistry first", p.config.Name)
+	}
+	ref := localRegistryRef(p.registryHost, image)
+	for _, args := range [][]string{{"pull", image}, {"tag", image, ref}, {"push", ref}} {
+		if _, err := runDocker(args...); err != nil {
+			return "", fmt.Errorf("failed to push %s to the local registry: %w", image, err)
+		}
+	}
+	t.Logf("Pushed %s as %s", image, ref)
+	return ref, nil
+}
+
+// imageArchivePath is where loadImage copies the image archive inside a node
+const imageArchivePath = "/image.tar"
+
+// loadImage pulls image on the host and imports it into containerd on every node, like
+// kind load docker-image, so pods can start from it without pulling. archive is a scratch
+// file on the host.
+func loadImage(nodes []string, image, archive string) error {
+	if _, err := runDocker("pull", image); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+	if _, err := runDocker("save", "-o", archive, image); err != nil {
+		return fmt.Errorf("failed to save %s: %w", image, err)
+	}
+	for _, node := range nodes {
+		for _, args := range [][]string{
+			{"cp", archive, node + ":" + imageArchivePath},
+			{"exec", node, "ctr", "--namespace=k8s.io", "images", "import", "--digests", imageArchivePath},
+			{"exec", node, "rm", "-f", imageArchivePath},
+		} {
+			if _, err := runDocker(args...); err != nil {
+				return fmt.Errorf("failed to load %s into node %s: %w", image, node, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadImage preloads image into every node of the cluster
+func (p *Kind) LoadImage(t *testing.T, image string) error {
+	t.Helper()
+
+	nodes, err := p.cluster.nodeNames()
+	if err != nil {
+		return err
+	}
+	archive := filepath.Join(t.TempDir(), "image.tar")
+	if err := loadImage(nodes, image, archive); err != nil {
+		return err
+	}
+	t.Logf("Loaded %s into %d nodes", image, len(nodes))
+	return nil
+}
@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureRegistryMirror(t *testing.T) {
+	var calls [][]string
+	orig := runDocker
+	runDocker = func(args ...string) (string, error) {
+		calls = append(calls, args)
+		return "", nil
+	}
+	defer func() { runDocker = orig }()
+
+	nodes := []string{"cnpg-test-control-plane", "cnpg-test-worker"}
+	require.NoError(t, configureRegistryMirror(nodes, "cnpg-test-registry", "localhost:32768"))
+	require.Len(t, calls, 2)
+	for i, call := range calls {
+		require.Equal(t, []string{"exec", nodes[i], "sh", "-c"}, call[:4])
+		require.Contains(t, call[4], "/etc/containerd/certs.d/localhost:32768/hosts.toml")
+		require.Contains(t, call[4], `[host."http://cnpg-test-registry:5000"]`)
+	}
+
+	runDocker = func(args ...string) (string, error) {
+		return "", errors.New("no such container")
+	}
+	err := configureRegistryMirror(nodes, "cnpg-test-registry", "localhost:32768")
+	require.ErrorContains(t, err, "cnpg-test-control-plane")
+}
+
+func TestDeleteLocalRegistry(t *testing.T) {
+	var calls []string
+	orig := runDocker
+	defer func() { runDocker = orig }()
+
+	kc := &kindCluster{Name: "cnpg-test"}
+
+	// No registry container: nothing is removed
+	runDocker = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return "", errors.New("no such object")
+	}
+	require.NoError(t, kc.deleteLocalRegistry())
+	require.Equal(t, []string{"inspect cnpg-test-registry"}, calls)
+
+	calls = nil
+	runDocker = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return "", nil
+	}
+	require.NoError(t, kc.deleteLocalRegistry())
+	require.Equal(t, []string{"inspect cnpg-test-registry", "rm -f cnpg-test-registry"}, calls)
+}
+
+func TestParseDockerPort(t *testing.T) {
+	port, err := parseDockerPort("127.0.0.1:32768\n")
+	require.NoError(t, err)
+	require.Equal(t, 32768, port)
+
+	port, err = parseDockerPort("0.0.0.0:49153\n[::]:49153")
+	require.NoError(t, err)
+	require.Equal(t, 49153, port)
+
+	_, err = parseDockerPort("")
+	require.Error(t, err)
+}
+
+func TestLocalRegistryRef(t *testing.T) {
+	require.Equal(t, "localhost:32768/pgedge/pgedge-postgres:17-spock5-standard",
+		localRegistryRef("localhost:32768", "ghcr.io/pgedge/pgedge-postgres:17-spock5-standard"))
+	require.Equal(t, "localhost:32768/library/busybox:1.36", localRegistryRef("localhost:32768", "localhost:5000/library/busybox:1.36"))
+	require.Equal(t, "localhost:32768/pgedge/postgres:17", localRegistryRef("localhost:32768", "pgedge/postgres:17"))
+	require.Equal(t, "localhost:32768/busybox:1.36", localRegistryRef("localhost:32768", "busybox:1.36"))
+}
+
+func TestPushToLocalRegistry(t *testing.T) {
+	var calls []string
+	orig := runDocker
+	runDocker = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return "", nil
+	}
+	defer func() { runDocker = orig }()
+
+	kind := &Kind{config: &Config{Name: "cnpg-test"}}
+	_, err := kind.PushToLocalRegistry(t, "ghcr.io/pgedge/pgedge-postgres:17")
+	require.ErrorContains(t, err, "no local registry")
+
+	kind.registryHost = "localhost:32768"
+	ref, err := kind.PushToLocalRegistry(t, "ghcr.io/pgedge/pgedge-postgres:17")
+	require.NoError(t, err)
+	require.Equal(t, "localhost:32768/pgedge/pgedge-postgres:17", ref)
+	require.Equal(t, []string{
+		"pull ghcr.io/pgedge/pgedge-postgres:17",
+		"tag ghcr.io/pgedge/pgedge-postgres:17 localhost:32768/pgedge/pgedge-postgres:17",
+		"push localhost:32768/pgedge/pgedge-postgres:17",
+	}, calls)
+}
+
+func TestLoadImage(t *testing.T) {
+	var calls []string
+	orig := runDocker
+	runDocker = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return "", nil
+	}
+	defer func() { runDocker = orig }()
+
+	image := "ghcr.io/pgedge/pgedge-postgres:17"
+	require.NoError(t, loadImage([]string{"cnpg-test-control-plane", "cnpg-test-worker"}, image, "/tmp/image.tar"))
+	require.Equal(t, []string{
+		"pull " + image,
+		"save -o /tmp/image.tar " + image,
+		"cp /tmp/image.tar cnpg-test-control-plane:/image.tar",
+		"exec cnpg-test-control-plane ctr --namespace=k8s.io images import --digests /image.tar",
+		"exec cnpg-test-control-plane rm -f /image.tar",
+		"cp /tmp/image.tar cnpg-test-worker:/image.tar",
+		"exec cnpg-test-worker ctr --namespace=k8s.io images import --digests /image.tar",
+		"exec cnpg-test-worker rm -f /image.tar",
+	}, calls)
+
+	runDocker = func(args ...string) (string, error) {
+		if args[0] == "cp" {
+			return "", errors.New("no such container")
+		}
+		return "", nil
+	}
+	err := loadImage([]string{"cnpg-test-control-plane"}, image, "/tmp/image.tar")
+	require.ErrorContains(t, err, "failed to load "+image+" into node cnpg-test-control-plane")
+}
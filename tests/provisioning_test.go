@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// provisioningValues are cluster chart values declaring an application database, its owner and
+// managed roles; provisioningCluster is the Cluster they render to
+const (
+	provisioningValues = `
+cluster:
+  instances: 1
+  initdb:
+    database: inventory
+    owner: inventory_owner
+  roles:
+    - name: reporting
+      ensure: present
+      login: true
+    - name: auditor
+      ensure: present
+    - name: legacy
+      ensure: absent
+`
+	provisioningCluster = `
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: provisioning
+spec:
+  instances: 1
+  enableSuperuserAccess: true
+  storage:
+    size: 1Gi
+  bootstrap:
+    initdb:
+      database: inventory
+      owner: inventory_owner
+  managed:
+    roles:
+      - name: reporting
+        ensure: present
+        login: true
+      - name: auditor
+        ensure: present
+      - name: legacy
+        ensure: absent
+`
+)
+
+// TestValuesProvisioned deploys a cluster from chart values and checks every database and role
+// the values declare exists once the cluster is healthy
+func TestValuesProvisioned(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-provisioning-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, provisioningCluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "provisioning", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "provisioning", 10*time.Minute))
+
+	conn, closeConn, err := helpers.OpenServiceConnectionToDatabase(t, opts, "provisioning-rw", "provisioning-superuser", "postgres")
+	require.NoError(t, err)
+	defer closeConn()
+
+	t.Run("Application database and owner exist", func(t *testing.T) {
+		helpers.AssertDatabaseExists(t, conn, "inventory")
+		helpers.AssertRoleExists(t, conn, "inventory_owner")
+	})
+
+	t.Run("Every value-declared database and role exists", func(t *testing.T) {
+		// The instance manager reconciles managed roles after the cluster reports healthy
+		_, err := retry.DoWithRetryE(t, "Waiting for managed roles", 30, 2*time.Second, func() (string, error) {
+			var created int
+			if err := conn.QueryRow(`SELECT count(*) FROM pg_roles WHERE rolname IN ('reporting', 'auditor')`).Scan(&created); err != nil {
+				return "", err
+			}
+			if created != 2 {
+				return "", fmt.Errorf("%d of 2 managed roles created", created)
+			}
+			return "", nil
+		})
+		require.NoError(t, err)
+
+		helpers.AssertValuesProvisioned(t, conn, []byte(provisioningValues))
+	})
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAPIServerBlip pauses the API server and verifies the data plane keeps serving queries,
+// the operator reconnects and the cluster stays healthy
+func TestAPIServerBlip(t *testing.T) {
+	t.Parallel()
+
+	if providers.GetProviderType() != "kind" {
+		t.Skipf("API server blip is not supported on %s", providers.GetProviderType())
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-apiserver-blip-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	operator := helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+
+	// The NodePort lets the test reach the primary without tunnelling through the API server
+	manifest := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: blip-test
+spec:
+  instances: 2
+  storage:
+    size: 1Gi
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: blip-test-nodeport
+spec:
+  type: NodePort
+  selector:
+    cnpg.io/cluster: blip-test
+    cnpg.io/instanceRole: primary
+  ports:
+    - port: 5432
+      targetPort: 5432
+      nodePort: 30432
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, manifest), "Failed to create cluster")
+	defer func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, manifest)
+	}()
+
+	// Also waits for the cluster to become healthy
+	helpers.AssertNotReadyBeforeBootstrap(t, opts, "blip-test")
+
+	kind := provider.(*providers.Kind)
+	addr, err := kind.NodeAddress(provider.GetClusterName() + "-worker")
+	require.NoError(t, err)
+
+	conn, err := helpers.OpenDirectConnection(t, opts, addr+":30432", "blip-test-app")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	helpers.AssertNoConnectionDrop(t, conn, func() {
+		require.NoError(t, providers.SimulateAPIServerBlip(t, provider, 30*time.Second))
+	})
+
+	t.Run("Operator reconnects", func(t *testing.T) {
+		err := k8s.WaitUntilDeploymentAvailableE(t, operator.KubectlOptions, operator.ReleaseName, 60, 5*time.Second)
+		require.NoError(t, err, "Operator did not recover after API server blip")
+	})
+
+	t.Run("Cluster stays healthy", func(t *testing.T) {
+		require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "blip-test", 5*time.Minute))
+	})
+
+	t.Run("Operator reconciles drift", func(t *testing.T) {
+		helpers.AssertDriftReconciliation(t, opts, "blip-test")
+	})
+
+	t.Run("Cluster self-heals", func(t *testing.T) {
+		helpers.AssertClusterRecoversFromUnhealthy(t, opts, "blip-test", func() {
+			_, err := helpers.DeletePrimaryFault(opts, "blip-test")(t)
+			require.NoError(t, err)
+		})
+	})
+
+	t.Run("Cluster serves without operator", func(t *testing.T) {
+		helpers.AssertDataPlaneIndependence(t, operator, opts, "blip-test")
+	})
+}
+
+// TestPrimaryOOMKill forces an OOMKill of the primary's postgres container and verifies the
+// cluster recovers with its data intact
+func TestPrimaryOOMKill(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping OOMKill of the primary in short mode")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-oomkill-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+
+	// OOMKillPrimary sizes its allocation from the postgres container's memory limit
+	cluster := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: oomkill
+spec:
+  instances: 2
+  storage:
+    size: 1Gi
+  resources:
+    requests:
+      memory: 256Mi
+    limits:
+      memory: 512Mi
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "oomkill", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "oomkill", 10*time.Minute))
+
+	helpers.OOMKillPrimary(t, opts, "oomkill")
+}
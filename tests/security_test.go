@@ -0,0 +1,366 @@
+package tests
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadOnlyRootFilesystem verifies pgEdge images start with the read-only root filesystem
+// CNPG applies to instance containers, as required by restrictive PodSecurity settings
+func TestReadOnlyRootFilesystem(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-readonly-rootfs-test")
+	providers.Setup(t, provider)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+
+	cluster := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: readonly-rootfs
+spec:
+  instances: 2
+  storage:
+    size: 1Gi
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "readonly-rootfs", "--ignore-not-found=true")
+	}()
+
+	helpers.AssertReadOnlyRootFilesystem(t, opts, "readonly-rootfs", 2, 10*time.Minute)
+}
+
+// TestAppCredentialRotation rotates the app user's password of a cluster with an operator-generated
+// secret and of one bootstrapped from an externally managed secret, while a connection opened with
+// the old password keeps serving queries
+func TestAppCredentialRotation(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping credential rotation test in short mode")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-credential-rotation-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+
+	clusters := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: rotate-managed
+spec:
+  instances: 2
+  storage:
+    size: 1Gi
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: rotate-external-credentials
+type: kubernetes.io/basic-auth
+stringData:
+  username: app
+  password: initial-external-password
+---
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: rotate-external
+spec:
+  instances: 2
+  storage:
+    size: 1Gi
+  bootstrap:
+    initdb:
+      database: app
+      owner: app
+      secret:
+        name: rotate-external-credentials
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, clusters), "Failed to create clusters")
+	defer func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, clusters)
+	}()
+
+	for _, tc := range []struct {
+		name    string
+		cluster string
+		secret  string
+	}{
+		{"Operator-generated secret", "rotate-managed", "rotate-managed-app"},
+		{"Externally managed secret", "rotate-external", "rotate-external-credentials"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, helpers.WaitForClusterHealthy(t, opts, tc.cluster, 10*time.Minute))
+
+			conn, closeConn, err := helpers.OpenServiceConnection(t, opts, tc.cluster+"-rw", tc.secret)
+			require.NoError(t, err)
+			defer closeConn()
+
+			// Sessions opened with the old password must survive the rotation
+			helpers.AssertNoConnectionDrop(t, conn, func() {
+				helpers.RotateAppPassword(t, opts, tc.cluster)
+			})
+		})
+	}
+}
+
+// networkPolicies isolates the netpol cluster's namespace: ingress is denied by default, instances
+// admit PostgreSQL from each other and from poolers and the operator's status checks, and
+// instances may only send PostgreSQL traffic to each other besides DNS and the API server
+const networkPolicies = `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: default-deny-ingress
+spec:
+  podSelector: {}
+  policyTypes:
+    - Ingress
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-postgres-ingress
+spec:
+  podSelector:
+    matchLabels:
+      cnpg.io/cluster: netpol
+      cnpg.io/podRole: instance
+  policyTypes:
+    - Ingress
+  ingress:
+    - from:
+        - podSelector:
+            matchLabels:
+              cnpg.io/cluster: netpol
+              cnpg.io/podRole: instance
+        - podSelector:
+            matchExpressions:
+              - key: cnpg.io/poolerName
+                operator: Exists
+      ports:
+        - port: 5432
+    - from:
+        - namespaceSelector:
+            matchLabels:
+              kubernetes.io/metadata.name: cnpg-system
+      ports:
+        - port: 8000
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: restrict-instance-egress
+spec:
+  podSelector:
+    matchLabels:
+      cnpg.io/cluster: netpol
+      cnpg.io/podRole: instance
+  policyTypes:
+    - Egress
+  egress:
+    - to:
+        - podSelector:
+            matchLabels:
+              cnpg.io/cluster: netpol
+              cnpg.io/podRole: instance
+      ports:
+        - port: 5432
+    - ports:
+        - port: 53
+          protocol: UDP
+        - port: 53
+          protocol: TCP
+    - to:
+        - ipBlock:
+            cidr: 0.0.0.0/0
+      ports:
+        - port: 443
+        - port: 6443
+`
+
+// TestNetworkPolicies isolates a cluster and its poolers with NetworkPolicies and checks they still
+// let replication and pooler traffic through, both by inspecting the policies and by rebuilding
+// a replica under them
+func TestNetworkPolicies(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-network-policy-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "netpol")
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("netpol")
+	require.NoError(t, k8s.CreateNamespaceE(t, opts, "netpol"))
+	defer func() {
+		_ = k8s.DeleteNamespaceE(t, opts, "netpol")
+	}()
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, networkPolicies), "Failed to apply NetworkPolicies")
+
+	cluster := helpers.ClusterSpec{Name: "netpol", Instances: 2}.Manifest()
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, cluster), "Failed to create cluster")
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "netpol", 10*time.Minute))
+
+	pooler := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Pooler
+metadata:
+  name: netpol-pooler-rw
+spec:
+  cluster:
+    name: netpol
+  instances: 1
+  type: rw
+  pgbouncer:
+    poolMode: session
+---
+apiVersion: postgresql.cnpg.io/v1
+kind: Pooler
+metadata:
+  name: netpol-pooler-ro
+spec:
+  cluster:
+    name: netpol
+  instances: 1
+  type: ro
+  pgbouncer:
+    poolMode: session
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, pooler), "Failed to create poolers")
+	for _, name := range []string{"netpol-pooler-rw", "netpol-pooler-ro"} {
+		require.NoError(t, helpers.WaitForPodsReady(t, opts, "cnpg.io/poolerName="+name, 1, 60))
+	}
+
+	t.Run("Policies admit replication and pooler traffic", func(t *testing.T) {
+		helpers.AssertNetworkPoliciesAllowReplication(t, opts, "netpol")
+	})
+
+	t.Run("Poolers route to their instances under the policies", func(t *testing.T) {
+		helpers.AssertPoolerRouting(t, opts, "netpol-pooler-rw", false)
+		helpers.AssertPoolerRouting(t, opts, "netpol-pooler-ro", true)
+	})
+
+	t.Run("Replica rejoins under the policies", func(t *testing.T) {
+		status, err := helpers.GetClusterStatus(t, opts, "netpol")
+		require.NoError(t, err)
+		replica := "netpol-1"
+		if status.CurrentPrimary == replica {
+			replica = "netpol-2"
+		}
+		before, err := helpers.GetInstancePods(t, opts, "netpol")
+		require.NoError(t, err)
+
+		_, err = helpers.DeletePodFault(opts, replica)(t)
+		require.NoError(t, err)
+		_, err = retry.DoWithRetryE(t, fmt.Sprintf("Wait for %s to be recreated", replica), 60, 5*time.Second, func() (string, error) {
+			after, err := helpers.GetInstancePods(t, opts, "netpol")
+			if err != nil {
+				return "", err
+			}
+			for _, pod := range after {
+				if pod.Name == replica && !slices.Contains(before, pod) {
+					return "", nil
+				}
+			}
+			return "", fmt.Errorf("%s has not been recreated", replica)
+		})
+		require.NoError(t, err)
+		require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "netpol", 10*time.Minute))
+	})
+}
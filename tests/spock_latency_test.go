@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSpockReplicationUnderLatency delays the links of one node of a two-region Spock mesh, as
+// a WAN would, and checks replication keeps up. Lag is reported next to the injected delay.
+func TestSpockReplicationUnderLatency(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping latency test in short mode")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-latency-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	regions := []string{"latency-east", "latency-west"}
+	conns := helpers.DeployMultiRegionMesh(t, provider.GetKubectlOptions(""), regions)
+	westOpts := k8s.NewKubectlOptions("", provider.GetKubeConfigPath(), regions[1])
+	helpers.AssertUniqueSpockNodeIDs(t, conns)
+
+	const (
+		samples = 10
+		delay   = 200 * time.Millisecond
+	)
+	baseline := helpers.MeasureReplicationLag(t, conns[0], conns[1], samples)
+	t.Logf("Replication lag without injected latency: %s", baseline)
+
+	// DeployMultiRegionMesh names the cluster of the second region pgedge-2
+	helpers.InjectNetworkLatency(t, westOpts, "pgedge-2", delay)
+	delayed := helpers.MeasureReplicationLag(t, conns[0], conns[1], samples)
+	t.Logf("Replication lag with %s injected latency: %s", delay, delayed)
+	require.GreaterOrEqual(t, delayed.Avg, delay, "Injected latency had no effect")
+
+	// A TOASTed value spans many WAL records, so it crosses the slow link in pieces
+	helpers.AssertLargeValueReplicated(t, conns[0], conns[1], 4<<20)
+
+	helpers.ClearNetworkLatency(t, westOpts, "pgedge-2")
+	helpers.AssertFullMeshReplication(t, conns)
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSpockSubscriptionPause pauses the subscription of one node of a two-region Spock mesh and
+// checks writes are held back while it is paused and replicated once it is resumed
+func TestSpockSubscriptionPause(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping subscription pause test in short mode")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	provider := providers.NewProvider(t, "cnpg-subscription-pause-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	regions := []string{"pause-east", "pause-west"}
+	conns := helpers.DeployMultiRegionMesh(t, provider.GetKubectlOptions(""), regions)
+	for _, region := range regions {
+		// Each region runs exactly one pgEdge node, named pgedge-N
+		helpers.AssertClusterCount(t, provider.GetKubectlOptions(region), region, 1)
+	}
+
+	// Rows written while paused are resolved by commit time once replication resumes
+	helpers.AssertClockSkewTolerance(t, conns)
+	helpers.AssertReplicationResumesAfterPause(t, conns[0], conns[1], 30*time.Second)
+	helpers.AssertFullMeshReplication(t, conns)
+	helpers.AssertSequenceConsistency(t, conns, "pause_sequence_check")
+}
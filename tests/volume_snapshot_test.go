@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/config"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/helpers"
+	"github.com/pgedge/pgedge-cnpg-dist/tests/providers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVolumeSnapshotBackupRestore takes a cold volumeSnapshot Backup of a cluster with the
+// provider's VolumeSnapshotClass and restores it into a new cluster. The upstream snapshot specs
+// are excluded, so this is what checks the snapshot class each provider installs works.
+func TestVolumeSnapshotBackupRestore(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping volume snapshot test in short mode")
+	}
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err, "Failed to load configuration")
+
+	cnpgVersion, err := cfg.GetCNPGVersionFromEnv()
+	require.NoError(t, err, "Failed to get CNPG version")
+	postgresVersion := cnpgVersion.GetPostgresVersionFromEnv()
+
+	t.Logf("Test execution: CNPG=%s  PostgreSQL=%s  Kubernetes=%s  Provider=%s",
+		cnpgVersion.Version, postgresVersion, providers.GetKubernetesVersion(), providers.GetProviderType())
+
+	storageConfig, ok := cfg.GetStorageConfig(providers.GetProviderType())
+	if !ok {
+		t.Fatalf("no storage config found for provider %s", providers.GetProviderType())
+	}
+	if storageConfig.CSIClass == "" || storageConfig.SnapshotClass == "" {
+		t.Fatalf("storage config for provider %s is missing CSIClass or SnapshotClass", providers.GetProviderType())
+	}
+
+	provider := providers.NewProvider(t, "cnpg-snapshot-test")
+	providers.Setup(t, provider)
+	providers.DumpDiagnosticsOnFailure(t, provider, "default")
+	providers.DumpDiagnosticsOnFailure(t, provider, helpers.DefaultOperatorNamespace)
+
+	variant, err := cfg.GetImageVariantFromEnv()
+	require.NoError(t, err, "Failed to get image variant")
+	postgresImage := cfg.GetPostgresImageName(
+		cfg.PostgresImages.DefaultRegistry,
+		postgresVersion,
+		variant,
+	)
+
+	helpers.DeployCNPGOperator(t,
+		provider.GetKubeConfigPath(),
+		cnpgVersion.Version,
+		cnpgVersion.ChartVersion,
+		helpers.DefaultOperatorNamespace,
+		cnpgVersion.GetOperatorImageName(),
+		postgresImage,
+	)
+
+	opts := provider.GetKubectlOptions("default")
+
+	source := fmt.Sprintf(`
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: snapshot-source
+spec:
+  instances: 1
+  storage:
+    size: 1Gi
+    storageClass: %[1]s
+  backup:
+    volumeSnapshot:
+      className: %[2]s
+`, storageConfig.CSIClass, storageConfig.SnapshotClass)
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, source), "Failed to create source cluster")
+	defer func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, source)
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "snapshot-source", 10*time.Minute))
+	helpers.AssertPVCStorageClass(t, opts, "snapshot-source", storageConfig.CSIClass)
+
+	const rows = 1000
+	ctx := context.Background()
+	conn, closeConn, err := helpers.OpenServiceConnection(t, opts, "snapshot-source-rw", "snapshot-source-app")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, `CREATE TABLE snapshot_check AS SELECT g AS id, md5(g::text) AS payload FROM generate_series(1, $1) g`, rows)
+	closeConn()
+	require.NoError(t, err, "Failed to write test data")
+
+	// A cold backup needs no WAL archive to restore from
+	backup := `
+apiVersion: postgresql.cnpg.io/v1
+kind: Backup
+metadata:
+  name: snapshot-source-manual
+spec:
+  cluster:
+    name: snapshot-source
+  method: volumeSnapshot
+  online: false
+`
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, backup), "Failed to create backup")
+	defer func() {
+		_ = k8s.KubectlDeleteFromStringE(t, opts, backup)
+	}()
+	require.NoError(t, helpers.WaitForBackupCompleted(t, opts, "snapshot-source-manual", 10*time.Minute))
+
+	snapshots, err := helpers.GetBackupSnapshots(t, opts, "snapshot-source-manual")
+	require.NoError(t, err)
+	for _, snapshot := range snapshots {
+		require.NoError(t, helpers.WaitForSnapshotReady(t, opts, snapshot, 5*time.Minute))
+	}
+
+	restored := fmt.Sprintf(`
+apiVersion: postgresql.cnpg.io/v1
+kind: Cluster
+metadata:
+  name: snapshot-restored
+spec:
+  instances: 1
+  storage:
+    size: 1Gi
+    storageClass: %s
+  bootstrap:
+    recovery:
+      volumeSnapshots:
+        storage:
+          name: %s
+          kind: VolumeSnapshot
+          apiGroup: snapshot.storage.k8s.io
+`, storageConfig.CSIClass, snapshots[0])
+	require.NoError(t, k8s.KubectlApplyFromStringE(t, opts, restored), "Failed to create restored cluster")
+	defer func() {
+		_ = k8s.RunKubectlE(t, opts, "delete", "cluster", "snapshot-restored", "--ignore-not-found=true")
+	}()
+	require.NoError(t, helpers.WaitForClusterHealthy(t, opts, "snapshot-restored", 15*time.Minute))
+
+	t.Run("Restored cluster uses the CSI storage class", func(t *testing.T) {
+		helpers.AssertPVCStorageClass(t, opts, "snapshot-restored", storageConfig.CSIClass)
+	})
+
+	t.Run("Restored cluster has the snapshotted data", func(t *testing.T) {
+		conn, closeConn, err := helpers.OpenServiceConnection(t, opts, "snapshot-restored-rw", "snapshot-restored-app")
+		require.NoError(t, err)
+		defer closeConn()
+
+		var count int
+		require.NoError(t, conn.QueryRowContext(ctx, `SELECT count(*) FROM snapshot_check`).Scan(&count))
+		require.Equal(t, rows, count)
+	})
+}